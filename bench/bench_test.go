@@ -0,0 +1,143 @@
+package bench
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+func newWUID(opts ...internal.Option) *internal.WUID {
+	w := internal.NewWUID("alpha", slog.NewDumbLogger(), opts...)
+	var h32 int64
+	err := w.Load(context.Background(), internal.RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.AddInt64(&h32, 1), nil
+	}))
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+func TestNext_ZeroAlloc(t *testing.T) {
+	for name, w := range map[string]*internal.WUID{
+		"plain":       newWUID(),
+		"step":        newWUID(internal.WithStep(1000, 0)),
+		"floor":       newWUID(internal.WithStep(16, 10)),
+		"obfuscation": newWUID(internal.WithObfuscation(1), internal.WithStep(16, 10)),
+		"shards":      newWUID(internal.WithShards(8)),
+	} {
+		if n := testing.AllocsPerRun(1000, func() { w.Next() }); n != 0 {
+			t.Fatalf("Next allocates. name: %s, allocs: %v", name, n)
+		}
+		dst := make([]int64, 64)
+		if n := testing.AllocsPerRun(1000, func() { w.NextN(dst) }); n != 0 {
+			t.Fatalf("NextN allocates. name: %s, allocs: %v", name, n)
+		}
+	}
+}
+
+func TestNextString_Alloc(t *testing.T) {
+	w := newWUID()
+	if n := testing.AllocsPerRun(1000, func() { _ = w.NextString() }); n > 1 {
+		t.Fatalf("NextString allocates more than once. allocs: %v", n)
+	}
+}
+
+func TestAppendNext_ZeroAlloc(t *testing.T) {
+	w := newWUID()
+	buf := make([]byte, 0, 32)
+	if n := testing.AllocsPerRun(1000, func() { buf = w.AppendNext(buf[:0]) }); n != 0 {
+		t.Fatalf("AppendNext allocates. allocs: %v", n)
+	}
+}
+
+func TestPool_ZeroAlloc(t *testing.T) {
+	p := newWUID().Reserve(2000)
+	if n := testing.AllocsPerRun(1000, func() { p.Get() }); n != 0 {
+		t.Fatalf("Pool.Get allocates. allocs: %v", n)
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	w := newWUID()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Next()
+	}
+}
+
+func BenchmarkNext_Obfuscation(b *testing.B) {
+	w := newWUID(internal.WithObfuscation(1), internal.WithStep(16, 10))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Next()
+	}
+}
+
+func BenchmarkNext_Parallel(b *testing.B) {
+	w := newWUID()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w.Next()
+		}
+	})
+}
+
+func BenchmarkNext_Shards_Parallel(b *testing.B) {
+	w := newWUID(internal.WithShards(16))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w.Next()
+		}
+	})
+}
+
+func BenchmarkNextString(b *testing.B) {
+	w := newWUID()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = w.NextString()
+	}
+}
+
+// BenchmarkNextN reports the time per identifier rather than per call.
+func BenchmarkNextN(b *testing.B) {
+	w := newWUID()
+	dst := make([]int64, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(dst) {
+		w.NextN(dst)
+	}
+}
+
+// BenchmarkRenew_Contention renews the high bits every 4096 identifiers while all the
+// goroutines keep calling Next.
+func BenchmarkRenew_Contention(b *testing.B) {
+	w := newWUID()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			i++
+			if i&4095 == 0 {
+				if err := w.RenewNow(); err != nil {
+					b.Fatal(err)
+				}
+				continue
+			}
+			w.Next()
+		}
+	})
+}
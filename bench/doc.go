@@ -0,0 +1,6 @@
+// Package bench holds the reproducible benchmarks of WUID, which need no data source.
+//
+//	go test -run=^$ -bench=. -benchmem github.com/driftboat/wuid/bench
+//
+// The tests of the package make sure that the hot paths stay free of allocations.
+package bench
@@ -0,0 +1,72 @@
+package wuid
+
+import (
+	"sync"
+)
+
+// Buffered is a generator that takes identifiers from a channel kept full by a background
+// goroutine, so that a caller never waits for a renewal of the underlying generator, unless
+// a burst drains the buffer.
+type Buffered struct {
+	ch        chan int64
+	done      chan struct{}
+	closeOnce sync.Once
+	failure   interface{}
+}
+
+// NewBuffered creates a Buffered holding up to size identifiers of w. The identifiers still
+// in the buffer when the program exits are lost, which leaves gaps but never duplicates.
+// Call Close to stop the background goroutine.
+func NewBuffered(w WUID, size int) *Buffered {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	if size <= 0 {
+		panic("size must be positive")
+	}
+	b := &Buffered{
+		ch:   make(chan int64, size),
+		done: make(chan struct{}),
+	}
+	go b.fill(w)
+	return b
+}
+
+func (b *Buffered) fill(w WUID) {
+	defer close(b.ch)
+	defer func() {
+		if r := recover(); r != nil {
+			b.failure = r
+		}
+	}()
+
+	for {
+		v := w.Next()
+		select {
+		case b.ch <- v:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Next returns a unique identifier from the buffer, waiting for one if the buffer is empty.
+// If the underlying generator has panicked, Next panics with the same value after the
+// buffer is drained. It also panics after Close.
+func (b *Buffered) Next() int64 {
+	v, ok := <-b.ch
+	if !ok {
+		if b.failure != nil {
+			panic(b.failure)
+		}
+		panic("wuid: the buffered generator is closed")
+	}
+	return v
+}
+
+// Close stops the background goroutine. It is safe to call Close more than once.
+func (b *Buffered) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
@@ -0,0 +1,47 @@
+package wuid
+
+import (
+	"testing"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestNewBuffered(t *testing.T) {
+	b := NewBuffered(wuidtest.NewDeterministicWUID(42), 16)
+	wuidtest.Run(t, b, wuidtest.Config{Goroutines: 8, PerGoroutine: 1000, Monotonic: true})
+	b.Close()
+	b.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Next should have panicked after Close")
+		}
+	}()
+	for i := 0; i < 32; i++ {
+		b.Next()
+	}
+}
+
+func TestNewBuffered_Panic(t *testing.T) {
+	n := 0
+	b := NewBuffered(nextFunc(func() int64 {
+		n++
+		if n > 3 {
+			panic("exhausted")
+		}
+		return int64(n)
+	}), 8)
+	defer b.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		if v := b.Next(); v != i {
+			t.Fatalf("Next returned %d, while it should be %d", v, i)
+		}
+	}
+	defer func() {
+		if r := recover(); r != "exhausted" {
+			t.Fatalf("Next should have panicked with exhausted, but got %v", r)
+		}
+	}()
+	b.Next()
+}
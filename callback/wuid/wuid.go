@@ -0,0 +1,239 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+}
+
+type H32Callback func() (h32 int64, clean func(), err error)
+
+type H32CallbackCtx func(ctx context.Context) (h32 int64, clean func(), err error)
+
+// Backend describes the callback function to get the high bits from. Exactly one of Callback
+// and CallbackCtx should be set.
+type Backend struct {
+	Callback    H32Callback
+	CallbackCtx H32CallbackCtx
+}
+
+// LoadHighBits invokes a callback function to get a number, and uses it as the high bits of
+// all generated numbers. In addition, the callback function is saved for future renewal. If
+// clean is not nil, it is called after the number is returned, before it is verified.
+//
+// CallbackCtx gets a context that is canceled when the renewal timeout set by
+// WithRenewTimeout expires. LoadHighBits returns when the context is done even if the
+// callback function does not, so that a hanging data source cannot block the renewal
+// forever. The clean function returned by a late callback is still called.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	switch {
+	case b.Callback != nil && b.CallbackCtx != nil:
+		return errors.New("only one of Callback and CallbackCtx can be set")
+	case b.Callback != nil:
+		cb := b.Callback
+		return w.loadh32WithCallbackCtx(ctx, func(ctx context.Context) (int64, func(), error) {
+			return cb()
+		})
+	default:
+		return w.loadh32WithCallbackCtx(ctx, b.CallbackCtx)
+	}
+}
+
+// Loadh32WithCallback is the same as LoadHighBits(Backend{Callback: cb}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32WithCallback(cb H32Callback) error {
+	return w.LoadHighBits(Backend{Callback: cb})
+}
+
+// Loadh32WithCallbackCtx is the same as LoadHighBits(Backend{CallbackCtx: cb}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32WithCallbackCtx(cb H32CallbackCtx) error {
+	return w.LoadHighBits(Backend{CallbackCtx: cb})
+}
+
+// loadh32WithCallbackCtx implements LoadHighBitsContext.
+func (w *WUID) loadh32WithCallbackCtx(ctx context.Context, cb H32CallbackCtx) error {
+	if cb == nil {
+		return errors.New("cb cannot be nil")
+	}
+
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (h32 int64, err error) {
+		span := w.w.StartLoadSpan("callback", "")
+		defer func() {
+			span.End(err)
+		}()
+
+		h32, clean, err := w.invoke(ctx, cb, true)
+		if clean != nil {
+			defer clean()
+		}
+		return h32, err
+	}))
+}
+
+// invoke calls cb and returns without waiting for it once ctx is done. If cleanLate is true,
+// the clean function returned by a late cb is called as soon as cb returns.
+func (w *WUID) invoke(ctx context.Context, cb H32CallbackCtx, cleanLate bool) (int64, func(), error) {
+	type result struct {
+		h32   int64
+		clean func()
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		var r result
+		r.h32, r.clean, r.err = cb(ctx)
+		ch <- r
+	}()
+
+	select {
+	case r := <-ch:
+		return r.h32, r.clean, r.err
+	case <-ctx.Done():
+		if cleanLate {
+			go func() {
+				if r := <-ch; r.clean != nil {
+					r.clean()
+				}
+			}()
+		}
+		return 0, nil, ctx.Err()
+	}
+}
+
+// RetryPolicy tells how LoadH28WithCallbacks retries a failed callback.
+type RetryPolicy struct {
+	// Attempts is the number of times each callback is tried. Zero means once.
+	Attempts int
+	// Backoff is the time to wait before trying the same callback again.
+	Backoff time.Duration
+}
+
+// LoadH28WithCallbacks is like LoadHighBits(Backend{CallbackCtx: primary}), but a load that
+// fails on primary, including an h32 rejected by the verifier, is retried according to retry
+// and then tried on fallback in the same way, e.g. a static pool of h32 for the time the
+// config service is down. fallback can be nil. All the attempts of a load are bound to the
+// timeout set by WithRenewTimeout together. The same applies to every renewal, which starts
+// over with primary.
+//
+// Unlike LoadHighBits, the clean function is called only for the callback whose h32 is used
+// or rejected by the verifier. A callback that fails or times out is expected to release its
+// resources by itself.
+func (w *WUID) LoadH28WithCallbacks(primary, fallback H32CallbackCtx, retry RetryPolicy) error {
+	return w.LoadH28WithCallbacksContext(context.Background(), primary, fallback, retry)
+}
+
+// LoadH28WithCallbacksContext is like LoadH28WithCallbacks but the initial load is bound to
+// ctx as well.
+func (w *WUID) LoadH28WithCallbacksContext(ctx context.Context, primary, fallback H32CallbackCtx, retry RetryPolicy) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	if retry.Attempts < 0 {
+		return errors.New("retry.Attempts cannot be negative")
+	}
+	if retry.Backoff < 0 {
+		return errors.New("retry.Backoff cannot be negative")
+	}
+	return w.loadh28WithCallbacks(ctx, primary, fallback, retry)
+}
+
+// loadh28WithCallbacks implements LoadH28WithCallbacksContext.
+func (w *WUID) loadh28WithCallbacks(ctx context.Context, primary, fallback H32CallbackCtx, retry RetryPolicy) error {
+	if primary == nil {
+		return errors.New("primary cannot be nil")
+	}
+	return w.w.Load(ctx, &callbacksRenewer{w: w, primary: primary, fallback: fallback, retry: retry})
+}
+
+// callbacksRenewer tries primary and then fallback. The core passes its verification to
+// RenewVerified, so that a rejected h32 falls through to the next attempt and is verified only
+// once.
+type callbacksRenewer struct {
+	w                 *WUID
+	primary, fallback H32CallbackCtx
+	retry             RetryPolicy
+}
+
+// Renew is never called by the core, which prefers RenewVerified.
+func (r *callbacksRenewer) Renew(ctx context.Context) (int64, error) {
+	return r.RenewVerified(ctx, func(int64) error {
+		return nil
+	})
+}
+
+func (r *callbacksRenewer) RenewVerified(ctx context.Context, verify func(h32 int64) error) (h32 int64, err error) {
+	w := r.w
+	span := w.w.StartLoadSpan("callback", "")
+	defer func() {
+		span.End(err)
+	}()
+
+	h32, clean, err := w.tryCallback(ctx, "primary", r.primary, r.retry, verify)
+	if err != nil && r.fallback != nil {
+		primaryErr := err
+		h32, clean, err = w.tryCallback(ctx, "fallback", r.fallback, r.retry, verify)
+		if err != nil {
+			err = fmt.Errorf("the fallback callback failed: %w, the primary callback failed: %v", err, primaryErr)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if clean != nil {
+		defer clean()
+	}
+	return h32, nil
+}
+
+// tryCallback calls cb until it returns an h32 accepted by verify, the attempts run out or ctx
+// is done. The clean function of a rejected h32 is called at once.
+func (w *WUID) tryCallback(ctx context.Context, which string, cb H32CallbackCtx, retry RetryPolicy, verify func(h32 int64) error) (h32 int64, clean func(), err error) {
+	for i := 0; i < retry.Attempts || i == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, nil, ctx.Err()
+			case <-time.After(retry.Backoff):
+			}
+		}
+		h32, clean, err = w.invoke(ctx, cb, false)
+		if err == nil {
+			if err = verify(h32); err != nil && clean != nil {
+				clean()
+			}
+		}
+		if err == nil {
+			return h32, clean, nil
+		}
+		w.w.Logger.Warnf("<wuid> the %s callback failed. name: %s, attempt: %d, reason: %v", which, w.w.Name, i+1, err)
+	}
+	return 0, nil, err
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
@@ -0,0 +1,366 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+func TestWUID_Loadh32WithCallback(t *testing.T) {
+	var h32 int64 = 100
+	var numCleaned int
+	callback := func() (int64, func(), error) {
+		h32++
+		return h32, func() { numCleaned++ }, nil
+	}
+	w := NewWUID("alpha", dumb)
+	err := w.Loadh32WithCallback(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	if initial != 101<<32 {
+		t.Fatalf("w.w.N is %d, while it should be %d", initial, int64(101<<32))
+	}
+	for i := 1; i < 100; i++ {
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+	if numCleaned != 100 {
+		t.Fatal(`numCleaned != 100`)
+	}
+}
+
+func TestWUID_Loadh32WithCallback_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32WithCallback(nil) == nil {
+		t.Fatal("cb is not properly checked")
+	}
+	if w.Loadh32WithCallbackCtx(nil) == nil {
+		t.Fatal("cb is not properly checked")
+	}
+
+	callback := func() (int64, func(), error) {
+		return 0, nil, errors.New("beta")
+	}
+	if w.Loadh32WithCallback(callback) == nil {
+		t.Fatal(`w.Loadh32WithCallback(callback) == nil`)
+	}
+	callback2 := func() (int64, func(), error) {
+		return 0, nil, nil
+	}
+	if w.Loadh32WithCallback(callback2) == nil {
+		t.Fatal("h32 is not properly verified")
+	}
+}
+
+func TestWUID_Loadh32WithCallbackCtx(t *testing.T) {
+	w := NewWUID("alpha", dumb, WithRenewTimeout(time.Millisecond*50))
+	var h32 int64
+	var hang int32
+	cleaned := make(chan struct{}, 1)
+	callback := func(ctx context.Context) (int64, func(), error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return 0, nil, errors.New("no deadline")
+		}
+		if atomic.LoadInt32(&hang) == 1 {
+			time.Sleep(time.Millisecond * 200)
+			return 1000, func() { cleaned <- struct{}{} }, nil
+		}
+		return atomic.AddInt64(&h32, 1), nil, nil
+	}
+	if err := w.Loadh32WithCallbackCtx(callback); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&hang, 1)
+	startTime := time.Now()
+	if err := w.RenewNow(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err is %v, while it should be context.DeadlineExceeded", err)
+	}
+	if time.Since(startTime) > time.Millisecond*150 {
+		t.Fatal("RenewNow should not wait for the hanging callback")
+	}
+	select {
+	case <-cleaned:
+	case <-time.After(time.Second):
+		t.Fatal("the clean function of the late callback is not called")
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 1 {
+		t.Fatal("the result of the late callback should be discarded")
+	}
+
+	atomic.StoreInt32(&hang, 0)
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 2 {
+		t.Fatal(`atomic.LoadInt64(&w.w.N)>>32 != 2`)
+	}
+}
+
+func TestWUID_LoadHighBitsContext(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	callback := func(ctx context.Context) (int64, func(), error) {
+		<-ctx.Done()
+		return 0, nil, ctx.Err()
+	}
+	if err := w.LoadHighBitsContext(ctx, Backend{CallbackCtx: callback}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err is %v, while it should be context.Canceled", err)
+	}
+	if w.w.Renewer() != nil {
+		t.Fatal("the callback should not be saved when the initial load fails")
+	}
+
+	callback = func(ctx context.Context) (int64, func(), error) {
+		return 10, nil, nil
+	}
+	if err := w.LoadHighBitsContext(context.Background(), Backend{CallbackCtx: callback}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 10 {
+		t.Fatal(`atomic.LoadInt64(&w.w.N)>>32 != 10`)
+	}
+}
+
+func TestWUID_LoadH28WithCallbacks(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	var numPrimary, numFallback int32
+	var primaryDown int32
+	var cleaned []string
+	primary := func(ctx context.Context) (int64, func(), error) {
+		n := atomic.AddInt32(&numPrimary, 1)
+		if atomic.LoadInt32(&primaryDown) == 1 {
+			return 0, func() { cleaned = append(cleaned, "primary") }, errors.New("config service down")
+		}
+		return int64(n), func() { cleaned = append(cleaned, "primary") }, nil
+	}
+	fallback := func(ctx context.Context) (int64, func(), error) {
+		n := atomic.AddInt32(&numFallback, 1)
+		return 1000 + int64(n), func() { cleaned = append(cleaned, "fallback") }, nil
+	}
+	retry := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	if err := w.LoadH28WithCallbacks(primary, fallback, retry); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 1 || numFallback != 0 {
+		t.Fatal("the primary callback should have been used")
+	}
+
+	atomic.StoreInt32(&primaryDown, 1)
+	cleaned = nil
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 1001 {
+		t.Fatalf("the fallback callback should have been used. h32: %d", atomic.LoadInt64(&w.w.N)>>32)
+	}
+	if numPrimary != 4 {
+		t.Fatalf("the primary callback should have been tried 3 times. numPrimary: %d", numPrimary)
+	}
+	if strings.Join(cleaned, ",") != "fallback" {
+		t.Fatalf("only the clean function of the fallback callback should be called: %v", cleaned)
+	}
+
+	atomic.StoreInt32(&primaryDown, 0)
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != 5 {
+		t.Fatal("a renewal should start over with the primary callback")
+	}
+}
+
+func TestWUID_LoadH28WithCallbacks_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.LoadH28WithCallbacks(nil, nil, RetryPolicy{}) == nil {
+		t.Fatal("primary is not properly checked")
+	}
+	ok := func(ctx context.Context) (int64, func(), error) {
+		return 1, nil, nil
+	}
+	if w.LoadH28WithCallbacks(ok, nil, RetryPolicy{Attempts: -1}) == nil {
+		t.Fatal("retry.Attempts is not properly checked")
+	}
+
+	errPrimary, errFallback := errors.New("primary"), errors.New("fallback")
+	primary := func(ctx context.Context) (int64, func(), error) {
+		return 0, nil, errPrimary
+	}
+	var numFallback int
+	fallback := func(ctx context.Context) (int64, func(), error) {
+		numFallback++
+		return 0, nil, errFallback
+	}
+	err := w.LoadH28WithCallbacks(primary, fallback, RetryPolicy{Attempts: 2})
+	if !errors.Is(err, errFallback) || !strings.Contains(err.Error(), "primary") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if numFallback != 2 {
+		t.Fatalf("the fallback callback should have been tried twice. numFallback: %d", numFallback)
+	}
+
+	invalid := func(ctx context.Context) (int64, func(), error) {
+		return 0, nil, nil
+	}
+	if err := w.LoadH28WithCallbacks(invalid, nil, RetryPolicy{}); err == nil {
+		t.Fatal("h32 is not properly verified")
+	}
+}
+
+type countingRegistry struct {
+	claims map[int64]int
+}
+
+func (r *countingRegistry) Claim(ctx context.Context, section int8, h32 int64, owner string) (string, error) {
+	r.claims[h32]++
+	return owner, nil
+}
+
+func TestWUID_LoadH28WithCallbacks_Rejected(t *testing.T) {
+	reg := &countingRegistry{claims: make(map[int64]int)}
+	w := NewWUID("alpha", dumb, WithRegistry(reg), Withh32Verifier(func(h32 int64) error {
+		if h32 < 3 {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+	var n int64
+	var cleaned []int64
+	primary := func(ctx context.Context) (int64, func(), error) {
+		n++
+		h32 := n
+		return h32, func() { cleaned = append(cleaned, h32) }, nil
+	}
+	if err := w.LoadH28WithCallbacks(primary, nil, RetryPolicy{Attempts: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if h := atomic.LoadInt64(&w.w.N) >> 32; h != 3 {
+		t.Fatalf("the rejected h32 should have been skipped. h32: %d", h)
+	}
+	if fmt.Sprint(cleaned) != "[1 2 3]" {
+		t.Fatalf("the clean functions of the rejected h32 should be called as well: %v", cleaned)
+	}
+	if reg.claims[3] != 1 {
+		t.Fatalf("h32 should be claimed once. claims: %d", reg.claims[3])
+	}
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestWUID_Next_Renew(t *testing.T) {
+	var h32 int64
+	callback := func() (int64, func(), error) {
+		return atomic.AddInt64(&h32, 1), nil, nil
+	}
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	err := w.Loadh32WithCallback(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h32a := atomic.LoadInt64(&w.w.N) >> 32
+	atomic.StoreInt64(&w.w.N, (h32a<<32)|internal.Bye)
+	n1a := w.Next()
+	if n1a>>32 != h32a {
+		t.Fatal(`n1a>>32 != h32a`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != (h32a+1)<<32+1 {
+		t.Fatal(`n1b != (h32a+1)<<32+1`)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 1 {
+		t.Fatal(`num != 1`)
+	}
+}
+
+func TestNewSectioned(t *testing.T) {
+	const euWest SectionID = 2
+	b := Backend{Callback: func() (int64, func(), error) {
+		return 42, nil, nil
+	}}
+	w, err := NewSectioned("alpha", euWest, b, dumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := w.Next()
+	if SectionOf(id) != euWest || id>>32&0x00FFFFFF != 42 {
+		t.Fatalf("the section of %#016x should be %d", id, euWest)
+	}
+	if _, err := NewSectioned("alpha", MaxSectionID+1, b, dumb); err == nil {
+		t.Fatal("NewSectioned should have rejected an invalid section")
+	}
+	w, err = NewSectioned("alpha", NoSection, b, dumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SectionOf(w.Next()) != NoSection {
+		t.Fatal("NoSection should brand nothing")
+	}
+}
+
+func Example() {
+	callback := func(ctx context.Context) (int64, func(), error) {
+		var h32 int64
+		// ...
+		return h32, nil, nil
+	}
+
+	// Setup
+	w := NewWUID("alpha", nil, WithRenewTimeout(time.Second*3))
+	err := w.LoadHighBits(Backend{CallbackCtx: callback})
+	if err != nil {
+		panic(err)
+	}
+
+	// Generate
+	for i := 0; i < 10; i++ {
+		fmt.Printf("%#016x\n", w.Next())
+	}
+}
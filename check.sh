@@ -36,3 +36,5 @@ find . -name coverage.sh | xargs -n 1 bash -c \
     'cmp --silent internal/coverage.sh "$0" || echo "files are different. file: $0"'
 find . -name vet.sh | xargs -n 1 bash -c \
     'cmp --silent internal/vet.sh "$0" || echo "files are different. file: $0"'
+find . -name go.mod -not -path ./go.mod | xargs -n 1 bash -c \
+    'cd "$(dirname "$0")" && go vet ./... || echo "go vet failed. module: $(dirname "$0")"'
@@ -0,0 +1,231 @@
+// Command wuidgen generates the forwarding layer shared by the adapters of WUID: the aliases of
+// the types of the core package, the options and the methods forwarding to the core WUID. An
+// adapter only writes by hand its WUID, Backend, LoadHighBits, LoadHighBitsContext and Stop,
+// next to the directive:
+//
+//	//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+//
+// which writes wuid_gen.go and trace_gen.go. With -internal, wuidgen writes the alias table of
+// the internal package to wuid_gen.go instead, from the exported declarations of the core
+// package found in the directory -core.
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const header = "// Code generated by wuidgen. DO NOT EDIT.\n\n"
+
+//go:embed forward.go.tmpl
+var forwardBody string
+
+//go:embed trace.go.tmpl
+var traceBody string
+
+func main() {
+	internal := flag.Bool("internal", false, "generate the alias table of the internal package")
+	coreDir := flag.String("core", "../core", "the directory of the core package, with -internal")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("wuidgen: ")
+
+	pkg := os.Getenv("GOPACKAGE")
+	if *internal {
+		if pkg == "" {
+			pkg = "internal"
+		}
+		src, err := aliasTable(pkg, *coreDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write("wuid_gen.go", src)
+		return
+	}
+
+	if pkg == "" {
+		pkg = "wuid"
+	}
+	write("wuid_gen.go", []byte(header+"package "+pkg+`
+
+import (
+	"context"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+`+forwardBody))
+	write("trace_gen.go", []byte(header+"//go:build !wuid_nodeps\n\npackage "+pkg+`
+
+import (
+	"github.com/driftboat/wuid/wuidotel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+`+traceBody))
+}
+
+// write formats src and saves it to name.
+func write(name string, src []byte) {
+	out, err := format.Source(src)
+	if err != nil {
+		log.Fatalf("failed to format %s: %s", name, err)
+	}
+	if err := os.WriteFile(name, out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// exported is the exported declarations of a file, in the order of the source.
+type exported struct {
+	consts, types, funcs []string
+}
+
+// aliasTable returns the source of a package aliasing the exported constants, types and
+// functions of the core package in dir. A name declared only by the files of one side of a
+// build tag, e.g. !wuid_nodeps, is left out unless the other side declares it too, so that the
+// table compiles either way.
+func aliasTable(pkg, dir string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	// wuid.go first, for the basic declarations to lead the table.
+	sort.Slice(paths, func(i, j int) bool {
+		bi, bj := filepath.Base(paths[i]), filepath.Base(paths[j])
+		if (bi == "wuid.go") != (bj == "wuid.go") {
+			return bi == "wuid.go"
+		}
+		return bi < bj
+	})
+
+	var all exported
+	untagged := make(map[string]bool)
+	tagged := make(map[string]map[string]bool) // build constraint -> names
+	seen := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		var e exported
+		collect(f, &e)
+		names := untagged
+		if c := buildConstraint(f); c != "" {
+			if tagged[c] == nil {
+				tagged[c] = make(map[string]bool)
+			}
+			names = tagged[c]
+		}
+		for _, group := range [][]string{e.consts, e.types, e.funcs} {
+			for _, name := range group {
+				names[name] = true
+			}
+		}
+		add := func(dst *[]string, names []string) {
+			for _, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					*dst = append(*dst, name)
+				}
+			}
+		}
+		add(&all.consts, e.consts)
+		add(&all.types, e.types)
+		add(&all.funcs, e.funcs)
+	}
+
+	portable := func(name string) bool {
+		if untagged[name] {
+			return true
+		}
+		for _, names := range tagged {
+			if !names[name] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%spackage %s\n\nimport (\n\t\"github.com/driftboat/wuid/core\"\n)\n", header, pkg)
+	for _, group := range []struct {
+		keyword string
+		names   []string
+	}{
+		{"const", all.consts},
+		{"type", all.types},
+		{"var", all.funcs},
+	} {
+		fmt.Fprintf(&b, "\n%s (\n", group.keyword)
+		for _, name := range group.names {
+			if portable(name) {
+				fmt.Fprintf(&b, "\t%s = core.%s\n", name, name)
+			}
+		}
+		b.WriteString(")\n")
+	}
+	return b.Bytes(), nil
+}
+
+// collect adds the exported constants, types and functions of f to e. Methods and variables
+// are left out: a variable copied by an alias table would not follow the original.
+func collect(f *ast.File, e *exported) {
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			for _, s := range d.Specs {
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						e.types = append(e.types, s.Name.Name)
+					}
+				case *ast.ValueSpec:
+					if d.Tok != token.CONST {
+						continue
+					}
+					for _, n := range s.Names {
+						if n.IsExported() {
+							e.consts = append(e.consts, n.Name)
+						}
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.IsExported() {
+				e.funcs = append(e.funcs, d.Name.Name)
+			}
+		}
+	}
+}
+
+// buildConstraint returns the //go:build expression of f, or "" if it has none.
+func buildConstraint(f *ast.File) string {
+	for _, g := range f.Comments {
+		if g.Pos() > f.Package {
+			break
+		}
+		for _, c := range g.List {
+			if strings.HasPrefix(c.Text, "//go:build ") {
+				return strings.TrimSpace(strings.TrimPrefix(c.Text, "//go:build "))
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+// Package snowflake helps with the migration from Snowflake IDs to WUID. It parses the
+// existing Snowflake IDs, keeps a WUID generator away from the range of the Snowflake IDs
+// issued in the past, and emits Snowflake-layout IDs backed by a WUID generator during the
+// transition, so that the worker IDs no longer have to be assigned by hand.
+//
+//	w := redisWUID.NewWUID("orders", nil, snowflake.Twitter.Avoid(firstIssued, time.Now()))
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+)
+
+// Layout describes the bits of a Snowflake ID: a timestamp in milliseconds since Epoch,
+// followed by a worker ID and a sequence number. The three widths must add up to 63.
+type Layout struct {
+	Epoch        time.Time
+	TimeBits     uint
+	WorkerBits   uint
+	SequenceBits uint
+}
+
+// Twitter is the original layout of Twitter.
+var Twitter = Layout{
+	Epoch:        time.Unix(1288834974, 657*int64(time.Millisecond)),
+	TimeBits:     41,
+	WorkerBits:   10,
+	SequenceBits: 12,
+}
+
+// ID is a decoded Snowflake ID.
+type ID struct {
+	Time     time.Time
+	Worker   int64
+	Sequence int64
+}
+
+func (l Layout) check() error {
+	if l.TimeBits+l.WorkerBits+l.SequenceBits != 63 {
+		return errors.New("the widths of a Snowflake layout must add up to 63")
+	}
+	if l.Epoch.IsZero() {
+		return errors.New("the epoch of a Snowflake layout cannot be zero")
+	}
+	return nil
+}
+
+// Parse decodes id.
+func (l Layout) Parse(id int64) (ID, error) {
+	if err := l.check(); err != nil {
+		return ID{}, err
+	}
+	if id < 0 {
+		return ID{}, fmt.Errorf("%d is not a valid Snowflake ID", id)
+	}
+	ms := id >> (l.WorkerBits + l.SequenceBits)
+	return ID{
+		Time:     l.Epoch.Add(time.Duration(ms) * time.Millisecond),
+		Worker:   id >> l.SequenceBits & (1<<l.WorkerBits - 1),
+		Sequence: id & (1<<l.SequenceBits - 1),
+	}, nil
+}
+
+// Range returns the smallest and the greatest Snowflake IDs that could be issued between from
+// and to.
+func (l Layout) Range(from, to time.Time) (min, max int64) {
+	if err := l.check(); err != nil {
+		panic(err)
+	}
+	shift := l.WorkerBits + l.SequenceBits
+	return l.millis(from) << shift, l.millis(to)<<shift | (1<<shift - 1)
+}
+
+func (l Layout) millis(t time.Time) int64 {
+	ms := int64(t.Sub(l.Epoch) / time.Millisecond)
+	if ms < 0 || ms >= 1<<l.TimeBits {
+		panic(fmt.Errorf("%v is out of the range of the layout", t))
+	}
+	return ms
+}
+
+// Avoid returns an option that rejects every h32 whose identifiers could collide with the
+// Snowflake IDs issued between from and to, so that a loader fails rather than generating a
+// duplicate. It takes WithSection into account, but not WithTransform or WithChecksum. It
+// replaces the verifier set by Withh32Verifier.
+func (l Layout) Avoid(from, to time.Time) core.Option {
+	min, max := l.Range(from, to)
+	return func(w *core.WUID) {
+		core.Withh32Verifier(func(h32 int64) error {
+			lo := w.Section | h32<<32
+			hi := lo | core.L32Mask
+			if lo <= max && min <= hi {
+				return fmt.Errorf("the identifiers of h32 %d overlap the Snowflake IDs in between [%d, %d]", h32, min, max)
+			}
+			return nil
+		})(w)
+	}
+}
+
+// WUID is the generator behind a Generator. Any adapter's WUID satisfies it.
+type WUID interface {
+	Next() int64
+}
+
+// Generator emits Snowflake-layout IDs during a transition period. The worker ID is taken
+// from the lowest bits of the h32 in use, so that it is assigned by the data source of WUID
+// and changes with every renewal. Every ID consumes a number of the WUID generator, which
+// drives its renewal. Two instances get the same worker ID only if 1<<WorkerBits h32 are
+// loaded while one of them keeps its h32, so combine it with WithMaxH32Age. WithTransform and
+// WithChecksum must not be used.
+type Generator struct {
+	w WUID
+	l Layout
+
+	mu     sync.Mutex
+	last   int64
+	worker int64
+	seq    int64
+	now    func() time.Time
+}
+
+// NewGenerator returns a Generator backed by w.
+func (l Layout) NewGenerator(w WUID) *Generator {
+	if err := l.check(); err != nil {
+		panic(err)
+	}
+	return &Generator{w: w, l: l, last: -1, now: time.Now}
+}
+
+// Next returns a unique Snowflake ID. If the clock goes backwards, it keeps using the last
+// timestamp until the clock catches up.
+func (g *Generator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// The worker ID is taken under the lock, or the calls around a renewal could interleave
+	// the old and the new worker IDs within a millisecond.
+	worker := g.w.Next() >> 32 & (1<<g.l.WorkerBits - 1)
+	ms := g.l.millis(g.now())
+	if ms < g.last {
+		ms = g.last
+	}
+	if ms == g.last && worker == g.worker {
+		g.seq = (g.seq + 1) & (1<<g.l.SequenceBits - 1)
+		if g.seq == 0 {
+			for ms <= g.last {
+				time.Sleep(100 * time.Microsecond)
+				ms = g.l.millis(g.now())
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.last, g.worker = ms, worker
+	return ms<<(g.l.WorkerBits+g.l.SequenceBits) | worker<<g.l.SequenceBits | g.seq
+}
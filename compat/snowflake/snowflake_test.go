@@ -0,0 +1,90 @@
+package snowflake
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+	"github.com/driftboat/wuid/wuiderr"
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestLayout_Parse(t *testing.T) {
+	id, err := Twitter.Parse(1212092628029698048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Time.Equal(time.Date(2019, 12, 31, 19, 26, 16, 771*int(time.Millisecond), time.UTC)) {
+		t.Fatalf("id.Time is %v", id.Time.UTC())
+	}
+	if id.Worker != 327 || id.Sequence != 0 {
+		t.Fatalf("id.Worker: %d, id.Sequence: %d", id.Worker, id.Sequence)
+	}
+	if id, _ := Twitter.Parse(5<<22 | 362<<12 | 7); id.Worker != 362 || id.Sequence != 7 {
+		t.Fatalf("id.Worker: %d, id.Sequence: %d", id.Worker, id.Sequence)
+	}
+
+	if _, err := Twitter.Parse(-1); err == nil {
+		t.Fatal("Parse should have failed with a negative ID")
+	}
+	if _, err := (Layout{Epoch: Twitter.Epoch, TimeBits: 41}).Parse(1); err == nil {
+		t.Fatal("Parse should have failed with an invalid layout")
+	}
+}
+
+func TestLayout_Avoid(t *testing.T) {
+	from := Twitter.Epoch
+	to := from.Add(10 * 24 * time.Hour)
+	min, max := Twitter.Range(from, to)
+	if min != 0 || max != (864000000<<22|1<<22-1) {
+		t.Fatalf("min: %d, max: %d", min, max)
+	}
+
+	w := core.NewWUID("alpha", nil, Twitter.Avoid(from, to))
+	for _, h32 := range []int64{1, max >> 32} {
+		if err := w.Verifyh32(h32); !errors.Is(err, wuiderr.ErrInvalidH32) {
+			t.Fatalf("h32 %d should have been rejected, err: %v", h32, err)
+		}
+	}
+	if err := w.Verifyh32(max>>32 + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	w2 := core.NewWUID("alpha", nil, Twitter.Avoid(from, to), core.WithSection(1))
+	if err := w2.Verifyh32(1); err != nil {
+		t.Fatalf("the identifiers of section 1 are far above the Snowflake IDs: %v", err)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	w := wuidtest.NewDeterministicWUID(0x401)
+	g := Twitter.NewGenerator(w)
+	now := Twitter.Epoch.Add(time.Hour)
+	g.now = func() time.Time { return now }
+
+	seen := make(map[int64]struct{})
+	for i := 0; i < 1<<12+10; i++ {
+		if i == 1<<12 {
+			now = now.Add(time.Millisecond)
+		}
+		v := g.Next()
+		if _, ok := seen[v]; ok {
+			t.Fatalf("%d is a duplicate", v)
+		}
+		seen[v] = struct{}{}
+		id, err := Twitter.Parse(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.Worker != 1 {
+			t.Fatalf("id.Worker is %d, while it should be 1", id.Worker)
+		}
+	}
+
+	now = now.Add(-time.Second)
+	v := g.Next()
+	if id, _ := Twitter.Parse(v); id.Time.Before(Twitter.Epoch.Add(time.Hour + time.Millisecond)) {
+		t.Fatalf("the timestamp should not go backwards with the clock: %v", id.Time)
+	}
+}
@@ -0,0 +1,51 @@
+// Command wuid works with the configuration files read by the config package. By now, the only
+// subcommand is doctor, which checks a configuration against its backend before a service takes
+// traffic, and prints the effective bit layout:
+//
+//	wuid doctor [-timeout 10s] wuid.yaml
+//
+// doctor exits with 1 if a problem is found, and with 2 if the backend cannot be used at all.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/driftboat/wuid/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "doctor" {
+		fmt.Fprintln(os.Stderr, "usage: wuid doctor [-timeout 10s] <config file>")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "the timeout of the whole check")
+	_ = fs.Parse(os.Args[2:])
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: wuid doctor [-timeout 10s] <config file>")
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	r, err := config.Doctor(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	_ = r.Print(os.Stdout)
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,401 @@
+// Package config builds a WUID instance from a configuration file, so that the wiring of each
+// environment lives in YAML or JSON rather than in code.
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/driftboat/wuid/credentials"
+	etcdwuid "github.com/driftboat/wuid/etcd/wuid"
+	"github.com/driftboat/wuid/iamauth"
+	"github.com/driftboat/wuid/internal"
+	memcachewuid "github.com/driftboat/wuid/memcache/wuid"
+	rediswuid "github.com/driftboat/wuid/redis/v8/wuid"
+	sqlitewuid "github.com/driftboat/wuid/sqlite/wuid"
+	"github.com/go-redis/redis/v8"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a WUID instance and its backend.
+type Config struct {
+	Name string `json:"name" yaml:"name"`
+	// Backend is one of redis, memcache, etcd and sqlite.
+	Backend string `json:"backend" yaml:"backend"`
+	// Key is the key of the counter, or the table name for sqlite.
+	Key string `json:"key" yaml:"key"`
+
+	// Addrs are the server addresses for redis, memcache and etcd.
+	Addrs    []string `json:"addrs" yaml:"addrs"`
+	Username string   `json:"username" yaml:"username"`
+	Password string   `json:"password" yaml:"password"`
+	DB       int      `json:"db" yaml:"db"`
+	// PasswordFile is read instead of Password for every connection to redis, so that a
+	// rotated password, e.g. one mounted from a secret, is picked up by the next renewal.
+	PasswordFile string `json:"password_file" yaml:"password_file"`
+	// TLS enables TLS for redis.
+	TLS *TLS `json:"tls" yaml:"tls"`
+	// ReadTimeout and WriteTimeout are the socket timeouts of redis, e.g. 3s. The defaults of
+	// the client are used if they are empty.
+	ReadTimeout  string `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout string `json:"write_timeout" yaml:"write_timeout"`
+	// IAM authenticates to an ElastiCache redis as Username with IAM tokens instead of a
+	// password.
+	IAM *IAM `json:"iam" yaml:"iam"`
+	// Driver and DSN are passed to sql.Open for sqlite. The driver must be registered by the
+	// caller. Driver defaults to sqlite3.
+	Driver string `json:"driver" yaml:"driver"`
+	DSN    string `json:"dsn" yaml:"dsn"`
+	// H32Floor is the floor of the counter for memcache.
+	H32Floor int64 `json:"h32_floor" yaml:"h32_floor"`
+
+	Step                int64   `json:"step" yaml:"step"`
+	Floor               int64   `json:"floor" yaml:"floor"`
+	Section             *int8   `json:"section" yaml:"section"`
+	ObfuscationSeed     int     `json:"obfuscation_seed" yaml:"obfuscation_seed"`
+	ExhaustionThreshold float64 `json:"exhaustion_threshold" yaml:"exhaustion_threshold"`
+	QuietRenewals       bool    `json:"quiet_renewals" yaml:"quiet_renewals"`
+	LogSampling         int     `json:"log_sampling" yaml:"log_sampling"`
+
+	Logger internal.Logger `json:"-" yaml:"-"`
+	// TLSConfig is the base of the TLS configuration of redis, for the settings that TLS
+	// cannot express. It enables TLS on its own.
+	TLSConfig *tls.Config `json:"-" yaml:"-"`
+	// AWSCredentials returns the AWS credentials signing the IAM tokens, e.g. with the AWS SDK.
+	// The environment variables of the AWS credentials are read if it is nil.
+	AWSCredentials iamauth.CredentialsFunc `json:"-" yaml:"-"`
+	// Credentials provides the username and the password of redis and etcd instead of
+	// Username, Password and PasswordFile, e.g. from AWS Secrets Manager or Vault. They are
+	// fetched for every connection.
+	Credentials credentials.Provider `json:"-" yaml:"-"`
+}
+
+// IAM describes the IAM authentication to ElastiCache. A token is minted for every new
+// connection, and replaced before its expiry.
+type IAM struct {
+	Region string `json:"region" yaml:"region"`
+	// CacheName is the name of the replication group or the serverless cache.
+	CacheName string `json:"cache_name" yaml:"cache_name"`
+}
+
+// TLS describes the TLS configuration of redis. The files are read again for every connection,
+// so that rotated certificates are picked up by the next renewal.
+type TLS struct {
+	// CAFile is the PEM file of the certificate authorities to verify the server with. The
+	// system pool is used if it is empty.
+	CAFile string `json:"ca_file" yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM files of the client certificate for mutual TLS.
+	CertFile   string `json:"cert_file" yaml:"cert_file"`
+	KeyFile    string `json:"key_file" yaml:"key_file"`
+	ServerName string `json:"server_name" yaml:"server_name"`
+	// InsecureSkipVerify skips verifying the certificate of the server. It is for testing only.
+	InsecureSkipVerify bool `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// WUID is implemented by the WUID types of all the adapters.
+type WUID interface {
+	Next() int64
+	RenewNow() error
+	Stats() internal.StatsSnapshot
+}
+
+// LoadConfig reads a configuration file. The format is decided by the file extension, which
+// must be .yaml, .yml or .json. References to environment variables like ${REDIS_PASSWORD}
+// are expanded before parsing.
+func LoadConfig(path string) (cfg Config, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	data = []byte(os.ExpandEnv(string(data)))
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	default:
+		return cfg, fmt.Errorf("unsupported config file: %s", path)
+	}
+	return cfg, err
+}
+
+// NewFromConfig creates a WUID instance as described by cfg and loads the high 28 bits from
+// the backend.
+func NewFromConfig(cfg Config) (WUID, error) {
+	return NewFromConfigContext(context.Background(), cfg)
+}
+
+// NewFromConfigContext is like NewFromConfig but the initial load is bound to ctx as well.
+func NewFromConfigContext(ctx context.Context, cfg Config) (WUID, error) {
+	if len(cfg.Name) == 0 {
+		return nil, errors.New("name cannot be empty")
+	}
+	opts, err := options(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Backend {
+	case "redis":
+		newClient, err := redisClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		w := rediswuid.NewWUID(cfg.Name, cfg.Logger, opts...)
+		return loaded(w, w.LoadHighBitsContext(ctx, rediswuid.Backend{NewClient: newClient, Key: cfg.Key}))
+	case "memcache":
+		newClient, err := memcacheClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		w := memcachewuid.NewWUID(cfg.Name, cfg.Logger, opts...)
+		return loaded(w, w.LoadHighBitsContext(ctx, memcachewuid.Backend{NewClient: newClient, Key: cfg.Key, Floor: cfg.H32Floor}))
+	case "etcd":
+		newClient, err := etcdClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		w := etcdwuid.NewWUID(cfg.Name, cfg.Logger, opts...)
+		return loaded(w, w.LoadHighBitsContext(ctx, etcdwuid.Backend{NewClient: newClient, Key: cfg.Key}))
+	case "sqlite":
+		openDB, err := sqliteDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		w := sqlitewuid.NewWUID(cfg.Name, cfg.Logger, opts...)
+		return loaded(w, w.LoadHighBitsContext(ctx, sqlitewuid.Backend{OpenDB: openDB, Table: cfg.Key}))
+	default:
+		return nil, fmt.Errorf("unsupported backend: %q", cfg.Backend)
+	}
+}
+
+func redisClient(cfg Config) (rediswuid.NewClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("addrs cannot be empty")
+	}
+	// A misconfiguration is reported right away rather than by the first load.
+	if _, err := redisOptions(cfg); err != nil {
+		return nil, err
+	}
+	p, err := redisCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Every call builds a new client, which is closed after use, so the credentials and the
+	// certificates are read again and a rotation never breaks a connection kept open.
+	return func() (redis.UniversalClient, bool, error) {
+		opts, err := redisOptions(cfg)
+		if err != nil {
+			return nil, false, err
+		}
+		if p != nil {
+			// The hook selects the database after AUTH, which go-redis would do before.
+			opts.OnConnect = rediswuid.CredentialsOnConnect(p, opts.DB)
+			opts.DB = 0
+		}
+		return redis.NewUniversalClient(opts), true, nil
+	}, nil
+}
+
+// redisCredentials returns the provider of the credentials authenticating every new connection
+// to redis, or nil if Username and Password are used. The IAM tokens are shared by the
+// clients, so that a token is reused until shortly before its expiry.
+func redisCredentials(cfg Config) (credentials.Provider, error) {
+	if cfg.IAM == nil && cfg.Credentials == nil {
+		return nil, nil
+	}
+	switch {
+	case cfg.IAM != nil && cfg.Credentials != nil:
+		return nil, errors.New("iam and Credentials cannot be used together")
+	case cfg.Password != "" || cfg.PasswordFile != "":
+		return nil, errors.New("password and password_file cannot be used with iam or Credentials")
+	case cfg.Credentials != nil:
+		return cfg.Credentials, nil
+	case cfg.IAM.Region == "" || cfg.IAM.CacheName == "":
+		return nil, errors.New("iam: region and cache_name cannot be empty")
+	case cfg.Username == "":
+		return nil, errors.New("iam: username cannot be empty")
+	}
+	creds := cfg.AWSCredentials
+	if creds == nil {
+		creds = iamauth.EnvCredentials
+	}
+	return credentials.IAMToken(cfg.Username, iamauth.ElastiCache(creds, cfg.IAM.Region, cfg.IAM.CacheName, cfg.Username)), nil
+}
+
+func redisOptions(cfg Config) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:    cfg.Addrs,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	}
+	if cfg.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("password_file: %w", err)
+		}
+		opts.Password = strings.TrimSpace(string(data))
+	}
+	var err error
+	if opts.ReadTimeout, err = duration(cfg.ReadTimeout); err != nil {
+		return nil, fmt.Errorf("read_timeout: %w", err)
+	}
+	if opts.WriteTimeout, err = duration(cfg.WriteTimeout); err != nil {
+		return nil, fmt.Errorf("write_timeout: %w", err)
+	}
+	if opts.TLSConfig, err = tlsConfig(cfg); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return opts, nil
+}
+
+func duration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = errors.New("the timeout must be positive")
+	}
+	return d, err
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLS == nil && cfg.TLSConfig == nil {
+		return nil, nil
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSConfig != nil {
+		c = cfg.TLSConfig.Clone()
+	}
+	if cfg.TLS == nil {
+		return c, nil
+	}
+
+	if cfg.TLS.ServerName != "" {
+		c.ServerName = cfg.TLS.ServerName
+	}
+	if cfg.TLS.InsecureSkipVerify {
+		c.InsecureSkipVerify = true
+	}
+	if cfg.TLS.CAFile != "" {
+		data, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate is found in %s", cfg.TLS.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = append(c.Certificates, cert)
+	}
+	return c, nil
+}
+
+func memcacheClient(cfg Config) (memcachewuid.NewClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("addrs cannot be empty")
+	}
+	return func() (*memcache.Client, bool, error) {
+		return memcache.New(cfg.Addrs...), true, nil
+	}, nil
+}
+
+func etcdClient(cfg Config) (etcdwuid.NewClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("addrs cannot be empty")
+	}
+	etcdCfg := clientv3.Config{
+		Endpoints:   cfg.Addrs,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DialTimeout: time.Second * 5,
+	}
+	if cfg.Credentials != nil {
+		if cfg.Password != "" {
+			return nil, errors.New("password cannot be used with Credentials")
+		}
+		return etcdwuid.NewClientWithCredentials(etcdCfg, cfg.Credentials), nil
+	}
+	return func() (*clientv3.Client, bool, error) {
+		client, err := clientv3.New(etcdCfg)
+		return client, true, err
+	}, nil
+}
+
+func sqliteDB(cfg Config) (sqlitewuid.OpenDB, error) {
+	if len(cfg.DSN) == 0 {
+		return nil, errors.New("dsn cannot be empty")
+	}
+	driver := cfg.Driver
+	if len(driver) == 0 {
+		driver = "sqlite3"
+	}
+	return func() (*sql.DB, bool, error) {
+		db, err := sql.Open(driver, cfg.DSN)
+		return db, true, err
+	}, nil
+}
+
+func loaded(w WUID, err error) (WUID, error) {
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func options(cfg Config) (opts []internal.Option, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid config: %v", r)
+		}
+	}()
+
+	if cfg.Step != 0 || cfg.Floor != 0 {
+		step := cfg.Step
+		if step == 0 {
+			step = 1
+		}
+		opts = append(opts, internal.WithStep(step, cfg.Floor))
+	}
+	if cfg.Section != nil {
+		opts = append(opts, internal.WithSection(*cfg.Section))
+	}
+	if cfg.ObfuscationSeed != 0 {
+		opts = append(opts, internal.WithObfuscation(cfg.ObfuscationSeed))
+	}
+	if cfg.ExhaustionThreshold != 0 {
+		// The warning logged by WUID is all we need here.
+		opts = append(opts, internal.WithH32ExhaustionAlarm(cfg.ExhaustionThreshold, func(est internal.ExhaustionEstimate) {}))
+	}
+	if cfg.QuietRenewals {
+		opts = append(opts, internal.WithQuietRenewals())
+	}
+	if cfg.LogSampling != 0 {
+		opts = append(opts, internal.WithLogSampling(cfg.LogSampling))
+	}
+	return opts, nil
+}
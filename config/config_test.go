@@ -0,0 +1,238 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/credentials"
+	"github.com/edwingeng/slog"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openSqlite(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	const ddl = "CREATE TABLE IF NOT EXISTS wuid (x INTEGER PRIMARY KEY CHECK (x = 0), h INTEGER NOT NULL)"
+	if _, err := db.Exec(ddl); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("WUID_TEST_PASSWORD", "beta")
+	yamlPath := writeFile(t, "wuid.yaml", `
+name: alpha
+backend: redis
+key: wuid
+addrs: [127.0.0.1:6379]
+password: ${WUID_TEST_PASSWORD}
+step: 16
+floor: 2
+section: 0
+obfuscation_seed: 5
+exhaustion_threshold: 0.8
+log_sampling: 10
+`)
+	cfg, err := LoadConfig(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "alpha" || cfg.Backend != "redis" || cfg.Key != "wuid" || len(cfg.Addrs) != 1 {
+		t.Fatalf("LoadConfig does not work as expected. cfg: %+v", cfg)
+	}
+	if cfg.Password != "beta" {
+		t.Fatal("environment variables are not properly expanded")
+	}
+	if cfg.Step != 16 || cfg.Floor != 2 || cfg.Section == nil || *cfg.Section != 0 {
+		t.Fatalf("LoadConfig does not work as expected. cfg: %+v", cfg)
+	}
+	if cfg.ObfuscationSeed != 5 || cfg.ExhaustionThreshold != 0.8 || cfg.LogSampling != 10 {
+		t.Fatalf("LoadConfig does not work as expected. cfg: %+v", cfg)
+	}
+
+	jsonPath := writeFile(t, "wuid.json", `{"name": "alpha", "backend": "sqlite", "dsn": "${WUID_TEST_PASSWORD}.db", "quiet_renewals": true}`)
+	cfg, err = LoadConfig(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Backend != "sqlite" || cfg.DSN != "beta.db" || !cfg.QuietRenewals || cfg.Section != nil {
+		t.Fatalf("LoadConfig does not work as expected. cfg: %+v", cfg)
+	}
+}
+
+func TestLoadConfig_Error(t *testing.T) {
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("a missing file is not properly handled")
+	}
+	if _, err := LoadConfig(writeFile(t, "wuid.toml", `name = "alpha"`)); err == nil {
+		t.Fatal("the file extension is not properly checked")
+	}
+	if _, err := LoadConfig(writeFile(t, "wuid.json", `{"name": `)); err == nil {
+		t.Fatal("a malformed file is not properly handled")
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "wuid.db")
+	db, err := openSqlite(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	section := int8(1)
+	cfg := Config{
+		Name:            "alpha",
+		Backend:         "sqlite",
+		Key:             "wuid",
+		DSN:             dsn,
+		Step:            4,
+		Section:         &section,
+		ObfuscationSeed: 5,
+		Logger:          slog.NewDumbLogger(),
+	}
+	w, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss := w.Stats(); ss.H32 != 1 {
+		t.Fatalf("ss.H32 is %d, while it should be 1", ss.H32)
+	}
+	if v := w.Next(); v>>60 != 1 {
+		t.Fatalf("the section is not properly applied. v: %x", v)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if ss := w.Stats(); ss.H32 != 2 {
+		t.Fatalf("ss.H32 is %d, while it should be 2", ss.H32)
+	}
+}
+
+func TestNewFromConfig_Error(t *testing.T) {
+	section := int8(8)
+	for i, cfg := range []Config{
+		{Backend: "sqlite", DSN: "beta.db"},
+		{Name: "alpha", Backend: "beta"},
+		{Name: "alpha", Backend: "objectstore"},
+		{Name: "alpha", Backend: "redis"},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, ReadTimeout: "beta"},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, PasswordFile: "beta"},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, TLS: &TLS{CertFile: "beta"}},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, IAM: &IAM{Region: "us-east-1"}},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, IAM: &IAM{Region: "us-east-1", CacheName: "beta"}},
+		{Name: "alpha", Backend: "redis", Addrs: []string{"127.0.0.1:6379"}, IAM: &IAM{Region: "us-east-1", CacheName: "beta"}, Username: "beta", Password: "beta"},
+		{Name: "alpha", Backend: "memcache"},
+		{Name: "alpha", Backend: "etcd"},
+		{Name: "alpha", Backend: "sqlite"},
+		{Name: "alpha", Backend: "sqlite", DSN: "beta.db", Step: -1},
+		{Name: "alpha", Backend: "sqlite", DSN: "beta.db", Section: &section},
+		{Name: "alpha", Backend: "sqlite", DSN: "beta.db", ExhaustionThreshold: 2},
+		{Name: "alpha", Backend: "sqlite", DSN: "beta.db", LogSampling: -1},
+		{Name: "alpha", Backend: "sqlite", DSN: filepath.Join(t.TempDir(), "beta.db"), Key: "beta"},
+	} {
+		cfg.Logger = slog.NewDumbLogger()
+		if w, err := NewFromConfig(cfg); err == nil || w != nil {
+			t.Fatalf("NewFromConfig should have failed. i: %d", i)
+		}
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	passwordFile := writeFile(t, "password", "beta\n")
+	cfg := Config{
+		Addrs:        []string{"127.0.0.1:6379"},
+		Username:     "alpha",
+		PasswordFile: passwordFile,
+		ReadTimeout:  "3s",
+		WriteTimeout: "1s",
+		TLS:          &TLS{ServerName: "redis.internal"},
+	}
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Username != "alpha" || opts.Password != "beta" {
+		t.Fatalf("the credentials are not properly applied. opts: %+v", opts)
+	}
+	if opts.ReadTimeout != time.Second*3 || opts.WriteTimeout != time.Second {
+		t.Fatalf("the timeouts are not properly applied. opts: %+v", opts)
+	}
+	if opts.TLSConfig == nil || opts.TLSConfig.ServerName != "redis.internal" {
+		t.Fatal("the TLS configuration is not properly applied")
+	}
+
+	if err := os.WriteFile(passwordFile, []byte("gamma"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if opts, err := redisOptions(cfg); err != nil || opts.Password != "gamma" {
+		t.Fatal("a rotated password should have been picked up")
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS13}
+	opts, err = redisOptions(Config{Addrs: cfg.Addrs, TLSConfig: base, TLS: &TLS{InsecureSkipVerify: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.TLSConfig == base || opts.TLSConfig.MinVersion != tls.VersionTLS13 || !opts.TLSConfig.InsecureSkipVerify {
+		t.Fatal("TLSConfig should have been cloned as the base of TLS")
+	}
+	if base.InsecureSkipVerify {
+		t.Fatal("TLSConfig should not have been modified")
+	}
+
+	if _, err := redisOptions(Config{TLS: &TLS{CAFile: passwordFile}}); err == nil {
+		t.Fatal("a CA file without a certificate should have been rejected")
+	}
+	if _, err := redisOptions(Config{WriteTimeout: "-1s"}); err == nil {
+		t.Fatal("a negative timeout should have been rejected")
+	}
+}
+
+func TestRedisCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "alpha")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "beta")
+	if p, err := redisCredentials(Config{Username: "wuid", Password: "beta"}); err != nil || p != nil {
+		t.Fatal("no provider should be returned without IAM or Credentials")
+	}
+	p, err := redisCredentials(Config{Username: "wuid", IAM: &IAM{Region: "us-east-1", CacheName: "wuid-cache"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := p.Credentials(context.Background()); err != nil || c.Username != "wuid" || !strings.HasPrefix(c.Password, "wuid-cache/?Action=connect&User=wuid&") {
+		t.Fatalf("unexpected credentials: %+v, err: %v", c, err)
+	}
+
+	static := credentials.Static("wuid", "gamma")
+	if p, err := redisCredentials(Config{Credentials: static, DB: 1}); err != nil || p == nil {
+		t.Fatal("Credentials should have been returned:", err)
+	}
+	for i, cfg := range []Config{
+		{Credentials: static, IAM: &IAM{Region: "us-east-1", CacheName: "wuid-cache"}},
+		{Credentials: static, PasswordFile: "beta"},
+	} {
+		if _, err := redisCredentials(cfg); err == nil {
+			t.Fatalf("redisCredentials should have failed. i: %d", i)
+		}
+	}
+}
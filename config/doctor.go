@@ -0,0 +1,280 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+	"github.com/go-redis/redis/v8"
+)
+
+// ScratchSuffix is appended to the key of the counter to make the scratch key used by Doctor.
+const ScratchSuffix = ":doctor"
+
+// Layout describes the bits of the identifiers generated with a configuration.
+type Layout struct {
+	// HighBits is the number of bits of the values loaded from the backend.
+	HighBits int
+	// MaxH32 is the greatest value the backend can hand out.
+	MaxH32 int64
+	// LowBits is the number of bits counted by each instance between two loads.
+	LowBits int
+	// Section is the section ID branded on each number, or -1 without WithSection.
+	Section     int64
+	Step        int64
+	Floor       int64
+	Obfuscation bool
+	// StringWidth is the number of decimal digits of the greatest identifier.
+	StringWidth int
+}
+
+// DoctorReport is the outcome of Doctor.
+type DoctorReport struct {
+	Backend string
+	Key     string
+	Layout  Layout
+	// Latency is the round trip of allocating and releasing the scratch value.
+	Latency time.Duration
+	// CurrentH32 is the number in the counter of the configuration, or 0 if it does not exist.
+	CurrentH32 int64
+	// Problems are the findings that would hurt the service, e.g. a counter close to MaxH32.
+	Problems []string
+}
+
+// OK reports whether no problem was found.
+func (r DoctorReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Print writes r to out in a human readable form.
+func (r DoctorReport) Print(out io.Writer) error {
+	section := "none"
+	if r.Layout.Section >= 0 {
+		section = strconv.FormatInt(r.Layout.Section, 10)
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "backend\t%s\n", r.Backend)
+	_, _ = fmt.Fprintf(tw, "key\t%s\n", r.Key)
+	_, _ = fmt.Fprintf(tw, "latency\t%s\n", r.Latency)
+	_, _ = fmt.Fprintf(tw, "current h32\t%d of %d\n", r.CurrentH32, r.Layout.MaxH32)
+	_, _ = fmt.Fprintf(tw, "high bits\t%d\n", r.Layout.HighBits)
+	_, _ = fmt.Fprintf(tw, "low bits\t%d\n", r.Layout.LowBits)
+	_, _ = fmt.Fprintf(tw, "section\t%s\n", section)
+	_, _ = fmt.Fprintf(tw, "step\t%d\n", r.Layout.Step)
+	_, _ = fmt.Fprintf(tw, "floor\t%d\n", r.Layout.Floor)
+	_, _ = fmt.Fprintf(tw, "obfuscation\t%t\n", r.Layout.Obfuscation)
+	_, _ = fmt.Fprintf(tw, "string width\t%d\n", r.Layout.StringWidth)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, p := range r.Problems {
+		_, _ = fmt.Fprintf(out, "problem: %s\n", p)
+	}
+	return nil
+}
+
+// Doctor checks cfg before a service takes traffic. It connects to the backend, allocates a
+// value at the scratch key, i.e. the key followed by ScratchSuffix, and releases it, which
+// proves the permissions needed by the renewals without consuming the counter. With sqlite,
+// the allocation is made in the table itself and rolled back. It also reads the counter and
+// reports the effective bit layout. An error means that the backend cannot be used at all,
+// while the other findings are reported in DoctorReport.Problems.
+func Doctor(ctx context.Context, cfg Config) (r DoctorReport, err error) {
+	if len(cfg.Name) == 0 {
+		return r, errors.New("name cannot be empty")
+	}
+	if len(cfg.Key) == 0 {
+		return r, errors.New("key cannot be empty")
+	}
+	opts, err := options(cfg)
+	if err != nil {
+		return r, err
+	}
+	w := internal.NewWUID(cfg.Name, slog.NewDumbLogger(), opts...)
+	r.Backend, r.Key = cfg.Backend, cfg.Key
+	r.Layout = layout(w)
+
+	ctx, cancel := context.WithTimeout(ctx, w.RenewTimeout())
+	defer cancel()
+	startTime := time.Now()
+	switch cfg.Backend {
+	case "redis":
+		r.CurrentH32, err = probeRedis(ctx, cfg)
+	case "memcache":
+		r.CurrentH32, err = probeMemcache(ctx, cfg)
+	case "etcd":
+		r.CurrentH32, err = probeEtcd(ctx, cfg)
+	case "sqlite":
+		r.CurrentH32, err = probeSqlite(ctx, cfg)
+	default:
+		return r, fmt.Errorf("unsupported backend: %q", cfg.Backend)
+	}
+	if err != nil {
+		return r, err
+	}
+	r.Latency = time.Since(startTime)
+
+	if r.Latency > w.RenewTimeout()/2 {
+		r.Problems = append(r.Problems, fmt.Sprintf("the backend took %s, more than half of the renew timeout %s", r.Latency, w.RenewTimeout()))
+	}
+	if r.CurrentH32 >= r.Layout.MaxH32 {
+		r.Problems = append(r.Problems, fmt.Sprintf("h32 is exhausted: %d", r.CurrentH32))
+	} else if threshold := cfg.ExhaustionThreshold; threshold > 0 && float64(r.CurrentH32)/float64(r.Layout.MaxH32) >= threshold {
+		r.Problems = append(r.Problems, fmt.Sprintf("h32 %d is beyond the exhaustion threshold %g", r.CurrentH32, threshold))
+	}
+	return r, nil
+}
+
+func layout(w *internal.WUID) Layout {
+	step, floor := w.CurrentStep()
+	l := Layout{
+		HighBits:    w.HighBitsWidth(),
+		MaxH32:      w.MaxH32(),
+		LowBits:     32,
+		Section:     -1,
+		Step:        step,
+		Floor:       floor,
+		Obfuscation: w.Obfuscation,
+		StringWidth: w.StringWidth(),
+	}
+	if !w.Monolithic {
+		l.Section = w.Section >> 60
+	}
+	return l
+}
+
+func probeRedis(ctx context.Context, cfg Config) (int64, error) {
+	newClient, err := redisClient(cfg)
+	if err != nil {
+		return 0, err
+	}
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	scratch := cfg.Key + ScratchSuffix
+	if err := client.Incr(ctx, scratch).Err(); err != nil {
+		return 0, fmt.Errorf("failed to allocate at %s: %w", scratch, err)
+	}
+	if err := client.Del(ctx, scratch).Err(); err != nil {
+		return 0, fmt.Errorf("failed to release %s: %w", scratch, err)
+	}
+	h32, err := client.Get(ctx, cfg.Key).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("failed to read %s: %w", cfg.Key, err)
+	}
+	return h32, nil
+}
+
+func probeMemcache(ctx context.Context, cfg Config) (int64, error) {
+	newClient, err := memcacheClient(cfg)
+	if err != nil {
+		return 0, err
+	}
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		client.Timeout = time.Until(deadline)
+	}
+
+	scratch := cfg.Key + ScratchSuffix
+	err = client.Add(&memcache.Item{Key: scratch, Value: []byte("0")})
+	if err != nil && !errors.Is(err, memcache.ErrNotStored) {
+		return 0, fmt.Errorf("failed to allocate at %s: %w", scratch, err)
+	}
+	if _, err := client.Increment(scratch, 1); err != nil {
+		return 0, fmt.Errorf("failed to allocate at %s: %w", scratch, err)
+	}
+	if err := client.Delete(scratch); err != nil {
+		return 0, fmt.Errorf("failed to release %s: %w", scratch, err)
+	}
+	item, err := client.Get(cfg.Key)
+	switch {
+	case errors.Is(err, memcache.ErrCacheMiss):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("failed to read %s: %w", cfg.Key, err)
+	}
+	return strconv.ParseInt(string(item.Value), 10, 64)
+}
+
+func probeEtcd(ctx context.Context, cfg Config) (int64, error) {
+	newClient, err := etcdClient(cfg)
+	if err != nil {
+		return 0, err
+	}
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	scratch := cfg.Key + ScratchSuffix
+	if _, err := client.Put(ctx, scratch, "1"); err != nil {
+		return 0, fmt.Errorf("failed to allocate at %s: %w", scratch, err)
+	}
+	if _, err := client.Delete(ctx, scratch); err != nil {
+		return 0, fmt.Errorf("failed to release %s: %w", scratch, err)
+	}
+	resp, err := client.Get(ctx, cfg.Key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", cfg.Key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+}
+
+func probeSqlite(ctx context.Context, cfg Config) (h32 int64, err error) {
+	openDB, err := sqliteDB(cfg)
+	if err != nil {
+		return 0, err
+	}
+	db, autoClose, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	query := fmt.Sprintf("INSERT INTO %s (x, h) VALUES (0, 1) ON CONFLICT (x) DO UPDATE SET h = h + 1 RETURNING h", cfg.Key)
+	if err := tx.QueryRowContext(ctx, query).Scan(&h32); err != nil {
+		return 0, fmt.Errorf("failed to allocate in %s: %w", cfg.Key, err)
+	}
+	return h32 - 1, nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edwingeng/slog"
+)
+
+func TestDoctor(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "wuid.db")
+	db, err := openSqlite(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	section := int8(2)
+	cfg := Config{
+		Name:                "alpha",
+		Backend:             "sqlite",
+		Key:                 "wuid",
+		DSN:                 dsn,
+		Step:                4,
+		Section:             &section,
+		ExhaustionThreshold: 0.5,
+		Logger:              slog.NewDumbLogger(),
+	}
+	r, err := Doctor(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || r.CurrentH32 != 0 {
+		t.Fatalf("Doctor does not work as expected. r: %+v", r)
+	}
+	if r.Layout.Section != 2 || r.Layout.Step != 4 || r.Layout.HighBits != 24 || r.Layout.MaxH32 != 0x00FFFFFF {
+		t.Fatalf("the layout is not as expected. layout: %+v", r.Layout)
+	}
+
+	if _, err := NewFromConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = Doctor(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if r.CurrentH32 != 1 {
+		t.Fatalf("r.CurrentH32 is %d, while it should be 1", r.CurrentH32)
+	}
+	var h32 int64
+	if err := db.QueryRow("SELECT h FROM wuid").Scan(&h32); err != nil {
+		t.Fatal(err)
+	}
+	if h32 != 1 {
+		t.Fatal("Doctor should not consume the counter")
+	}
+
+	if _, err := db.Exec("UPDATE wuid SET h = ?", 0x00FFFFFF*3/4); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = Doctor(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || !strings.Contains(r.Problems[0], "exhaustion threshold") {
+		t.Fatalf("the exhaustion threshold is not properly checked. r: %+v", r)
+	}
+
+	var sb strings.Builder
+	if err := r.Print(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "high bits") || !strings.Contains(sb.String(), "problem: ") {
+		t.Fatalf("unexpected output: %s", sb.String())
+	}
+}
+
+func TestDoctor_Error(t *testing.T) {
+	for i, cfg := range []Config{
+		{Backend: "sqlite", Key: "wuid", DSN: "beta.db"},
+		{Name: "alpha", Backend: "sqlite", DSN: "beta.db"},
+		{Name: "alpha", Backend: "beta", Key: "wuid"},
+		{Name: "alpha", Backend: "redis", Key: "wuid"},
+		{Name: "alpha", Backend: "sqlite", Key: "wuid", DSN: "beta.db", Step: -1},
+		{Name: "alpha", Backend: "sqlite", Key: "beta", DSN: filepath.Join(t.TempDir(), "beta.db")},
+	} {
+		if _, err := Doctor(context.Background(), cfg); err == nil {
+			t.Fatalf("Doctor should have failed. i: %d", i)
+		}
+	}
+}
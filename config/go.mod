@@ -0,0 +1,48 @@
+module github.com/driftboat/wuid/config
+
+go 1.18
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
+	github.com/driftboat/wuid v1.5.0
+	github.com/driftboat/wuid/etcd/wuid v1.5.0
+	github.com/driftboat/wuid/memcache/wuid v1.5.0
+	github.com/driftboat/wuid/redis/v8/wuid v1.5.0
+	github.com/driftboat/wuid/sqlite/wuid v1.5.0
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/mattn/go-sqlite3 v1.14.16
+	go.etcd.io/etcd/client/v3 v3.5.6
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/coreos/go-semver v0.3.0 // indirect
+	github.com/coreos/go-systemd/v22 v22.3.3-0.20220203105225-a9a7ef127534 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	go.etcd.io/etcd/api/v3 v3.5.6 // indirect
+	go.etcd.io/etcd/client/pkg/v3 v3.5.6 // indirect
+	go.opentelemetry.io/otel v1.11.2 // indirect
+	go.opentelemetry.io/otel/trace v1.11.2 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
+	google.golang.org/genproto v0.0.0-20210602131652-f16073e35f0c // indirect
+	google.golang.org/grpc v1.41.0 // indirect
+	google.golang.org/protobuf v1.26.0 // indirect
+)
+
+replace (
+	github.com/driftboat/wuid => ..
+	github.com/driftboat/wuid/etcd/wuid => ../etcd/wuid
+	github.com/driftboat/wuid/memcache/wuid => ../memcache/wuid
+	github.com/driftboat/wuid/mirror => ../mirror
+	github.com/driftboat/wuid/redis/v8/wuid => ../redis/v8/wuid
+	github.com/driftboat/wuid/sqlite/wuid => ../sqlite/wuid
+)
@@ -0,0 +1,27 @@
+package wuid
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id, e.g. the ID of a request, so that the
+// functions it is passed down to can find it with FromContext.
+func NewContext(ctx context.Context, id ID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the ID put in ctx by NewContext, NextIntoContext or the middlewares of
+// the httpmiddleware and the grpcmiddleware packages.
+func FromContext(ctx context.Context) (ID, bool) {
+	id, ok := ctx.Value(contextKey{}).(ID)
+	return id, ok
+}
+
+// NextIntoContext takes a unique identifier from the default generator and returns it with a
+// copy of ctx carrying it. It panics if SetDefault has not been called.
+func NextIntoContext(ctx context.Context) (context.Context, ID) {
+	id := NextID()
+	return NewContext(ctx, id), id
+}
@@ -0,0 +1,16 @@
+package wuid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := FromContext(ctx); ok {
+		t.Fatal("a context without an ID should report false")
+	}
+	if id, ok := FromContext(NewContext(ctx, 42)); !ok || id != 42 {
+		t.Fatalf("FromContext should return the ID put by NewContext. id: %d, ok: %v", id, ok)
+	}
+}
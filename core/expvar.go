@@ -0,0 +1,36 @@
+//go:build !wuid_nodeps
+
+package core
+
+import (
+	"expvar"
+	"fmt"
+)
+
+func (w *WUID) PublishExpvar(prefix string) error {
+	name := prefix + w.Name
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %s has been published already", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		ss := w.Stats()
+		est := w.ExhaustionEstimate()
+		var lastRenewError string
+		if ss.LastRenewError != nil {
+			lastRenewError = ss.LastRenewError.Error()
+		}
+		return map[string]interface{}{
+			"h32":                ss.H32,
+			"h32_remaining":      est.Remaining,
+			"h32_eta_seconds":    int64(est.ETA.Seconds()),
+			"low_bits_usage":     ss.LowBitsUsage,
+			"num_issued":         ss.NumIssued,
+			"num_renew_attempts": ss.NumRenewAttempts,
+			"num_renewed":        ss.NumRenewed,
+			"num_renew_failed":   ss.NumRenewFailed,
+			"last_renew_time":    ss.LastRenewTime,
+			"last_renew_error":   lastRenewError,
+		}
+	}))
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build wuid_nodeps
+
+package core
+
+import (
+	"errors"
+)
+
+func (w *WUID) PublishExpvar(prefix string) error {
+	return errors.New("expvar is not available with the wuid_nodeps build tag")
+}
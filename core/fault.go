@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// Fault is a failure injected into a load from the data source by WithFaultInjector.
+type Fault int
+
+const (
+	// NoFault lets the load go through.
+	NoFault Fault = iota
+	// FaultTimeout makes the load hang until the renewal timeout expires, without reaching
+	// the data source.
+	FaultTimeout
+	// FaultError fails the load without reaching the data source.
+	FaultError
+	// FaultLostReply lets the data source allocate an h32, but fails the load as if the reply
+	// were lost, which wastes the h32 just like a partial failure of the network.
+	FaultLostReply
+	// FaultDuplicateIncrement makes the data source allocate two h32 values, as a retried
+	// request does, and uses the second one.
+	FaultDuplicateIncrement
+)
+
+func (f Fault) String() string {
+	switch f {
+	case NoFault:
+		return "none"
+	case FaultTimeout:
+		return "timeout"
+	case FaultError:
+		return "error"
+	case FaultLostReply:
+		return "lost reply"
+	case FaultDuplicateIncrement:
+		return "duplicate increment"
+	default:
+		return fmt.Sprintf("Fault(%d)", int(f))
+	}
+}
+
+// FaultInjector decides the fault to inject into each load of the generators using
+// WithFaultInjector, so that the tests of an application can check its alerting and fallbacks
+// without breaking the data source.
+type FaultInjector interface {
+	// Fault returns the fault to inject into the next load of the generator named name.
+	Fault(name string) Fault
+}
+
+// FaultInjectorFunc is an adapter to allow the use of an ordinary function as a FaultInjector.
+type FaultInjectorFunc func(name string) Fault
+
+func (f FaultInjectorFunc) Fault(name string) Fault {
+	return f(name)
+}
+
+// FaultSequence returns a FaultInjector injecting faults in order, one per load, and NoFault
+// once they run out.
+func FaultSequence(faults ...Fault) FaultInjector {
+	var mu sync.Mutex
+	faults = append([]Fault(nil), faults...)
+	return FaultInjectorFunc(func(string) Fault {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(faults) == 0 {
+			return NoFault
+		}
+		f := faults[0]
+		faults = faults[1:]
+		return f
+	})
+}
+
+// fetchWithFault calls fetch, which loads from the data source, with the fault decided by the
+// injector set by WithFaultInjector.
+func (w *WUID) fetchWithFault(ctx context.Context, fetch func() (h32, low int64, err error)) (h32, low int64, err error) {
+	if w.faultInjector == nil {
+		return fetch()
+	}
+	f := w.faultInjector.Fault(w.Name)
+	if f != NoFault {
+		w.Warnf("<wuid> injecting a fault into the load. name: %s, fault: %s", w.Name, f)
+	}
+	switch f {
+	case FaultTimeout:
+		<-ctx.Done()
+		return 0, 0, fmt.Errorf("%w: %s", wuiderr.ErrFaultInjected, ctx.Err())
+	case FaultError:
+		return 0, 0, fmt.Errorf("%w: %s", wuiderr.ErrFaultInjected, f)
+	}
+	h32, low, err = fetch()
+	if err != nil {
+		return 0, 0, err
+	}
+	switch f {
+	case FaultLostReply:
+		return 0, 0, fmt.Errorf("%w: the reply of h32 %d is lost", wuiderr.ErrFaultInjected, h32)
+	case FaultDuplicateIncrement:
+		return fetch()
+	}
+	return h32, low, nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Fork returns a child generator issuing the identifiers of w whose bits under the step are
+// subSection, e.g. a step of 16 leaves room for the sub-sections 1 to 15, while w keeps 0 in
+// those bits from then on. The child shares the h32 of w and advances a counter of its own, so
+// it neither contends with w nor costs an allocation from the backend. When its counter runs
+// out, it moves to the current h32 of w, renewing w first if the child has used that one
+// already. w must use WithStep with a power of 2 and no floor, and none of the options that
+// change the numbers, e.g. WithObfuscation, WithShards and WithTransform. A sub-section can
+// be forked once, and the step of w and its children cannot be reconfigured. The children of
+// a generator with WithUint64 are unsigned as well.
+func (w *WUID) Fork(subSection int) (*WUID, error) {
+	l := w.layout()
+	if l.step < 2 || l.step&(l.step-1) != 0 || l.flags&^8 != 0 || w.shards != nil || l.maxSkip > 0 ||
+		len(w.transforms) > 0 || w.checksum || w.forkOffset != 0 {
+		return nil, errors.New("Fork requires WithStep with a power of 2 and no floor, and cannot be combined with the options that change the numbers, e.g. WithObfuscation, WithShards and WithTransform")
+	}
+	if subSection < 1 || int64(subSection) >= l.step {
+		return nil, fmt.Errorf("subSection must be in between [1, %d)", l.step)
+	}
+	w.Lock()
+	r := w.renewer
+	w.Unlock()
+	if r == nil {
+		return nil, errors.New("nothing has been loaded")
+	}
+
+	w.nextStep.Lock()
+	defer w.nextStep.Unlock()
+	if w.nextStep.step != 0 {
+		return nil, errors.New("Fork cannot be used while ReconfigureStep is pending")
+	}
+	if w.forks == nil {
+		if atomic.LoadInt64(&w.N)&(l.step-1) != 0 {
+			return nil, errors.New("the counter is not aligned to the step, e.g. after ResetForward")
+		}
+		fl := *l
+		fl.flags |= 8
+		w.stepLayout.Store(&fl)
+		w.forks = make(map[int]bool)
+	}
+	if w.forks[subSection] {
+		return nil, fmt.Errorf("sub-section %d is forked already", subSection)
+	}
+
+	opts := []Option{WithStep(l.step, 0)}
+	if w.unsigned {
+		opts = append(opts, WithUint64())
+	}
+	child := NewWUID(fmt.Sprintf("%s#%d", w.Name, subSection), w.Logger, opts...)
+	child.Monolithic, child.Section = w.Monolithic, w.Section
+	child.forkOffset = int64(subSection)
+	child.Flags |= 8
+	child.stepLayout.Store(child.newLayout())
+	if err := child.Load(context.Background(), &forkRenewer{parent: w, child: child}); err != nil {
+		return nil, err
+	}
+	w.forks[subSection] = true
+	return child, nil
+}
+
+// forkRenewer moves a child generator made by Fork to the current h32 of its parent.
+type forkRenewer struct {
+	parent, child *WUID
+}
+
+func (r *forkRenewer) Renew(ctx context.Context) (int64, error) {
+	current := atomic.LoadInt64(&r.child.N) >> 32 & r.child.MaxH32()
+	h32 := r.parent.CurrentHighBits().Value
+	if h32 > current {
+		return h32, nil
+	}
+	if err := r.parent.RenewNow(); err != nil {
+		return 0, err
+	}
+	return r.parent.CurrentHighBits().Value, nil
+}
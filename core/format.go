@@ -0,0 +1,407 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// NextString returns a unique identifier in decimal, which is unsigned with WithUint64.
+func (w *WUID) NextString() string {
+	var buf [20]byte
+	return string(w.appendID(buf[:0], w.Next()))
+}
+
+// NextUint64 returns a unique identifier as an unsigned integer. With WithUint64, it covers
+// the identifiers whose sign bit is set, which are negative as int64.
+func (w *WUID) NextUint64() uint64 {
+	return uint64(w.Next())
+}
+
+// ToUint64 returns the unsigned form of id, e.g. to store an identifier generated with
+// WithUint64 as BIGINT UNSIGNED. It keeps all the 64 bits, so FromUint64 gets id back.
+func ToUint64(id int64) uint64 {
+	return uint64(id)
+}
+
+// FromUint64 returns the identifier whose unsigned form is u, e.g. one read from a BIGINT
+// UNSIGNED column, as it is returned by Next.
+func FromUint64(u uint64) int64 {
+	return int64(u)
+}
+
+// appendID appends id in decimal, which is unsigned with WithUint64.
+func (w *WUID) appendID(dst []byte, id int64) []byte {
+	if w.unsigned {
+		return strconv.AppendUint(dst, uint64(id), 10)
+	}
+	return AppendString(dst, id)
+}
+
+// AppendString appends id in decimal, the form returned by NextString, to dst and returns the
+// extended buffer, like strconv.AppendInt.
+func AppendString(dst []byte, id int64) []byte {
+	return strconv.AppendInt(dst, id, 10)
+}
+
+// AppendNext appends a unique identifier in decimal to dst and returns the extended buffer. It
+// does not allocate when dst has room for StringWidth() more bytes, e.g. on the hot paths of
+// logging and serialization.
+func (w *WUID) AppendNext(dst []byte) []byte {
+	return w.appendID(dst, w.Next())
+}
+
+// NextStringFixed returns a unique identifier in decimal, padded with zeros to width, so that
+// the strings sort in the same order as the numbers. width must be at least StringWidth().
+func (w *WUID) NextStringFixed(width int) string {
+	if width < w.StringWidth() {
+		panic(fmt.Errorf("width should be at least %d", w.StringWidth()))
+	}
+	var buf [32]byte
+	b := w.appendID(buf[:0], w.Next())
+	if len(b) == width {
+		return string(b)
+	}
+	return strings.Repeat("0", width-len(b)) + string(b)
+}
+
+// crockford is the Crockford's base32 alphabet used by ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NextULID returns a unique identifier as a 26-character ULID. The 48-bit timestamp is the
+// current time in milliseconds, as usual, but the 80-bit random part is replaced by an
+// identifier from Next, so that the ULIDs are free of collisions rather than unlikely to
+// collide, while they still sort by time.
+func (w *WUID) NextULID() string {
+	return encodeULID(time.Now(), w.Next())
+}
+
+// SignatureSize is the number of bytes of the HMAC-SHA256 tag kept by NextSigned.
+const SignatureSize = 8
+
+// NextSigned returns a unique identifier in decimal, followed by a dot and a truncated
+// HMAC-SHA256 tag of it in unpadded base64url, e.g. 4294967297.q1Lq9Lw_EjY, so that the
+// identifiers exposed to the public can be neither enumerated nor forged by those without
+// the key. VerifySigned checks it. It panics if WithSigningKey is not used.
+func (w *WUID) NextSigned() string {
+	if len(w.signingKey) == 0 {
+		panic("NextSigned requires WithSigningKey")
+	}
+	id := w.Next()
+	return string(w.appendID(nil, id)) + "." + base64.RawURLEncoding.EncodeToString(w.sign(id))
+}
+
+// VerifySigned checks the tag of s, which is returned by NextSigned, and returns the
+// identifier. The error wraps wuiderr.ErrInvalidSignature if the tag does not match.
+func (w *WUID) VerifySigned(s string) (int64, error) {
+	if len(w.signingKey) == 0 {
+		return 0, errors.New("VerifySigned requires WithSigningKey")
+	}
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0, fmt.Errorf("%w: no tag in %q", wuiderr.ErrInvalidSignature, s)
+	}
+	id, err := strconv.ParseInt(s[:i], 10, 64)
+	if w.unsigned {
+		var u uint64
+		u, err = strconv.ParseUint(s[:i], 10, 64)
+		id = int64(u)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", wuiderr.ErrInvalidSignature, err)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(s[i+1:])
+	if err != nil || !hmac.Equal(tag, w.sign(id)) {
+		return 0, fmt.Errorf("%w: %q", wuiderr.ErrInvalidSignature, s)
+	}
+	return id, nil
+}
+
+// sign returns the truncated HMAC-SHA256 tag of id in big-endian.
+func (w *WUID) sign(id int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	mac := hmac.New(sha256.New, w.signingKey)
+	mac.Write(b[:])
+	return mac.Sum(nil)[:SignatureSize]
+}
+
+// encodeULID encodes the 48-bit timestamp of t, 16 zero bits and id, which add up to 128 bits,
+// into 26 characters of 5 bits each, from the most significant.
+func encodeULID(t time.Time, id int64) string {
+	hi := uint64(t.UnixMilli()) << 16
+	lo := uint64(id)
+	var b [26]byte
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// StringWidth returns the number of decimal digits of the greatest identifier the instance
+// can generate, which is 16, 17 with WithChecksum, 19 with WithSection, or 20 with WithUint64.
+func (w *WUID) StringWidth() int {
+	if w.unsigned {
+		return len(strconv.FormatUint(uint64(w.MaxH32()<<32|L32Mask), 10))
+	}
+	if w.checksum {
+		return len(strconv.FormatInt(w.MaxH32()<<32|L32Mask, 10)) + 1
+	}
+	if w.Monolithic {
+		return len(strconv.FormatInt(w.MaxH32()<<32|L32Mask, 10))
+	}
+	return len(strconv.FormatInt(1<<63-1, 10))
+}
+
+// StringFormat describes the identifiers returned by NextString, so that the services receiving
+// them, e.g. API gateways, can validate them the same way they are generated. Pattern,
+// MinLength and MaxLength can be used as is in OpenAPI and JSON Schema.
+type StringFormat struct {
+	Pattern   string
+	MinLength int
+	MaxLength int
+
+	min, max int64
+	checksum bool
+	unsigned bool
+}
+
+// StringFormat returns the format of the identifiers returned by NextString. The lengths and the
+// range are only known without WithTransform, otherwise it is AnyStringFormat().
+func (w *WUID) StringFormat() StringFormat {
+	if len(w.transforms) > 0 {
+		return AnyStringFormat()
+	}
+	var min, max int64
+	switch {
+	case w.Monolithic:
+		min, max = 1<<32, w.MaxH32()<<32|L32Mask
+	default:
+		const L60Mask = 0x0FFFFFFFFFFFFFFF
+		min, max = w.Section|1<<32, w.Section|L60Mask
+	}
+	// The floor, which ReconfigureStep may change, rounds the numbers down by less than MaxStep.
+	min -= MaxStep
+	if w.checksum {
+		return newStringFormat(min*10, max*10+9, true)
+	}
+	if w.unsigned {
+		return newUnsignedStringFormat(min, max)
+	}
+	return newStringFormat(min, max, false)
+}
+
+// AnyStringFormat returns the format accepting any positive decimal number without leading
+// zeros, for the services that do not know the configuration of the generator.
+func AnyStringFormat() StringFormat {
+	return newStringFormat(1, 1<<63-1, false)
+}
+
+func newStringFormat(min, max int64, checksum bool) StringFormat {
+	f := StringFormat{min: min, max: max, checksum: checksum}
+	f.MinLength = len(strconv.FormatInt(min, 10))
+	f.MaxLength = len(strconv.FormatInt(max, 10))
+	f.Pattern = fmt.Sprintf("^[1-9][0-9]{%d,%d}$", f.MinLength-1, f.MaxLength-1)
+	return f
+}
+
+// newUnsignedStringFormat is newStringFormat for WithUint64, where min and max are compared
+// as unsigned.
+func newUnsignedStringFormat(min, max int64) StringFormat {
+	f := StringFormat{min: min, max: max, unsigned: true}
+	f.MinLength = len(strconv.FormatUint(uint64(min), 10))
+	f.MaxLength = len(strconv.FormatUint(uint64(max), 10))
+	f.Pattern = fmt.Sprintf("^[1-9][0-9]{%d,%d}$", f.MinLength-1, f.MaxLength-1)
+	return f
+}
+
+// Parse parses an identifier in the format of f. It rejects the strings that NextString cannot
+// return, e.g. the ones with leading zeros, out of range or, with WithChecksum, with a wrong
+// check digit.
+func (f StringFormat) Parse(s string) (int64, error) {
+	if len(s) < f.MinLength || len(s) > f.MaxLength || s[0] == '0' {
+		return 0, fmt.Errorf("invalid identifier: %q", s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("invalid identifier: %q", s)
+		}
+	}
+	if f.unsigned {
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || u < uint64(f.min) || u > uint64(f.max) {
+			return 0, fmt.Errorf("identifier out of range: %q", s)
+		}
+		return int64(u), nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("identifier out of range: %q", s)
+	}
+	if f.checksum && damm(n) != 0 {
+		return 0, fmt.Errorf("invalid check digit: %q", s)
+	}
+	return n, nil
+}
+
+func (w *WUID) format(v1 int64) int64 {
+	return w.formatWith(w.layout(), v1)
+}
+
+func (w *WUID) formatWith(l *stepLayout, v1 int64) int64 {
+	r := v1
+	if l.flags&4 != 0 {
+		k := permute(uint64(v1&L32Mask)>>l.permShift, 32-l.permShift, &l.permKeys)
+		r = v1&^L32Mask | int64(k<<l.permShift) | v1&(l.step-1)
+	}
+	if l.flags&1 != 0 {
+		x := r ^ l.mask
+		r = r&^L32Mask | x&L32Mask
+	}
+	if l.flags&2 != 0 {
+		r = r / l.floor * l.floor
+	}
+	if l.flags&8 != 0 {
+		r = r&^l.forkMask | l.forkOffset
+	}
+	for _, f := range w.transforms {
+		r = f(r)
+	}
+	if w.checksum {
+		r = r*10 + int64(damm(r))
+	}
+	return r
+}
+
+// permute maps k, a number of n bits, to another one with a few rounds of bijective mixing
+// keyed by keys. Each step of a round, i.e. the xor, the multiplication by an odd number and
+// the xorshift, is a bijection modulo 1<<n.
+func permute(k uint64, n uint, keys *[3]uint64) uint64 {
+	m := uint64(1)<<n - 1
+	for _, key := range keys {
+		k = (k ^ key) & m
+		k = k * (key>>32 | 1) & m
+		k ^= k >> (n/2 + 1)
+	}
+	return k
+}
+
+// dammTable is the quasigroup of order 10 used by the Damm algorithm.
+var dammTable = [10][10]byte{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+// damm returns the Damm check digit of the decimal digits of v.
+func damm(v int64) byte {
+	var buf [20]byte
+	var interim byte
+	for _, c := range strconv.AppendInt(buf[:0], v, 10) {
+		interim = dammTable[interim][c-'0']
+	}
+	return interim
+}
+
+// ValidateChecksum reports whether the lowest decimal digit of id is the check digit added by
+// WithChecksum, which catches all single-digit errors and all adjacent transpositions.
+func ValidateChecksum(id int64) bool {
+	return id >= 0 && damm(id) == 0
+}
+
+// CheckID reports whether id could have been generated with the configuration of w, and
+// returns its h32. It checks the check digit of WithChecksum, the section, the floor, the
+// range of h32, including the ranges reserved by WithReservedH32Ranges, and the low bits when
+// they are not obfuscated. Whether the h32 has been allocated by the backend is left to the
+// caller. The identifiers changed by WithTransform cannot be checked.
+func (w *WUID) CheckID(id int64) (h32 int64, err error) {
+	if len(w.transforms) > 0 {
+		return 0, errors.New("the identifiers changed by WithTransform cannot be checked")
+	}
+	if id == 0 || id < 0 && !w.unsigned {
+		return 0, fmt.Errorf("%w: %d is not positive", wuiderr.ErrInvalidID, id)
+	}
+	if w.checksum {
+		if !ValidateChecksum(id) {
+			return 0, fmt.Errorf("%w: the check digit of %d is wrong", wuiderr.ErrInvalidID, id)
+		}
+		id /= 10
+	}
+	l := w.layout()
+	if l.flags&2 != 0 && id%l.floor != 0 {
+		return 0, fmt.Errorf("%w: %d is not a multiple of the floor %d", wuiderr.ErrInvalidID, id, l.floor)
+	}
+	if w.Monolithic {
+		h32 = id >> 32
+		if w.unsigned {
+			h32 &= 0xFFFFFFFF
+		}
+	} else {
+		const L60Mask = 0x0FFFFFFFFFFFFFFF
+		if section := id &^ L60Mask; section != w.Section {
+			return 0, fmt.Errorf("%w: the section of %d is %d, not %d", wuiderr.ErrInvalidID, id, section>>60, w.Section>>60)
+		}
+		h32 = id & L60Mask >> 32
+	}
+	if h32 <= 0 || h32 > w.MaxH32() {
+		return 0, fmt.Errorf("%w: h32 %d of %d is out of range", wuiderr.ErrInvalidID, h32, id)
+	}
+	if rng, ok := w.ReservedRange(h32); ok {
+		return 0, fmt.Errorf("%w: h32 %d of %d is in the reserved range [%d, %d]", wuiderr.ErrInvalidID, h32, id, rng[0], rng[1])
+	}
+	if l.flags&(1|4) == 0 {
+		if low := id & L32Mask; low == 0 || low >= PanicValue {
+			return 0, fmt.Errorf("%w: the low bits of %d are out of range", wuiderr.ErrInvalidID, id)
+		}
+	}
+	return h32, nil
+}
+
+// numTransformSamples is the number of identifiers checkTransforms tries at each end of the
+// low bits.
+const numTransformSamples = 4096
+
+// checkTransforms makes sure that the transforms set by WithTransform map distinct identifiers
+// to distinct non-negative ones. It tries the identifiers at both ends of the low bits of the
+// smallest and the greatest h32, which catches the usual mistakes, e.g. dropping high bits or
+// truncating low digits, but it is not a proof.
+func (w *WUID) checkTransforms() error {
+	if len(w.transforms) == 0 && !w.checksum {
+		return nil
+	}
+	seen := make(map[int64]int64, numTransformSamples*8)
+	for _, h32 := range []int64{1, w.MaxH32()} {
+		base := w.align(h32 << 32)
+		for _, start := range []int64{base, base + (PanicValue-1)/w.Step*w.Step - numTransformSamples*w.Step} {
+			for i := int64(1); i <= numTransformSamples; i++ {
+				v1 := start + i*w.Step
+				r := w.format(v1)
+				if r < 0 {
+					return fmt.Errorf("the transform maps %#016x to a negative number", v1)
+				}
+				if prev, ok := seen[r]; ok && prev != v1 {
+					return fmt.Errorf("the transform is not injective: both %#016x and %#016x map to %#016x", prev, v1, r)
+				}
+				seen[r] = v1
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// rateLimiter is a token bucket holding up to one second of tokens.
+type rateLimiter struct {
+	sync.Mutex
+	perSecond float64
+	tokens    float64
+	last      time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{perSecond: float64(perSecond), tokens: float64(perSecond), last: time.Now()}
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.perSecond
+	if l.tokens > l.perSecond {
+		l.tokens = l.perSecond
+	}
+	l.last = now
+}
+
+// allow takes n tokens if they are available.
+func (l *rateLimiter) allow(n int) bool {
+	l.Lock()
+	defer l.Unlock()
+	l.refill(time.Now())
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+// wait takes n tokens, sleeping until they would have been available.
+func (l *rateLimiter) wait(n int) {
+	l.Lock()
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.Unlock()
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / l.perSecond * float64(time.Second)))
+	}
+}
+
+// duplicateGuard remembers the most recently issued identifiers.
+type duplicateGuard struct {
+	sync.Mutex
+	ring []int64
+	pos  int
+	seen map[int64]struct{}
+}
+
+// checkDuplicate panics with wuiderr.ErrDuplicateID, or calls the callback set by
+// WithDuplicateCallback, if id is among the recently issued identifiers.
+func (w *WUID) checkDuplicate(id int64) {
+	g := w.guard
+	g.Lock()
+	_, dup := g.seen[id]
+	if !dup {
+		if len(g.seen) == len(g.ring) {
+			delete(g.seen, g.ring[g.pos])
+		}
+		g.ring[g.pos] = id
+		g.pos = (g.pos + 1) % len(g.ring)
+		g.seen[id] = struct{}{}
+	}
+	g.Unlock()
+	if !dup {
+		return
+	}
+
+	w.Warnf("<wuid> duplicate identifier detected. name: %s, id: %#016x", w.Name, id)
+	if w.onDuplicate != nil {
+		w.onDuplicate(id)
+		return
+	}
+	panic(fmt.Errorf("%w: %#016x", wuiderr.ErrDuplicateID, id))
+}
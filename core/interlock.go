@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// interlock is the registry of the live generators of the process by their data source, key,
+// section and name. See Interlock.
+var interlock = struct {
+	sync.Mutex
+	m map[string]*WUID
+}{m: make(map[string]*WUID)}
+
+// Interlock registers w as the generator of the process loading from key of the data source
+// named backend, e.g. redis, together with its section and name. Another live generator
+// registered with the same ones is a misconfiguration that works sporadically, with both of
+// them racing to renew. Interlock logs a warning about it, or returns
+// wuiderr.ErrDuplicateGenerator with WithStrictInterlock. Stop releases the registration. The
+// adapters call it before the first load.
+func (w *WUID) Interlock(backend, key string) error {
+	id := fmt.Sprintf("%s\x00%s\x00%d\x00%s", backend, key, w.Section>>60, w.Name)
+	interlock.Lock()
+	other, ok := interlock.m[id]
+	if !ok || other == w {
+		interlock.m[id] = w
+		w.interlockID = id
+	}
+	interlock.Unlock()
+	if !ok || other == w {
+		return nil
+	}
+
+	if w.strictInterlock {
+		return fmt.Errorf("%w. name: %s, backend: %s, key: %s, section: %d",
+			wuiderr.ErrDuplicateGenerator, w.Name, backend, key, w.Section>>60)
+	}
+	w.Warnf("<wuid> another generator of the process loads from the same key. name: %s, backend: %s, key: %s, section: %d",
+		w.Name, backend, key, w.Section>>60)
+	return nil
+}
+
+// releaseInterlock removes the registration made by Interlock.
+func (w *WUID) releaseInterlock() {
+	interlock.Lock()
+	defer interlock.Unlock()
+	if w.interlockID != "" && interlock.m[w.interlockID] == w {
+		delete(interlock.m, w.interlockID)
+	}
+	w.interlockID = ""
+}
+
+// WithStrictInterlock makes the load fail with wuiderr.ErrDuplicateGenerator when another
+// live generator of the process loads from the same key of the same data source, with the same
+// section and name, instead of logging a warning. See Interlock.
+func WithStrictInterlock() Option {
+	return func(w *WUID) {
+		w.strictInterlock = true
+	}
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// stepLayout is the part of the configuration read by Next, which ReconfigureStep replaces
+// as a whole when h32 changes.
+type stepLayout struct {
+	step       int64
+	laneStride int64
+	floor      int64
+	mask       int64
+	flags      int8
+	renewMask  int64
+	critical   int64
+	permShift  uint
+	permKeys   [3]uint64
+	maxSkip    int64
+	skipKey    uint64
+	forkMask   int64
+	forkOffset int64
+}
+
+// newLayout builds the layout of the options. The fields it reads are not changed afterwards:
+// ReconfigureStep replaces the layout only, so that Next never reads a field being written.
+func (w *WUID) newLayout() *stepLayout {
+	return w.buildLayout(w.Step, w.Floor, w.ObfuscationMask, w.Flags)
+}
+
+func (w *WUID) buildLayout(step, floor, mask int64, flags int8) *stepLayout {
+	l := &stepLayout{step: step, laneStride: step, floor: floor, mask: mask, flags: flags}
+	if flags&4 != 0 {
+		l.permShift = uint(bits.TrailingZeros64(uint64(step)))
+		l.permKeys = w.permKeys
+	}
+	if w.numShards > 1 {
+		l.laneStride = step * w.numShards
+	}
+	if flags&8 != 0 {
+		l.forkMask, l.forkOffset = step-1, w.forkOffset
+	}
+	l.critical = criticalValue(l.laneStride * (w.maxSkip + 1))
+	l.maxSkip, l.skipKey = w.maxSkip, w.skipKey
+	l.renewMask = RenewIntervalMask
+	if w.checkIDs > 0 {
+		// The check is triggered by crossing a multiple of renewMask+1 in the low bits, which
+		// every lane advances by laneStride per identifier.
+		l.renewMask = 1<<bits.Len64(uint64(w.checkIDs*l.laneStride-1)) - 1
+	}
+	return l
+}
+
+// layout returns the layout in use. The scratch instances of Validate have none stored, so it
+// is built from the fields.
+func (w *WUID) layout() *stepLayout {
+	if l, ok := w.stepLayout.Load().(*stepLayout); ok {
+		return l
+	}
+	return w.newLayout()
+}
+
+// numFingerprintSamples is the number of counter values LayoutFingerprint formats.
+const numFingerprintSamples = 16
+
+// LayoutFingerprint returns a digest of how the counter is turned into identifiers, i.e. the
+// step, the floor, the section, WithObfuscation, WithPermutation, WithTransform and
+// WithChecksum. Two instances with the same fingerprint map the same counter to the same
+// identifier, so one can resume the counter of the other, e.g. from a saved watermark, without
+// any collision. Since the transforms are functions, it is computed from the identifiers of a
+// few sample counters rather than from the options themselves.
+func (w *WUID) LayoutFingerprint() string {
+	l := w.layout()
+	h := fnv.New64a()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(l.step))
+	h.Write(b[:])
+	for i := int64(0); i < numFingerprintSamples; i++ {
+		v1 := w.align(1<<32 | (PanicValue-1)/numFingerprintSamples*i/l.step*l.step + l.step)
+		binary.BigEndian.PutUint64(b[:], uint64(w.formatWith(l, v1)))
+		h.Write(b[:])
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func (w *WUID) Reset(n int64) {
+	if n < 0 && !w.unsigned {
+		panic("n cannot be negative")
+	}
+	if n&L32Mask >= PanicValue {
+		panic("n is too old")
+	}
+	if w.Monolithic && n>>32 > w.MaxH32() {
+		panic(fmt.Errorf("%w: the high bits of %#016x exceed %#x", wuiderr.ErrLowBitsOverflow, n, w.MaxH32()))
+	}
+
+	w.countIssued()
+	oldh32 := w.maxLane() >> 32 & w.MaxH32()
+	if n>>32&w.MaxH32() != oldh32 {
+		w.applyNextStep()
+	}
+	n = w.align(n)
+	w.storeLanes(n)
+
+	atomic.AddInt64(&w.numLoads, 1)
+	atomic.StoreInt64(&w.loadedAt, time.Now().UnixNano())
+	if w.maxh32Age > 0 && w.determined == 0 {
+		w.ageOnce.Do(func() {
+			go w.watchh32Age()
+		})
+	}
+	atomic.StoreInt64(&w.stats.BlockStart, atomic.LoadInt64(&w.N))
+	w.observeh32(n >> 32 & w.MaxH32())
+	if newh32 := n >> 32 & w.MaxH32(); newh32 != oldh32 {
+		w.notifyEpochChange(oldh32, newh32)
+	}
+	if w.mirror != nil && w.determined == 0 {
+		if w.syncBudget > 0 {
+			w.mirrorh32(n >> 32 & w.MaxH32())
+		} else {
+			go w.mirrorh32(n >> 32 & w.MaxH32())
+		}
+	}
+}
+
+// ReconfigureStep changes the step and the floor, just like WithStep, from the next h32 on,
+// so that the numbers already issued under the current h32 cannot be generated again. It
+// lets a running fleet migrate its sharding parameters without a restart. The new step must
+// be compatible with the other options, e.g. WithObfuscation and WithShards.
+func (w *WUID) ReconfigureStep(step, floor int64) error {
+	opt, err := TryWithStep(step, floor)
+	if err != nil {
+		return err
+	}
+	l := w.layout()
+	s := &WUID{
+		Step:            1,
+		Obfuscation:     w.Obfuscation,
+		ObfuscationMask: l.mask,
+		Flags:           l.flags &^ 2,
+		permKeys:        l.permKeys,
+		maxSkip:         w.maxSkip,
+		Monolithic:      w.Monolithic,
+		Section:         w.Section,
+		numShards:       w.numShards,
+		checkIDs:        w.checkIDs,
+		transforms:      w.transforms,
+		checksum:        w.checksum,
+		unsigned:        w.unsigned,
+	}
+	opt(s)
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := s.checkTransforms(); err != nil {
+		return err
+	}
+
+	w.nextStep.Lock()
+	defer w.nextStep.Unlock()
+	if w.forks != nil || w.layout().flags&8 != 0 {
+		return errors.New("the step of a forked generator cannot be reconfigured")
+	}
+	w.nextStep.step, w.nextStep.floor = step, floor
+	return nil
+}
+
+// CurrentStep returns the step and the floor in use, which ReconfigureStep changes from the
+// next h32 on.
+func (w *WUID) CurrentStep() (step, floor int64) {
+	l := w.layout()
+	return l.step, l.floor
+}
+
+// applyNextStep switches to the step set by ReconfigureStep, if any. It is called by Reset
+// when h32 changes.
+func (w *WUID) applyNextStep() {
+	w.nextStep.Lock()
+	step, floor := w.nextStep.step, w.nextStep.floor
+	w.nextStep.step, w.nextStep.floor = 0, 0
+	w.nextStep.Unlock()
+	if step == 0 {
+		return
+	}
+
+	l := w.layout()
+	mask, flags := l.mask, l.flags&^2
+	if floor >= 2 {
+		flags |= 2
+	} else {
+		floor = 0
+	}
+	if w.Obfuscation && floor != 0 {
+		mask |= step - 1
+	}
+	w.stepLayout.Store(w.buildLayout(step, floor, mask, flags))
+	w.Infof("<wuid> the step is reconfigured. name: %s, step: %d, floor: %d", w.Name, step, floor)
+}
+
+// align brands the section ID on n and rounds it up to a multiple of the step.
+func (w *WUID) align(n int64) int64 {
+	if w.Monolithic {
+		// Empty
+	} else {
+		const L60Mask = 0x0FFFFFFFFFFFFFFF
+		n = n&L60Mask | w.Section
+	}
+	if l := w.layout(); l.floor > 1 {
+		if r := n % l.step; r != 0 {
+			n = n - r + l.step
+		}
+	}
+	return n
+}
+
+// ResetOption customizes ResetForward.
+type ResetOption func(*resetOptions)
+
+type resetOptions struct {
+	allowRewind bool
+}
+
+// AllowRewind lets ResetForward move the counter backwards. The identifiers issued since then
+// may be issued again.
+func AllowRewind() ResetOption {
+	return func(o *resetOptions) {
+		o.allowRewind = true
+	}
+}
+
+// ResetForward moves the counter to n, i.e. the next identifier will be the one right after
+// n. Unlike Reset, it returns an error instead of panicking on an invalid n, and it refuses
+// to move the counter backwards unless AllowRewind is passed. Every call is logged as a
+// warning.
+func (w *WUID) ResetForward(n int64, opts ...ResetOption) error {
+	var o resetOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if n < 0 && !w.unsigned {
+		return fmt.Errorf("%w: n cannot be negative", wuiderr.ErrInvalidH32)
+	}
+	if n&L32Mask >= PanicValue {
+		return fmt.Errorf("%w: n is too old", wuiderr.ErrLowBitsExhausted)
+	}
+	if w.Monolithic && n>>32 > w.MaxH32() {
+		return fmt.Errorf("%w: the high bits of %#016x exceed %#x", wuiderr.ErrLowBitsOverflow, n, w.MaxH32())
+	}
+
+	current := w.maxLane()
+	target := w.align(n)
+	behind := target < current
+	if w.unsigned {
+		behind = uint64(target) < uint64(current)
+	}
+	if behind && !o.allowRewind {
+		w.Warnf("<wuid> refused to move the counter backwards. name: %s, current: %#016x, n: %#016x", w.Name, current, n)
+		return fmt.Errorf("%w: %#016x is behind the current counter %#016x", wuiderr.ErrRewind, target, current)
+	}
+
+	w.Warnf("<wuid> the counter is reset manually. name: %s, current: %#016x, n: %#016x", w.Name, current, n)
+	w.Reset(n)
+	return nil
+}
+
+// FastForward moves all the lanes right before the next renewal boundary, so that the next
+// call to Next triggers a renewal. The identifiers skipped are counted as issued.
+func (w *WUID) FastForward() {
+	n := w.maxLane()
+	l := w.layout()
+	stride, mask := l.laneStride, l.renewMask
+	target := (w.threshold(l) + mask) &^ mask
+	if n&L32Mask+stride > target {
+		target = (n&L32Mask + stride + mask) &^ mask
+	}
+	if target >= PanicValue {
+		return
+	}
+	w.storeLanes(n&^L32Mask | (target - stride))
+}
+
+// Exhaust makes Next panic from now on, and returns the counter of the fastest lane before
+// the exhaustion, which is the watermark of the identifiers issued so far.
+func (w *WUID) Exhaust() int64 {
+	var watermark int64
+	for i := len(w.shards); i >= 0; i-- {
+		p := w.lane(i)
+		for {
+			old := atomic.LoadInt64(p)
+			if atomic.CompareAndSwapInt64(p, old, old&^L32Mask|PanicValue) {
+				if i == len(w.shards) || old&L32Mask > watermark&L32Mask {
+					watermark = old
+				}
+				break
+			}
+		}
+	}
+	return watermark
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"log"
+)
+
+type dumbLogger struct{}
+
+func (dumbLogger) Infof(format string, args ...interface{}) {}
+func (dumbLogger) Warnf(format string, args ...interface{}) {}
+
+type stdLogger struct{}
+
+func (stdLogger) Infof(format string, args ...interface{}) {
+	log.Printf("INFO "+format, args...)
+}
+
+func (stdLogger) Warnf(format string, args ...interface{}) {
+	log.Printf("WARN "+format, args...)
+}
+
+// defaultLogger returns the logger of the generators created with a nil Logger, which logs
+// with the standard log package if verbose is true, and discards everything otherwise.
+func defaultLogger(verbose bool) Logger {
+	if verbose {
+		return stdLogger{}
+	}
+	return dumbLogger{}
+}
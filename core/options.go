@@ -0,0 +1,559 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// ApplyOptions changes the tunables of a live instance: WithRenewTimeout, WithReadyTimeout,
+// WithRateLimit, WithQuietRenewals, WithLogSampling and WithH32ExhaustionAlarm. Any other
+// option, e.g. WithStep or WithSection, would change the numbers being generated, so it is
+// rejected, and nothing is applied.
+func (w *WUID) ApplyOptions(opts ...Option) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid options: %v", r)
+		}
+	}()
+	s := &WUID{Step: 1, Monolithic: true}
+	for _, opt := range opts {
+		if opt == nil {
+			return errors.New("opt cannot be nil")
+		}
+		opt(s)
+	}
+
+	limiter := s.limiter.Load()
+	renewTimeout, readyTimeout := s.renewTimeout, s.readyTimeout
+	quietRenewals, logSampling := s.quietRenewals, s.logSampling
+	threshold, alarm := s.exhaustionThreshold, s.exhaustionAlarm
+	s.limiter = atomic.Value{}
+	s.renewTimeout, s.readyTimeout = 0, 0
+	s.quietRenewals, s.logSampling = false, 0
+	s.exhaustionThreshold, s.exhaustionAlarm = 0, nil
+	if !reflect.DeepEqual(s, &WUID{Step: 1, Monolithic: true}) {
+		return errors.New("only WithRenewTimeout, WithReadyTimeout, WithRateLimit, WithQuietRenewals, " +
+			"WithLogSampling and WithH32ExhaustionAlarm can be applied to a live instance")
+	}
+
+	w.tuneMu.Lock()
+	defer w.tuneMu.Unlock()
+	if renewTimeout > 0 {
+		w.renewTimeout = renewTimeout
+	}
+	if readyTimeout > 0 {
+		w.readyTimeout = readyTimeout
+	}
+	if quietRenewals {
+		w.quietRenewals = true
+	}
+	if logSampling > 0 {
+		w.logSampling = logSampling
+	}
+	if alarm != nil {
+		w.exhaustionThreshold, w.exhaustionAlarm = threshold, alarm
+	}
+	if limiter != nil {
+		w.limiter.Store(limiter)
+	}
+	w.Infof("<wuid> options applied. name: %s", w.Name)
+	return nil
+}
+
+type Option func(w *WUID)
+
+// H32Verifier verifies the h32 loaded by a generator. section is the one set by WithSection,
+// or 0. A verifier shared by many generators can apply a policy to each of them by its name,
+// e.g. the ranges reserved for an environment.
+type H32Verifier interface {
+	Verifyh32(name string, section int64, h32 int64) error
+}
+
+// H32VerifierFunc is an adapter to allow the use of an ordinary function as an H32Verifier.
+type H32VerifierFunc func(name string, section int64, h32 int64) error
+
+// Verifyh32 calls f(name, section, h32).
+func (f H32VerifierFunc) Verifyh32(name string, section int64, h32 int64) error {
+	return f(name, section, h32)
+}
+
+func Withh32Verifier(cb func(h32 int64) error) Option {
+	if cb == nil {
+		return WithVerifier(nil)
+	}
+	return WithVerifier(H32VerifierFunc(func(_ string, _ int64, h32 int64) error {
+		return cb(h32)
+	}))
+}
+
+func WithVerifier(v H32Verifier) Option {
+	return func(w *WUID) {
+		w.h32Verifier = v
+	}
+}
+
+func WithSequenceAllocator(a SequenceAllocator, blockSize int64) Option {
+	if a == nil {
+		panic("a cannot be nil")
+	}
+	if blockSize < 1 {
+		panic("blockSize must be positive")
+	}
+	return func(w *WUID) {
+		w.seqAllocator = a
+		w.seqBlockSize = blockSize
+	}
+}
+
+func WithReservedH32Ranges(ranges ...[2]int64) Option {
+	for _, rng := range ranges {
+		if rng[0] < 1 || rng[0] > rng[1] {
+			panic(fmt.Sprintf("invalid reserved range: [%d, %d]", rng[0], rng[1]))
+		}
+	}
+	ranges = append([][2]int64(nil), ranges...)
+	return func(w *WUID) {
+		w.reserved = append(w.reserved, ranges...)
+	}
+}
+
+func WithRegistry(r Registry) Option {
+	if r == nil {
+		panic("r cannot be nil")
+	}
+	return func(w *WUID) {
+		w.registry = r
+	}
+}
+
+func WithH32ExhaustionAlarm(threshold float64, cb func(est ExhaustionEstimate)) Option {
+	if threshold <= 0 || threshold > 1 {
+		panic("threshold must be in between (0, 1]")
+	}
+	if cb == nil {
+		panic("cb cannot be nil")
+	}
+	return func(w *WUID) {
+		w.exhaustionThreshold = threshold
+		w.exhaustionAlarm = cb
+	}
+}
+
+func WithVerboseLogging() Option {
+	return func(w *WUID) {
+		w.verbose = true
+	}
+}
+
+func WithQuietRenewals() Option {
+	return func(w *WUID) {
+		w.quietRenewals = true
+	}
+}
+
+func WithLogSampling(n int) Option {
+	if n < 1 {
+		panic("n must be positive")
+	}
+	return func(w *WUID) {
+		w.logSampling = int64(n)
+	}
+}
+
+func WithDeterministic(seed int64) Option {
+	if seed <= 0 {
+		panic("seed must be positive")
+	}
+	return func(w *WUID) {
+		w.determined = seed
+	}
+}
+
+func WithMaxH32Age(d time.Duration) Option {
+	if d <= 0 {
+		panic("d must be positive")
+	}
+	return func(w *WUID) {
+		w.maxh32Age = d
+		w.stop = make(chan struct{})
+	}
+}
+
+func WithDuplicateGuard(window int) Option {
+	if window < 1 {
+		panic("window must be positive")
+	}
+	return func(w *WUID) {
+		w.guard = &duplicateGuard{
+			ring: make([]int64, window),
+			seen: make(map[int64]struct{}, window),
+		}
+	}
+}
+
+func WithDuplicateCallback(cb func(id int64)) Option {
+	if cb == nil {
+		panic("cb cannot be nil")
+	}
+	return func(w *WUID) {
+		w.onDuplicate = cb
+	}
+}
+
+func WithChecksum(mod int) Option {
+	if mod != 10 {
+		panic("mod must be 10")
+	}
+	return func(w *WUID) {
+		w.checksum = true
+	}
+}
+
+// WithSigningKey sets the HMAC key of NextSigned and VerifySigned, which should be at least
+// 32 random bytes and kept secret.
+func WithSigningKey(key []byte) Option {
+	if len(key) == 0 {
+		panic("key cannot be empty")
+	}
+	key = append([]byte(nil), key...)
+	return func(w *WUID) {
+		w.signingKey = key
+	}
+}
+
+// WithResumePreviousBlock makes the first load take the block parked by a generator shut down
+// with Shutdown, if the data source implements Parker and the layout is the same, and continue
+// from ResumeGap above its watermark, rather than consuming a new h32. It extends the lifetime
+// of the counter for the services that are redeployed often but barely use their blocks.
+// Only the blocks parked by Shutdown are resumed, so a crash never leads to a duplicate, and
+// each block is resumed by a single generator.
+func WithResumePreviousBlock() Option {
+	return func(w *WUID) {
+		w.resumePrevious = true
+	}
+}
+
+// WithFaultInjector injects the faults decided by fi into the loads from the data source, the
+// first one included, e.g. timeouts, lost replies and duplicated increments, so that the
+// alerting and the fallbacks of an application can be tested without breaking the data
+// source. Every fault injected is logged as a warning. It is meant for tests only.
+func WithFaultInjector(fi FaultInjector) Option {
+	if fi == nil {
+		panic("fi cannot be nil")
+	}
+	return func(w *WUID) {
+		w.faultInjector = fi
+	}
+}
+
+func WithTransform(f func(int64) int64) Option {
+	if f == nil {
+		panic("f cannot be nil")
+	}
+	return func(w *WUID) {
+		w.transforms = append(w.transforms, f)
+	}
+}
+
+func WithRateLimit(perSecond int) Option {
+	if perSecond <= 0 {
+		panic("perSecond must be positive")
+	}
+	return func(w *WUID) {
+		w.limiter.Store(newRateLimiter(perSecond))
+	}
+}
+
+func WithReadyTimeout(d time.Duration) Option {
+	if d <= 0 {
+		panic("d must be positive")
+	}
+	return func(w *WUID) {
+		w.readyTimeout = d
+	}
+}
+
+func WithMirror(m Mirror) Option {
+	if m == nil {
+		panic("m cannot be nil")
+	}
+	return func(w *WUID) {
+		w.mirror = m
+	}
+}
+
+func WithInstanceFingerprint() Option {
+	return func(w *WUID) {
+		w.fingerprint = true
+	}
+}
+
+func WithRenewExecutor(submit func(task func())) Option {
+	if submit == nil {
+		panic("submit cannot be nil")
+	}
+	return func(w *WUID) {
+		w.renewExecutor = submit
+	}
+}
+
+func WithSynchronousRenew(budget time.Duration) Option {
+	if budget <= 0 {
+		panic("budget must be positive")
+	}
+	return func(w *WUID) {
+		w.syncBudget = budget
+	}
+}
+
+func WithRenewCheckInterval(ids int64) Option {
+	if ids <= 0 {
+		panic("ids must be positive")
+	}
+	return func(w *WUID) {
+		w.checkIDs = ids
+	}
+}
+
+func WithRenewTimeout(d time.Duration) Option {
+	if d <= 0 {
+		panic("d must be positive")
+	}
+	return func(w *WUID) {
+		w.renewTimeout = d
+	}
+}
+
+// WithRandomSkip leaves a random gap of up to maxSkip steps before every number, so that
+// the volume of the orders cannot be estimated from the differences between identifiers.
+// The numbers are still unique, but an h32 holds fewer of them, so the renewal becomes due
+// earlier and the h32 space is consumed faster. The step multiplied by maxSkip+1 should not
+// exceed MaxStep. The statistics count the skipped numbers as issued.
+func WithRandomSkip(maxSkip int64) Option {
+	if maxSkip < 1 || maxSkip >= MaxStep {
+		panic(fmt.Errorf("maxSkip must be in between [1, %d)", MaxStep))
+	}
+	return func(w *WUID) {
+		w.maxSkip = maxSkip
+	}
+}
+
+func WithShards(n int) Option {
+	if n < 1 || n > 256 {
+		panic("n must be in between [1, 256]")
+	}
+	return func(w *WUID) {
+		w.numShards = int64(n)
+	}
+}
+
+func WithSection(section int8) Option {
+	opt, err := TryWithSection(section)
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
+
+func TryWithSection(section int8) (Option, error) {
+	if section < 0 || section > 7 {
+		return nil, errors.New("section must be in between [0, 7]")
+	}
+	return func(w *WUID) {
+		w.Monolithic = false
+		w.Section = int64(section) << 60
+	}, nil
+}
+
+// SectionID is the section branded on the numbers by WithSection, e.g. the datacenter that
+// generated them. Declare the sections of a deployment as constants of this type, so that the
+// mapping is written down once:
+//
+//	const (
+//		USEast wuid.SectionID = 1
+//		EUWest wuid.SectionID = 2
+//	)
+type SectionID int8
+
+const (
+	// NoSection is the section of the numbers generated without WithSection.
+	NoSection SectionID = 0
+	// MaxSectionID is the greatest section.
+	MaxSectionID SectionID = 7
+)
+
+// WithSectionID is like WithSection, but takes a SectionID.
+func WithSectionID(section SectionID) Option {
+	return WithSection(int8(section))
+}
+
+// SectionOf returns the section branded on id by WithSection, or NoSection for the numbers
+// generated without it. It is meaningless for the numbers generated with WithUint64.
+func SectionOf(id int64) SectionID {
+	return SectionID(id >> 60 & 7)
+}
+
+// WithUint64 lets the high bits take all the 32 bits above the low ones, the sign bit
+// included, for the systems storing identifiers as unsigned 64-bit integers, e.g. BIGINT
+// UNSIGNED of MySQL. It raises the h32 limit from 0x1FFFFF to 0xFFFFFFFF, and the identifiers
+// from the h32 of 0x80000000 on are negative as int64, so they should be taken with NextUint64
+// or converted with ToUint64. NextString and the other decimal forms print them unsigned. It
+// cannot be combined with WithSection, WithChecksum, WithTransform or a floor.
+func WithUint64() Option {
+	return func(w *WUID) {
+		w.unsigned = true
+	}
+}
+
+func WithStep(step int64, floor int64) Option {
+	opt, err := TryWithStep(step, floor)
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
+
+func TryWithStep(step int64, floor int64) (Option, error) {
+	if step < 1 || step > MaxStep {
+		return nil, fmt.Errorf("the step must be in between [1, %d]", MaxStep)
+	}
+	if floor != 0 && (floor < 0 || floor >= step) {
+		return nil, fmt.Errorf("floor must be in between [0, %d)", step)
+	}
+	return func(w *WUID) {
+		if w.Step != 1 {
+			panic("a second WithStep detected")
+		}
+		w.Step = step
+		if floor >= 2 {
+			w.Floor = floor
+			w.Flags |= 2
+		}
+	}, nil
+}
+
+func WithObfuscation(seed int) Option {
+	opt, err := TryWithObfuscation(seed)
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
+
+func TryWithObfuscation(seed int) (Option, error) {
+	if seed == 0 {
+		return nil, errors.New("seed cannot be zero")
+	}
+	return func(w *WUID) {
+		w.Obfuscation = true
+		x := uint64(seed)
+		x = (x ^ (x >> 30)) * uint64(0xbf58476d1ce4e5b9)
+		x = (x ^ (x >> 27)) * uint64(0x94d049bb133111eb)
+		x = (x ^ (x >> 31)) & 0x7FFFFFFFFFFFFFFF
+		w.ObfuscationMask = int64(x)
+		w.Flags |= 1
+	}, nil
+}
+
+// WithPermutation applies a keyed permutation to the step blocks of the low 32 bits, so that
+// the numbers issued one after another no longer tell how many were issued in between. The
+// mask of WithObfuscation keeps the distance between two numbers of the same block sequence
+// recognizable, e.g. with WithStep(1024, floor), while the permutation spreads them over the
+// whole low space. The bits below the step, which the floor works on, are not permuted, so
+// the numbers stay unique and aligned to the floor. It can be combined with WithObfuscation,
+// and the step must be a power of 2. It is not meant to be cryptographically secure.
+func WithPermutation(seed int) Option {
+	opt, err := TryWithPermutation(seed)
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
+
+func TryWithPermutation(seed int) (Option, error) {
+	if seed == 0 {
+		return nil, errors.New("seed cannot be zero")
+	}
+	return func(w *WUID) {
+		x := uint64(seed)
+		for i := range w.permKeys {
+			x += 0x9e3779b97f4a7c15
+			z := x
+			z = (z ^ (z >> 30)) * uint64(0xbf58476d1ce4e5b9)
+			z = (z ^ (z >> 27)) * uint64(0x94d049bb133111eb)
+			w.permKeys[i] = z ^ (z >> 31)
+		}
+		w.Flags |= 4
+	}, nil
+}
+
+// Validate applies opts to a scratch WUID and reports the conflicts between them, e.g. a
+// second WithStep, as an error instead of a panic.
+func Validate(opts ...Option) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid options: %v", r)
+		}
+	}()
+	w := &WUID{Step: 1, Monolithic: true}
+	for _, opt := range opts {
+		if opt == nil {
+			return errors.New("opt cannot be nil")
+		}
+		opt(w)
+	}
+	if err := w.check(); err != nil {
+		return err
+	}
+	return w.checkTransforms()
+}
+
+func (w *WUID) check() error {
+	// The obfuscation keeps the numbers distinct after flooring only when the step is a power of 2.
+	if w.Obfuscation && w.Floor != 0 && w.Step&(w.Step-1) != 0 {
+		return errors.New("obfuscation with a floor requires the step to be a power of 2")
+	}
+	if w.Flags&4 != 0 && w.Step&(w.Step-1) != 0 {
+		return errors.New("WithPermutation requires the step to be a power of 2")
+	}
+	if w.checkIDs > 0 {
+		stride := w.Step
+		if w.numShards > 1 {
+			stride *= w.numShards
+		}
+		if w.checkIDs > (PanicValue-criticalValue(stride))/stride {
+			return errors.New("the renew check interval multiplied by the step is too large to trigger a renewal before the low bits run out")
+		}
+	}
+	if w.numShards > 1 && w.Step*w.numShards > MaxStep {
+		return fmt.Errorf("the step multiplied by the number of shards should not exceed %d", MaxStep)
+	}
+	if w.maxSkip > 0 {
+		stride := w.Step
+		if w.numShards > 1 {
+			stride *= w.numShards
+		}
+		if stride*(w.maxSkip+1) > MaxStep {
+			return fmt.Errorf("the step multiplied by maxSkip+1 should not exceed %d", MaxStep)
+		}
+	}
+	if w.syncBudget > 0 && (w.maxh32Age > 0 || w.renewExecutor != nil) {
+		return errors.New("WithSynchronousRenew cannot be combined with WithMaxH32Age or WithRenewExecutor")
+	}
+	if w.determined > w.MaxH32() {
+		return fmt.Errorf("the seed of WithDeterministic should not exceed %d", w.MaxH32())
+	}
+	if w.unsigned && (!w.Monolithic || w.checksum || len(w.transforms) > 0 || w.Floor != 0) {
+		return errors.New("WithUint64 cannot be combined with WithSection, WithChecksum, WithTransform or a floor")
+	}
+	if w.checksum && !w.Monolithic {
+		return errors.New("WithChecksum cannot be combined with WithSection, which leaves no room for the check digit")
+	}
+	if w.onDuplicate != nil && w.guard == nil {
+		return errors.New("WithDuplicateCallback requires WithDuplicateGuard")
+	}
+	return nil
+}
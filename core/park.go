@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// ResumeGap is the number of low values skipped above the watermark of a block resumed by
+// WithResumePreviousBlock.
+const ResumeGap = MaxStep
+
+// ParkedBlock is the h32 of a generator shut down by Shutdown, together with the watermark of
+// the identifiers it issued and its LayoutFingerprint.
+type ParkedBlock struct {
+	H32         int64
+	Low         int64
+	Fingerprint string
+}
+
+// Parker is implemented by the Renewers that can keep the blocks of the generators shut down
+// in the data source, for WithResumePreviousBlock.
+type Parker interface {
+	// Park saves b for the next generator starting with the same layout.
+	Park(ctx context.Context, b ParkedBlock) error
+	// Unpark takes a block parked with fingerprint, so that no other generator can take it,
+	// and returns false if there is none.
+	Unpark(ctx context.Context, fingerprint string) (ParkedBlock, bool, error)
+}
+
+// Shutdown stops the background renewal and makes Next panic from now on. With
+// WithResumePreviousBlock, it also parks the current h32 with its watermark in the data
+// source, so that the next generator starting with the same layout continues from there
+// rather than consuming a new h32. It returns an error if the data source cannot park it.
+func (w *WUID) Shutdown(ctx context.Context) error {
+	w.Stop()
+	r := w.Renewer()
+	if r == nil {
+		return nil
+	}
+	watermark := w.Exhaust()
+	if !w.resumePrevious {
+		return nil
+	}
+	p, ok := r.(Parker)
+	if !ok {
+		return errors.New("the data source cannot park the block")
+	}
+	w.nextStep.Lock()
+	forked := w.forks != nil || w.forkOffset != 0
+	w.nextStep.Unlock()
+	if forked {
+		return errors.New("the block of a forked generator cannot be parked")
+	}
+	low := watermark & L32Mask
+	if low+ResumeGap >= w.RenewalThreshold() {
+		return nil
+	}
+	b := ParkedBlock{
+		H32:         watermark >> 32 & w.MaxH32(),
+		Low:         low,
+		Fingerprint: w.LayoutFingerprint(),
+	}
+	if err := p.Park(ctx, b); err != nil {
+		return err
+	}
+	w.Infof("<wuid> the block is parked. name: %s, h32: %d, watermark: %d", w.Name, b.H32, b.Low)
+	return nil
+}
+
+// resume loads a block parked by a generator with the same layout, and reports whether it
+// did. A failure is logged and left to the usual load.
+func (w *WUID) resume(ctx context.Context, r Renewer) bool {
+	p, ok := r.(Parker)
+	if !ok || w.Renewer() != nil {
+		return false
+	}
+	b, ok, err := p.Unpark(ctx, w.LayoutFingerprint())
+	if err != nil {
+		w.Warnf("<wuid> failed to resume the previous block. name: %s, reason: %s", w.Name, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	low := b.Low + ResumeGap
+	if low >= w.RenewalThreshold() || low < ResumeGap {
+		return false
+	}
+	if err := w.Verifyh32(b.H32); err != nil {
+		w.Warnf("<wuid> the previous block cannot be resumed. name: %s, h32: %d, reason: %s", w.Name, b.H32, err)
+		return false
+	}
+	if err := w.applyVerified(b.H32, low, r); err != nil {
+		return false
+	}
+	return true
+}
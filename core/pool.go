@@ -0,0 +1,46 @@
+package core
+
+// Pool is a block of identifiers reserved up front by Reserve, for the latency-critical paths
+// that cannot afford to wait for a renewal or to contend with other goroutines, e.g. the frame
+// loop of a game server. Get touches nothing shared, so a Pool belongs to one goroutine and is
+// not safe for concurrent use.
+type Pool struct {
+	ids []int64
+	i   int
+}
+
+// Get returns the next identifier of the pool, and false once the pool is used up.
+func (p *Pool) Get() (int64, bool) {
+	if p.i >= len(p.ids) {
+		return 0, false
+	}
+	id := p.ids[p.i]
+	p.i++
+	return id, true
+}
+
+// Len returns the number of identifiers left in the pool.
+func (p *Pool) Len() int {
+	return len(p.ids) - p.i
+}
+
+// Reserve takes n identifiers right away and returns them as a Pool. They are reserved with
+// NextN, in as few atomic operations as the step allows, so Reserve itself may wait for a
+// renewal, but Get of the pool never does. The identifiers left unused are lost, which leaves
+// gaps but never duplicates.
+func (w *WUID) Reserve(n int) *Pool {
+	if n < 1 {
+		panic("n must be positive")
+	}
+	ids := make([]int64, n)
+	for i := 0; i < n; {
+		l := w.layout()
+		end := i + int(MaxStep/(l.laneStride*(l.maxSkip+1)))
+		if end > n {
+			end = n
+		}
+		w.NextN(ids[i:end])
+		i = end
+	}
+	return &Pool{ids: ids}
+}
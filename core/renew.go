@@ -0,0 +1,485 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// triggerRenew renews h32 in the background, with the executor set by WithRenewExecutor if
+// there is one.
+func (w *WUID) triggerRenew() {
+	if w.determined != 0 {
+		return
+	}
+	// At most one renewal is in flight. The callers crossing the later boundaries while it is
+	// running do not start another one against the backend.
+	if !atomic.CompareAndSwapInt32(&w.renewing, 0, 1) {
+		return
+	}
+	task := func() {
+		defer atomic.StoreInt32(&w.renewing, 0)
+		renewImpl(w)
+	}
+	switch {
+	case w.renewExecutor != nil:
+		w.renewExecutor(task)
+	case w.syncBudget > 0:
+		// Only the caller crossing the boundary pays for the renewal, while the others keep
+		// going. A failed renewal is retried by the caller crossing the next boundary.
+		task()
+	default:
+		go task()
+	}
+}
+
+func renewImpl(w *WUID) {
+	defer func() {
+		atomic.AddInt64(&w.stats.NumRenewAttempts, 1)
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			w.Warnf("<wuid> panic, renew failed. name: %s, reason: %+v", w.Name, r)
+			w.recordRenewal(fmt.Errorf("panic: %+v", r))
+		}
+	}()
+
+	err := w.renew()
+	if err != nil {
+		w.Warnf("<wuid> renew failed. name: %s, reason: %+v", w.Name, err)
+	} else {
+		w.Renewalf("<wuid> renew succeeded. name: %s", w.Name)
+	}
+	w.recordRenewal(err)
+}
+
+// watchh32Age renews h32 whenever it gets older than maxh32Age, which also verifies that the
+// backend is still reachable. A failed renewal is retried after min(maxh32Age, 1 minute). It
+// shares the gate of triggerRenew, so it skips its turn while another renewal is in flight.
+func (w *WUID) watchh32Age() {
+	retryInterval := w.maxh32Age
+	if retryInterval > time.Minute {
+		retryInterval = time.Minute
+	}
+	for {
+		loadedAt := atomic.LoadInt64(&w.loadedAt)
+		wait := time.Until(time.Unix(0, loadedAt).Add(w.maxh32Age))
+		if wait <= 0 {
+			if atomic.CompareAndSwapInt32(&w.renewing, 0, 1) {
+				w.Infof("<wuid> h32 is too old, renew it. name: %s", w.Name)
+				renewImpl(w)
+				atomic.StoreInt32(&w.renewing, 0)
+			}
+			if atomic.LoadInt64(&w.loadedAt) != loadedAt {
+				continue
+			}
+			wait = retryInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-w.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop stops the background renewal started by WithMaxH32Age, and releases the registration
+// made by Interlock.
+func (w *WUID) Stop() {
+	w.releaseInterlock()
+	if w.stop == nil {
+		return
+	}
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Renewalf logs an informational line about loading h32. The first load is always logged,
+// while the following ones are subject to WithQuietRenewals and WithLogSampling.
+func (w *WUID) Renewalf(format string, args ...interface{}) {
+	k := atomic.LoadInt64(&w.numLoads)
+	if k > 1 {
+		w.tuneMu.RLock()
+		quiet, sampling := w.quietRenewals, w.logSampling
+		w.tuneMu.RUnlock()
+		if quiet {
+			return
+		}
+		if sampling > 1 && (k-1)%sampling != 0 {
+			return
+		}
+	}
+	w.Infof(format, args...)
+}
+
+func (w *WUID) recordRenewal(err error) {
+	if err != nil {
+		atomic.AddInt64(&w.stats.NumRenewFailed, 1)
+	} else {
+		atomic.AddInt64(&w.stats.NumRenewed, 1)
+	}
+	w.stats.Lock()
+	w.stats.LastRenewTime = time.Now()
+	w.stats.LastRenewError = err
+	w.stats.Unlock()
+}
+
+func (w *WUID) RenewNow() error {
+	if err := w.renew(); err != nil {
+		return &wuiderr.ErrRenewFailed{Cause: err}
+	}
+	return nil
+}
+
+func (w *WUID) renew() error {
+	w.Lock()
+	r := w.renewer
+	w.Unlock()
+	if r == nil {
+		return errors.New("nothing has been loaded")
+	}
+	return w.Load(context.Background(), r)
+}
+
+// Renewer fetches a new h32 from a data source, e.g. by increasing a counter. It does not
+// verify or apply h32, which is done by the core.
+type Renewer interface {
+	Renew(ctx context.Context) (h32 int64, err error)
+}
+
+// RenewerFunc is an adapter to allow the use of an ordinary function as a Renewer.
+type RenewerFunc func(ctx context.Context) (h32 int64, err error)
+
+// Renew calls f(ctx).
+func (f RenewerFunc) Renew(ctx context.Context) (int64, error) {
+	return f(ctx)
+}
+
+// Resumer is implemented by the Renewers that hand out an h32 used before, together with the
+// low 32 bits consumed so far, e.g. the slots of the session mode of etcd. Load calls Resume
+// instead of Renew, and the counter resumes from low rather than from 0.
+type Resumer interface {
+	Resume(ctx context.Context) (h32 int64, low int64, err error)
+}
+
+// VerifyingRenewer is implemented by the Renewers that can try another h32 when one is
+// rejected, e.g. by retrying a callback or falling back to another source. Load calls
+// RenewVerified instead of Renew, with verify doing the checks Load would do afterwards, and
+// does not verify the returned h32 again.
+type VerifyingRenewer interface {
+	RenewVerified(ctx context.Context, verify func(h32 int64) error) (h32 int64, err error)
+}
+
+// Load fetches h32 with r, verifies it and makes it the high bits. r is saved for the renewals
+// unless a Renewer has been saved already. ctx is further bound to the renewal timeout set by
+// WithRenewTimeout, and so is every renewal. If r implements sync.Locker, it is locked from the
+// fetch through the reset of the counter, e.g. to keep the state of the data source in step.
+func (w *WUID) Load(ctx context.Context, r Renewer) error {
+	ctx, cancel := context.WithTimeout(ctx, w.RenewTimeout())
+	defer cancel()
+	if l, ok := r.(sync.Locker); ok {
+		l.Lock()
+		defer l.Unlock()
+	}
+	if w.resumePrevious && w.resume(ctx, r) {
+		return nil
+	}
+	var h32, low int64
+	var err error
+	startTime := time.Now()
+	h32, low, err = w.fetchWithFault(ctx, func() (h32, low int64, err error) {
+		switch rr := r.(type) {
+		case Resumer:
+			h32, low, err = rr.Resume(ctx)
+		case VerifyingRenewer:
+			h32, err = rr.RenewVerified(ctx, w.Verifyh32)
+		default:
+			h32, err = r.Renew(ctx)
+		}
+		return h32, low, err
+	})
+	w.observeLatency(time.Since(startTime))
+	if err != nil {
+		return err
+	}
+	switch r.(type) {
+	case Resumer:
+	case VerifyingRenewer:
+		return w.applyVerified(h32, low, r)
+	default:
+		if h32, err = w.skipReserved(ctx, r, h32); err != nil {
+			return err
+		}
+	}
+	return w.apply(h32, low, r)
+}
+
+// Raiser is implemented by the Renewers that can raise the counter in the data source. Load
+// uses it to skip a range reserved by WithReservedH32Ranges at once rather than one by one.
+type Raiser interface {
+	// Raise raises the counter to h32 unless it is greater already, so that the next call to
+	// Renew returns a greater h32.
+	Raise(ctx context.Context, h32 int64) error
+}
+
+// skipReserved fetches h32 with r again until it is out of the reserved ranges.
+func (w *WUID) skipReserved(ctx context.Context, r Renewer, h32 int64) (int64, error) {
+	for {
+		rng, ok := w.ReservedRange(h32)
+		if !ok {
+			return h32, nil
+		}
+		w.Warnf("<wuid> h32 %d is reserved, skipping [%d, %d]. name: %s", h32, rng[0], rng[1], w.Name)
+		if ra, ok := r.(Raiser); ok {
+			if err := ra.Raise(ctx, rng[1]); err != nil {
+				return 0, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("failed to skip the reserved range [%d, %d]: %w", rng[0], rng[1], err)
+		}
+		var err error
+		if h32, err = r.Renew(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ReservedRange returns the range set by WithReservedH32Ranges that h32 falls in.
+func (w *WUID) ReservedRange(h32 int64) ([2]int64, bool) {
+	for _, rng := range w.reserved {
+		if rng[0] <= h32 && h32 <= rng[1] {
+			return rng, true
+		}
+	}
+	return [2]int64{}, false
+}
+
+// Apply is like Load but uses the h32 fetched already, e.g. together with the ones of other
+// generators. r is saved for the renewals unless a Renewer has been saved already. If h32 is
+// reserved, it falls back to Load with ctx.
+func (w *WUID) Apply(ctx context.Context, h32 int64, r Renewer) error {
+	if _, ok := w.ReservedRange(h32); ok {
+		return w.Load(ctx, r)
+	}
+	return w.apply(h32, 0, r)
+}
+
+func (w *WUID) apply(h32, low int64, r Renewer) error {
+	if err := w.Verifyh32(h32); err != nil {
+		return err
+	}
+	return w.applyVerified(h32, low, r)
+}
+
+// applyVerified is apply without the verification, which the caller has done.
+func (w *WUID) applyVerified(h32, low int64, r Renewer) error {
+	w.Reset(h32<<32 | low)
+	if low != 0 {
+		w.Renewalf("<wuid> new h32: %d. name: %s, watermark: %d", h32, w.Name, low)
+	} else {
+		w.Renewalf("<wuid> new h32: %d. name: %s", h32, w.Name)
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	if w.renewer == nil {
+		w.renewer = r
+	}
+	return nil
+}
+
+// Renewer returns the Renewer saved by Load, or nil if nothing has been loaded.
+func (w *WUID) Renewer() Renewer {
+	w.Lock()
+	defer w.Unlock()
+	return w.renewer
+}
+
+// Mirror is a secondary store of h32, which lets the backend be recovered from a safe value
+// after a disaster. Store should keep the greatest value ever stored.
+type Mirror interface {
+	Store(ctx context.Context, h32 int64) error
+	Load(ctx context.Context) (int64, error)
+}
+
+// mirrorh32 saves h32 to the mirror unless a greater value has been saved.
+func (w *WUID) mirrorh32(h32 int64) {
+	w.mirrorMu.Lock()
+	defer w.mirrorMu.Unlock()
+	if h32 <= w.mirrored {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.RenewTimeout())
+	defer cancel()
+	if err := w.mirror.Store(ctx, h32); err != nil {
+		w.Warnf("<wuid> failed to mirror h32. name: %s, h32: %d, reason: %+v", w.Name, h32, err)
+		return
+	}
+	w.mirrored = h32
+}
+
+// LoadMirror returns the h32 saved in the mirror set by WithMirror.
+func (w *WUID) LoadMirror() (int64, error) {
+	if w.mirror == nil {
+		return 0, errors.New("no mirror is set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.RenewTimeout())
+	defer cancel()
+	return w.mirror.Load(ctx)
+}
+
+// RenewalThreshold returns the value of the low bits from which a renewal is due. It is
+// CriticalValue, unless the step is so large that the renewal has to start earlier to leave
+// MinRenewHeadroom identifiers before Next panics, or the backend is so slow that the renewal
+// has to start earlier to finish before the low bits run out at the current issuance rate.
+func (w *WUID) RenewalThreshold() int64 {
+	return w.threshold(w.layout())
+}
+
+// threshold returns the renewal threshold, which adaptThreshold may have moved earlier than
+// l.critical.
+func (w *WUID) threshold(l *stepLayout) int64 {
+	if c := atomic.LoadInt64(&w.adaptiveCritical); c > 0 && c < l.critical {
+		return c
+	}
+	return l.critical
+}
+
+// RenewMargin is the number of times the p99 latency of the backend the low bits left after the
+// renewal threshold should last at the current issuance rate, which covers a few attempts of a
+// slow renewal.
+const RenewMargin = 4
+
+// adaptThreshold moves the renewal threshold earlier when the low bits left after it would
+// not last for RenewMargin times the p99 latency of the backend at the current issuance
+// rate. Like criticalValue, it never moves below half of PanicValue.
+func (w *WUID) adaptThreshold() {
+	rate := math.Float64frombits(atomic.LoadUint64(&w.rates.rate))
+	p99 := time.Duration(atomic.LoadInt64(&w.latency.p99))
+	l := w.layout()
+	c := l.critical
+	// The lanes share the rate, so the low bits of each lane are consumed at rate*step.
+	headroom := rate * p99.Seconds() * RenewMargin * float64(l.step*(l.maxSkip+1))
+	if headroom > float64(PanicValue-c) {
+		c = (PanicValue - int64(headroom)) &^ 1023
+		if half := (PanicValue/2 + 1023) &^ 1023; c < half {
+			c = half
+		}
+	}
+	atomic.StoreInt64(&w.adaptiveCritical, c)
+}
+
+// Loadh32Async calls load in a new goroutine and returns a channel receiving its result.
+// Until load succeeds for the first time, Next blocks for at most the ready timeout, and
+// panics with wuiderr.ErrNotReady if it is still not done. A failed load can be retried by
+// calling Loadh32Async again.
+func (w *WUID) Loadh32Async(load func() error) <-chan error {
+	w.Lock()
+	if w.ready == nil {
+		w.ready = make(chan struct{})
+		atomic.StoreInt32(&w.loading, 1)
+	}
+	w.Unlock()
+
+	ch := make(chan error, 1)
+	go func() {
+		err := load()
+		if err == nil {
+			w.readyOnce.Do(func() {
+				atomic.StoreInt32(&w.loading, 0)
+				close(w.ready)
+			})
+		}
+		ch <- err
+		close(ch)
+	}()
+	return ch
+}
+
+func (w *WUID) waitReady() {
+	w.Lock()
+	ready := w.ready
+	w.Unlock()
+
+	timer := time.NewTimer(w.ReadyTimeout())
+	defer timer.Stop()
+	select {
+	case <-ready:
+	case <-timer.C:
+		panic(wuiderr.ErrNotReady)
+	}
+}
+
+// ReadyTimeout returns how long Next waits for the first load started by Loadh32Async.
+func (w *WUID) ReadyTimeout() time.Duration {
+	w.tuneMu.RLock()
+	d := w.readyTimeout
+	w.tuneMu.RUnlock()
+	if d > 0 {
+		return d
+	}
+	return w.RenewTimeout()
+}
+
+// DefaultRenewTimeout is the timeout of loading h32 when WithRenewTimeout is not used.
+const DefaultRenewTimeout = time.Second * 5
+
+// RenewTimeout returns the timeout of loading h32 from the backend. A renewal run by the
+// caller of Next with WithSynchronousRenew is bounded by its budget instead.
+func (w *WUID) RenewTimeout() time.Duration {
+	if w.syncBudget > 0 && atomic.LoadInt32(&w.renewing) != 0 {
+		return w.syncBudget
+	}
+	w.tuneMu.RLock()
+	d := w.renewTimeout
+	w.tuneMu.RUnlock()
+	if d > 0 {
+		return d
+	}
+	return DefaultRenewTimeout
+}
+
+// CallWithContext calls f in a new goroutine, and returns ctx.Err() if ctx is done before f
+// returns, e.g. on the deadline Load sets from the renewal timeout. It is for the clients that
+// do not accept a context. f keeps running in the background after ctx is done.
+func (w *WUID) CallWithContext(ctx context.Context, f func() error) error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- f()
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CallWithTimeout calls f in a new goroutine, and returns context.DeadlineExceeded if f does
+// not return within the renewal timeout. It is for the clients that do not accept a context.
+func (w *WUID) CallWithTimeout(f func() error) error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- f()
+	}()
+	timer := time.NewTimer(w.RenewTimeout())
+	defer timer.Stop()
+	select {
+	case err := <-ch:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("<wuid> timed out after %s: %w", w.RenewTimeout(), context.DeadlineExceeded)
+	}
+}
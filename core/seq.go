@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SequenceAllocator reserves the numbers of the per-key sequences in the backend.
+type SequenceAllocator interface {
+	// Allocate reserves the next n numbers of the sequence key, and returns the last one.
+	Allocate(ctx context.Context, key string, n int64) (last int64, err error)
+}
+
+type allocResult struct {
+	last int64
+	err  error
+}
+
+// Seq is a dense sequence of numbers for a key, e.g. the invoice numbers of a customer. It
+// reserves a block of numbers from the SequenceAllocator at a time, and reserves the next
+// block in the background when the current one is running out.
+type Seq struct {
+	w        *WUID
+	key      string
+	mu       sync.Mutex
+	cur, end int64
+	prefetch chan allocResult
+}
+
+// Sequence returns the sequence of key, creating it on first use. It panics if
+// WithSequenceAllocator is not used.
+func (w *WUID) Sequence(key string) *Seq {
+	if w.seqAllocator == nil {
+		panic("Sequence requires WithSequenceAllocator")
+	}
+	w.seqMu.Lock()
+	defer w.seqMu.Unlock()
+	if s, ok := w.seqs[key]; ok {
+		return s
+	}
+	if w.seqs == nil {
+		w.seqs = make(map[string]*Seq)
+	}
+	s := &Seq{w: w, key: key, cur: 1}
+	w.seqs[key] = s
+	return s
+}
+
+// Key returns the key of the sequence.
+func (s *Seq) Key() string {
+	return s.key
+}
+
+// Next returns the next number of the sequence. The numbers handed out by an instance are
+// increasing, and the numbers of all the instances are unique. The unused numbers of a block
+// are lost when the process exits, so use a block size of 1 where no gap is acceptable.
+func (s *Seq) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur > s.end {
+		if err := s.advance(); err != nil {
+			return 0, err
+		}
+	}
+	v := s.cur
+	s.cur++
+	if n := s.w.seqBlockSize; n > 1 && s.prefetch == nil && s.end-s.cur < n/5 {
+		ch := make(chan allocResult, 1)
+		go func() {
+			last, err := s.allocate()
+			ch <- allocResult{last: last, err: err}
+		}()
+		s.prefetch = ch
+	}
+	return v, nil
+}
+
+// advance moves to the next block, which is the prefetched one if it has been reserved.
+func (s *Seq) advance() error {
+	n := s.w.seqBlockSize
+	if ch := s.prefetch; ch != nil {
+		s.prefetch = nil
+		if r := <-ch; r.err == nil {
+			s.cur, s.end = r.last-n+1, r.last
+			return nil
+		}
+	}
+	last, err := s.allocate()
+	if err != nil {
+		return fmt.Errorf("failed to allocate the sequence %q: %w", s.key, err)
+	}
+	s.cur, s.end = last-n+1, last
+	return nil
+}
+
+func (s *Seq) allocate() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.w.RenewTimeout())
+	defer cancel()
+	return s.w.seqAllocator.Allocate(ctx, s.key, s.w.seqBlockSize)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+func (w *WUID) countIssued() {
+	atomic.AddInt64(&w.stats.NumIssued, w.issuedInBlock())
+}
+
+// issuedInBlock returns the number of identifiers issued under the current h32.
+func (w *WUID) issuedInBlock() (total int64) {
+	start := atomic.LoadInt64(&w.stats.BlockStart)
+	l := w.layout()
+	for i := 0; i <= len(w.shards); i++ {
+		n := atomic.LoadInt64(w.lane(i))
+		base := start + int64(i)*l.step
+		if n>>32 == base>>32 && n > base {
+			total += (n - base) / l.laneStride
+		}
+	}
+	return total
+}
+
+// shard is a lane of the low bits, padded to a cache line of its own.
+type shard struct {
+	N int64
+	_ [56]byte
+}
+
+// lane returns the counter of the i-th lane. Lane 0 is N itself.
+func (w *WUID) lane(i int) *int64 {
+	if i == 0 {
+		return &w.N
+	}
+	return &w.shards[i-1].N
+}
+
+// storeLanes sets the counters of all lanes, interleaving them by Step from n.
+func (w *WUID) storeLanes(n int64) {
+	step := w.layout().step
+	for i := range w.shards {
+		atomic.StoreInt64(&w.shards[i].N, n+int64(i+1)*step)
+	}
+	atomic.StoreInt64(&w.N, n)
+}
+
+// pickLane chooses a lane by the address of the goroutine stack, which is cheap and stays
+// the same for a goroutine most of the time.
+func (w *WUID) pickLane() *int64 {
+	if w.determined != 0 {
+		return w.lane(0)
+	}
+	var x byte
+	h := uint64(uintptr(unsafe.Pointer(&x))>>13) * 0x9E3779B97F4A7C15
+	return w.lane(int((h >> 32) % uint64(w.numShards)))
+}
+
+// maxLane returns the counter of the fastest lane.
+func (w *WUID) maxLane() int64 {
+	n := atomic.LoadInt64(&w.N)
+	for i := range w.shards {
+		if v := atomic.LoadInt64(&w.shards[i].N); v&L32Mask > n&L32Mask {
+			n = v
+		}
+	}
+	return n
+}
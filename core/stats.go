@@ -0,0 +1,350 @@
+package core
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatsSnapshot is a point-in-time copy of the statistics of a WUID instance.
+type StatsSnapshot struct {
+	// H32 is the current h32.
+	H32 int64
+	// LowBitsUsage is the percentage of the low 32 bits consumed under the current h32.
+	LowBitsUsage float64
+	// NumIssued is the number of identifiers issued so far.
+	NumIssued int64
+	// NumRenewAttempts is the number of automatic renewal attempts.
+	NumRenewAttempts int64
+	// NumRenewed is the number of successful automatic renewals.
+	NumRenewed int64
+	// NumRenewFailed is the number of failed automatic renewals.
+	NumRenewFailed int64
+	// LastRenewTime is the time of the last automatic renewal attempt.
+	LastRenewTime time.Time
+	// LastRenewError is the error of the last automatic renewal attempt, or nil if it succeeded.
+	LastRenewError error
+}
+
+func (w *WUID) Stats() StatsSnapshot {
+	n := w.maxLane()
+	low := n & L32Mask
+	if low > PanicValue {
+		low = PanicValue
+	}
+	ss := StatsSnapshot{
+		H32:              n >> 32 & w.MaxH32(),
+		LowBitsUsage:     float64(low) / float64(PanicValue) * 100,
+		NumIssued:        atomic.LoadInt64(&w.stats.NumIssued) + w.issuedInBlock(),
+		NumRenewAttempts: atomic.LoadInt64(&w.stats.NumRenewAttempts),
+		NumRenewed:       atomic.LoadInt64(&w.stats.NumRenewed),
+		NumRenewFailed:   atomic.LoadInt64(&w.stats.NumRenewFailed),
+	}
+	w.stats.Lock()
+	ss.LastRenewTime = w.stats.LastRenewTime
+	ss.LastRenewError = w.stats.LastRenewError
+	w.stats.Unlock()
+	return ss
+}
+
+// rateBlockShift sets how often the issuance rate is sampled, i.e. whenever a lane crosses a
+// multiple of 1<<rateBlockShift in the low bits.
+const rateBlockShift = 16
+
+// RateTimeConstant is the time constant of the moving average of RateStats.Rate.
+const RateTimeConstant = 10 * time.Second
+
+// NumIntervalBuckets is the number of buckets of RateStats.Intervals.
+const NumIntervalBuckets = 40
+
+// RateStats is the issuance rate of a WUID instance.
+type RateStats struct {
+	// Rate is the exponentially weighted moving average of the identifiers issued per
+	// second, with a time constant of RateTimeConstant.
+	Rate float64
+	// Intervals is the histogram of the intervals between two identifiers. Intervals[i]
+	// counts the identifiers issued at least 1<<(i-1) and less than 1<<i nanoseconds after
+	// the previous one, while the last bucket also counts the longer intervals. The
+	// intervals are averaged over each sample, which spans 65536 values of the low bits of a
+	// lane, or the time between two calls to RateStats.
+	Intervals [NumIntervalBuckets]int64
+}
+
+type rateTracker struct {
+	sync.Mutex
+	rate       uint64 // math.Float64bits of RateStats.Rate
+	lastTime   time.Time
+	lastIssued int64
+	intervals  [NumIntervalBuckets]int64
+}
+
+// RateStats returns the issuance rate, which is sampled as the low bits are consumed and
+// whenever RateStats is called.
+func (w *WUID) RateStats() RateStats {
+	w.updateRate(true)
+	r := &w.rates
+	r.Lock()
+	defer r.Unlock()
+	return RateStats{Rate: math.Float64frombits(r.rate), Intervals: r.intervals}
+}
+
+// sampleRate is called when a lane advanced by delta crosses a sampling boundary at v2. Besides
+// the sampling, it triggers the renewal before the threshold when the low bits would run out
+// within twice the renew timeout at the current rate, e.g. when a burst hits a slow store.
+// Like the threshold itself, it waits until half of the low bits are used, and tries only
+// when v2 crosses a multiple of the renew interval.
+func (w *WUID) sampleRate(l *stepLayout, v2, delta int64) {
+	rate := w.updateRate(false)
+	w.adaptThreshold()
+	if rate <= 0 || v2 < PanicValue/2 || (v2-delta)&^l.renewMask == v2&^l.renewMask {
+		return
+	}
+	// The lanes share the rate, so the time left does not depend on their number.
+	left := float64(PanicValue-v2) / float64(l.step*(l.maxSkip+1)) / rate
+	if left < 2*w.RenewTimeout().Seconds() {
+		w.triggerRenew()
+	}
+}
+
+// updateRate folds the identifiers issued since the last sample into the rate, and returns
+// it. Unless wait is true, it gives up when another caller is sampling.
+func (w *WUID) updateRate(wait bool) float64 {
+	r := &w.rates
+	if wait {
+		r.Lock()
+	} else if !r.TryLock() {
+		return math.Float64frombits(atomic.LoadUint64(&r.rate))
+	}
+	defer r.Unlock()
+
+	now := time.Now()
+	issued := atomic.LoadInt64(&w.stats.NumIssued) + w.issuedInBlock()
+	rate := math.Float64frombits(r.rate)
+	dt := now.Sub(r.lastTime)
+	switch n := issued - r.lastIssued; {
+	case r.lastTime.IsZero() || n < 0:
+	case dt < time.Millisecond:
+		return rate
+	default:
+		inst := float64(n) / dt.Seconds()
+		if rate == 0 {
+			rate = inst
+		} else {
+			rate += (1 - math.Exp(-dt.Seconds()/RateTimeConstant.Seconds())) * (inst - rate)
+		}
+		atomic.StoreUint64(&r.rate, math.Float64bits(rate))
+		if n > 0 {
+			i := bits.Len64(uint64(dt / time.Duration(n)))
+			if i >= NumIntervalBuckets {
+				i = NumIntervalBuckets - 1
+			}
+			r.intervals[i] += n
+		}
+	}
+	r.lastTime, r.lastIssued = now, issued
+	return rate
+}
+
+// numLatencySamples is the number of the latest fetches RenewLatency reports on.
+const numLatencySamples = 64
+
+// LatencyStats is the latency of the backend measured by the latest loads and renewals.
+type LatencyStats struct {
+	NumSamples int
+	P50        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+type latencyTracker struct {
+	sync.Mutex
+	samples [numLatencySamples]time.Duration
+	n       int
+	p99     int64 // time.Duration
+}
+
+// RenewLatency returns the latency of fetching h32 from the backend, measured by the latest
+// loads and renewals, including the failed ones.
+func (w *WUID) RenewLatency() LatencyStats {
+	t := &w.latency
+	t.Lock()
+	defer t.Unlock()
+	return t.stats()
+}
+
+func (t *latencyTracker) stats() LatencyStats {
+	n := t.n
+	if n > numLatencySamples {
+		n = numLatencySamples
+	}
+	if n == 0 {
+		return LatencyStats{}
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, t.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return LatencyStats{
+		NumSamples: n,
+		P50:        sorted[(n-1)/2],
+		P99:        sorted[(n*99+99)/100-1],
+		Max:        sorted[n-1],
+	}
+}
+
+// observeLatency records the latency of a fetch from the backend and adapts the threshold.
+func (w *WUID) observeLatency(d time.Duration) {
+	t := &w.latency
+	t.Lock()
+	t.samples[t.n%numLatencySamples] = d
+	t.n++
+	atomic.StoreInt64(&t.p99, int64(t.stats().P99))
+	t.Unlock()
+	w.adaptThreshold()
+}
+
+// Pressure returns a score in [0, 1] telling how close the instance is to exhausting its low
+// bits, so that a load balancer or an admission controller can shed traffic from it before
+// Next panics. It stays 0 until a renewal is due, grows to 1 as the low bits run out, and is
+// at least 0.5 while the last renewal has failed.
+func (w *WUID) Pressure() float64 {
+	low := w.maxLane() & L32Mask
+	critical := w.RenewalThreshold()
+	var p float64
+	if low > critical {
+		p = float64(low-critical) / float64(PanicValue-critical)
+		if p > 1 {
+			p = 1
+		}
+	}
+	w.stats.Lock()
+	failed := w.stats.LastRenewError != nil
+	w.stats.Unlock()
+	if failed {
+		p = 0.5 + p/2
+	}
+	return p
+}
+
+// ExhaustionEstimate describes how much of the h32 space is left in the backend.
+type ExhaustionEstimate struct {
+	// Current is the latest h32 loaded from the backend.
+	Current int64
+	// Max is the largest h32 allowed.
+	Max int64
+	// Remaining is the number of h32 values left.
+	Remaining int64
+	// Usage is the fraction of the h32 space used so far.
+	Usage float64
+	// Rate is the number of h32 values consumed per second, observed across renewals.
+	Rate float64
+	// ETA is the estimated time until the h32 space runs out. It is zero if Rate is unknown.
+	ETA time.Duration
+}
+
+func (w *WUID) MaxH32() int64 {
+	if w.unsigned {
+		return 0xFFFFFFFF
+	}
+	if w.Monolithic {
+		return 0x1FFFFF
+	}
+	return 0x00FFFFFF
+}
+
+func (w *WUID) observeh32(h32 int64) {
+	h := &w.h32History
+	h.Lock()
+	now := time.Now()
+	if h.firstTime.IsZero() || h32 < h.last {
+		h.first, h.firstTime = h32, now
+	}
+	h.last, h.lastTime = h32, now
+	h.Unlock()
+
+	w.tuneMu.RLock()
+	threshold, alarm := w.exhaustionThreshold, w.exhaustionAlarm
+	w.tuneMu.RUnlock()
+	if alarm == nil {
+		return
+	}
+	est := w.ExhaustionEstimate()
+	if est.Usage >= threshold {
+		w.Warnf("<wuid> the h32 space is running out. name: %s, h32: %d, usage: %.2f%%, eta: %s",
+			w.Name, est.Current, est.Usage*100, est.ETA)
+		alarm(est)
+	}
+}
+
+func (w *WUID) ExhaustionEstimate() ExhaustionEstimate {
+	h := &w.h32History
+	h.Lock()
+	first, last := h.first, h.last
+	elapsed := h.lastTime.Sub(h.firstTime)
+	h.Unlock()
+
+	est := ExhaustionEstimate{
+		Current: last,
+		Max:     w.MaxH32(),
+	}
+	est.Remaining = est.Max - est.Current
+	if est.Remaining < 0 {
+		est.Remaining = 0
+	}
+	est.Usage = float64(est.Current) / float64(est.Max)
+	if last > first && elapsed > 0 {
+		est.Rate = float64(last-first) / elapsed.Seconds()
+		est.ETA = time.Duration(float64(est.Remaining) / est.Rate * float64(time.Second))
+	}
+	return est
+}
+
+type epochListener struct {
+	id int64
+	cb func(old, new int64)
+}
+
+// OnEpochChange calls cb whenever the high bits change, by a renewal or by Reset, with the h32
+// before and after, so that the caches keyed by the epoch, e.g. per-epoch bloom filters or
+// metric labels, rotate in sync with the generator. old is 0 for the first load. cb is called
+// on the goroutine applying the new h32 and must not block. The returned function stops the
+// subscription.
+func (w *WUID) OnEpochChange(cb func(old, new int64)) (stop func()) {
+	if cb == nil {
+		panic("cb cannot be nil")
+	}
+	w.tuneMu.Lock()
+	defer w.tuneMu.Unlock()
+	w.lastEpochListener++
+	id := w.lastEpochListener
+	listeners := make([]epochListener, len(w.epochListeners), len(w.epochListeners)+1)
+	copy(listeners, w.epochListeners)
+	w.epochListeners = append(listeners, epochListener{id: id, cb: cb})
+
+	return func() {
+		w.tuneMu.Lock()
+		defer w.tuneMu.Unlock()
+		for i, l := range w.epochListeners {
+			if l.id == id {
+				listeners := make([]epochListener, 0, len(w.epochListeners)-1)
+				listeners = append(listeners, w.epochListeners[:i]...)
+				w.epochListeners = append(listeners, w.epochListeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notifyEpochChange calls the callbacks subscribed with OnEpochChange.
+func (w *WUID) notifyEpochChange(oldh32, newh32 int64) {
+	w.tuneMu.RLock()
+	listeners := w.epochListeners
+	w.tuneMu.RUnlock()
+	for _, l := range listeners {
+		l.cb(oldh32, newh32)
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"sync/atomic"
+)
+
+// Attribute is a key-value pair describing a load. Value is a string, an int64 or a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts the spans of the loads from the data source, so that the core package does
+// not depend on a tracing library. The wuidotel package implements it with OpenTelemetry.
+type Tracer interface {
+	// StartLoad starts the span of a load described by attrs.
+	StartLoad(attrs []Attribute) Span
+}
+
+// Span is the span of a load started by a Tracer.
+type Span interface {
+	// SetAttributes adds attrs to the span.
+	SetAttributes(attrs []Attribute)
+	// RecordError records err and marks the span as failed.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// LoadSpan traces a single attempt to load h32 from the backend.
+type LoadSpan struct {
+	w    *WUID
+	span Span
+}
+
+// StartLoadSpan starts a span for loading h32 from the backend. It returns nil if
+// no tracer is configured.
+func (w *WUID) StartLoadSpan(backend string, key string) *LoadSpan {
+	if w.tracer == nil {
+		return nil
+	}
+	w.Lock()
+	renewal := w.renewer != nil
+	w.Unlock()
+	span := w.tracer.StartLoad([]Attribute{
+		{Key: "wuid.name", Value: w.Name},
+		{Key: "wuid.backend", Value: backend},
+		{Key: "wuid.key", Value: key},
+		{Key: "wuid.renewal", Value: renewal},
+		{Key: "wuid.old_h32", Value: atomic.LoadInt64(&w.N) >> 32 & w.MaxH32()},
+		{Key: "wuid.retry_count", Value: atomic.LoadInt64(&w.numRetries)},
+	})
+	return &LoadSpan{w: w, span: span}
+}
+
+// End ends the span. It is safe to call End on a nil LoadSpan.
+func (s *LoadSpan) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		atomic.AddInt64(&s.w.numRetries, 1)
+		s.span.RecordError(err)
+	} else {
+		atomic.StoreInt64(&s.w.numRetries, 0)
+		s.span.SetAttributes([]Attribute{
+			{Key: "wuid.new_h32", Value: atomic.LoadInt64(&s.w.N) >> 32 & s.w.MaxH32()},
+		})
+	}
+	s.span.End()
+}
+
+// WithTracer traces the loads and renewals of the high bits with t.
+func WithTracer(t Tracer) Option {
+	if t == nil {
+		panic("t cannot be nil")
+	}
+	return func(w *WUID) {
+		w.tracer = t
+	}
+}
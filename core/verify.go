@@ -0,0 +1,188 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// HighBits is a value loaded from a data source, which makes the high bits of the generated
+// numbers, together with its width. The width is 21 bits by default, which keeps the numbers
+// within the 53-bit integer precision of JavaScript, 24 bits with WithSection, and 32 bits with
+// WithUint64.
+type HighBits struct {
+	Value int64
+	Width int
+}
+
+// HighBitsWidth returns the number of bits available to the values loaded from the data
+// source.
+func (w *WUID) HighBitsWidth() int {
+	return bits.Len64(uint64(w.MaxH32()))
+}
+
+// CurrentHighBits returns the high bits in use.
+func (w *WUID) CurrentHighBits() HighBits {
+	return HighBits{
+		Value: atomic.LoadInt64(&w.N) >> 32 & w.MaxH32(),
+		Width: w.HighBitsWidth(),
+	}
+}
+
+// VerifyHighBits checks whether hb can be the next high bits. It is Verifyh32 with a check of
+// the width.
+func (w *WUID) VerifyHighBits(hb HighBits) error {
+	if width := w.HighBitsWidth(); hb.Width != width {
+		return fmt.Errorf("%w: the width of the high bits should be %d, not %d", wuiderr.ErrInvalidH32, width, hb.Width)
+	}
+	return w.Verifyh32(hb.Value)
+}
+
+// ResetHighBits makes hb the high bits, with the low bits starting from zero.
+func (w *WUID) ResetHighBits(hb HighBits) {
+	w.Reset(hb.Value << 32)
+}
+
+func (w *WUID) Verifyh32(h32 int64) error {
+	if h32 <= 0 {
+		return fmt.Errorf("%w: h32 must be positive", wuiderr.ErrInvalidH32)
+	}
+
+	if w.unsigned {
+		if h32 > 0xFFFFFFFF {
+			return fmt.Errorf("%w: h32 should not exceed 0xFFFFFFFF", wuiderr.ErrH32Exhausted)
+		}
+	} else if w.Monolithic {
+		if h32 > 0x1FFFFF {
+			return fmt.Errorf("%w: h32 should not exceed 0x1FFFFF", wuiderr.ErrH32Exhausted)
+		}
+	} else {
+		if h32 > 0x00FFFFFF {
+			return fmt.Errorf("%w: h32 should not exceed 0x00FFFFFF", wuiderr.ErrH32Exhausted)
+		}
+	}
+
+	current := atomic.LoadInt64(&w.N) >> 32
+	if w.unsigned {
+		current &= 0xFFFFFFFF
+	}
+	if w.Monolithic {
+		if h32 == current {
+			return fmt.Errorf("%w: h32 should be a different value other than %d", wuiderr.ErrInvalidH32, h32)
+		}
+	} else {
+		if h32 == current&0x00FFFFFF {
+			return fmt.Errorf("%w: h32 should be a different value other than %d", wuiderr.ErrInvalidH32, h32)
+		}
+	}
+
+	if rng, ok := w.ReservedRange(h32); ok {
+		return fmt.Errorf("%w: h32 %d is in the reserved range [%d, %d]", wuiderr.ErrInvalidH32, h32, rng[0], rng[1])
+	}
+	if w.h32Verifier != nil {
+		if err := w.h32Verifier.Verifyh32(w.Name, w.Section>>60, h32); err != nil {
+			return &invalidh32Error{cause: err}
+		}
+	}
+	w.tuneMu.RLock()
+	added := w.addedVerifiers
+	w.tuneMu.RUnlock()
+	for _, v := range added {
+		if err := v.cb(h32); err != nil {
+			return &invalidh32Error{cause: err}
+		}
+	}
+	if w.registry != nil {
+		if err := w.claimh32(h32); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Registry records which generator each h32 of each section is claimed by. It lets the
+// generators that share a data source detect the ones loading the same h32 from another
+// counter, or with another configuration, which would produce the same numbers.
+type Registry interface {
+	// Claim claims h32 of section for owner unless it has been claimed, and returns the owner
+	// of h32 after that.
+	Claim(ctx context.Context, section int8, h32 int64, owner string) (claimedBy string, err error)
+}
+
+// claimh32 claims h32 in the registry with the name of w as the owner.
+func (w *WUID) claimh32(h32 int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.RenewTimeout())
+	defer cancel()
+	section := int8(w.Section >> 60)
+	owner, err := w.registry.Claim(ctx, section, h32, w.Name)
+	if err != nil {
+		return fmt.Errorf("failed to claim h32 in the registry: %w", err)
+	}
+	if owner != w.Name {
+		return fmt.Errorf("%w: h32 %d of section %d is claimed by %s", wuiderr.ErrInvalidH32, h32, section, owner)
+	}
+	return nil
+}
+
+// VerifierToken identifies a verifier added by AddH32Verifier.
+type VerifierToken int64
+
+type addedVerifier struct {
+	token VerifierToken
+	cb    func(h32 int64) error
+}
+
+// AddH32Verifier adds cb to the verifiers of the h32 loaded from now on, after the one set by
+// Withh32Verifier or WithVerifier, e.g. once an ops tool pushes new reserved ranges. It is safe
+// to call while the generator is in use. The returned token removes cb with
+// RemoveH32Verifier.
+func (w *WUID) AddH32Verifier(cb func(h32 int64) error) VerifierToken {
+	if cb == nil {
+		panic("cb cannot be nil")
+	}
+	w.tuneMu.Lock()
+	defer w.tuneMu.Unlock()
+	w.lastVerifierToken++
+	added := make([]addedVerifier, len(w.addedVerifiers), len(w.addedVerifiers)+1)
+	copy(added, w.addedVerifiers)
+	w.addedVerifiers = append(added, addedVerifier{token: w.lastVerifierToken, cb: cb})
+	return w.lastVerifierToken
+}
+
+// RemoveH32Verifier removes the verifier added by AddH32Verifier with token, and reports
+// whether it was found. A load verifying h32 at the same time may still call it.
+func (w *WUID) RemoveH32Verifier(token VerifierToken) bool {
+	w.tuneMu.Lock()
+	defer w.tuneMu.Unlock()
+	for i, v := range w.addedVerifiers {
+		if v.token == token {
+			added := make([]addedVerifier, 0, len(w.addedVerifiers)-1)
+			added = append(added, w.addedVerifiers[:i]...)
+			w.addedVerifiers = append(added, w.addedVerifiers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// invalidh32Error wraps the error returned by the h32 verifier, so that it matches both
+// wuiderr.ErrInvalidH32 and the original error. The message is left untouched.
+type invalidh32Error struct {
+	cause error
+}
+
+func (e *invalidh32Error) Error() string {
+	return e.cause.Error()
+}
+
+func (e *invalidh32Error) Is(target error) bool {
+	return target == wuiderr.ErrInvalidH32
+}
+
+func (e *invalidh32Error) Unwrap() error {
+	return e.cause
+}
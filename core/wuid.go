@@ -0,0 +1,483 @@
+// Package core is the engine shared by all the adapters of WUID: the generation of the
+// numbers, the renewal of the high bits, their verification, the options and the statistics.
+// Use it to build an adapter for a custom data source. An adapter only fetches h32 from the
+// data source with a Renewer, and Load verifies and applies it. The Renewer is saved, so that
+// it is called again for the renewals:
+//
+//	func (a *Adapter) Load(ctx context.Context, key string) error {
+//		return a.w.Load(ctx, core.RenewerFunc(func(ctx context.Context) (h32 int64, err error) {
+//			span := a.w.StartLoadSpan("mystore", key)
+//			defer func() {
+//				span.End(err)
+//			}()
+//			return fetch(ctx, key)
+//		}))
+//	}
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+const (
+	// PanicValue indicates when Next starts to panic.
+	PanicValue int64 = ((1 << 32) * 96 / 100) & ^1023
+	// CriticalValue indicates when to renew the high 28 bits.
+	CriticalValue int64 = ((1 << 32) * 80 / 100) & ^1023
+	// RenewIntervalMask indicates the 'time' between two renewal attempts.
+	RenewIntervalMask int64 = 0x2000000 - 1
+)
+
+const (
+	// MaxStep is the maximum step. It leaves room for hundreds of renewal attempts.
+	MaxStep = 1 << 20
+	// MinRenewHeadroom is the number of identifiers an instance can generate after a renewal
+	// becomes due and before Next panics, as long as the step allows.
+	MinRenewHeadroom = 1 << 20
+)
+
+// criticalValue returns when to renew for a lane advancing by stride per identifier. A large
+// stride moves it below CriticalValue, so that the window before PanicValue still holds
+// MinRenewHeadroom identifiers, but never below half of PanicValue, which would waste most of
+// every h32.
+func criticalValue(stride int64) int64 {
+	c := (PanicValue - MinRenewHeadroom*stride) &^ 1023
+	if c > CriticalValue {
+		c = CriticalValue
+	}
+	if half := (PanicValue/2 + 1023) &^ 1023; c < half {
+		c = half
+	}
+	return c
+}
+
+const (
+	Bye = ((CriticalValue + RenewIntervalMask) & ^RenewIntervalMask) - 1
+)
+
+const (
+	H32Mask = 0x1FFFFF << 32 //高位有效位21位，js number有效 53位
+	L32Mask = 0x0FFFFFFFF
+)
+
+// Logger is the minimal logging interface WUID depends on. A slog.Logger from
+// github.com/edwingeng/slog, a *zap.SugaredLogger and a logrus logger satisfy it as they are.
+// A *slog.Logger of the standard library does not, and is wrapped by the logger package.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+type WUID struct {
+	N int64
+	// Step, Floor, Flags and ObfuscationMask are set by the options and never change
+	// afterwards. See CurrentStep for the step in use.
+	Step  int64
+	Floor int64
+
+	Flags           int8
+	Obfuscation     bool
+	Monolithic      bool
+	ObfuscationMask int64
+	Section         int64
+	permKeys        [3]uint64
+	maxSkip         int64
+	skipKey         uint64
+	unsigned        bool
+
+	Logger
+	Name        string
+	KeyPrefix   string
+	AuditTable  string
+	fingerprint bool
+	determined  int64
+	h32Verifier H32Verifier
+	reserved    [][2]int64
+	registry    Registry
+
+	strictInterlock bool
+	interlockID     string // guarded by the lock of interlock
+
+	// addedVerifiers is replaced rather than modified under tuneMu, so that a copy can be
+	// iterated without the lock.
+	addedVerifiers    []addedVerifier
+	lastVerifierToken VerifierToken
+	// epochListeners is replaced rather than modified under tuneMu as well.
+	epochListeners    []epochListener
+	lastEpochListener int64
+
+	tuneMu              sync.RWMutex
+	exhaustionThreshold float64
+	exhaustionAlarm     func(est ExhaustionEstimate)
+	tracer              Tracer
+	numRetries          int64
+	quietRenewals       bool
+	verbose             bool
+	renewTimeout        time.Duration
+	maxh32Age           time.Duration
+	loadedAt            int64
+	ageOnce             sync.Once
+	stopOnce            sync.Once
+	stop                chan struct{}
+	logSampling         int64
+	numLoads            int64
+	h32History          struct {
+		sync.Mutex
+		first, last         int64
+		firstTime, lastTime time.Time
+	}
+
+	sync.Mutex
+	renewer       Renewer
+	renewExecutor func(task func())
+	syncBudget    time.Duration
+	renewing      int32
+
+	numShards  int64
+	shards     []shard
+	checkIDs   int64
+	stepLayout atomic.Value // *stepLayout
+	nextStep   struct {
+		sync.Mutex
+		step, floor int64
+	}
+	forks      map[int]bool // guarded by nextStep
+	forkOffset int64
+
+	loading      int32
+	ready        chan struct{}
+	readyOnce    sync.Once
+	readyTimeout time.Duration
+
+	mirror   Mirror
+	mirrorMu sync.Mutex
+	mirrored int64
+
+	rates            rateTracker
+	latency          latencyTracker
+	adaptiveCritical int64
+
+	guard       *duplicateGuard
+	onDuplicate func(id int64)
+
+	limiter atomic.Value // *rateLimiter
+
+	seqAllocator  SequenceAllocator
+	seqBlockSize  int64
+	seqMu         sync.Mutex
+	seqs          map[string]*Seq
+	transforms    []func(int64) int64
+	checksum      bool
+	signingKey    []byte
+	faultInjector FaultInjector
+
+	resumePrevious bool
+
+	stats struct {
+		NumRenewAttempts int64
+		NumRenewed       int64
+		NumRenewFailed   int64
+		NumIssued        int64
+		BlockStart       int64
+
+		sync.Mutex
+		LastRenewTime  time.Time
+		LastRenewError error
+	}
+}
+
+func NewWUID(name string, logger Logger, opts ...Option) (w *WUID) {
+	w = &WUID{Step: 1, Name: name, Monolithic: true, Logger: logger}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.Logger == nil {
+		w.Logger = defaultLogger(w.verbose)
+	}
+	if err := w.check(); err != nil {
+		panic(err)
+	}
+	if w.numShards > 1 {
+		w.shards = make([]shard, w.numShards-1)
+		w.storeLanes(0)
+	}
+	if w.Obfuscation && w.Floor != 0 {
+		ones := w.Step - 1
+		w.ObfuscationMask |= ones
+	}
+	if w.maxSkip > 0 {
+		w.skipKey = uint64(time.Now().UnixNano())
+		if w.determined != 0 {
+			w.skipKey = uint64(w.determined)
+		}
+	}
+	w.stepLayout.Store(w.newLayout())
+	if err := w.checkTransforms(); err != nil {
+		panic(err)
+	}
+	if w.determined != 0 {
+		w.Reset(w.determined << 32)
+	}
+	return
+}
+
+func (w *WUID) Next() int64 {
+	if l, ok := w.limiter.Load().(*rateLimiter); ok {
+		l.wait(1)
+	}
+	return w.next()
+}
+
+// NextOrErr is like Next but returns wuiderr.ErrRateLimited instead of waiting when the rate
+// limit set by WithRateLimit is exceeded. It also returns the errors Next would panic with,
+// e.g. wuiderr.ErrLowBitsExhausted.
+func (w *WUID) NextOrErr() (id int64, err error) {
+	if l, ok := w.limiter.Load().(*rateLimiter); ok && !l.allow(1) {
+		return 0, wuiderr.ErrRateLimited
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return w.next(), nil
+}
+
+func (w *WUID) next() int64 {
+	if atomic.LoadInt32(&w.loading) != 0 {
+		w.waitReady()
+	}
+	l := w.layout()
+	p, step := &w.N, l.step
+	if w.shards != nil {
+		p, step = w.pickLane(), l.laneStride
+	}
+	var v1 int64
+	if l.maxSkip > 0 {
+		v1, step = advanceWithSkips(p, l, step, 1)
+	} else {
+		v1 = atomic.AddInt64(p, step)
+	}
+	v2 := v1 & L32Mask
+	if v2 >= PanicValue || v2 < step {
+		exhausted(p, v1, step)
+	}
+	if (v2-step)&^l.renewMask != v2&^l.renewMask && v2 >= w.threshold(l) {
+		w.triggerRenew()
+	} else if (v2-step)>>rateBlockShift != v2>>rateBlockShift {
+		w.sampleRate(l, v2, step)
+	}
+	r := w.formatWith(l, v1)
+	if w.guard != nil {
+		w.checkDuplicate(r)
+	}
+	return r
+}
+
+// skipOf returns the number of steps skipped after the counter value v, which is in between
+// [0, l.maxSkip]. It is derived from v with a keyed hash, so that NextN can tell the numbers
+// reserved by advanceWithSkips.
+func skipOf(v int64, l *stepLayout) int64 {
+	if l.maxSkip == 0 {
+		return 0
+	}
+	x := uint64(v) ^ l.skipKey
+	x = (x ^ (x >> 30)) * uint64(0xbf58476d1ce4e5b9)
+	x = (x ^ (x >> 27)) * uint64(0x94d049bb133111eb)
+	x ^= x >> 31
+	return int64(x % uint64(l.maxSkip+1))
+}
+
+// advanceWithSkips reserves n numbers from the counter p, skipping a random number of steps
+// before each of them. It returns the new value of the counter and the distance it has moved.
+func advanceWithSkips(p *int64, l *stepLayout, step int64, n int) (v1, delta int64) {
+	for {
+		cur := atomic.LoadInt64(p)
+		v := cur
+		for i := 0; i < n; i++ {
+			v += step + skipOf(v, l)*step
+		}
+		if atomic.CompareAndSwapInt64(p, cur, v) {
+			return v, v - cur
+		}
+	}
+}
+
+// exhausted panics for the counter p, which has just been advanced to v1 by delta. It pulls
+// the counter back to PanicValue, so that the callers that keep calling Next after the panic
+// cannot carry the low bits into the high bits. If the carry has happened anyway, e.g. after a
+// misuse of Reset, it panics with wuiderr.ErrLowBitsOverflow rather than returning an
+// identifier that aliases the next h32.
+func exhausted(p *int64, v1, delta int64) {
+	old := v1 - delta
+	panicValue := old&^L32Mask | PanicValue
+	if old>>32 != v1>>32 {
+		atomic.CompareAndSwapInt64(p, v1, panicValue)
+		panic(fmt.Errorf("%w: %#016x + %d", wuiderr.ErrLowBitsOverflow, old, delta))
+	}
+	if v1&L32Mask < PanicValue {
+		return
+	}
+	for {
+		cur := atomic.LoadInt64(p)
+		if cur>>32 != v1>>32 || cur&L32Mask <= PanicValue {
+			break
+		}
+		if atomic.CompareAndSwapInt64(p, cur, panicValue) {
+			break
+		}
+	}
+	panic(wuiderr.ErrLowBitsExhausted)
+}
+
+// NextN fills dst with unique identifiers, which are reserved with a single atomic operation.
+// len(dst) multiplied by the step should not exceed MaxStep.
+func (w *WUID) NextN(dst []int64) {
+	if len(dst) == 0 {
+		return
+	}
+	if l, ok := w.limiter.Load().(*rateLimiter); ok {
+		l.wait(len(dst))
+	}
+	if atomic.LoadInt32(&w.loading) != 0 {
+		w.waitReady()
+	}
+	l := w.layout()
+	p, step := &w.N, l.step
+	if w.shards != nil {
+		p, step = w.pickLane(), l.laneStride
+	}
+	span := step * int64(len(dst))
+	if span*(l.maxSkip+1) > MaxStep {
+		panic(fmt.Errorf("len(dst) multiplied by the step should not exceed %d", MaxStep/(l.maxSkip+1)))
+	}
+	var v1 int64
+	if l.maxSkip > 0 {
+		v1, span = advanceWithSkips(p, l, step, len(dst))
+	} else {
+		v1 = atomic.AddInt64(p, span)
+	}
+	v2 := v1 & L32Mask
+	if v2 >= PanicValue || v2 < span {
+		exhausted(p, v1, span)
+	}
+	if (v2-span)&^l.renewMask != v2&^l.renewMask && v2 >= w.threshold(l) {
+		w.triggerRenew()
+	} else if (v2-span)>>rateBlockShift != v2>>rateBlockShift {
+		w.sampleRate(l, v2, span)
+	}
+
+	v := v1 - span
+	for i := range dst {
+		v += step + skipOf(v, l)*step
+		dst[i] = w.formatWith(l, v)
+	}
+	if w.guard != nil {
+		for _, r := range dst {
+			w.checkDuplicate(r)
+		}
+	}
+}
+
+// Range is a block of identifiers handed out by AllocateRange. Both ends are inclusive.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// Len returns the number of identifiers in r.
+func (r Range) Len() int64 {
+	return r.End - r.Start + 1
+}
+
+// Contains reports whether id falls in r.
+func (r Range) Contains(id int64) bool {
+	return id >= r.Start && id <= r.End
+}
+
+// AllocateRange reserves n consecutive identifiers that Next never issues, so that the
+// mobile and offline clients can mint their own identifiers from the range and sync them
+// later without conflicts. The range is taken from the low bits of the current h32, just
+// like NextN, so n rounded up to a multiple of the step should not exceed MaxStep. The
+// identifiers must be the counter itself, so AllocateRange returns an error with the options
+// that change the numbers, e.g. WithObfuscation, a floor, WithTransform and WithShards.
+func (w *WUID) AllocateRange(n int64) (rng Range, err error) {
+	if n < 1 {
+		return rng, errors.New("n must be positive")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	if atomic.LoadInt32(&w.loading) != 0 {
+		w.waitReady()
+	}
+	l := w.layout()
+	if l.flags != 0 || l.maxSkip > 0 || w.shards != nil || len(w.transforms) > 0 || w.checksum {
+		return rng, errors.New("AllocateRange cannot be combined with the options that change the numbers, e.g. WithObfuscation, a floor, WithTransform and WithShards")
+	}
+	span := (n + l.step - 1) / l.step * l.step
+	if span > MaxStep {
+		return rng, fmt.Errorf("n rounded up to a multiple of the step should not exceed %d", MaxStep)
+	}
+
+	v1 := atomic.AddInt64(&w.N, span)
+	v2 := v1 & L32Mask
+	if v2 >= PanicValue || v2 < span {
+		exhausted(&w.N, v1, span)
+	}
+	if (v2-span)&^l.renewMask != v2&^l.renewMask && v2 >= w.threshold(l) {
+		w.triggerRenew()
+	} else if (v2-span)>>rateBlockShift != v2>>rateBlockShift {
+		w.sampleRate(l, v2, span)
+	}
+	start := v1 - span + 1
+	return Range{Start: start, End: start + n - 1}, nil
+}
+
+// Fingerprint identifies the process that allocated an h32.
+type Fingerprint struct {
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"startTime"`
+}
+
+var processStart = time.Now()
+
+// Fingerprint returns the fingerprint of the current process and whether the adapters should
+// record it alongside each allocation, i.e. whether WithInstanceFingerprint is used.
+func (w *WUID) Fingerprint() (Fingerprint, bool) {
+	host, _ := os.Hostname()
+	return Fingerprint{Host: host, PID: os.Getpid(), StartTime: processStart}, w.fingerprint
+}
+
+// Deterministic reports whether WithDeterministic is used, in which case the loaders must not
+// touch the data source.
+func (w *WUID) Deterministic() bool {
+	return w.determined != 0
+}
+
+func (w *WUID) HasVerifier() bool {
+	if w.h32Verifier != nil {
+		return true
+	}
+	w.tuneMu.RLock()
+	defer w.tuneMu.RUnlock()
+	return len(w.addedVerifiers) > 0
+}
@@ -0,0 +1,3047 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/wuiderr"
+	"github.com/edwingeng/slog"
+)
+
+func (w *WUID) Scavenger() *slog.Scavenger {
+	return w.Logger.(*slog.Scavenger)
+}
+
+func TestWUID_Next(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		w := NewWUID("alpha", nil)
+		w.Reset(int64(i+1) << 32)
+		v := atomic.LoadInt64(&w.N)
+		for j := 0; j < 100; j++ {
+			v++
+			if id := w.Next(); id != v {
+				t.Fatalf("the id is %d, while it should be %d", id, v)
+			}
+		}
+	}
+}
+
+func TestWUID_Next_Concurrent(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	var mu sync.Mutex
+	const N1 = 100
+	const N2 = 100
+	a := make([]int64, 0, N1*N2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < N1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < N2; j++ {
+				id := w.Next()
+				mu.Lock()
+				a = append(a, id)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	sort.Slice(a, func(i, j int) bool {
+		return a[i] < a[j]
+	})
+
+	for i := 0; i < N1*N2-1; i++ {
+		if a[i] == a[i+1] {
+			t.Fatalf("duplication detected")
+		}
+	}
+}
+
+func TestWUID_Reserve(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithStep(1000, 0)},
+		{WithShards(4), WithStep(16, 10)},
+	} {
+		w := NewWUID("alpha", nil, opts...)
+		w.Reset(0x20 << 32)
+		const n = 5000
+		p := w.Reserve(n)
+		if p.Len() != n {
+			t.Fatalf("p.Len() is %d, while it should be %d", p.Len(), n)
+		}
+		seen := make(map[int64]struct{}, n+1)
+		for i := 0; i < n; i++ {
+			id, ok := p.Get()
+			if !ok {
+				t.Fatalf("the pool is used up after %d identifiers", i)
+			}
+			seen[id] = struct{}{}
+		}
+		if _, ok := p.Get(); ok || p.Len() != 0 {
+			t.Fatal("the pool should have been used up")
+		}
+		seen[w.Next()] = struct{}{}
+		if len(seen) != n+1 {
+			t.Fatalf("%d of the identifiers are duplicates", n+1-len(seen))
+		}
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil).Reserve(0)
+		t.Fatal("Reserve should have panicked")
+	}()
+}
+
+type parkingRenewer struct {
+	mu     sync.Mutex
+	h32    int64
+	parked []ParkedBlock
+}
+
+func (r *parkingRenewer) Renew(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.h32++
+	return r.h32, nil
+}
+
+func (r *parkingRenewer) Park(_ context.Context, b ParkedBlock) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parked = append(r.parked, b)
+	return nil
+}
+
+func (r *parkingRenewer) Unpark(_ context.Context, fingerprint string) (ParkedBlock, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, b := range r.parked {
+		if b.Fingerprint == fingerprint {
+			r.parked = append(r.parked[:i], r.parked[i+1:]...)
+			return b, true, nil
+		}
+	}
+	return ParkedBlock{}, false, nil
+}
+
+func TestWUID_ResumePreviousBlock(t *testing.T) {
+	r := &parkingRenewer{}
+	w1 := NewWUID("alpha", slog.NewDumbLogger(), WithResumePreviousBlock())
+	if err := w1.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	var last int64
+	for i := 0; i < 100; i++ {
+		last = w1.Next()
+	}
+	if err := w1.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.parked) != 1 || r.parked[0].H32 != 1 || r.parked[0].Low != last&L32Mask {
+		t.Fatalf("the block is not parked as expected: %+v", r.parked)
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		w1.Next()
+		t.Fatal("Next should panic after Shutdown")
+	}()
+
+	// Another layout cannot take the block.
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), WithResumePreviousBlock(), WithStep(16, 0))
+	if err := w2.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if hb := w2.CurrentHighBits(); hb.Value != 2 {
+		t.Fatalf("the generator with another layout should have loaded a new h32, not %d", hb.Value)
+	}
+
+	w3 := NewWUID("alpha", slog.NewDumbLogger(), WithResumePreviousBlock())
+	if err := w3.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if v := w3.Next(); v>>32 != 1 || v <= last+ResumeGap {
+		t.Fatalf("the generator should have resumed above the watermark. v: %#x, last: %#x", v, last)
+	}
+	if r.h32 != 2 || len(r.parked) != 0 {
+		t.Fatalf("the block should have been taken without a new h32. h32: %d, parked: %d", r.h32, len(r.parked))
+	}
+
+	// The renewals load new blocks as usual.
+	if err := w3.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if hb := w3.CurrentHighBits(); hb.Value != 3 {
+		t.Fatalf("h32 should be 3, not %d", hb.Value)
+	}
+}
+
+func TestWUID_FaultInjector(t *testing.T) {
+	var h32 int64
+	r := RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.AddInt64(&h32, 1), nil
+	})
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithRenewTimeout(time.Millisecond*50),
+		WithFaultInjector(FaultSequence(FaultError, FaultLostReply, FaultDuplicateIncrement, FaultTimeout)))
+	for i, c := range []struct {
+		fault   Fault
+		failed  bool
+		current int64
+	}{
+		{FaultError, true, 0},
+		{FaultLostReply, true, 1},
+		{FaultDuplicateIncrement, false, 3},
+		{FaultTimeout, true, 3},
+		{NoFault, false, 4},
+	} {
+		err := w.Load(context.Background(), r)
+		if c.failed != errors.Is(err, wuiderr.ErrFaultInjected) {
+			t.Fatalf("unexpected error. i: %d, fault: %s, err: %v", i, c.fault, err)
+		}
+		if v := atomic.LoadInt64(&h32); v != c.current {
+			t.Fatalf("the counter of the backend is %d, while it should be %d. fault: %s", v, c.current, c.fault)
+		}
+		if !c.failed && w.CurrentHighBits().Value != c.current {
+			t.Fatalf("h32 should be %d. fault: %s", c.current, c.fault)
+		}
+	}
+}
+
+func TestWUID_Uint64(t *testing.T) {
+	w := NewWUID("alpha", nil, WithUint64())
+	if w.MaxH32() != 0xFFFFFFFF || w.HighBitsWidth() != 32 || w.StringWidth() != 20 {
+		t.Fatalf("unexpected limits. MaxH32: %#x, HighBitsWidth: %d, StringWidth: %d", w.MaxH32(), w.HighBitsWidth(), w.StringWidth())
+	}
+	var h32 int64 = 0x80000001
+	w.Reset(h32 << 32)
+
+	id := w.Next()
+	if id >= 0 || ToUint64(id)>>32 != 0x80000001 || FromUint64(ToUint64(id)) != id {
+		t.Fatalf("the sign bit of %#x should be set", ToUint64(id))
+	}
+	if u := w.NextUint64(); u != ToUint64(id)+1 {
+		t.Fatalf("NextUint64 returned %d, while it should be %d", u, ToUint64(id)+1)
+	}
+	s := w.NextString()
+	if s != strconv.FormatUint(ToUint64(id)+2, 10) {
+		t.Fatalf("NextString should print the identifiers unsigned: %s", s)
+	}
+	if v, err := w.StringFormat().Parse(s); err != nil || v != id+2 {
+		t.Fatalf("StringFormat().Parse(%s) does not work as expected. v: %d, err: %v", s, v, err)
+	}
+	if h, err := w.CheckID(id); err != nil || h != 0x80000001 {
+		t.Fatalf("CheckID does not work as expected. h32: %#x, err: %v", h, err)
+	}
+
+	if err := w.Verifyh32(0xFFFFFFFF); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Verifyh32(0x100000000); !errors.Is(err, wuiderr.ErrH32Exhausted) {
+		t.Fatalf("Verifyh32 should have failed with ErrH32Exhausted. err: %v", err)
+	}
+	if err := w.Verifyh32(0x80000001); err == nil {
+		t.Fatal("Verifyh32 should reject the current h32")
+	}
+	if err := w.ResetForward(0x7FFFFFFF << 32); !errors.Is(err, wuiderr.ErrRewind) {
+		t.Fatalf("ResetForward should refuse to move backwards. err: %v", err)
+	}
+	h32 = 0x80000002
+	if err := w.ResetForward(h32 << 32); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]Option{
+		{WithUint64(), WithSection(1)},
+		{WithUint64(), WithChecksum(10)},
+		{WithUint64(), WithStep(16, 4)},
+	} {
+		if err := Validate(opts...); err == nil {
+			t.Fatal("Validate should have failed")
+		}
+	}
+}
+
+func TestWUID_Fork(t *testing.T) {
+	var h32, numLoads int64 = 0x20, 0
+	w := NewWUID("alpha", nil, WithStep(16, 0))
+	if _, err := w.Fork(1); err == nil {
+		t.Fatal("Fork should have failed before the first load")
+	}
+	if err := w.Load(context.Background(), RenewerFunc(func(context.Context) (int64, error) {
+		atomic.AddInt64(&numLoads, 1)
+		return atomic.AddInt64(&h32, 1), nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	w.Next()
+
+	children := make([]*WUID, 0, 3)
+	for _, sub := range []int{1, 7, 15} {
+		c, err := w.Fork(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, c)
+	}
+	if n := atomic.LoadInt64(&numLoads); n != 1 {
+		t.Fatalf("the forks should not load from the backend. numLoads: %d", n)
+	}
+	for _, sub := range []int{0, 7, 16} {
+		if _, err := w.Fork(sub); err == nil {
+			t.Fatalf("Fork(%d) should have failed", sub)
+		}
+	}
+	if err := w.ReconfigureStep(32, 0); err == nil {
+		t.Fatal("the step of a forked generator should not be reconfigured")
+	}
+
+	gens := append([]*WUID{w}, children...)
+	results := make([][]int64, len(gens))
+	var wg sync.WaitGroup
+	for i, g := range gens {
+		wg.Add(1)
+		go func(i int, g *WUID) {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				results[i] = append(results[i], g.Next())
+			}
+		}(i, g)
+	}
+	wg.Wait()
+	// A child moves to a new h32 by renewing the parent.
+	if err := children[0].RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if hb := children[0].CurrentHighBits(); hb.Value != 0x22 || w.CurrentHighBits().Value != 0x22 {
+		t.Fatalf("the h32 of the child is %#x, while both should have moved to 0x22", hb.Value)
+	}
+	for i, g := range gens {
+		for j := 0; j < 100; j++ {
+			results[i] = append(results[i], g.Next())
+		}
+	}
+
+	seen := make(map[int64]struct{})
+	for i, ids := range results {
+		for _, v := range ids {
+			if _, ok := seen[v]; ok {
+				t.Fatalf("duplicate: %#x", v)
+			}
+			seen[v] = struct{}{}
+			if i > 0 && v%16 != int64([]int{1, 7, 15}[i-1]) {
+				t.Fatalf("%#x is out of the sub-section of the child", v)
+			}
+		}
+	}
+
+	if _, err := NewWUID("alpha", nil, WithStep(12, 0)).Fork(1); err == nil {
+		t.Fatal("Fork should require the step to be a power of 2")
+	}
+}
+
+func TestWUID_Fork_Uint64(t *testing.T) {
+	w := NewWUID("alpha", nil, WithStep(16, 0), WithUint64())
+	if err := w.Load(context.Background(), RenewerFunc(func(context.Context) (int64, error) {
+		return 0x80000001, nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	c, err := w.Fork(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb := c.CurrentHighBits(); hb.Value != 0x80000001 {
+		t.Fatalf("the h32 of the child is %#x, while it should be 0x80000001", hb.Value)
+	}
+	for i := 0; i < 100; i++ {
+		if u := c.NextUint64(); u>>32 != 0x80000001 || u%16 != 3 {
+			t.Fatalf("%#x is out of the h32 or the sub-section of the child", u)
+		}
+	}
+	if s := c.NextString(); strings.HasPrefix(s, "-") {
+		t.Fatalf("the child should print its identifiers unsigned. s: %s", s)
+	}
+}
+
+func TestWUID_AppendNext(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	w.Reset(0x20 << 32)
+	b := w.AppendNext([]byte("id="))
+	if string(b) != "id="+strconv.FormatInt(0x20<<32|1, 10) {
+		t.Fatalf("AppendNext returned %q", b)
+	}
+	if b := AppendString(b[:0], -42); string(b) != "-42" {
+		t.Fatalf("AppendString returned %q", b)
+	}
+}
+
+func TestWUID_NextStringFixed(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	if w.StringWidth() != 16 {
+		t.Fatalf("w.StringWidth() is %d, while it should be 16", w.StringWidth())
+	}
+	w.Reset(0x9 << 32)
+	s1 := w.NextStringFixed(16)
+	w.Reset(0x10 << 32)
+	s2 := w.NextStringFixed(16)
+	if len(s1) != 16 || len(s2) != 16 || s1 >= s2 {
+		t.Fatalf("s1: %s, s2: %s", s1, s2)
+	}
+	if s1 != "0000038654705665" {
+		t.Fatalf("s1 is %s, while it should be 0000038654705665", s1)
+	}
+	if w2 := NewWUID("alpha", slog.NewDumbLogger(), WithSection(1)); w2.StringWidth() != 19 {
+		t.Fatalf("w2.StringWidth() is %d, while it should be 19", w2.StringWidth())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NextStringFixed should have panicked with a small width")
+		}
+	}()
+	w.NextStringFixed(15)
+}
+
+func TestWithDeterministic(t *testing.T) {
+	newWUID := func() *WUID {
+		return NewWUID("alpha", slog.NewDumbLogger(), WithDeterministic(42), WithObfuscation(7), WithShards(4))
+	}
+	w1, w2 := newWUID(), newWUID()
+	if !w1.Deterministic() {
+		t.Fatal("w1 should be deterministic")
+	}
+	for i := 0; i < 100; i++ {
+		v1, v2 := w1.Next(), w2.Next()
+		if v1 != v2 {
+			t.Fatalf("v1: %d, v2: %d", v1, v2)
+		}
+		if v1>>32 != 42 {
+			t.Fatalf("h32 of %#016x should be 42", v1)
+		}
+	}
+
+	var renewed int32
+	w1.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		atomic.AddInt32(&renewed, 1)
+		return 43, nil
+	})
+	w1.N = 42<<32 | CriticalValue
+	w1.Next()
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&renewed) != 0 {
+		t.Fatal("a deterministic instance should not renew")
+	}
+
+	if err := Validate(WithDeterministic(0x200000)); err == nil {
+		t.Fatal("the seed should not exceed MaxH32")
+	}
+	if err := Validate(WithDeterministic(0x200000), WithSection(1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWUID_Next_Overflow(t *testing.T) {
+	setLanes := func(w *WUID, v int64) {
+		for i := 0; i <= len(w.shards); i++ {
+			atomic.StoreInt64(w.lane(i), v)
+		}
+	}
+	recoverErr := func(f func()) (err error) {
+		defer func() {
+			err, _ = recover().(error)
+		}()
+		f()
+		return nil
+	}
+	for _, step := range []int64{1, 3, 1000, 1024, MaxStep} {
+		for _, shards := range []int{1, 4} {
+			if step*int64(shards) > MaxStep {
+				continue
+			}
+			w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(step, 0), WithShards(shards))
+			w.Reset(0x20 << 32)
+			w.renewer = RenewerFunc(func(context.Context) (int64, error) { return 0, errors.New("beta") })
+			stride := w.layout().laneStride
+
+			// The callers that keep calling Next after the panic must not push the counter
+			// towards the next h32.
+			setLanes(w, 0x20<<32|(PanicValue-1)/stride*stride)
+			for i := 0; i < 1000; i++ {
+				if err := recoverErr(func() { w.Next() }); err != nil && !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+					t.Fatalf("step: %d, shards: %d, unexpected error: %v", step, shards, err)
+				}
+				if err := recoverErr(func() { w.NextN(make([]int64, 1)) }); !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+					t.Fatalf("step: %d, shards: %d, NextN should have panicked, err: %v", step, shards, err)
+				}
+			}
+			for i := 0; i < shards; i++ {
+				if v := atomic.LoadInt64(w.lane(i)); v>>32 != 0x20 || v&L32Mask > PanicValue+stride {
+					t.Fatalf("step: %d, shards: %d, lane %d is %#016x", step, shards, i, v)
+				}
+			}
+
+			// A carry into the high bits must never produce an identifier.
+			setLanes(w, 0x20<<32|L32Mask-stride+1)
+			if err := recoverErr(func() { w.Next() }); !errors.Is(err, wuiderr.ErrLowBitsOverflow) {
+				t.Fatalf("step: %d, shards: %d, err is %v, while it should be wuiderr.ErrLowBitsOverflow", step, shards, err)
+			}
+			setLanes(w, 0x20<<32|L32Mask-stride+1)
+			if err := recoverErr(func() { w.NextN(make([]int64, 1)) }); !errors.Is(err, wuiderr.ErrLowBitsOverflow) {
+				t.Fatalf("step: %d, shards: %d, err is %v, while it should be wuiderr.ErrLowBitsOverflow", step, shards, err)
+			}
+		}
+	}
+
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	if err := recoverErr(func() { w.Reset((w.MaxH32() + 1) << 32) }); !errors.Is(err, wuiderr.ErrLowBitsOverflow) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrLowBitsOverflow", err)
+	}
+	if err := w.ResetForward((w.MaxH32() + 1) << 32); !errors.Is(err, wuiderr.ErrLowBitsOverflow) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrLowBitsOverflow", err)
+	}
+}
+
+func TestWUID_RenewalThreshold(t *testing.T) {
+	var steps []int64
+	for step := int64(1); step <= MaxStep; step++ {
+		if step <= 1024 || step&(step-1) == 0 || step%1000 == 0 {
+			steps = append(steps, step)
+		}
+	}
+	for _, step := range steps {
+		w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(step, 0))
+		l := w.layout()
+		critical := w.RenewalThreshold()
+		if critical > CriticalValue || critical < PanicValue/2 || critical%1024 != 0 {
+			t.Fatalf("step: %d, critical: %#x", step, critical)
+		}
+		if (PanicValue-critical)/step < MinRenewHeadroom && critical >= PanicValue/2+1024 {
+			t.Fatalf("step: %d, the headroom is only %d identifiers", step, (PanicValue-critical)/step)
+		}
+		// The first renewal attempt must be made before Next panics.
+		first := (critical + l.renewMask) &^ l.renewMask
+		if first+step > PanicValue {
+			t.Fatalf("step: %d, the first renewal attempt is at %#x, beyond the panic value", step, first)
+		}
+	}
+
+	for _, step := range []int64{1024, 4096, MaxStep} {
+		w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(step, 0))
+		w.Reset(0x20 << 32)
+		var numCalls int32
+		w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+			atomic.AddInt32(&numCalls, 1)
+			return 0, errors.New("beta")
+		})
+		atomic.StoreInt64(&w.N, 0x20<<32|(w.RenewalThreshold()-1)/step*step)
+		var numIssued int64
+		func() {
+			defer func() {
+				if r := recover(); r != wuiderr.ErrLowBitsExhausted {
+					t.Fatalf("step: %d, unexpected panic: %v", step, r)
+				}
+			}()
+			for {
+				w.Next()
+				numIssued++
+			}
+		}()
+		for atomic.LoadInt32(&w.renewing) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if atomic.LoadInt32(&numCalls) == 0 {
+			t.Fatalf("step: %d, no renewal was attempted before the panic", step)
+		}
+		if numIssued < MinRenewHeadroom && numIssued < (PanicValue-PanicValue/2)/step-1 {
+			t.Fatalf("step: %d, only %d identifiers were issued after the renewal became due", step, numIssued)
+		}
+	}
+}
+
+func TestWithRenewCheckInterval(t *testing.T) {
+	for _, step := range []int64{1, 1024} {
+		w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(step, 0), WithRenewCheckInterval(1000))
+		w.Reset(0x20 << 32)
+		w.FastForward()
+		var numCalls int32
+		w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+			atomic.AddInt32(&numCalls, 1)
+			return 0, errors.New("beta")
+		})
+		for i := 0; i < 5000; i++ {
+			w.Next()
+			for atomic.LoadInt32(&w.renewing) != 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		// 1000 is rounded up to 1024 identifiers.
+		if n := atomic.LoadInt32(&numCalls); n != 5 {
+			t.Fatalf("step: %d, %d renewal attempts were made, while there should be 5", step, n)
+		}
+	}
+
+	if err := Validate(WithStep(1024, 0), WithRenewCheckInterval(1<<21)); err == nil {
+		t.Fatal("the interval should be too large to trigger a renewal before the panic")
+	}
+}
+
+func TestWUID_Next_SingleFlight(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(0x20 << 32)
+	var inFlight, maxInFlight, numCalls int32
+	release := make(chan struct{})
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&numCalls, 1)
+		<-release
+		return 0x21, nil
+	})
+
+	// Every goroutine crosses a different renewal boundary while the first renewal is stuck.
+	var wg sync.WaitGroup
+	for b := Bye + 1; b < PanicValue; b += RenewIntervalMask + 1 {
+		wg.Add(1)
+		go func(b int64) {
+			defer wg.Done()
+			p := &w.N
+			for {
+				n := atomic.LoadInt64(p)
+				if atomic.CompareAndSwapInt64(p, n, 0x20<<32|b-1) {
+					break
+				}
+			}
+			w.Next()
+		}(b)
+	}
+	wg.Wait()
+	close(release)
+	for atomic.LoadInt32(&w.renewing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&numCalls); n != 1 {
+		t.Fatalf("%d renewals were started, while there should be only one", n)
+	}
+	if m := atomic.LoadInt32(&maxInFlight); m != 1 {
+		t.Fatalf("%d renewals were in flight at the same time", m)
+	}
+
+	atomic.StoreInt64(&w.N, 0x20<<32|Bye)
+	w.Next()
+	for atomic.LoadInt32(&numCalls) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithSynchronousRenew(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithSynchronousRenew(50*time.Millisecond))
+	w.Reset(0x20<<32 | Bye - 1)
+	var timeout time.Duration
+	var fail bool
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		timeout = w.RenewTimeout()
+		if fail {
+			return 0, errors.New("beta")
+		}
+		return 0x21, nil
+	})
+	w.Next()
+	if w.N != 0x20<<32|Bye || timeout != 0 {
+		t.Fatal("the renewal should not start before the critical value")
+	}
+	w.Next()
+	if w.N != 0x21<<32 {
+		t.Fatalf("the renewal should be done before Next returns. w.N: %#016x", w.N)
+	}
+	if timeout != 50*time.Millisecond {
+		t.Fatalf("the renewal should be bounded by the budget, not %v", timeout)
+	}
+	if w.RenewTimeout() != DefaultRenewTimeout {
+		t.Fatal("the budget should only apply to the synchronous renewals")
+	}
+
+	fail = true
+	w.Reset(0x21<<32 | Bye)
+	w.Next()
+	if w.Stats().NumRenewFailed != 1 {
+		t.Fatal("the failed renewal should be recorded")
+	}
+
+	if err := Validate(WithSynchronousRenew(time.Second), WithMaxH32Age(time.Hour)); err == nil {
+		t.Fatal("WithSynchronousRenew should not be combined with WithMaxH32Age")
+	}
+}
+
+func TestWUID_NextULID(t *testing.T) {
+	if s := encodeULID(time.UnixMilli(0), 1); s != "00000000000000000000000001" {
+		t.Fatalf("encodeULID returned %s", s)
+	}
+	if s := encodeULID(time.UnixMilli(1<<48-1), 1<<63-1); s != "7ZZZZZZZZZ0007ZZZZZZZZZZZZ" {
+		t.Fatalf("encodeULID returned %s", s)
+	}
+
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(0x20 << 32)
+	prev := ""
+	for i := 0; i < 100; i++ {
+		s := w.NextULID()
+		if len(s) != 26 || s <= prev {
+			t.Fatalf("s: %s, prev: %s", s, prev)
+		}
+		prev = s
+	}
+	if !strings.HasSuffix(prev, "0000040000034") {
+		t.Fatalf("the ULID should end with the identifier %d: %s", 0x20<<32+100, prev)
+	}
+}
+
+func TestWUID_StringFormat(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	f := w.StringFormat()
+	if f.Pattern != "^[1-9][0-9]{9,15}$" || f.MinLength != 10 || f.MaxLength != 16 {
+		t.Fatalf("unexpected format: %+v", f)
+	}
+	re := regexp.MustCompile(f.Pattern)
+	for _, h32 := range []int64{1, 0x20, w.MaxH32()} {
+		w.Reset(h32 << 32)
+		s := w.NextString()
+		if !re.MatchString(s) {
+			t.Fatalf("%s does not match %s", s, f.Pattern)
+		}
+		if n, err := f.Parse(s); err != nil || strconv.FormatInt(n, 10) != s {
+			t.Fatalf("f.Parse(%q) returned %d, %v", s, n, err)
+		}
+	}
+	for _, s := range []string{"", "123", "04294967297", "42949672970000000", "4294967297x", "-4294967297"} {
+		if _, err := f.Parse(s); err == nil {
+			t.Fatalf("f.Parse(%q) should have failed", s)
+		}
+	}
+
+	if f := NewWUID("alpha", slog.NewDumbLogger(), WithSection(1)).StringFormat(); f.MinLength != 19 || f.MaxLength != 19 {
+		t.Fatalf("unexpected format with a section: %+v", f)
+	}
+
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), WithChecksum(10))
+	w2.Reset(0x20 << 32)
+	f2 := w2.StringFormat()
+	v := w2.NextString()
+	if _, err := f2.Parse(v); err != nil {
+		t.Fatal(err)
+	}
+	typo := v[:len(v)-1] + string('0'+(v[len(v)-1]-'0'+1)%10)
+	if _, err := f2.Parse(typo); err == nil {
+		t.Fatalf("f2.Parse(%q) should have failed", typo)
+	}
+
+	w3 := NewWUID("alpha", slog.NewDumbLogger(), WithTransform(func(n int64) int64 { return n - 1<<32 }))
+	if f3 := w3.StringFormat(); f3 != AnyStringFormat() {
+		t.Fatalf("unexpected format with a transform: %+v", f3)
+	}
+}
+
+func TestNewWUID_Logger(t *testing.T) {
+	if _, ok := NewWUID("alpha", nil).Logger.(dumbLogger); !ok {
+		t.Fatal("a nil logger should mean no logs")
+	}
+	if _, ok := NewWUID("alpha", nil, WithVerboseLogging()).Logger.(stdLogger); !ok {
+		t.Fatal("WithVerboseLogging should log with the standard log package")
+	}
+	logger := slog.NewDumbLogger()
+	if NewWUID("alpha", logger, WithVerboseLogging()).Logger != Logger(logger) {
+		t.Fatal("the logger passed in should be used")
+	}
+}
+
+func TestWithRenewTimeout(t *testing.T) {
+	if d := NewWUID("alpha", nil).RenewTimeout(); d != DefaultRenewTimeout {
+		t.Fatalf("the default renew timeout is %s, while it should be %s", d, DefaultRenewTimeout)
+	}
+	if d := NewWUID("alpha", nil, WithRenewTimeout(time.Second)).RenewTimeout(); d != time.Second {
+		t.Fatalf("the renew timeout is %s, while it should be 1s", d)
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithRenewTimeout(0)
+		t.Fatal("WithRenewTimeout should have panicked")
+	}()
+}
+
+func TestWithMaxH32Age(t *testing.T) {
+	w := NewWUID("alpha", nil, WithMaxH32Age(time.Millisecond*20))
+	defer w.Stop()
+	var h32 int64 = 10
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.AddInt64(&h32, 1), nil
+	})
+	w.Reset(h32 << 32)
+
+	startTime := time.Now()
+	for atomic.LoadInt64(&w.stats.NumRenewed) < 3 {
+		if time.Since(startTime) > time.Second*5 {
+			t.Fatal("h32 should have been renewed by age")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if v := atomic.LoadInt64(&w.N) >> 32; v < 13 {
+		t.Fatalf("h32 is %d, while it should be at least 13", v)
+	}
+
+	w.Stop()
+	w.Stop()
+	time.Sleep(time.Millisecond * 30)
+	n := atomic.LoadInt64(&w.stats.NumRenewed)
+	time.Sleep(time.Millisecond * 60)
+	if v := atomic.LoadInt64(&w.stats.NumRenewed); v != n {
+		t.Fatal("the background renewal should have stopped")
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithMaxH32Age(0)
+		t.Fatal("WithMaxH32Age should have panicked")
+	}()
+}
+
+func TestWithMaxH32Age_SingleFlight(t *testing.T) {
+	w := NewWUID("alpha", nil, WithMaxH32Age(time.Millisecond*50))
+	defer w.Stop()
+	var h32, calls int64 = 10, 0
+	release := make(chan struct{})
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			<-release
+		}
+		return atomic.AddInt64(&h32, 1), nil
+	})
+	w.Reset(h32 << 32)
+
+	startTime := time.Now()
+	for atomic.LoadInt64(&calls) == 0 {
+		if time.Since(startTime) > time.Second*5 {
+			t.Fatal("h32 should have been renewed by age")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The renewals triggered by Next while the one by age is in flight are skipped.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.triggerRenew()
+		}()
+	}
+	wg.Wait()
+	close(release)
+	time.Sleep(time.Millisecond * 20)
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("the renewer was called %d times, while the renewals should be single-flight", n)
+	}
+}
+
+func TestWUID_ResetForward(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithSection(1))
+	w.Reset(0x20 << 32)
+	w.Next()
+	if err := w.ResetForward(0x21<<32 | 100); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v != 1<<60|0x21<<32|101 {
+		t.Fatalf("w.Next() returned %#016x, while it should be %#016x", v, 1<<60|0x21<<32|101)
+	}
+	if err := w.ResetForward(0x21<<32 | 101); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.ResetForward(0x20 << 32); !errors.Is(err, wuiderr.ErrRewind) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrRewind", err)
+	}
+	if v := w.Next(); v != 1<<60|0x21<<32|102 {
+		t.Fatal("a refused ResetForward should not change the counter")
+	}
+	if err := w.ResetForward(0x20<<32, AllowRewind()); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v != 1<<60|0x20<<32|1 {
+		t.Fatalf("w.Next() returned %#016x, while it should be %#016x", v, 1<<60|0x20<<32|1)
+	}
+
+	if err := w.ResetForward(-1); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	if err := w.ResetForward(0x30<<32 | PanicValue); !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrLowBitsExhausted", err)
+	}
+}
+
+func TestWUID_ReconfigureStep(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(16, 0))
+	w.Reset(0x20 << 32)
+	if err := w.ReconfigureStep(1000, 10); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v != 0x20<<32|16 {
+		t.Fatalf("w.Next() returned %#x, while the step should not change before the next h32", v)
+	}
+	w.ResetForward(0x20<<32 | 100)
+	if v := w.Next(); v != 0x20<<32|116 {
+		t.Fatalf("w.Next() returned %#x, while the step should not change within the same h32", v)
+	}
+
+	w.Reset(0x21 << 32)
+	v1, v2 := w.Next(), w.Next()
+	if v2-v1 != 1000 || v1%10 != 0 {
+		t.Fatalf("v1: %#x, v2: %#x, while the new step and floor should be in effect", v1, v2)
+	}
+	w.Reset(0x22 << 32)
+	if v3, v4 := w.Next(), w.Next(); v4-v3 != 1000 {
+		t.Fatalf("v3: %#x, v4: %#x, while the new step should stay", v3, v4)
+	}
+
+	if err := w.ReconfigureStep(0, 0); err == nil {
+		t.Fatal("an invalid step should be rejected")
+	}
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), WithObfuscation(1), WithStep(16, 10))
+	if err := w2.ReconfigureStep(12, 10); err == nil {
+		t.Fatal("the obfuscation with a floor should require the step to be a power of 2")
+	}
+	if err := w2.ReconfigureStep(32, 10); err != nil {
+		t.Fatal(err)
+	}
+	w2.Reset(0x20 << 32)
+	seen := make(map[int64]struct{})
+	for i := 0; i < 10000; i++ {
+		v := w2.Next()
+		if _, ok := seen[v]; ok || v%10 != 0 {
+			t.Fatalf("%#x is either a duplicate or not a multiple of the floor", v)
+		}
+		seen[v] = struct{}{}
+	}
+}
+
+func TestWUID_ReconfigureStep_Concurrent(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithObfuscation(1), WithStep(16, 10))
+	var h32 int64 = 0x20
+	if err := w.Load(context.Background(), RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.AddInt64(&h32, 1), nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	const numWorkers, numIDs = 4, 10000
+	results := make([][]int64, numWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < numIDs; j++ {
+				results[i] = append(results[i], w.Next())
+			}
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		step := int64(16 << (i % 3))
+		if err := w.ReconfigureStep(step, 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := w.CurrentStep(); s != step {
+			t.Fatalf("the step in use is %d, while it should be %d after the renewal", s, step)
+		}
+	}
+	wg.Wait()
+
+	seen := make(map[int64]struct{}, numWorkers*numIDs)
+	for _, ids := range results {
+		for _, v := range ids {
+			if _, ok := seen[v]; ok {
+				t.Fatalf("duplicate: %#x", v)
+			}
+			seen[v] = struct{}{}
+		}
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithRateLimit(10))
+	w.Reset(0x20 << 32)
+	for i := 0; i < 10; i++ {
+		if _, err := w.NextOrErr(); err != nil {
+			t.Fatalf("NextOrErr should succeed within the burst. err: %v", err)
+		}
+	}
+	if _, err := w.NextOrErr(); !errors.Is(err, wuiderr.ErrRateLimited) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrRateLimited", err)
+	}
+
+	start := time.Now()
+	w.Next()
+	w.Next()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("Next should have waited for the rate limit. elapsed: %v", elapsed)
+	}
+
+	w2 := NewWUID("alpha", slog.NewDumbLogger())
+	w2.N = 0x20<<32 | PanicValue
+	if _, err := w2.NextOrErr(); !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrLowBitsExhausted", err)
+	}
+}
+
+func TestWithTransform(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(16, 10),
+		WithTransform(func(v int64) int64 { return v * 10 }),
+		WithTransform(func(v int64) int64 { return v + 3 }))
+	w.Reset(0x20 << 32)
+	expected := func(v1 int64) int64 {
+		return v1/10*10*10 + 3
+	}
+	if v := w.Next(); v != expected(0x20<<32+16) {
+		t.Fatalf("w.Next() returned %d, while it should be %d", v, expected(0x20<<32+16))
+	}
+	dst := make([]int64, 2)
+	w.NextN(dst)
+	if dst[0] != expected(0x20<<32+32) || dst[1] != expected(0x20<<32+48) {
+		t.Fatalf("w.NextN returned %d", dst)
+	}
+
+	if err := Validate(WithTransform(func(v int64) int64 { return v & 0xFFFF })); err == nil {
+		t.Fatal("a transform dropping the high bits should be rejected")
+	}
+	if err := Validate(WithTransform(func(v int64) int64 { return v / 10 })); err == nil {
+		t.Fatal("a transform truncating the low digits should be rejected")
+	}
+	if err := Validate(WithTransform(func(v int64) int64 { return -v })); err == nil {
+		t.Fatal("a transform producing negative numbers should be rejected")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("NewWUID should have panicked with a transform that is not injective")
+			}
+		}()
+		NewWUID("alpha", slog.NewDumbLogger(), WithTransform(func(v int64) int64 { return v >> 1 }))
+	}()
+}
+
+func TestWithChecksum(t *testing.T) {
+	if !ValidateChecksum(5724) || ValidateChecksum(5723) || ValidateChecksum(7524) {
+		t.Fatal("ValidateChecksum does not work as expected")
+	}
+
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithChecksum(10))
+	w.Reset(0x20 << 32)
+	for i := 0; i < 100; i++ {
+		v := w.Next()
+		if !ValidateChecksum(v) {
+			t.Fatalf("%d should pass the checksum validation", v)
+		}
+		if v/10 != 0x20<<32+int64(i)+1 {
+			t.Fatalf("%d should be %d followed by a check digit", v, 0x20<<32+int64(i)+1)
+		}
+		if typo := v/10*10 + (v%10+1)%10; ValidateChecksum(typo) {
+			t.Fatalf("%d should not pass the checksum validation", typo)
+		}
+	}
+	if w.StringWidth() != 17 {
+		t.Fatalf("w.StringWidth() is %d, while it should be 17", w.StringWidth())
+	}
+
+	if err := Validate(WithChecksum(10), WithSection(1)); err == nil {
+		t.Fatal("WithChecksum should not be combined with WithSection")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("WithChecksum should have panicked")
+			}
+		}()
+		WithChecksum(11)
+	}()
+}
+
+func TestWUID_ApplyOptions(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithStep(16, 0))
+	w.Reset(0x20 << 32)
+	if err := w.ApplyOptions(WithRenewTimeout(time.Second), WithReadyTimeout(2*time.Second), WithRateLimit(1), WithLogSampling(4)); err != nil {
+		t.Fatal(err)
+	}
+	if w.RenewTimeout() != time.Second || w.ReadyTimeout() != 2*time.Second {
+		t.Fatalf("RenewTimeout: %v, ReadyTimeout: %v", w.RenewTimeout(), w.ReadyTimeout())
+	}
+	if _, err := w.NextOrErr(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.NextOrErr(); !errors.Is(err, wuiderr.ErrRateLimited) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrRateLimited", err)
+	}
+
+	for _, opt := range []Option{WithStep(32, 0), WithSection(1), WithObfuscation(1), WithVerboseLogging(), WithShards(2)} {
+		if err := w.ApplyOptions(WithRenewTimeout(3*time.Second), opt); err == nil {
+			t.Fatal("ApplyOptions should reject the options changing the numbers")
+		}
+	}
+	if w.RenewTimeout() != time.Second {
+		t.Fatal("nothing should be applied when an option is rejected")
+	}
+	if err := w.ApplyOptions(nil); err == nil {
+		t.Fatal("ApplyOptions should reject a nil option")
+	}
+	if err := w.ApplyOptions(WithRateLimit(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.NextOrErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithDuplicateGuard(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithDuplicateGuard(4))
+	w.Reset(0x20 << 32)
+	for i := 0; i < 10; i++ {
+		w.Next()
+	}
+	dst := make([]int64, 3)
+	w.NextN(dst)
+
+	w.Reset(0x20<<32 | 11)
+	func() {
+		defer func() {
+			r := recover()
+			if err, ok := r.(error); !ok || !errors.Is(err, wuiderr.ErrDuplicateID) {
+				t.Fatalf("Next should have panicked with wuiderr.ErrDuplicateID. r: %v", r)
+			}
+		}()
+		w.Next()
+	}()
+
+	// 0x20<<32|1 has been evicted from the window.
+	w.Reset(0x20 << 32)
+	w.Next()
+
+	var dups []int64
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), WithDuplicateGuard(16), WithDuplicateCallback(func(id int64) {
+		dups = append(dups, id)
+	}))
+	w2.Reset(0x20 << 32)
+	w2.Next()
+	w2.Next()
+	w2.Reset(0x20 << 32)
+	w2.NextN(dst)
+	if len(dups) != 2 || dups[0] != 0x20<<32|1 || dups[1] != 0x20<<32|2 {
+		t.Fatalf("the duplicates reported are %#x", dups)
+	}
+
+	if err := Validate(WithDuplicateCallback(func(int64) {})); err == nil {
+		t.Fatal("WithDuplicateCallback should require WithDuplicateGuard")
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithDuplicateGuard(0)
+		t.Fatal("WithDuplicateGuard should have panicked")
+	}()
+}
+
+func TestWUID_Loadh32Async(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithReadyTimeout(time.Second*5))
+	release := make(chan struct{})
+	load := func() error {
+		<-release
+		w.Reset(42 << 32)
+		return nil
+	}
+	errc := w.Loadh32Async(load)
+
+	ch := make(chan int64, 1)
+	go func() {
+		ch <- w.Next()
+	}()
+	select {
+	case <-ch:
+		t.Fatal("Next should have blocked until the first load is done")
+	case <-time.After(time.Millisecond * 50):
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if v := <-ch; v != 42<<32|1 {
+		t.Fatalf("Next returned %#016x, while it should be %#016x", v, 42<<32|1)
+	}
+	dst := make([]int64, 2)
+	w.NextN(dst)
+
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), WithReadyTimeout(time.Millisecond*50))
+	foo := errors.New("foo")
+	if err := <-w2.Loadh32Async(func() error { return foo }); err != foo {
+		t.Fatalf("err is %v, while it should be foo", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != wuiderr.ErrNotReady {
+				t.Fatalf("Next should have panicked with wuiderr.ErrNotReady. r: %v", r)
+			}
+		}()
+		w2.Next()
+	}()
+	if err := <-w2.Loadh32Async(func() error { w2.Reset(42 << 32); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if v := w2.Next(); v != 42<<32|1 {
+		t.Fatalf("Next returned %#016x, while it should be %#016x", v, 42<<32|1)
+	}
+
+	if d := NewWUID("alpha", nil, WithRenewTimeout(time.Second)).ReadyTimeout(); d != time.Second {
+		t.Fatalf("the ready timeout is %s, while it should be 1s", d)
+	}
+}
+
+type memMirror struct {
+	sync.Mutex
+	h32 []int64
+	err error
+}
+
+func (m *memMirror) Store(ctx context.Context, h32 int64) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.h32 = append(m.h32, h32)
+	return nil
+}
+
+func (m *memMirror) Load(ctx context.Context) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+	if len(m.h32) == 0 {
+		return 0, errors.New("empty")
+	}
+	return m.h32[len(m.h32)-1], nil
+}
+
+func TestWithMirror(t *testing.T) {
+	m := &memMirror{}
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithMirror(m))
+	for _, h32 := range []int64{10, 11, 12} {
+		w.Reset(h32 << 32)
+	}
+
+	startTime := time.Now()
+	for {
+		if h32, err := w.LoadMirror(); err == nil && h32 == 12 {
+			break
+		}
+		if time.Since(startTime) > time.Second*5 {
+			t.Fatal("h32 should have been mirrored")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	w.mirrorh32(11)
+	m.Lock()
+	if m.h32[len(m.h32)-1] != 12 {
+		t.Fatal("a smaller h32 should not be mirrored")
+	}
+	m.err = errors.New("foo")
+	m.Unlock()
+	w.mirrorh32(13)
+	if w.mirrored != 12 {
+		t.Fatal("a failed store should not be recorded")
+	}
+
+	if _, err := NewWUID("alpha", nil).LoadMirror(); err == nil {
+		t.Fatal("LoadMirror should have failed without a mirror")
+	}
+}
+
+func TestWUID_CallWithTimeout(t *testing.T) {
+	w := NewWUID("alpha", nil, WithRenewTimeout(time.Millisecond*50))
+	foo := errors.New("foo")
+	if err := w.CallWithTimeout(func() error { return foo }); err != foo {
+		t.Fatalf("err is %v, while it should be foo", err)
+	}
+	startTime := time.Now()
+	err := w.CallWithTimeout(func() error {
+		time.Sleep(time.Millisecond * 300)
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err is %v, while it should be context.DeadlineExceeded", err)
+	}
+	if time.Since(startTime) > time.Millisecond*200 {
+		t.Fatal("CallWithTimeout should not wait for f")
+	}
+}
+
+func TestWUID_CallWithContext(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	foo := errors.New("foo")
+	if err := w.CallWithContext(context.Background(), func() error { return foo }); err != foo {
+		t.Fatalf("err is %v, while it should be foo", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	startTime := time.Now()
+	err := w.CallWithContext(ctx, func() error {
+		time.Sleep(time.Millisecond * 300)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err is %v, while it should be context.Canceled", err)
+	}
+	if time.Since(startTime) > time.Millisecond*200 {
+		t.Fatal("CallWithContext should not wait for f")
+	}
+}
+
+func TestWithShards(t *testing.T) {
+	const step = 4
+	w := NewWUID("alpha", slog.NewScavenger(), WithShards(8), WithStep(step, 3))
+	w.Reset(1 << 32)
+	var renewed int32
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		atomic.StoreInt32(&renewed, 1)
+		return 0, errors.New("beta")
+	})
+
+	var mu sync.Mutex
+	const N1 = 100
+	const N2 = 100
+	seen := make(map[int64]bool, N1*N2)
+	var wg sync.WaitGroup
+	for i := 0; i < N1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < N2; j++ {
+				id := w.Next()
+				mu.Lock()
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != N1*N2 {
+		t.Fatalf("duplication detected. len(seen): %d", len(seen))
+	}
+	for id := range seen {
+		if id>>32 != 1 || id%3 != 0 {
+			t.Fatalf("the id is not properly generated. id: %x", id)
+		}
+	}
+	if n := w.Stats().NumIssued; n != N1*N2 {
+		t.Fatalf("NumIssued is %d, while it should be %d", n, N1*N2)
+	}
+
+	const stride = step * 8
+	w.storeLanes(1<<32 | (Bye+1)/stride*stride - stride)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 1)
+	if atomic.LoadInt32(&renewed) != 1 {
+		t.Fatal("the renewal is not triggered")
+	}
+
+	fastest := int64(1<<32 | (PanicValue-1024)/stride*stride + 5*step)
+	atomic.StoreInt64(w.lane(5), fastest)
+	if usage := w.Stats().LowBitsUsage; usage < 99 {
+		t.Fatalf("LowBitsUsage should follow the fastest lane. usage: %f", usage)
+	}
+	if watermark := w.Exhaust(); watermark != fastest {
+		t.Fatalf("the watermark is %x, while it should be %x", watermark, fastest)
+	}
+	for i := 0; i < 100; i++ {
+		func() {
+			defer func() {
+				_ = recover()
+			}()
+			w.Next()
+			t.Fatal("Next should have panicked after Exhaust")
+		}()
+	}
+
+	if err := Validate(WithShards(256), WithStep(8192, 0)); err == nil {
+		t.Fatal("Validate should have rejected the huge stride")
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithShards(0)
+		t.Fatal("WithShards should have panicked")
+	}()
+}
+
+func TestWUID_Next_Panic(t *testing.T) {
+	const total = 100
+	w := NewWUID("alpha", nil)
+	atomic.StoreInt64(&w.N, PanicValue)
+
+	ch := make(chan int64, total)
+	for i := 0; i < total; i++ {
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					ch <- 0
+				}
+			}()
+
+			ch <- w.Next()
+		}()
+	}
+
+	for i := 0; i < total; i++ {
+		v := <-ch
+		if v != 0 {
+			t.Fatal("something is wrong with Next()")
+		}
+	}
+}
+
+func TestWUID_Errors(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	if err := w.Verifyh32(0); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	if err := w.Verifyh32(0x200000); !errors.Is(err, wuiderr.ErrH32Exhausted) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrH32Exhausted", err)
+	}
+
+	foo := errors.New("foo")
+	w2 := NewWUID("alpha", nil, Withh32Verifier(func(h32 int64) error {
+		return foo
+	}))
+	if err := w2.Verifyh32(100); !errors.Is(err, wuiderr.ErrInvalidH32) || !errors.Is(err, foo) {
+		t.Fatalf("err is %v, while it should be both wuiderr.ErrInvalidH32 and foo", err)
+	}
+
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return 0, foo
+	})
+	var rf *wuiderr.ErrRenewFailed
+	if err := w.RenewNow(); !errors.As(err, &rf) || rf.Cause != foo || !errors.Is(err, foo) {
+		t.Fatalf("err is %v, while it should be a *wuiderr.ErrRenewFailed", err)
+	}
+
+	atomic.StoreInt64(&w.N, PanicValue)
+	func() {
+		defer func() {
+			r := recover()
+			if err, ok := r.(error); !ok || !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+				t.Fatalf("r is %v, while it should be wuiderr.ErrLowBitsExhausted", r)
+			}
+		}()
+		w.Next()
+	}()
+}
+
+func waitUntilNumRenewAttemptsReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second {
+		if w.Stats().NumRenewAttempts == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+type resumer struct {
+	sync.Mutex
+	h32, low int64
+	locked   bool
+}
+
+func (r *resumer) Renew(ctx context.Context) (int64, error) {
+	return 0, errors.New("Resume should have been called")
+}
+
+func (r *resumer) Resume(ctx context.Context) (int64, int64, error) {
+	if r.TryLock() {
+		r.Unlock()
+	} else {
+		r.locked = true
+	}
+	return r.h32, r.low, nil
+}
+
+func TestWUID_Load(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	if err := w.RenewNow(); err == nil {
+		t.Fatal("RenewNow should fail before anything is loaded")
+	}
+
+	invalid := RenewerFunc(func(ctx context.Context) (int64, error) {
+		return 0, nil
+	})
+	if err := w.Load(context.Background(), invalid); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("h32 is not properly verified, err: %v", err)
+	}
+	if w.Renewer() != nil {
+		t.Fatal("a Renewer should not be saved before a successful load")
+	}
+
+	var h32 int64 = 10
+	r := RenewerFunc(func(ctx context.Context) (int64, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return 0, errors.New("no deadline")
+		}
+		return atomic.AddInt64(&h32, 1), nil
+	})
+	if err := w.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Apply(context.Background(), 20, invalid); err != nil {
+		t.Fatal(err)
+	}
+	if w.N != 20<<32 {
+		t.Fatalf("w.N is %#016x", w.N)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if w.N != 12<<32 {
+		t.Fatalf("the first Renewer should have been kept. w.N: %#016x", w.N)
+	}
+
+	w2 := NewWUID("alpha", slog.NewDumbLogger())
+	rs := &resumer{h32: 3, low: 1000}
+	if err := w2.Load(context.Background(), rs); err != nil {
+		t.Fatal(err)
+	}
+	if w2.N != 3<<32|1000 || !rs.locked {
+		t.Fatalf("the counter should resume from the watermark under the lock. w2.N: %#016x", w2.N)
+	}
+}
+
+func TestWUID_Renew(t *testing.T) {
+	w := NewWUID("alpha", slog.NewScavenger())
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.LoadInt64(&w.N)>>32 + 1, nil
+	})
+
+	w.Reset(Bye)
+	n1a := w.Next()
+	if n1a>>32 != 0 {
+		t.Fatal(`n1a>>32 != 0`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != 1<<32+1 {
+		t.Fatal(`n1b != 1<<32+1`)
+	}
+
+	w.Reset(1<<32 | Bye)
+	n2a := w.Next()
+	if n2a>>32 != 1 {
+		t.Fatal(`n2a>>32 != 1`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 2)
+	n2b := w.Next()
+	if n2b != 2<<32+1 {
+		t.Fatal(`n2b != 2<<32+1`)
+	}
+
+	w.Reset(2<<32 | Bye + RenewIntervalMask + 1)
+	n3a := w.Next()
+	if n3a>>32 != 2 {
+		t.Fatal(`n3a>>32 != 2`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 3)
+	n3b := w.Next()
+	if n3b != 3<<32+1 {
+		t.Fatal(`n3b != 3<<32+1`)
+	}
+
+	w.Reset(Bye + 1)
+	for i := 0; i < 100; i++ {
+		w.Next()
+	}
+	if w.Stats().NumRenewAttempts != 3 {
+		t.Fatal(`w.Stats().NumRenewAttempts != 3`)
+	}
+
+	var num int
+	w.Scavenger().Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 3 {
+		t.Fatal(`num != 3`)
+	}
+}
+
+func TestWithRenewExecutor(t *testing.T) {
+	var numSubmitted int64
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithRenewExecutor(func(task func()) {
+		atomic.AddInt64(&numSubmitted, 1)
+		go task()
+	}))
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.LoadInt64(&w.N)>>32 + 1, nil
+	})
+
+	w.Reset(Bye)
+	w.Next()
+	waitUntilNumRenewedReaches(t, w, 1)
+	if atomic.LoadInt64(&numSubmitted) != 1 {
+		t.Fatal("the renewal should have been submitted to the executor")
+	}
+}
+
+func TestWUID_Renew_Error(t *testing.T) {
+	w := NewWUID("alpha", slog.NewScavenger())
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return 0, errors.New("foo")
+	})
+
+	w.Reset((1 >> 32 << 32) | Bye)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 1)
+	w.Next()
+
+	w.Reset((2 >> 32 << 32) | Bye)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 2)
+
+	for i := 0; i < 100; i++ {
+		w.Next()
+	}
+	if w.Stats().NumRenewAttempts != 2 {
+		t.Fatal(`w.Stats().NumRenewAttempts != 2`)
+	}
+	if w.Stats().NumRenewed != 0 {
+		t.Fatal(`w.Stats().NumRenewed != 0`)
+	}
+
+	var num int
+	w.Scavenger().Filter(func(level, msg string) bool {
+		if level == slog.LevelWarn && strings.Contains(msg, "renew failed") && strings.Contains(msg, "foo") {
+			num++
+		}
+		return true
+	})
+	if num != 2 {
+		t.Fatal(`num != 2`)
+	}
+}
+
+func TestWUID_Renew_Panic(t *testing.T) {
+	w := NewWUID("alpha", slog.NewScavenger())
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		panic("foo")
+	})
+
+	w.Reset((1 >> 32 << 32) | Bye)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 1)
+	w.Next()
+
+	w.Reset((2 >> 32 << 32) | Bye)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 2)
+
+	for i := 0; i < 100; i++ {
+		w.Next()
+	}
+	if w.Stats().NumRenewAttempts != 2 {
+		t.Fatal(`w.Stats().NumRenewAttempts != 2`)
+	}
+	if w.Stats().NumRenewed != 0 {
+		t.Fatal(`w.Stats().NumRenewed != 0`)
+	}
+
+	var num int
+	w.Scavenger().Filter(func(level, msg string) bool {
+		if level == slog.LevelWarn && strings.Contains(msg, "renew failed") && strings.Contains(msg, "foo") {
+			num++
+		}
+		return true
+	})
+	if num != 2 {
+		t.Fatal(`num != 2`)
+	}
+}
+
+func TestWUID_Step(t *testing.T) {
+	const step = 16
+	w := NewWUID("alpha", slog.NewScavenger(), WithStep(step, 0))
+	w.Reset(17 << 32)
+
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.LoadInt64(&w.N)>>32 + 1, nil
+	})
+
+	for i := int64(1); i < 100; i++ {
+		if w.Next()&L32Mask != step*i {
+			t.Fatal("w.Next()&L36Mask != step*i")
+		}
+	}
+
+	n1 := w.Next()
+	w.Reset(((n1 >> 32 << 32) | Bye) & ^(step - 1))
+	w.Next()
+	waitUntilNumRenewedReaches(t, w, 1)
+	n2 := w.Next()
+
+	w.Reset(((n2 >> 32 << 32) | Bye) & ^(step - 1))
+	w.Next()
+	waitUntilNumRenewedReaches(t, w, 2)
+	n3 := w.Next()
+
+	if n2>>32-n1>>32 != 1 || n3>>32-n2>>32 != 1 {
+		t.Fatalf("the renew mechanism does not work as expected: %x, %x, %x", n1>>32, n2>>32, n3>>32)
+	}
+
+	var num int
+	w.Scavenger().Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 2 {
+		t.Fatal(`num != 2`)
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil, WithStep(0, 0))
+		t.Fatal("WithStep should have panicked")
+	}()
+}
+
+func TestWUID_Step_Arbitrary(t *testing.T) {
+	const step = 1000
+	w := NewWUID("alpha", slog.NewScavenger(), WithStep(step, 0))
+	w.Reset(17 << 32)
+
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.LoadInt64(&w.N)>>32 + 1, nil
+	})
+
+	for i := int64(1); i < 100; i++ {
+		if w.Next()&L32Mask != step*i {
+			t.Fatal("w.Next()&L32Mask != step*i")
+		}
+	}
+
+	n1 := w.Next()
+	atomic.StoreInt64(&w.N, n1>>32<<32|(Bye+1)/step*step)
+	for w.Next()&L32Mask < Bye {
+	}
+	waitUntilNumRenewedReaches(t, w, 1)
+	n2 := w.Next()
+	if n2>>32-n1>>32 != 1 || n2&L32Mask != step {
+		t.Fatalf("the renew mechanism does not work as expected: %x, %x", n1, n2)
+	}
+
+	if err := Validate(WithStep(1000, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(WithStep(1024, 10), WithObfuscation(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(WithStep(1000, 10), WithObfuscation(1)); err == nil {
+		t.Fatal("Validate should have rejected the obfuscation with a floor")
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil, WithStep(1000, 10), WithObfuscation(1))
+		t.Fatal("NewWUID should have panicked")
+	}()
+}
+
+func TestWUID_Floor(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	allSteps := []int64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 3, 10, 100, 1000, 4096, MaxStep}
+	for loop := 0; loop < 10000; loop++ {
+		step := allSteps[r.Intn(len(allSteps))]
+		var floor = r.Int63n(step)
+		w := NewWUID("alpha", slog.NewScavenger(), WithStep(step, floor))
+		if floor < 2 {
+			if w.Flags != 0 {
+				t.Fatal(`w.Flags != 0`)
+			}
+		} else {
+			if w.Flags != 2 {
+				t.Fatal(`w.Flags != 2`)
+			}
+		}
+
+		w.Reset(r.Int63n(100) << 32)
+		baseValue := atomic.LoadInt64(&w.N)
+
+		for i := int64(1); i < 100; i++ {
+			x := w.Next()
+			if floor != 0 {
+				if reminder := x % floor; reminder != 0 {
+					t.Fatal("reminder != 0")
+				}
+			}
+			if x <= baseValue+i*step-step || x > baseValue+i*step {
+				t.Fatal("x <= baseValue+i*step-step || x > baseValue+i*step")
+			}
+		}
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil, WithStep(1024, 2000))
+		t.Fatal("WithStep should have panicked")
+	}()
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil, WithStep(1024, 0), WithStep(128, 0))
+		t.Fatal("WithStep should have panicked")
+	}()
+}
+
+func TestWUID_Verifyh32(t *testing.T) {
+	w1 := NewWUID("alpha", nil)
+	w1.Reset(H32Mask)
+	if err := w1.Verifyh32(100); err != nil {
+		t.Fatalf("Verifyh32 does not work as expected. n: 100, error: %s", err)
+	}
+	if err := w1.Verifyh32(0); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. n: 0")
+	}
+	if err := w1.Verifyh32(0x08000000); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. n: 0x08000000")
+	}
+	if err := w1.Verifyh32(0x07FFFFFF); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. n: 0x07FFFFFF")
+	}
+
+	w2 := NewWUID("alpha", nil, WithSection(1))
+	w2.Reset(H32Mask)
+	if err := w2.Verifyh32(100); err != nil {
+		t.Fatalf("Verifyh32 does not work as expected. section: 1, n: 100, error: %s", err)
+	}
+	if err := w2.Verifyh32(0); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. section: 1, n: 0")
+	}
+	if err := w2.Verifyh32(0x01000000); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. section: 1, n: 0x01000000")
+	}
+	if err := w2.Verifyh32(0x00FFFFFF); err == nil {
+		t.Fatalf("Verifyh32 does not work as expected. section: 1, n: 0x00FFFFFF")
+	}
+}
+
+type memAllocator struct {
+	sync.Mutex
+	m    map[string]int64
+	fail bool
+}
+
+func (a *memAllocator) Allocate(ctx context.Context, key string, n int64) (int64, error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.fail {
+		return 0, errors.New("foo")
+	}
+	a.m[key] += n
+	return a.m[key], nil
+}
+
+func TestWUID_Sequence(t *testing.T) {
+	a := &memAllocator{m: make(map[string]int64)}
+	w1 := NewWUID("alpha", nil, WithSequenceAllocator(a, 10))
+	w2 := NewWUID("alpha", nil, WithSequenceAllocator(a, 10))
+	if w1.Sequence("acme") != w1.Sequence("acme") || w1.Sequence("acme").Key() != "acme" {
+		t.Fatal("Sequence should return the same Seq for a key")
+	}
+
+	seen := make(map[int64]struct{})
+	var last1, last2 int64
+	for i := 0; i < 100; i++ {
+		v1, err := w1.Sequence("acme").Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := w2.Sequence("acme").Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v1 <= last1 || v2 <= last2 {
+			t.Fatal("the numbers of an instance should be increasing")
+		}
+		last1, last2 = v1, v2
+		for _, v := range []int64{v1, v2} {
+			if _, ok := seen[v]; ok {
+				t.Fatalf("%d is a duplicate", v)
+			}
+			seen[v] = struct{}{}
+		}
+	}
+	if v, _ := w1.Sequence("globex").Next(); v != 1 {
+		t.Fatalf("the first number of a new sequence is %d, while it should be 1", v)
+	}
+
+	w3 := NewWUID("alpha", nil, WithSequenceAllocator(a, 1))
+	for i := int64(1); i <= 3; i++ {
+		if v, _ := w3.Sequence("dense").Next(); v != i {
+			t.Fatalf("the sequence is not dense. v: %d, i: %d", v, i)
+		}
+	}
+	a.Lock()
+	a.fail = true
+	a.Unlock()
+	if _, err := w3.Sequence("dense").Next(); err == nil {
+		t.Fatal("Next should fail when the allocation fails")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Sequence should have panicked without WithSequenceAllocator")
+		}
+	}()
+	NewWUID("alpha", nil).Sequence("acme")
+}
+
+type memRegistry struct {
+	sync.Mutex
+	m map[[2]int64]string
+}
+
+func (r *memRegistry) Claim(ctx context.Context, section int8, h32 int64, owner string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	k := [2]int64{int64(section), h32}
+	if _, ok := r.m[k]; !ok {
+		r.m[k] = owner
+	}
+	return r.m[k], nil
+}
+
+type raiser struct {
+	h32      int64
+	numCalls int
+}
+
+func (r *raiser) Renew(ctx context.Context) (int64, error) {
+	r.numCalls++
+	r.h32++
+	return r.h32, nil
+}
+
+func (r *raiser) Raise(ctx context.Context, h32 int64) error {
+	if r.h32 < h32 {
+		r.h32 = h32
+	}
+	return nil
+}
+
+func TestWithReservedH32Ranges(t *testing.T) {
+	opt := WithReservedH32Ranges([2]int64{1, 5}, [2]int64{100, 1 << 20})
+	w1 := NewWUID("alpha", slog.NewDumbLogger(), opt)
+	if err := w1.Verifyh32(3); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("a reserved h32 should be rejected, err: %v", err)
+	}
+	var h32 int64
+	if err := w1.Load(context.Background(), RenewerFunc(func(ctx context.Context) (int64, error) {
+		h32++
+		return h32, nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if w1.N>>32 != 6 {
+		t.Fatalf("the reserved h32 should have been skipped one by one. h32: %d", w1.N>>32)
+	}
+
+	w2 := NewWUID("alpha", slog.NewDumbLogger(), opt)
+	r := &raiser{h32: 99}
+	if err := w2.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if w2.N>>32 != 1<<20+1 || r.numCalls != 2 {
+		t.Fatalf("the reserved range should have been skipped at once. h32: %d, numCalls: %d", w2.N>>32, r.numCalls)
+	}
+
+	w3 := NewWUID("alpha", slog.NewDumbLogger(), opt)
+	r3 := &raiser{h32: 5}
+	if err := w3.Apply(context.Background(), 3, r3); err != nil {
+		t.Fatal(err)
+	}
+	if w3.N>>32 != 6 {
+		t.Fatalf("Apply should have fallen back to Load. h32: %d", w3.N>>32)
+	}
+
+	for _, rng := range [][2]int64{{0, 1}, {5, 4}} {
+		func() {
+			defer func() {
+				_ = recover()
+			}()
+			WithReservedH32Ranges(rng)
+			t.Fatalf("WithReservedH32Ranges should have panicked with %v", rng)
+		}()
+	}
+}
+
+func TestWithRegistry(t *testing.T) {
+	r := &memRegistry{m: make(map[[2]int64]string)}
+	w1 := NewWUID("alpha", nil, WithRegistry(r))
+	w2 := NewWUID("beta", nil, WithRegistry(r))
+	w3 := NewWUID("beta", nil, WithRegistry(r), WithSection(1))
+
+	if err := w1.Verifyh32(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.Verifyh32(10); err != nil {
+		t.Fatal("the owner should be able to claim h32 again")
+	}
+	if err := w2.Verifyh32(10); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	if err := w3.Verifyh32(10); err != nil {
+		t.Fatal("h32 of another section should be available")
+	}
+	if err := w2.Verifyh32(11); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWUID_HighBits(t *testing.T) {
+	w1 := NewWUID("alpha", nil)
+	w1.ResetHighBits(HighBits{Value: 42, Width: 21})
+	if hb := w1.CurrentHighBits(); hb.Value != 42 || hb.Width != 21 {
+		t.Fatalf("CurrentHighBits does not work as expected. hb: %+v", hb)
+	}
+	if err := w1.VerifyHighBits(HighBits{Value: 43, Width: 21}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.VerifyHighBits(HighBits{Value: 43, Width: 24}); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	if err := w1.VerifyHighBits(HighBits{Value: 1 << 21, Width: 21}); !errors.Is(err, wuiderr.ErrH32Exhausted) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrH32Exhausted", err)
+	}
+
+	w2 := NewWUID("alpha", nil, WithSection(1))
+	w2.ResetHighBits(HighBits{Value: 42, Width: 24})
+	if hb := w2.CurrentHighBits(); hb.Value != 42 || hb.Width != 24 {
+		t.Fatalf("CurrentHighBits does not work as expected. section: 1, hb: %+v", hb)
+	}
+}
+
+func TestWUID_Stats(t *testing.T) {
+	w := NewWUID("alpha", slog.NewScavenger(), WithStep(4, 0))
+	w.Reset(3 << 32)
+	for i := 0; i < 10; i++ {
+		w.Next()
+	}
+	ss := w.Stats()
+	if ss.H32 != 3 || ss.NumIssued != 10 || ss.LowBitsUsage <= 0 {
+		t.Fatalf("Stats does not work as expected. ss: %+v", ss)
+	}
+
+	w.Reset(4 << 32)
+	for i := 0; i < 5; i++ {
+		w.Next()
+	}
+	if ss := w.Stats(); ss.H32 != 4 || ss.NumIssued != 15 {
+		t.Fatalf("Stats does not work as expected. ss: %+v", ss)
+	}
+
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		return 0, errors.New("foo")
+	})
+	w.Reset(Bye &^ 3)
+	w.Next()
+	waitUntilNumRenewAttemptsReaches(t, w, 1)
+	ss = w.Stats()
+	if ss.NumRenewFailed != 1 || ss.NumRenewed != 0 || ss.LastRenewTime.IsZero() {
+		t.Fatalf("Stats does not work as expected. ss: %+v", ss)
+	}
+	if ss.LastRenewError == nil || ss.LastRenewError.Error() != "foo" {
+		t.Fatalf("ss.LastRenewError is %v, while it should be foo", ss.LastRenewError)
+	}
+}
+
+func TestWUID_Pressure(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(0x20 << 32)
+	if p := w.Pressure(); p != 0 {
+		t.Fatalf("w.Pressure() is %v, while it should be 0", p)
+	}
+	w.Reset(0x20<<32 | (CriticalValue+PanicValue)/2)
+	if p := w.Pressure(); p < 0.49 || p > 0.51 {
+		t.Fatalf("w.Pressure() is %v, while it should be about 0.5", p)
+	}
+	w.N = 0x20<<32 | PanicValue
+	if p := w.Pressure(); p != 1 {
+		t.Fatalf("w.Pressure() is %v, while it should be 1", p)
+	}
+
+	w.Reset(0x20 << 32)
+	w.recordRenewal(errors.New("foo"))
+	if p := w.Pressure(); p != 0.5 {
+		t.Fatalf("w.Pressure() is %v, while it should be 0.5 after a failed renewal", p)
+	}
+	w.recordRenewal(nil)
+	if p := w.Pressure(); p != 0 {
+		t.Fatalf("w.Pressure() is %v, while it should be 0 after a successful renewal", p)
+	}
+}
+
+func TestWUID_PublishExpvar(t *testing.T) {
+	w := NewWUID("expvar", nil)
+	w.Reset(5 << 32)
+	w.Next()
+	if err := w.PublishExpvar("wuid."); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.PublishExpvar("wuid."); err == nil {
+		t.Fatal("PublishExpvar should fail on a duplicated name")
+	}
+
+	v := expvar.Get("wuid.expvar")
+	if v == nil {
+		t.Fatal("wuid.expvar is not published")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["h32"] != float64(5) || m["num_issued"] != float64(1) {
+		t.Fatalf("the published stats are not as expected: %s", v.String())
+	}
+}
+
+func TestWithQuietRenewals(t *testing.T) {
+	count := func(opts ...Option) int {
+		w := NewWUID("alpha", slog.NewScavenger(), opts...)
+		for i := 1; i <= 10; i++ {
+			w.Reset(int64(i) << 32)
+			w.Renewalf("<wuid> new h32: %d. name: %s", i, w.Name)
+		}
+		var num int
+		w.Logger.(*slog.Scavenger).Filter(func(level, msg string) bool {
+			if level == slog.LevelInfo && strings.Contains(msg, "new h32") {
+				num++
+			}
+			return true
+		})
+		return num
+	}
+	if num := count(); num != 10 {
+		t.Fatalf("num is %d, while it should be 10", num)
+	}
+	if num := count(WithQuietRenewals()); num != 1 {
+		t.Fatalf("num is %d, while it should be 1", num)
+	}
+	if num := count(WithLogSampling(3)); num != 4 {
+		t.Fatalf("num is %d, while it should be 4", num)
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithLogSampling(0)
+		t.Fatal("WithLogSampling should have panicked")
+	}()
+}
+
+type recordedSpan struct {
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartLoad(attrs []Attribute) Span {
+	s := &recordedSpan{attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs)
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func (s *recordedSpan) SetAttributes(attrs []Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+func TestWithTracer(t *testing.T) {
+	tr := &recordingTracer{}
+	w := NewWUID("alpha", nil, WithTracer(tr))
+	if NewWUID("alpha", nil).StartLoadSpan("redis", "wuid") != nil {
+		t.Fatal("StartLoadSpan should return nil without a tracer")
+	}
+
+	span := w.StartLoadSpan("redis", "wuid")
+	span.End(errors.New("foo"))
+	span = w.StartLoadSpan("redis", "wuid")
+	w.Reset(7 << 32)
+	span.End(nil)
+
+	if len(tr.spans) != 2 || !tr.spans[0].ended || !tr.spans[1].ended {
+		t.Fatalf("the spans are not ended as expected. spans: %v", tr.spans)
+	}
+	if tr.spans[0].err == nil || tr.spans[0].err.Error() != "foo" {
+		t.Fatal("the error is not recorded")
+	}
+	attrs := tr.spans[1].attrs
+	if attrs["wuid.backend"] != "redis" || attrs["wuid.key"] != "wuid" {
+		t.Fatal("the backend attributes are not as expected")
+	}
+	if attrs["wuid.old_h32"] != int64(0) || attrs["wuid.new_h32"] != int64(7) {
+		t.Fatal("the h32 attributes are not as expected")
+	}
+	if attrs["wuid.retry_count"] != int64(1) {
+		t.Fatal("the retry count is not as expected")
+	}
+}
+
+func TestWUID_ExhaustionEstimate(t *testing.T) {
+	w1 := NewWUID("alpha", nil)
+	if est := w1.ExhaustionEstimate(); est.Current != 0 || est.Remaining != 0x1FFFFF || est.ETA != 0 {
+		t.Fatalf("ExhaustionEstimate does not work as expected. est: %+v", est)
+	}
+
+	w1.Reset(10 << 32)
+	time.Sleep(time.Millisecond * 10)
+	w1.Reset(20 << 32)
+	est := w1.ExhaustionEstimate()
+	if est.Current != 20 || est.Max != 0x1FFFFF || est.Remaining != 0x1FFFFF-20 {
+		t.Fatalf("ExhaustionEstimate does not work as expected. est: %+v", est)
+	}
+	if est.Rate <= 0 || est.ETA <= 0 {
+		t.Fatalf("the rate is not properly estimated. est: %+v", est)
+	}
+
+	w2 := NewWUID("alpha", nil, WithSection(1))
+	w2.Reset(30 << 32)
+	if est := w2.ExhaustionEstimate(); est.Current != 30 || est.Max != 0x00FFFFFF || est.Rate != 0 {
+		t.Fatalf("ExhaustionEstimate does not work as expected. section: 1, est: %+v", est)
+	}
+}
+
+func TestWithH32ExhaustionAlarm(t *testing.T) {
+	var num int
+	w := NewWUID("alpha", slog.NewScavenger(), WithH32ExhaustionAlarm(0.5, func(est ExhaustionEstimate) {
+		num++
+	}))
+	w.Reset(0x0FFFFF << 32)
+	if num != 0 {
+		t.Fatal(`num != 0`)
+	}
+	w.Reset(0x100000 << 32)
+	if num != 1 {
+		t.Fatal(`num != 1`)
+	}
+
+	var warnings int
+	w.Scavenger().Filter(func(level, msg string) bool {
+		if level == slog.LevelWarn && strings.Contains(msg, "running out") {
+			warnings++
+		}
+		return true
+	})
+	if warnings != 1 {
+		t.Fatal(`warnings != 1`)
+	}
+
+	for _, threshold := range []float64{0, -1, 1.1} {
+		func() {
+			defer func() {
+				_ = recover()
+			}()
+			WithH32ExhaustionAlarm(threshold, func(est ExhaustionEstimate) {})
+			t.Fatalf("WithH32ExhaustionAlarm should have panicked. threshold: %v", threshold)
+		}()
+	}
+}
+
+func TestWithSection_Panic(t *testing.T) {
+	for i := -100; i <= 100; i++ {
+		func(j int8) {
+			defer func() {
+				_ = recover()
+			}()
+			WithSection(j)
+			if j >= 8 {
+				t.Fatalf("WithSection should only accept the values in [0, 7]. j: %d", j)
+			}
+		}(int8(i))
+	}
+}
+
+func TestSectionOf(t *testing.T) {
+	for section := NoSection; section <= MaxSectionID; section++ {
+		w := NewWUID("alpha", nil, WithSectionID(section))
+		w.Reset(0x00FFFFFE << 32)
+		if id := w.Next(); SectionOf(id) != section {
+			t.Fatalf("SectionOf(%#016x) is %d, while it should be %d", id, SectionOf(id), section)
+		}
+	}
+	w := NewWUID("alpha", nil)
+	w.Reset(0x1FFFFF << 32)
+	if id := w.Next(); SectionOf(id) != NoSection {
+		t.Fatalf("SectionOf(%#016x) should be NoSection", id)
+	}
+}
+
+func TestTryWith(t *testing.T) {
+	if _, err := TryWithSection(8); err == nil {
+		t.Fatal("TryWithSection should have failed")
+	}
+	if _, err := TryWithStep(MaxStep+1, 0); err == nil {
+		t.Fatal("TryWithStep should have failed")
+	}
+	if _, err := TryWithStep(1024, 2000); err == nil {
+		t.Fatal("TryWithStep should have failed")
+	}
+	if _, err := TryWithObfuscation(0); err == nil {
+		t.Fatal("TryWithObfuscation should have failed")
+	}
+
+	opt1, err := TryWithSection(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt2, err := TryWithStep(128, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt3, err := TryWithObfuscation(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(opt1, opt2, opt3); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWUID("alpha", nil, opt1, opt2, opt3)
+	if w.Monolithic || w.Step != 128 || !w.Obfuscation {
+		t.Fatal("the options returned by TryWith* do not work as expected")
+	}
+
+	if err := Validate(opt2, WithStep(1024, 0)); err == nil {
+		t.Fatal("Validate should have detected the second WithStep")
+	}
+	if err := Validate(nil); err == nil {
+		t.Fatal("Validate should have detected the nil option")
+	}
+}
+
+func TestWithSection_Reset(t *testing.T) {
+	for i := 0; i < 28; i++ {
+		n := int64(1) << (uint(i) + 36)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if i != 27 {
+						t.Fatal(r)
+					}
+				}
+			}()
+			for j := int8(1); j < 8; j++ {
+				w := NewWUID("alpha", nil, WithSection(j))
+				w.Reset(n)
+				v := atomic.LoadInt64(&w.N)
+				if v>>60 != int64(j) {
+					t.Fatalf("w.Section does not work as expected. w.N: %x, n: %x, i: %d, j: %d", v, n, i, j)
+				}
+			}
+		}()
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		w := NewWUID("alpha", nil)
+		w.Reset((1 << 32) | PanicValue)
+		t.Fatal("Reset should have panicked")
+	}()
+}
+
+func TestWithh32Verifier(t *testing.T) {
+	w := NewWUID("alpha", nil, Withh32Verifier(func(h32 int64) error {
+		if h32 >= 20 {
+			return errors.New("bomb")
+		}
+		return nil
+	}))
+	if !w.HasVerifier() {
+		t.Fatal("w.HasVerifier() should return true")
+	}
+	if err := w.Verifyh32(10); err != nil {
+		t.Fatal("the h32Verifier should not return error")
+	}
+	if err := w.Verifyh32(20); err == nil || err.Error() != "bomb" {
+		t.Fatal("the h32Verifier was not called")
+	}
+}
+
+func TestWithVerifier(t *testing.T) {
+	reserved := map[string][2]int64{"staging": {100, 199}}
+	v := H32VerifierFunc(func(name string, section int64, h32 int64) error {
+		if r, ok := reserved[name]; ok && (h32 < r[0] || h32 > r[1]) {
+			return fmt.Errorf("h32 %d of section %d is out of the range of %s", h32, section, name)
+		}
+		return nil
+	})
+	w1 := NewWUID("staging", nil, WithVerifier(v), WithSection(3))
+	if err := w1.Verifyh32(150); err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.Verifyh32(20); !errors.Is(err, wuiderr.ErrInvalidH32) || err.Error() != "h32 20 of section 3 is out of the range of staging" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w2 := NewWUID("production", nil, WithVerifier(v))
+	if err := w2.Verifyh32(20); err != nil {
+		t.Fatal(err)
+	}
+
+	w3 := NewWUID("staging", nil, WithVerifier(v), Withh32Verifier(nil))
+	if w3.HasVerifier() {
+		t.Fatal("Withh32Verifier should have replaced the verifier")
+	}
+}
+
+func TestWUID_AddH32Verifier(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	if w.HasVerifier() {
+		t.Fatal("w.HasVerifier() should return false")
+	}
+	reject := func(min, max int64) func(h32 int64) error {
+		return func(h32 int64) error {
+			if h32 >= min && h32 <= max {
+				return fmt.Errorf("h32 %d is reserved", h32)
+			}
+			return nil
+		}
+	}
+	t1 := w.AddH32Verifier(reject(10, 19))
+	t2 := w.AddH32Verifier(reject(30, 39))
+	if !w.HasVerifier() {
+		t.Fatal("w.HasVerifier() should return true")
+	}
+	for h32, ok := range map[int64]bool{5: true, 15: false, 25: true, 35: false} {
+		if err := w.Verifyh32(h32); (err == nil) != ok || err != nil && !errors.Is(err, wuiderr.ErrInvalidH32) {
+			t.Fatalf("unexpected result of h32 %d: %v", h32, err)
+		}
+	}
+
+	if !w.RemoveH32Verifier(t1) || w.RemoveH32Verifier(t1) {
+		t.Fatal("a verifier should be removed exactly once")
+	}
+	if err := w.Verifyh32(15); err != nil {
+		t.Fatal("the removed verifier should not be called")
+	}
+	if err := w.Verifyh32(35); err == nil {
+		t.Fatal("the other verifier should still be called")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.RemoveH32Verifier(w.AddH32Verifier(reject(50, 59)))
+				_ = w.Verifyh32(int64(j))
+			}
+		}()
+	}
+	wg.Wait()
+	w.RemoveH32Verifier(t2)
+	if w.HasVerifier() {
+		t.Fatal("all the verifiers should have been removed")
+	}
+}
+
+func TestWUID_OnEpochChange(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	var changes [][2]int64
+	stop := w.OnEpochChange(func(old, new int64) {
+		changes = append(changes, [2]int64{old, new})
+	})
+	var numCalls int
+	w.OnEpochChange(func(int64, int64) {
+		numCalls++
+	})
+
+	var h32 int64
+	r := RenewerFunc(func(context.Context) (int64, error) {
+		h32++
+		return h32, nil
+	})
+	if err := w.Load(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	w.Reset(2<<32 | 100)
+	w.Reset(7 << 32)
+	if want := [][2]int64{{0, 1}, {1, 2}, {2, 7}}; fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Fatalf("changes: %v, want: %v", changes, want)
+	}
+
+	stop()
+	stop()
+	w.Reset(8 << 32)
+	if len(changes) != 3 || numCalls != 4 {
+		t.Fatalf("the stopped subscription should not be called. changes: %v, numCalls: %d", changes, numCalls)
+	}
+}
+
+func TestWUID_Interlock(t *testing.T) {
+	w1 := NewWUID("alpha", nil)
+	if err := w1.Interlock("redis", "wuid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.Interlock("redis", "wuid"); err != nil {
+		t.Fatal("registering the same generator again should succeed:", err)
+	}
+	defer w1.Stop()
+
+	w2 := NewWUID("alpha", nil)
+	if err := w2.Interlock("redis", "wuid"); err != nil {
+		t.Fatal("a duplicate should only be warned about without WithStrictInterlock:", err)
+	}
+	w3 := NewWUID("alpha", nil, WithStrictInterlock())
+	if err := w3.Interlock("redis", "wuid"); !errors.Is(err, wuiderr.ErrDuplicateGenerator) {
+		t.Fatal("the duplicate should have been rejected:", err)
+	}
+	for _, w := range []*WUID{
+		NewWUID("beta", nil, WithStrictInterlock()),
+		NewWUID("alpha", nil, WithStrictInterlock(), WithSection(1)),
+	} {
+		if err := w.Interlock("redis", "wuid"); err != nil {
+			t.Fatal("a different name or section is not a duplicate:", err)
+		}
+		w.Stop()
+	}
+	if err := w3.Interlock("etcd", "wuid"); err != nil {
+		t.Fatal("a different data source is not a duplicate:", err)
+	}
+	w3.Stop()
+
+	w1.Stop()
+	w4 := NewWUID("alpha", nil, WithStrictInterlock())
+	if err := w4.Interlock("redis", "wuid"); err != nil {
+		t.Fatal("Stop should have released the registration:", err)
+	}
+	w4.Stop()
+}
+
+//gocyclo:ignore
+func TestWithObfuscation(t *testing.T) {
+	w1 := NewWUID("alpha", nil, WithObfuscation(1))
+	if w1.Flags != 1 {
+		t.Fatal(`w1.Flags != 1`)
+	}
+	if w1.ObfuscationMask == 0 {
+		t.Fatal(`w1.ObfuscationMask == 0`)
+	}
+
+	w1.Reset(1 << 32)
+	for i := 1; i < 100; i++ {
+		v := w1.Next()
+		if v&H32Mask != 1<<32 {
+			t.Fatal(`v&h32Mask != 1<<32`)
+		}
+		tmp := v ^ w1.ObfuscationMask
+		if tmp&L32Mask != int64(i) {
+			t.Fatal(`tmp&L36Mask != int64(i)`)
+		}
+	}
+
+	w2 := NewWUID("alpha", nil, WithObfuscation(1), WithStep(128, 100))
+	if w2.Flags != 3 {
+		t.Fatal(`w2.Flags != 3`)
+	}
+	if w2.ObfuscationMask == 0 {
+		t.Fatal(`w2.ObfuscationMask == 0`)
+	}
+
+	w2.Reset(1 << 32)
+	for i := 1; i < 100; i++ {
+		v := w2.Next()
+		if v%w2.Floor != 0 {
+			t.Fatal(`v%w2.Floor != 0`)
+		}
+		if v&H32Mask != 1<<32 {
+			t.Fatal(`v&h32Mask != 1<<32`)
+		}
+		tmp := v ^ w2.ObfuscationMask
+		if tmp&L32Mask&^(w2.Step-1) != w2.Step*int64(i) {
+			t.Fatal(`tmp&L36Mask&^(w2.Step-1) != w2.Step*int64(i)`)
+		}
+	}
+
+	w3 := NewWUID("alpha", nil, WithObfuscation(1), WithStep(1024, 659))
+	if w3.Flags != 3 {
+		t.Fatal(`w3.Flags != 3`)
+	}
+	if w3.ObfuscationMask == 0 {
+		t.Fatal(`w3.ObfuscationMask == 0`)
+	}
+
+	w3.Reset(1<<32 + 1)
+	for i := 1; i < 100; i++ {
+		v := w3.Next()
+		if v%w3.Floor != 0 {
+			t.Fatal(`v%w3.Floor != 0`)
+		}
+		if v&H32Mask != 1<<32 {
+			t.Fatal(`v&h32Mask != 1<<32`)
+		}
+		tmp := v ^ w3.ObfuscationMask
+		if tmp&L32Mask&^(w3.Step-1) != w3.Step*int64(i+1) {
+			t.Fatal(`tmp&L36Mask&^(w3.Step-1) != w3.Step*int64(i+1)`)
+		}
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil, WithObfuscation(0))
+		t.Fatal("WithObfuscation should have panicked")
+	}()
+}
+
+func TestWithPermutation(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithPermutation(1)},
+		{WithPermutation(1), WithStep(1024, 1000)},
+		{WithPermutation(1), WithObfuscation(1), WithStep(1024, 659)},
+		{WithPermutation(1), WithStep(16, 0), WithShards(4)},
+	} {
+		w := NewWUID("alpha", nil, opts...)
+		if w.Flags&4 == 0 {
+			t.Fatal(`w.Flags&4 == 0`)
+		}
+		w.Reset(1<<32 + 1)
+		m := make(map[int64]struct{})
+		var numAscending int
+		var prev int64
+		for i := 0; i < 10000; i++ {
+			v := w.Next()
+			if v&H32Mask != 1<<32 {
+				t.Fatalf("v&H32Mask != 1<<32. v: %#x", v)
+			}
+			if w.Floor != 0 && v%w.Floor != 0 {
+				t.Fatalf("v%%w.Floor != 0. v: %d, floor: %d", v, w.Floor)
+			}
+			if _, ok := m[v]; ok {
+				t.Fatalf("duplicate: %d", v)
+			}
+			m[v] = struct{}{}
+			if v > prev {
+				numAscending++
+			}
+			prev = v
+		}
+		if numAscending > 6000 || numAscending < 4000 {
+			t.Fatalf("the numbers do not look permuted. numAscending: %d", numAscending)
+		}
+	}
+
+	w1 := NewWUID("alpha", nil, WithPermutation(1), WithDeterministic(1))
+	w2 := NewWUID("alpha", nil, WithPermutation(1), WithDeterministic(1))
+	w3 := NewWUID("alpha", nil, WithPermutation(2), WithDeterministic(1))
+	var numDiff int
+	for i := 0; i < 100; i++ {
+		v1, v2, v3 := w1.Next(), w2.Next(), w3.Next()
+		if v1 != v2 {
+			t.Fatal(`v1 != v2`)
+		}
+		if v1 != v3 {
+			numDiff++
+		}
+	}
+	if numDiff < 90 {
+		t.Fatalf("the seed makes little difference. numDiff: %d", numDiff)
+	}
+
+	if _, err := TryWithPermutation(0); err == nil {
+		t.Fatal("TryWithPermutation should have failed")
+	}
+	if err := Validate(WithStep(1000, 0), WithPermutation(1)); err == nil {
+		t.Fatal("Validate should have failed")
+	}
+	w4 := NewWUID("alpha", nil, WithPermutation(1), WithStep(1024, 0))
+	if err := w4.ReconfigureStep(1000, 0); err == nil {
+		t.Fatal("ReconfigureStep should have failed")
+	}
+	if err := w4.ReconfigureStep(2048, 1000); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWUID_LayoutFingerprint(t *testing.T) {
+	fp := func(opts ...Option) string {
+		return NewWUID("alpha", nil, opts...).LayoutFingerprint()
+	}
+	if fp(WithObfuscation(1)) != fp(WithObfuscation(1)) {
+		t.Fatal("the same options should have the same fingerprint")
+	}
+	if fp(WithMaxH32Age(time.Hour), WithRandomSkip(3)) != fp() {
+		t.Fatal("the options that do not change the mapping should not change the fingerprint")
+	}
+	seen := make(map[string]int)
+	for i, opts := range [][]Option{
+		{},
+		{WithObfuscation(1)},
+		{WithObfuscation(2)},
+		{WithPermutation(1)},
+		{WithStep(16, 0)},
+		{WithStep(16, 10)},
+		{WithSection(1)},
+		{WithChecksum(10)},
+		{WithTransform(func(v int64) int64 { return v ^ 1 })},
+	} {
+		s := fp(opts...)
+		if j, ok := seen[s]; ok {
+			t.Fatalf("the options #%d and #%d have the same fingerprint", j, i)
+		}
+		seen[s] = i
+	}
+}
+
+func TestPermute(t *testing.T) {
+	keys := [3]uint64{0x1234567890abcdef, 0xfedcba0987654321, 0x0f1e2d3c4b5a6978}
+	for _, n := range []uint{1, 5, 12} {
+		seen := make(map[uint64]struct{})
+		for k := uint64(0); k < 1<<n; k++ {
+			p := permute(k, n, &keys)
+			if p >= 1<<n {
+				t.Fatalf("out of range. n: %d, k: %d, p: %d", n, k, p)
+			}
+			seen[p] = struct{}{}
+		}
+		if len(seen) != 1<<n {
+			t.Fatalf("not a permutation. n: %d", n)
+		}
+	}
+}
+
+func TestWithRandomSkip(t *testing.T) {
+	w := NewWUID("alpha", nil, WithRandomSkip(7), WithStep(4, 0))
+	w.Reset(1 << 32)
+	m := make(map[int64]struct{})
+	gaps := make(map[int64]int)
+	prev := int64(1 << 32)
+	for i := 0; i < 10000; i++ {
+		v := w.Next()
+		if _, ok := m[v]; ok {
+			t.Fatalf("duplicate: %d", v)
+		}
+		m[v] = struct{}{}
+		d := v - prev
+		if d%4 != 0 || d < 4 || d > 32 {
+			t.Fatalf("unexpected gap: %d", d)
+		}
+		gaps[d]++
+		prev = v
+	}
+	if len(gaps) != 8 {
+		t.Fatalf("len(gaps) != 8. gaps: %v", gaps)
+	}
+
+	dst := make([]int64, 100)
+	w.NextN(dst)
+	for _, v := range dst {
+		if _, ok := m[v]; ok || v <= prev {
+			t.Fatalf("unexpected number: %d", v)
+		}
+		m[v] = struct{}{}
+		prev = v
+	}
+	if n := w.Next(); n <= prev {
+		t.Fatal(`n <= prev`)
+	}
+
+	w3 := NewWUID("alpha", nil, WithStep(1024, 0))
+	w4 := NewWUID("alpha", nil, WithStep(1024, 0), WithRandomSkip(15))
+	if w4.layout().critical >= w3.layout().critical {
+		t.Fatal("the renewal should be due earlier")
+	}
+
+	w1 := NewWUID("alpha", nil, WithRandomSkip(100), WithDeterministic(1))
+	w2 := NewWUID("alpha", nil, WithRandomSkip(100), WithDeterministic(1))
+	for i := 0; i < 100; i++ {
+		if w1.Next() != w2.Next() {
+			t.Fatal("WithDeterministic should make the skips reproducible")
+		}
+	}
+
+	if err := Validate(WithStep(1024, 0), WithRandomSkip(1024)); err == nil {
+		t.Fatal("Validate should have failed")
+	}
+	if err := Validate(WithStep(64, 0), WithShards(4), WithRandomSkip(4096)); err == nil {
+		t.Fatal("Validate should have failed")
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithRandomSkip(0)
+		t.Fatal("WithRandomSkip should have panicked")
+	}()
+}
+
+func TestWUID_AllocateRange(t *testing.T) {
+	w := NewWUID("alpha", nil, WithStep(4, 0))
+	w.Reset(1 << 32)
+	v1 := w.Next()
+	rng, err := w.AllocateRange(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rng.Len() != 10 || rng.Start != v1+1 {
+		t.Fatalf("unexpected range: %+v", rng)
+	}
+	for i := 0; i < 1000; i++ {
+		if v := w.Next(); rng.Contains(v) || v <= rng.End {
+			t.Fatalf("%d should not have been issued", v)
+		}
+	}
+
+	if _, err := w.AllocateRange(0); err == nil {
+		t.Fatal("AllocateRange should have failed")
+	}
+	if _, err := w.AllocateRange(MaxStep + 1); err == nil {
+		t.Fatal("AllocateRange should have failed")
+	}
+	w.Reset(1<<32 | PanicValue - 100)
+	if _, err := w.AllocateRange(1000); !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+		t.Fatalf("err should be wuiderr.ErrLowBitsExhausted. err: %v", err)
+	}
+
+	for _, opt := range []Option{WithObfuscation(1), WithStep(16, 10), WithShards(2), WithChecksum(10), WithRandomSkip(1)} {
+		w := NewWUID("alpha", nil, opt)
+		w.Reset(1 << 32)
+		if _, err := w.AllocateRange(10); err == nil {
+			t.Fatal("AllocateRange should have failed")
+		}
+	}
+}
+
+func TestWUID_CheckID(t *testing.T) {
+	w := NewWUID("alpha", nil, WithObfuscation(1), WithStep(1024, 1000), WithReservedH32Ranges([2]int64{10, 20}))
+	w.Reset(7 << 32)
+	for i := 0; i < 100; i++ {
+		if h32, err := w.CheckID(w.Next()); err != nil || h32 != 7 {
+			t.Fatalf("h32: %d, err: %v", h32, err)
+		}
+	}
+	for _, id := range []int64{0, 7<<32 | 999, 15<<32 | 1000, (w.MaxH32() + 1) << 32} {
+		if _, err := w.CheckID(id); !errors.Is(err, wuiderr.ErrInvalidID) {
+			t.Fatalf("%#x should have been rejected. err: %v", id, err)
+		}
+	}
+}
+
+func TestWUID_NextSigned(t *testing.T) {
+	w1 := NewWUID("alpha", nil, WithSigningKey([]byte("0123456789abcdef0123456789abcdef")))
+	w1.Reset(1 << 32)
+	w2 := NewWUID("alpha", nil, WithSigningKey([]byte("fedcba9876543210fedcba9876543210")))
+	w2.Reset(1 << 32)
+	s := w1.NextSigned()
+	id, err := w1.VerifySigned(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strconv.FormatInt(id, 10) != s[:strings.IndexByte(s, '.')] || len(s) != len(strconv.FormatInt(id, 10))+12 {
+		t.Fatalf("unexpected signed identifier: %s", s)
+	}
+	forged := strconv.FormatInt(id+1, 10) + s[strings.IndexByte(s, '.'):]
+	for _, str := range []string{forged, s[:len(s)-1], strconv.FormatInt(id, 10), "x" + s} {
+		if _, err := w1.VerifySigned(str); !errors.Is(err, wuiderr.ErrInvalidSignature) {
+			t.Fatalf("%q should have been rejected. err: %v", str, err)
+		}
+	}
+	if _, err := w2.VerifySigned(s); !errors.Is(err, wuiderr.ErrInvalidSignature) {
+		t.Fatal("the identifier signed with another key should have been rejected")
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewWUID("alpha", nil).NextSigned()
+		t.Fatal("NextSigned should have panicked")
+	}()
+}
+
+func TestWUID_RateStats(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(0x20 << 32)
+	if rs := w.RateStats(); rs.Rate != 0 {
+		t.Fatalf("rs.Rate != 0. rate: %g", rs.Rate)
+	}
+	const n = 1 << 18
+	for i := 0; i < n; i++ {
+		w.Next()
+	}
+	time.Sleep(2 * time.Millisecond)
+	rs := w.RateStats()
+	if rs.Rate <= 0 {
+		t.Fatalf("rs.Rate <= 0. rate: %g", rs.Rate)
+	}
+	var total int64
+	for _, c := range rs.Intervals {
+		total += c
+	}
+	if total != n {
+		t.Fatalf("total != n. total: %d", total)
+	}
+}
+
+func TestWUID_Next_RenewByRate(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger(), WithRenewTimeout(time.Hour))
+	w.Reset(0x20 << 32)
+	renewed := make(chan struct{}, 1)
+	w.renewer = RenewerFunc(func(context.Context) (int64, error) {
+		renewed <- struct{}{}
+		return 0x21, nil
+	})
+	w.RateStats()
+	time.Sleep(2 * time.Millisecond)
+
+	cross := func(b int64) {
+		atomic.StoreInt64(&w.N, 0x20<<32|b-1)
+		w.Next()
+	}
+	half := (PanicValue/2 + RenewIntervalMask) &^ RenewIntervalMask
+	cross(half - RenewIntervalMask - 1)
+	select {
+	case <-renewed:
+		t.Fatal("the renewal should wait until half of the low bits are used")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	cross(half)
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Fatal("the renewal should have been triggered by the rate")
+	}
+	if half >= w.RenewalThreshold() {
+		t.Fatal("half >= w.RenewalThreshold()")
+	}
+}
+
+func TestWUID_RenewLatency(t *testing.T) {
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	if ls := w.RenewLatency(); ls.NumSamples != 0 {
+		t.Fatalf("unexpected latency stats: %+v", ls)
+	}
+	err := w.Load(context.Background(), RenewerFunc(func(context.Context) (int64, error) {
+		time.Sleep(20 * time.Millisecond)
+		return 1, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls := w.RenewLatency(); ls.NumSamples != 1 || ls.P50 < 20*time.Millisecond || ls.P99 != ls.Max {
+		t.Fatalf("unexpected latency stats: %+v", ls)
+	}
+	for i := 0; i < 100; i++ {
+		w.observeLatency(time.Duration(i) * time.Millisecond)
+	}
+	if ls := w.RenewLatency(); ls.NumSamples != 64 || ls.P50 != 67*time.Millisecond || ls.Max != 99*time.Millisecond {
+		t.Fatalf("unexpected latency stats: %+v", ls)
+	}
+
+	// 1e8 identifiers per second for 4 times 2 seconds take 8e8 values of the low bits.
+	atomic.StoreUint64(&w.rates.rate, math.Float64bits(1e8))
+	w.observeLatency(2 * time.Second)
+	w.observeLatency(2 * time.Second)
+	if c := w.RenewalThreshold(); c != (PanicValue-8e8)&^1023 {
+		t.Fatalf("unexpected threshold: %d", c)
+	}
+	for i := 0; i < 10; i++ {
+		w.observeLatency(time.Minute)
+	}
+	if c := w.RenewalThreshold(); c != (PanicValue/2+1023)&^1023 {
+		t.Fatalf("the threshold should not move below half of PanicValue: %d", c)
+	}
+	atomic.StoreUint64(&w.rates.rate, math.Float64bits(10))
+	w.adaptThreshold()
+	if c := w.RenewalThreshold(); c != CriticalValue {
+		t.Fatalf("c != CriticalValue. c: %d", c)
+	}
+}
@@ -0,0 +1,307 @@
+// Package credentials provides the username and the password that the adapters authenticate
+// to their backends with, read from where they are kept rather than captured at startup, so
+// that a rotation does not break the next renewal hours later.
+//
+// The adapters call a Provider whenever they connect: the NewClient and OpenDB callbacks
+// fetch the credentials on every load, and the helpers of the adapters, e.g.
+// CredentialsOnConnect of the redis/v8 adapter, on every new connection of a long-lived
+// client. The providers reading a remote store are wrapped in a Cache.
+//
+// The redis, redis/v8, etcd, mongo and objectstore adapters have helpers. The memcache
+// adapter has none, because gomemcache does not support authentication, nor does the sqlite
+// adapter, whose databases are local files. The callback adapter leaves the load to its
+// callbacks, which call a Provider themselves if they need one.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/iamauth"
+)
+
+// DefaultRefreshInterval is how long the remote providers cache the credentials for.
+const DefaultRefreshInterval = time.Minute
+
+// Credentials are a username and a password. Username is empty for the backends that take a
+// password only.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Provider returns the current credentials. It must be safe for concurrent use.
+type Provider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials calls f.
+func (f ProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// Static returns a Provider of fixed credentials, e.g. for the tests.
+func Static(username, password string) Provider {
+	return ProviderFunc(func(context.Context) (Credentials, error) {
+		return Credentials{Username: username, Password: password}, nil
+	})
+}
+
+// Env returns a Provider reading the credentials from the environment variables usernameVar
+// and passwordVar on every call. usernameVar can be empty for the backends that take a
+// password only.
+func Env(usernameVar, passwordVar string) Provider {
+	if passwordVar == "" {
+		panic("passwordVar cannot be empty")
+	}
+	return ProviderFunc(func(context.Context) (Credentials, error) {
+		password, ok := os.LookupEnv(passwordVar)
+		if !ok {
+			return Credentials{}, fmt.Errorf("%s is not set", passwordVar)
+		}
+		c := Credentials{Password: password}
+		if usernameVar != "" {
+			c.Username = os.Getenv(usernameVar)
+		}
+		return c, nil
+	})
+}
+
+// File returns a Provider reading the credentials from the files usernameFile and passwordFile
+// on every call, e.g. those of a Kubernetes secret, which are updated in place when the secret
+// rotates. The surrounding whitespace is trimmed. usernameFile can be empty for the backends
+// that take a password only.
+func File(usernameFile, passwordFile string) Provider {
+	if passwordFile == "" {
+		panic("passwordFile cannot be empty")
+	}
+	return ProviderFunc(func(context.Context) (c Credentials, err error) {
+		if c.Password, err = readFile(passwordFile); err != nil {
+			return Credentials{}, err
+		}
+		if usernameFile != "" {
+			if c.Username, err = readFile(usernameFile); err != nil {
+				return Credentials{}, err
+			}
+		}
+		return c, nil
+	})
+}
+
+func readFile(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// IAMToken returns a Provider of username with the IAM tokens of tokens as its password.
+func IAMToken(username string, tokens *iamauth.TokenSource) Provider {
+	if tokens == nil {
+		panic("tokens cannot be nil")
+	}
+	return ProviderFunc(func(ctx context.Context) (Credentials, error) {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{Username: username, Password: token}, nil
+	})
+}
+
+// Cache caches the credentials of a Provider for an interval, so that the remote store is not
+// asked on every connection. An error is not cached.
+type Cache struct {
+	p        Provider
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	c       Credentials
+	fetched time.Time
+}
+
+// NewCache returns a Cache of p refreshing the credentials once they are older than interval.
+func NewCache(p Provider, interval time.Duration) *Cache {
+	if p == nil {
+		panic("p cannot be nil")
+	}
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+	return &Cache{p: p, interval: interval, now: time.Now}
+}
+
+// Credentials returns the cached credentials, or fetches them again if they are older than
+// the interval or Invalidate has been called.
+func (c *Cache) Credentials(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if !c.fetched.IsZero() && now.Sub(c.fetched) < c.interval {
+		return c.c, nil
+	}
+	creds, err := c.p.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.c, c.fetched = creds, now
+	return creds, nil
+}
+
+// Invalidate makes the next call fetch the credentials again, e.g. after an authentication
+// failure.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.fetched = time.Time{}
+	c.mu.Unlock()
+}
+
+// SecretsManager returns a Provider of the secret secretID in AWS Secrets Manager, cached for
+// DefaultRefreshInterval. The secret is either a JSON object with username and password, the
+// format of the secrets rotated by AWS, or the password itself. The requests are signed with
+// the AWS credentials returned by creds.
+func SecretsManager(creds iamauth.CredentialsFunc, region, secretID string) *Cache {
+	if creds == nil {
+		panic("creds cannot be nil")
+	}
+	if region == "" || secretID == "" {
+		panic("region and secretID cannot be empty")
+	}
+	endpoint := "https://secretsmanager." + region + ".amazonaws.com/"
+	return NewCache(&secretsManager{creds: creds, region: region, secretID: secretID, endpoint: endpoint}, DefaultRefreshInterval)
+}
+
+type secretsManager struct {
+	creds    iamauth.CredentialsFunc
+	region   string
+	secretID string
+	endpoint string
+}
+
+func (s *secretsManager) Credentials(ctx context.Context) (Credentials, error) {
+	c, err := s.creds(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	payload, err := json.Marshal(map[string]string{"SecretId": s.secretID})
+	if err != nil {
+		return Credentials{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	iamauth.Sign(req, payload, c, "secretsmanager", s.region, time.Now())
+
+	var resp struct {
+		SecretString string
+	}
+	if err := do(req, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to get the secret %s: %w", s.secretID, err)
+	}
+	return parseSecret(resp.SecretString)
+}
+
+// parseSecret parses a JSON object with username and password, or takes s as the password.
+func parseSecret(s string) (Credentials, error) {
+	var m struct {
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+	}
+	if json.Unmarshal([]byte(s), &m) != nil {
+		return Credentials{Password: s}, nil
+	}
+	if m.Password == nil {
+		return Credentials{}, errors.New("the secret has no password")
+	}
+	c := Credentials{Password: *m.Password}
+	if m.Username != nil {
+		c.Username = *m.Username
+	}
+	return c, nil
+}
+
+// Vault returns a Provider of the secret at path of the HashiCorp Vault at addr, cached for
+// DefaultRefreshInterval. path is that of the API without /v1, e.g. secret/data/redis for
+// the version 2 of the key-value engine, and the secret holds username and password. The
+// token is read from tokenFile on every fetch, so that it can be renewed by an agent, or from
+// VAULT_TOKEN if tokenFile is empty.
+func Vault(addr, path, tokenFile string) *Cache {
+	if addr == "" || path == "" {
+		panic("addr and path cannot be empty")
+	}
+	v := &vault{url: strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/"), tokenFile: tokenFile}
+	return NewCache(v, DefaultRefreshInterval)
+}
+
+type vault struct {
+	url       string
+	tokenFile string
+}
+
+func (v *vault) Credentials(ctx context.Context) (Credentials, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if v.tokenFile != "" {
+		var err error
+		if token, err = readFile(v.tokenFile); err != nil {
+			return Credentials{}, err
+		}
+	}
+	if token == "" {
+		return Credentials{}, errors.New("no Vault token is found")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := do(req, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to read %s from Vault: %w", v.url, err)
+	}
+	// The version 2 of the key-value engine nests the secret in another data.
+	data, err := json.Marshal(resp.Data)
+	if nested, ok := resp.Data["data"]; ok {
+		data, err = nested, nil
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	return parseSecret(string(data))
+}
+
+// do sends req and decodes the JSON body of a successful response into v.
+func do(req *http.Request, v interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, v)
+}
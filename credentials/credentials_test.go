@@ -0,0 +1,181 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/iamauth"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnv(t *testing.T) {
+	p := Env("WUID_TEST_USERNAME", "WUID_TEST_PASSWORD")
+	if _, err := p.Credentials(context.Background()); err == nil {
+		t.Fatal("a missing password should have been reported")
+	}
+	t.Setenv("WUID_TEST_USERNAME", "alpha")
+	t.Setenv("WUID_TEST_PASSWORD", "beta")
+	if c, err := p.Credentials(context.Background()); err != nil || c != (Credentials{"alpha", "beta"}) {
+		t.Fatalf("Env does not work as expected. c: %+v, err: %v", c, err)
+	}
+	t.Setenv("WUID_TEST_PASSWORD", "gamma")
+	if c, err := p.Credentials(context.Background()); err != nil || c.Password != "gamma" {
+		t.Fatal("the rotated password should have been read")
+	}
+}
+
+func TestFile(t *testing.T) {
+	passwordFile := writeFile(t, "password", "beta\n")
+	p := File(writeFile(t, "username", "alpha"), passwordFile)
+	if c, err := p.Credentials(context.Background()); err != nil || c != (Credentials{"alpha", "beta"}) {
+		t.Fatalf("File does not work as expected. c: %+v, err: %v", c, err)
+	}
+	if err := os.WriteFile(passwordFile, []byte("gamma"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := p.Credentials(context.Background()); err != nil || c.Password != "gamma" {
+		t.Fatal("the rotated password should have been read")
+	}
+	if _, err := File("", filepath.Join(t.TempDir(), "missing")).Credentials(context.Background()); err == nil {
+		t.Fatal("a missing file should have been reported")
+	}
+}
+
+func TestCache(t *testing.T) {
+	var numCalls int
+	var fail bool
+	c := NewCache(ProviderFunc(func(context.Context) (Credentials, error) {
+		numCalls++
+		if fail {
+			return Credentials{}, errors.New("boom")
+		}
+		return Credentials{Password: strings.Repeat("x", numCalls)}, nil
+	}), time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if creds, err := c.Credentials(context.Background()); err != nil || creds.Password != "x" {
+			t.Fatalf("the credentials should have been cached. creds: %+v, err: %v", creds, err)
+		}
+	}
+	now = now.Add(time.Minute)
+	if creds, _ := c.Credentials(context.Background()); creds.Password != "xx" {
+		t.Fatal("the credentials should have been refreshed")
+	}
+	c.Invalidate()
+	fail = true
+	if _, err := c.Credentials(context.Background()); err == nil {
+		t.Fatal("the error should have been returned")
+	}
+	fail = false
+	if creds, _ := c.Credentials(context.Background()); creds.Password != "xxxx" || numCalls != 4 {
+		t.Fatalf("the error should not have been cached. numCalls: %d", numCalls)
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	for _, c := range []struct {
+		secret string
+		want   Credentials
+		failed bool
+	}{
+		{`{"username": "alpha", "password": "beta", "engine": "redis"}`, Credentials{"alpha", "beta"}, false},
+		{`{"password": "beta"}`, Credentials{Password: "beta"}, false},
+		{`beta`, Credentials{Password: "beta"}, false},
+		{`12345`, Credentials{Password: "12345"}, false},
+		{`{"username": "alpha"}`, Credentials{}, true},
+	} {
+		creds, err := parseSecret(c.secret)
+		if (err != nil) != c.failed || creds != c.want {
+			t.Fatalf("parseSecret does not work as expected. secret: %s, creds: %+v, err: %v", c.secret, creds, err)
+		}
+	}
+}
+
+func TestSecretsManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=alpha/") ||
+			r.Header.Get("X-Amz-Security-Token") != "gamma" {
+			http.Error(w, `{"__type": "AccessDeniedException"}`, http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Name": "wuid", "SecretString": "{\"username\": \"wuid\", \"password\": \"delta\"}"}`))
+	}))
+	defer srv.Close()
+
+	s := &secretsManager{
+		creds: func(context.Context) (iamauth.Credentials, error) {
+			return iamauth.Credentials{AccessKeyID: "alpha", SecretAccessKey: "beta", SessionToken: "gamma"}, nil
+		},
+		region:   "us-east-1",
+		secretID: "wuid",
+		endpoint: srv.URL,
+	}
+	if c, err := s.Credentials(context.Background()); err != nil || c != (Credentials{"wuid", "delta"}) {
+		t.Fatalf("secretsManager does not work as expected. c: %+v, err: %v", c, err)
+	}
+	s.creds = func(context.Context) (iamauth.Credentials, error) {
+		return iamauth.Credentials{AccessKeyID: "alpha", SecretAccessKey: "beta"}, nil
+	}
+	if _, err := s.Credentials(context.Background()); err == nil || !strings.Contains(err.Error(), "AccessDeniedException") {
+		t.Fatal("the error of the service should have been returned:", err)
+	}
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "alpha" {
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/redis":
+			_, _ = w.Write([]byte(`{"data": {"data": {"username": "wuid", "password": "beta"}, "metadata": {"version": 2}}}`))
+		case "/v1/kv/redis":
+			_, _ = w.Write([]byte(`{"data": {"password": "gamma"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := writeFile(t, "token", "alpha\n")
+	if c, err := Vault(srv.URL+"/", "/secret/data/redis", tokenFile).Credentials(context.Background()); err != nil || c != (Credentials{"wuid", "beta"}) {
+		t.Fatalf("Vault does not work as expected. c: %+v, err: %v", c, err)
+	}
+	t.Setenv("VAULT_TOKEN", "alpha")
+	if c, err := Vault(srv.URL, "kv/redis", "").Credentials(context.Background()); err != nil || c != (Credentials{Password: "gamma"}) {
+		t.Fatalf("Vault does not work as expected. c: %+v, err: %v", c, err)
+	}
+	t.Setenv("VAULT_TOKEN", "beta")
+	if _, err := Vault(srv.URL, "kv/redis", "").Credentials(context.Background()); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatal("the error of Vault should have been returned:", err)
+	}
+}
+
+func TestIAMToken(t *testing.T) {
+	tokens := iamauth.ElastiCache(func(context.Context) (iamauth.Credentials, error) {
+		return iamauth.Credentials{AccessKeyID: "alpha", SecretAccessKey: "beta"}, nil
+	}, "us-east-1", "wuid-cache", "wuid")
+	c, err := IAMToken("wuid", tokens).Credentials(context.Background())
+	if err != nil || c.Username != "wuid" || !strings.HasPrefix(c.Password, "wuid-cache/?Action=connect&") {
+		t.Fatalf("IAMToken does not work as expected. c: %+v, err: %v", c, err)
+	}
+}
@@ -0,0 +1,428 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/credentials"
+	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/wuiderr"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+const dirtyMark = "dirty"
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+	s *session
+}
+
+type NewClient func() (client *clientv3.Client, autoClose bool, err error)
+
+// NewClientWithCredentials returns a NewClient creating a client with cfg and the credentials
+// of p on every load and closing it afterwards. The credentials are fetched again every
+// time, so that a rotated password is picked up by the next renewal.
+func NewClientWithCredentials(cfg clientv3.Config, p credentials.Provider) NewClient {
+	if p == nil {
+		panic("p cannot be nil")
+	}
+	return func() (*clientv3.Client, bool, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), internal.DefaultRenewTimeout)
+		defer cancel()
+		c, err := p.Credentials(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get the credentials: %w", err)
+		}
+		cfg := cfg
+		cfg.Username, cfg.Password = c.Username, c.Password
+		client, err := clientv3.New(cfg)
+		return client, true, err
+	}
+}
+
+// Backend describes the number in etcd to load the high bits from. For the session mode, use
+// Loadh32FromEtcdSession instead.
+type Backend struct {
+	NewClient NewClient
+	Key       string
+}
+
+// LoadHighBits adds 1 to the number at b.Key in etcd and fetches its new value. The new value
+// is used as the high bits of all generated numbers. In addition, b is saved for future
+// renewal.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromEtcd(ctx, b.NewClient, b.Key)
+}
+
+// Loadh32FromEtcd is the same as LoadHighBits(Backend{NewClient: newClient, Key: key}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32FromEtcd(newClient NewClient, key string) error {
+	return w.LoadHighBits(Backend{NewClient: newClient, Key: key})
+}
+
+// loadh32FromEtcd implements LoadHighBitsContext.
+func (w *WUID) loadh32FromEtcd(ctx context.Context, newClient NewClient, key string) error {
+	if len(key) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	if err := w.w.Interlock("etcd", key); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (int64, error) {
+		return w.fetchh32FromEtcd(ctx, newClient, key)
+	}))
+}
+
+// fetchh32FromEtcd adds 1 to the number at key and returns its new value.
+func (w *WUID) fetchh32FromEtcd(ctx context.Context, newClient NewClient, key string) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("etcd", key)
+	defer func() {
+		span.End(err)
+	}()
+
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	return incr(ctx, client, key)
+}
+
+func incr(ctx context.Context, client *clientv3.Client, key string) (int64, error) {
+	for {
+		resp, err := client.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		var current, rev int64
+		if len(resp.Kvs) > 0 {
+			current, err = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("the value of %s is not a number: %w", key, err)
+			}
+			rev = resp.Kvs[0].ModRevision
+		}
+
+		next := current + 1
+		txn, err := client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+			Then(clientv3.OpPut(key, strconv.FormatInt(next, 10))).
+			Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txn.Succeeded {
+			return next, nil
+		}
+	}
+}
+
+type session struct {
+	sync.Mutex
+	client *clientv3.Client
+	prefix string
+	ttl    int
+	cs     *concurrency.Session
+	slot   int64
+	closed bool
+	stop   chan struct{}
+}
+
+func (s *session) markKey(slot int64) string {
+	return s.prefix + "/mark/" + strconv.FormatInt(slot, 10)
+}
+
+func (s *session) ownerKey(slot int64) string {
+	return s.prefix + "/owner/" + strconv.FormatInt(slot, 10)
+}
+
+// Loadh32FromEtcdSession works in the session mode. Instead of increasing a counter, it claims
+// the smallest free slot under prefix with an etcd lease held by the process, and the slot number
+// is used as the high 28 bits of all generated numbers.
+//
+// When a slot is released by Close, the low 32 bits consumed so far are saved as its watermark,
+// together with the LayoutFingerprint of the owner. The next owner with the same fingerprint
+// continues from there, so the high 28 bits are reused without any collision, while the owners
+// with another configuration, e.g. another WithObfuscation seed, leave the slot alone. A slot is
+// retired forever if its owner loses the session or exhausts it. A lost session is
+// re-established in the background with a new slot.
+func (w *WUID) Loadh32FromEtcdSession(client *clientv3.Client, prefix string, ttl int) error {
+	return w.Loadh32FromEtcdSessionContext(context.Background(), client, prefix, ttl)
+}
+
+// Loadh32FromEtcdSessionContext is like Loadh32FromEtcdSession but the claim of the first slot
+// is bound to ctx as well. The session re-established in the background is not.
+func (w *WUID) Loadh32FromEtcdSessionContext(ctx context.Context, client *clientv3.Client, prefix string, ttl int) error {
+	if client == nil {
+		return errors.New("client cannot be nil")
+	}
+	if len(prefix) == 0 {
+		return errors.New("prefix cannot be empty")
+	}
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	if w.w.Renewer() != nil {
+		return errors.New("the WUID instance has been loaded already")
+	}
+	w.w.Lock()
+	if w.s != nil {
+		w.w.Unlock()
+		return errors.New("the WUID instance has been loaded already")
+	}
+	s := &session{
+		client: client,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+	}
+	w.s = s
+	w.w.Unlock()
+
+	if err := w.w.Load(ctx, &slotRenewer{w: w, s: s}); err != nil {
+		w.w.Lock()
+		w.s = nil
+		w.w.Unlock()
+		return err
+	}
+
+	go w.watchSession(s)
+	return nil
+}
+
+// slotRenewer claims a slot of the session mode. It holds the lock of the session from the
+// claim through the reset of the counter, so that Close cannot release the slot in between.
+type slotRenewer struct {
+	w          *WUID
+	s          *session
+	newSession bool
+}
+
+func (r *slotRenewer) Lock() {
+	r.s.Lock()
+}
+
+func (r *slotRenewer) Unlock() {
+	r.s.Unlock()
+}
+
+// Renew is never called, because the core prefers Resume.
+func (r *slotRenewer) Renew(ctx context.Context) (int64, error) {
+	return 0, errors.New("a slot must be resumed from its watermark")
+}
+
+// Resume claims the smallest free slot and returns it with its watermark.
+func (r *slotRenewer) Resume(ctx context.Context) (slot int64, low int64, err error) {
+	w, s := r.w, r.s
+	span := w.w.StartLoadSpan("etcd-session", s.prefix)
+	defer func() {
+		span.End(err)
+	}()
+
+	if s.closed {
+		return 0, 0, errors.New("the etcd session has been closed")
+	}
+
+	if r.newSession || s.cs == nil {
+		var cs *concurrency.Session
+		cs, err = concurrency.NewSession(s.client, concurrency.WithTTL(s.ttl))
+		if err != nil {
+			return 0, 0, err
+		}
+		if s.cs != nil {
+			_ = s.cs.Close()
+		}
+		s.cs = cs
+	}
+
+	slot, low, err = w.claimSlot(ctx, s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s.slot != 0 {
+		_, _ = s.client.Delete(ctx, s.ownerKey(s.slot))
+	}
+	s.slot = slot
+	return slot, low, nil
+}
+
+// markValue returns the watermark saved for the next owner of a slot.
+func (w *WUID) markValue(low int64) string {
+	return strconv.FormatInt(low, 10) + ":" + w.w.LayoutFingerprint()
+}
+
+// parseMark returns the watermark of a slot, and false if the slot cannot be resumed by w,
+// i.e. it is retired, or its watermark was saved with another layout or by an older version
+// that saved none.
+func (w *WUID) parseMark(v string) (int64, bool) {
+	i := strings.IndexByte(v, ':')
+	if i < 0 || v[i+1:] != w.w.LayoutFingerprint() {
+		return 0, false
+	}
+	low, err := strconv.ParseInt(v[:i], 10, 64)
+	if err != nil || low < 0 || low >= w.w.RenewalThreshold() {
+		return 0, false
+	}
+	return low, true
+}
+
+// claimSlot claims the smallest slot that is free, or released by an owner with the same
+// layout, and passes the verification of the core. A slot is only marked once it is verified,
+// so a rejected one stays available to the other generators.
+func (w *WUID) claimSlot(ctx context.Context, s *session) (slot int64, low int64, err error) {
+	for {
+		resp, err := s.client.Get(ctx, s.prefix+"/mark/", clientv3.WithPrefix())
+		if err != nil {
+			return 0, 0, err
+		}
+
+		marks := make(map[int64]int64, len(resp.Kvs))
+		values := make(map[int64]string, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			k, err := strconv.ParseInt(strings.TrimPrefix(string(kv.Key), s.prefix+"/mark/"), 10, 64)
+			if err != nil {
+				continue
+			}
+			marks[k] = kv.ModRevision
+			values[k] = string(kv.Value)
+		}
+
+		for slot = 1; ; slot++ {
+			if slot > w.w.MaxH32() {
+				return 0, 0, fmt.Errorf("%w: no slot is left under %s", wuiderr.ErrH32Exhausted, s.prefix)
+			}
+			if rng, ok := w.w.ReservedRange(slot); ok {
+				slot = rng[1]
+				continue
+			}
+			low = 0
+			if v, ok := values[slot]; ok {
+				if low, ok = w.parseMark(v); !ok {
+					continue
+				}
+			}
+			if err := w.w.Verifyh32(slot); err != nil {
+				w.w.Warnf("<wuid> slot %d is rejected. name: %s, reason: %s", slot, w.w.Name, err)
+				continue
+			}
+			break
+		}
+
+		txn, err := s.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(s.markKey(slot)), "=", marks[slot])).
+			Then(clientv3.OpPut(s.markKey(slot), dirtyMark),
+				clientv3.OpPut(s.ownerKey(slot), w.w.Name, clientv3.WithLease(s.cs.Lease()))).
+			Commit()
+		if err != nil {
+			return 0, 0, err
+		}
+		if txn.Succeeded {
+			return slot, low, nil
+		}
+	}
+}
+
+func (w *WUID) watchSession(s *session) {
+	for {
+		s.Lock()
+		cs := s.cs
+		s.Unlock()
+
+		select {
+		case <-s.stop:
+			return
+		case <-cs.Done():
+		}
+
+		s.Lock()
+		closed := s.closed
+		s.Unlock()
+		if closed {
+			return
+		}
+
+		w.w.Warnf("<wuid> etcd session lost. name: %s", w.w.Name)
+		for {
+			err := w.w.Load(context.Background(), &slotRenewer{w: w, s: s, newSession: true})
+			if err == nil {
+				break
+			}
+			w.w.Warnf("<wuid> failed to re-establish the etcd session. name: %s, reason: %+v", w.w.Name, err)
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// Close releases the slot claimed by Loadh32FromEtcdSession and saves its watermark for the
+// next owner. It also stops the background renewal started by WithMaxH32Age. Next panics
+// after Close.
+func (w *WUID) Close() error {
+	w.w.Stop()
+	w.w.Lock()
+	s := w.s
+	w.w.Unlock()
+	if s == nil {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+
+	old := w.w.Exhaust()
+
+	ctx1, cancel1 := context.WithTimeout(context.Background(), w.w.RenewTimeout())
+	defer cancel1()
+	var err error
+	if s.slot != 0 {
+		mark := w.markValue(old & internal.L32Mask)
+		_, err = s.client.Txn(ctx1).
+			If(clientv3.Compare(clientv3.LeaseValue(s.ownerKey(s.slot)), "=", s.cs.Lease())).
+			Then(clientv3.OpPut(s.markKey(s.slot), mark), clientv3.OpDelete(s.ownerKey(s.slot))).
+			Commit()
+	}
+	if err2 := s.cs.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
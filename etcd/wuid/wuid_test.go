@@ -0,0 +1,322 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+var (
+	cfg struct {
+		endpoints []string
+		key       string
+	}
+)
+
+func init() {
+	cfg.endpoints = []string{"127.0.0.1:2379"}
+	cfg.key = "wuid"
+}
+
+func connect(t *testing.T) *clientv3.Client {
+	t.Helper()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.endpoints,
+		DialTimeout: time.Second * 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func uniquePrefix() string {
+	return "wuid-session-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func TestWUID_Loadh32FromEtcd(t *testing.T) {
+	newClient := func() (*clientv3.Client, bool, error) {
+		return connect(t), true, nil
+	}
+	w := NewWUID("alpha", dumb)
+	err := w.Loadh32FromEtcd(newClient, cfg.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	for i := 1; i < 100; i++ {
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+}
+
+func TestWUID_Loadh32FromEtcd_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32FromEtcd(nil, "") == nil {
+		t.Fatal("key is not properly checked")
+	}
+
+	newErrorClient := func() (*clientv3.Client, bool, error) {
+		return nil, true, errors.New("beta")
+	}
+	if w.Loadh32FromEtcd(newErrorClient, "beta") == nil {
+		t.Fatal(`w.Loadh32FromEtcd(newErrorClient, "beta") == nil`)
+	}
+}
+
+func TestWUID_Loadh32FromEtcdSession(t *testing.T) {
+	client := connect(t)
+	defer client.Close()
+	prefix := uniquePrefix()
+
+	w1 := NewWUID("alpha", dumb)
+	if err := w1.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	w2 := NewWUID("beta", dumb)
+	if err := w2.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w1.w.N)>>32 != 1 || atomic.LoadInt64(&w2.w.N)>>32 != 2 {
+		t.Fatal("the slots are not properly claimed")
+	}
+
+	var last int64
+	for i := 0; i < 100; i++ {
+		last = w1.Next()
+	}
+	if err := w1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		w1.Next()
+		t.Fatal("Next should have panicked after Close")
+	}()
+
+	w3 := NewWUID("gamma", dumb)
+	if err := w3.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	if v := w3.Next(); v>>32 != 1 || v <= last {
+		t.Fatalf("the watermark of the slot is not respected. v: %x, last: %x", v, last)
+	}
+
+	if err := w2.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w2.w.N)>>32 != 3 {
+		t.Fatal("an exhausted slot should be retired")
+	}
+
+	_ = w2.Close()
+	_ = w3.Close()
+}
+
+func TestWUID_Loadh32FromEtcdSession_Layout(t *testing.T) {
+	client := connect(t)
+	defer client.Close()
+	prefix := uniquePrefix()
+
+	w1 := NewWUID("alpha", dumb, WithObfuscation(1))
+	if err := w1.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		w1.Next()
+	}
+	if err := w1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another layout must not resume the watermark of slot 1.
+	w2 := NewWUID("beta", dumb, WithObfuscation(2))
+	if err := w2.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+	if h := atomic.LoadInt64(&w2.w.N) >> 32; h != 2 {
+		t.Fatalf("the slot of another layout is claimed. h32: %d", h)
+	}
+	w3 := NewWUID("gamma", dumb, WithObfuscation(1))
+	if err := w3.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	defer w3.Close()
+	if h := atomic.LoadInt64(&w3.w.N) >> 32; h != 1 {
+		t.Fatalf("the slot of the same layout is not resumed. h32: %d", h)
+	}
+
+	// A rejected slot is not burned.
+	w4 := NewWUID("delta", dumb, Withh32Verifier(func(h32 int64) error {
+		if h32 == 3 {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+	if err := w4.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	defer w4.Close()
+	if h := atomic.LoadInt64(&w4.w.N) >> 32; h != 4 {
+		t.Fatalf("the rejected slot is claimed. h32: %d", h)
+	}
+	resp, err := client.Get(context.Background(), prefix+"/mark/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Kvs) != 0 {
+		t.Fatal("the rejected slot should not be marked")
+	}
+}
+
+func TestWUID_Loadh32FromEtcdSession_Lost(t *testing.T) {
+	client := connect(t)
+	defer client.Close()
+	prefix := uniquePrefix()
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	if err := w.Loadh32FromEtcdSession(client, prefix, 5); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.s.Lock()
+	lease := w.s.cs.Lease()
+	w.s.Unlock()
+	if _, err := client.Revoke(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := time.Now()
+	for atomic.LoadInt64(&w.w.N)>>32 != 2 {
+		if time.Since(startTime) > time.Second*5 {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelWarn && strings.Contains(msg, "session lost") {
+			num++
+		}
+		return true
+	})
+	if num != 1 {
+		t.Fatal(`num != 1`)
+	}
+}
+
+func TestWUID_Loadh32FromEtcdSession_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32FromEtcdSession(nil, "beta", 5) == nil {
+		t.Fatal("client is not properly checked")
+	}
+	client := &clientv3.Client{}
+	if w.Loadh32FromEtcdSession(client, "", 5) == nil {
+		t.Fatal("prefix is not properly checked")
+	}
+	if w.Loadh32FromEtcdSession(client, "beta", 0) == nil {
+		t.Fatal("ttl is not properly checked")
+	}
+	if w.Close() != nil {
+		t.Fatal("Close should do nothing")
+	}
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestWUID_Next_Renew(t *testing.T) {
+	client := connect(t)
+	defer client.Close()
+	newClient := func() (*clientv3.Client, bool, error) {
+		return client, false, nil
+	}
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	err := w.Loadh32FromEtcd(newClient, cfg.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h32 := atomic.LoadInt64(&w.w.N) >> 32
+	atomic.StoreInt64(&w.w.N, (h32<<32)|internal.Bye)
+	n1a := w.Next()
+	if n1a>>32 != h32 {
+		t.Fatal(`n1a>>32 != h32`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != (h32+1)<<32+1 {
+		t.Fatal(`n1b != (h32+1)<<32+1`)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 1 {
+		t.Fatal(`num != 1`)
+	}
+}
+
+func Example() {
+	var client *clientv3.Client
+	// ...
+
+	// Setup
+	w := NewWUID("alpha", nil)
+	err := w.Loadh32FromEtcdSession(client, "wuid", 10)
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	// Generate
+	for i := 0; i < 10; i++ {
+		fmt.Printf("%#016x\n", w.Next())
+	}
+}
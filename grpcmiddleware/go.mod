@@ -0,0 +1,20 @@
+module github.com/driftboat/wuid/grpcmiddleware
+
+go 1.18
+
+require (
+	github.com/driftboat/wuid v1.5.0
+	google.golang.org/grpc v1.41.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
+	google.golang.org/genproto v0.0.0-20210602131652-f16073e35f0c // indirect
+	google.golang.org/protobuf v1.26.0 // indirect
+)
+
+replace github.com/driftboat/wuid => ../
@@ -0,0 +1,90 @@
+// Package grpcmiddleware provides the gRPC server interceptors attaching an identifier
+// generated by WUID to every call as its request ID, so that the logs of a call and those of
+// the services it calls can be correlated.
+package grpcmiddleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/driftboat/wuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultHeader is the header carrying the request ID unless WithHeader is used.
+const DefaultHeader = "x-request-id"
+
+// Option configures the interceptors.
+type Option func(c *config)
+
+type config struct {
+	header string
+}
+
+// WithHeader sets the header carrying the request ID.
+func WithHeader(name string) Option {
+	if name == "" {
+		panic("name cannot be empty")
+	}
+	return func(c *config) {
+		c.header = strings.ToLower(name)
+	}
+}
+
+func newConfig(w wuid.WUID, opts []Option) config {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	c := config{header: DefaultHeader}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// attach generates a request ID with w, sends it in base62 in the header of the response, and
+// puts it in ctx. An ID in the metadata of the call is ignored, because it cannot be trusted
+// to be unique.
+func (c config) attach(ctx context.Context, w wuid.WUID) context.Context {
+	id := wuid.ID(w.Next())
+	// It fails only without a server stream in ctx, e.g. when the interceptor is called
+	// directly, in which case the ID is still put in ctx.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(c.header, id.String()))
+	return wuid.NewContext(ctx, id)
+}
+
+// UnaryServerInterceptor returns a unary interceptor that generates an identifier with w for
+// every call, puts it in the context of the call, where wuid.FromContext finds it, and sends
+// it in base62 in the header of the response. Any adapter's WUID can be passed in once it has
+// loaded the high bits.
+func UnaryServerInterceptor(w wuid.WUID, opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(w, opts)
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(c.attach(ctx, w), req)
+	}
+}
+
+// StreamServerInterceptor is like UnaryServerInterceptor, but for the streaming calls.
+func StreamServerInterceptor(w wuid.WUID, opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(w, opts)
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: c.attach(ss.Context(), w)})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// FromContext returns the request ID put in ctx by the interceptors. It is the same as
+// wuid.FromContext.
+func FromContext(ctx context.Context) (wuid.ID, bool) {
+	return wuid.FromContext(ctx)
+}
@@ -0,0 +1,102 @@
+package grpcmiddleware
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/driftboat/wuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type counter struct {
+	n int64
+}
+
+func (c *counter) Next() int64 {
+	c.n++
+	return c.n
+}
+
+// recorder records the request IDs found in the contexts of the calls.
+type recorder struct {
+	*health.Server
+	ids chan wuid.ID
+}
+
+func (r *recorder) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	id, _ := FromContext(ctx)
+	r.ids <- id
+	return r.Server.Check(ctx, req)
+}
+
+func (r *recorder) Watch(req *healthpb.HealthCheckRequest, s healthpb.Health_WatchServer) error {
+	id, _ := FromContext(s.Context())
+	r.ids <- id
+	return s.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func TestInterceptors(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	w := &counter{n: 1000}
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(w)),
+		grpc.StreamInterceptor(StreamServerInterceptor(w, WithHeader("X-Trace-ID"))),
+	)
+	r := &recorder{Server: health.NewServer(), ids: make(chan wuid.ID, 2)}
+	healthpb.RegisterHealthServer(s, r)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	c := healthpb.NewHealthClient(cc)
+
+	var md metadata.MD
+	if _, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&md)); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-r.ids; id != 1001 || md.Get(DefaultHeader)[0] != id.String() {
+		t.Fatalf("the unary call should carry the request ID. id: %d, header: %v", id, md)
+	}
+
+	stream, err := c.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	md, err = stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-r.ids; id != 1002 || md.Get("x-trace-id")[0] != id.String() {
+		t.Fatalf("the streaming call should carry the request ID. id: %d, header: %v", id, md)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := FromContext(ctx); ok {
+		t.Fatal("a context without a request ID should report false")
+	}
+	_, _ = UnaryServerInterceptor(&counter{})(ctx, nil, nil, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if id, ok := FromContext(ctx); !ok || id != 1 {
+			t.Fatalf("the request ID should be in the context without a server stream. id: %d", id)
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,61 @@
+// Package httpmiddleware attaches an identifier generated by WUID to every request of a
+// net/http server as its request ID, so that the logs of a request and those of the services
+// it calls can be correlated.
+package httpmiddleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/driftboat/wuid"
+)
+
+// DefaultHeader is the header carrying the request ID unless WithHeader is used.
+const DefaultHeader = "X-Request-ID"
+
+// Option configures RequestID.
+type Option func(c *config)
+
+type config struct {
+	header string
+}
+
+// WithHeader sets the header carrying the request ID.
+func WithHeader(name string) Option {
+	if name == "" {
+		panic("name cannot be empty")
+	}
+	return func(c *config) {
+		c.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// RequestID returns a middleware that generates an identifier with w for every request, puts it
+// in the context of the request, where wuid.FromContext finds it, and sets it in base62 in the
+// header of both the request and the response. Any adapter's WUID can be passed in once it has
+// loaded the high bits. An ID in the header of an incoming request is replaced, because it
+// cannot be trusted to be unique.
+func RequestID(w wuid.WUID, opts ...Option) func(http.Handler) http.Handler {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	c := config{header: DefaultHeader}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			id := wuid.ID(w.Next())
+			r = r.WithContext(wuid.NewContext(r.Context(), id))
+			r.Header.Set(c.header, id.String())
+			rw.Header().Set(c.header, id.String())
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// FromContext returns the request ID put in ctx by RequestID. It is the same as
+// wuid.FromContext.
+func FromContext(ctx context.Context) (wuid.ID, bool) {
+	return wuid.FromContext(ctx)
+}
@@ -0,0 +1,55 @@
+package httpmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/driftboat/wuid"
+)
+
+type counter struct {
+	n int64
+}
+
+func (c *counter) Next() int64 {
+	c.n++
+	return c.n
+}
+
+func TestRequestID(t *testing.T) {
+	var got []wuid.ID
+	h := RequestID(&counter{n: 1000})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, ok := FromContext(r.Context())
+		if !ok {
+			t.Fatal("the request ID should be in the context")
+		}
+		if r.Header.Get(DefaultHeader) != id.String() {
+			t.Fatalf("the request header should carry the ID. header: %q, id: %s", r.Header.Get(DefaultHeader), id)
+		}
+		got = append(got, id)
+	}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultHeader, "forged")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Header().Get(DefaultHeader) != got[i].String() {
+			t.Fatalf("the response header should carry the ID. header: %q", rec.Header().Get(DefaultHeader))
+		}
+	}
+	if got[0] != 1001 || got[1] != 1002 {
+		t.Fatalf("every request should get a fresh ID. got: %v", got)
+	}
+
+	h = RequestID(&counter{}, WithHeader("x-trace-id"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("X-Trace-Id") != wuid.ID(1).String() {
+		t.Fatalf("WithHeader should have changed the header. header: %v", rec.Header())
+	}
+	if _, ok := FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Fatal("a context without a request ID should report false")
+	}
+}
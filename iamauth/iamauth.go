@@ -0,0 +1,227 @@
+// Package iamauth mints the IAM authentication tokens of ElastiCache and RDS, so that the
+// adapters connect with short-lived tokens instead of static passwords. It signs the tokens
+// with AWS Signature Version 4 itself, and leaves retrieving the AWS credentials to a
+// CredentialsFunc, e.g. one backed by the AWS SDK, so that no AWS module is required.
+package iamauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenTTL is how long a token is valid for, which AWS caps at 15 minutes.
+const TokenTTL = time.Minute * 15
+
+// RefreshMargin is how long before its expiry a cached token is replaced by a new one.
+const RefreshMargin = time.Minute * 5
+
+// emptyPayloadHash is the SHA-256 of an empty payload, which the tokens are signed with.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Credentials are the AWS credentials signing the tokens.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is required by temporary credentials, e.g. those of an IAM role.
+	SessionToken string
+}
+
+// CredentialsFunc returns the AWS credentials. It is called for every token minted, so that
+// the temporary credentials of a role can rotate.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// EnvCredentials reads the AWS credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+func EnvCredentials(context.Context) (Credentials, error) {
+	c := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return c, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return c, nil
+}
+
+// TokenSource mints the tokens of a user and caches them until RefreshMargin before their
+// expiry. It is safe for concurrent use.
+type TokenSource struct {
+	creds   CredentialsFunc
+	service string
+	region  string
+	host    string
+	query   url.Values
+	now     func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// ElastiCache returns a TokenSource minting the tokens of user, the ID of an ElastiCache user
+// with IAM authentication enabled, for the replication group or the serverless cache
+// cacheName in region. The tokens are passed to AUTH as the password of user, which
+// AuthOnConnect of the redis/v8 adapter does for every new connection.
+func ElastiCache(creds CredentialsFunc, region, cacheName, user string) *TokenSource {
+	if cacheName == "" || user == "" {
+		panic("cacheName and user cannot be empty")
+	}
+	return newTokenSource(creds, "elasticache", region, cacheName, url.Values{
+		"Action": {"connect"},
+		"User":   {user},
+	})
+}
+
+// RDS returns a TokenSource minting the tokens of the database user for the RDS instance or
+// cluster at endpoint, which is host:port, in region. The tokens are the password of user,
+// e.g. in the DSN built by the OpenDB callback of an adapter.
+func RDS(creds CredentialsFunc, region, endpoint, user string) *TokenSource {
+	if !strings.Contains(endpoint, ":") || user == "" {
+		panic("endpoint must be host:port, and user cannot be empty")
+	}
+	return newTokenSource(creds, "rds-db", region, endpoint, url.Values{
+		"Action": {"connect"},
+		"DBUser": {user},
+	})
+}
+
+func newTokenSource(creds CredentialsFunc, service, region, host string, query url.Values) *TokenSource {
+	if creds == nil {
+		panic("creds cannot be nil")
+	}
+	if region == "" {
+		panic("region cannot be empty")
+	}
+	return &TokenSource{creds: creds, service: service, region: region, host: host, query: query, now: time.Now}
+}
+
+// Token returns the cached token, or mints a new one if the cached one expires in less than
+// RefreshMargin.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.token != "" && now.Add(RefreshMargin).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	c, err := s.creds(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := make(url.Values, len(s.query)+1)
+	for k, v := range s.query {
+		query[k] = v
+	}
+	if c.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	s.token = strings.TrimPrefix(presign(c, s.service, s.region, s.host, "/", query, emptyPayloadHash, now, TokenTTL), "https://")
+	s.expiry = now.Add(TokenTTL)
+	return s.token, nil
+}
+
+// presign returns the URL of a GET request to host and path signed with AWS Signature
+// Version 4 in its query string.
+func presign(c Credentials, service, region, host, path string, query url.Values, payloadHash string, t time.Time, ttl time.Duration) string {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", c.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		"GET", path, canonicalQuery, "host:" + host + "\n", "host", payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(c, amzDate[:8], region, service), stringToSign))
+	return "https://" + host + path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// Sign signs req, whose body is payload, with AWS Signature Version 4 in its Authorization
+// header, e.g. for the API of AWS Secrets Manager. Only the host and the headers set by Sign
+// are signed.
+func Sign(req *http.Request, payload []byte, c Credentials, service, region string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	headers := []string{"host:" + req.URL.Host, "x-amz-date:" + amzDate}
+	signedHeaders := "host;x-amz-date"
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+		headers = append(headers, "x-amz-security-token:"+c.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, canonicalQueryString(req.URL.Query()), strings.Join(headers, "\n") + "\n", signedHeaders, hexSHA256(string(payload)),
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(c, amzDate[:8], region, service), stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func signingKey(c Credentials, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	return key
+}
+
+// canonicalQueryString sorts the parameters by key and escapes everything but the unreserved
+// characters, as Signature Version 4 requires.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
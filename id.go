@@ -0,0 +1,133 @@
+package wuid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const base62Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ID is an identifier generated by WUID, which prints consistently across logs and
+// user-facing surfaces. %s, %v and String use base62, while %d, %x, %X, %o and %b print the
+// number as an int64.
+type ID int64
+
+// NextID returns a unique identifier from the default generator as an ID.
+func NextID() ID {
+	return ID(Next())
+}
+
+// String returns id in base62.
+func (id ID) String() string {
+	var buf [11]byte
+	return string(id.appendBase62(buf[:0]))
+}
+
+// StringFixed returns id in base62, padded with zeros to width, so that the strings sort in
+// the same order as the numbers. A width of 9 fits all the identifiers generated without
+// WithSection, and 11 fits all. It panics if id does not fit in width.
+func (id ID) StringFixed(width int) string {
+	var buf [11]byte
+	b := id.appendBase62(buf[:0])
+	if len(b) > width {
+		panic(fmt.Errorf("%s does not fit in %d characters", b, width))
+	}
+	return strings.Repeat("0", width-len(b)) + string(b)
+}
+
+func (id ID) appendBase62(dst []byte) []byte {
+	u := uint64(id)
+	if u == 0 {
+		return append(dst, '0')
+	}
+	var buf [11]byte
+	i := len(buf)
+	for u > 0 {
+		i--
+		buf[i] = base62Digits[u%62]
+		u /= 62
+	}
+	return append(dst, buf[i:]...)
+}
+
+// Format implements fmt.Formatter.
+func (id ID) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 's', 'v', 'q':
+		_, _ = fmt.Fprintf(f, formatString(f, verb), id.String())
+	case 'd', 'x', 'X', 'o', 'O', 'b':
+		_, _ = fmt.Fprintf(f, formatString(f, verb), int64(id))
+	default:
+		_, _ = fmt.Fprintf(f, "%%!%c(wuid.ID=%s)", verb, id.String())
+	}
+}
+
+// formatString rebuilds the directive of verb with the flags, the width and the precision.
+func formatString(f fmt.State, verb rune) string {
+	b := []byte{'%'}
+	for _, c := range "+-# 0" {
+		if f.Flag(int(c)) {
+			b = append(b, byte(c))
+		}
+	}
+	if w, ok := f.Width(); ok {
+		b = strconv.AppendInt(b, int64(w), 10)
+	}
+	if p, ok := f.Precision(); ok {
+		b = append(b, '.')
+		b = strconv.AppendInt(b, int64(p), 10)
+	}
+	return string(append(b, string(verb)...))
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. id is encoded as 8 bytes in big-endian,
+// which makes it work with gob, msgpack and the like without custom codecs.
+func (id ID) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (id *ID) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return fmt.Errorf("wuid.ID should be 8 bytes, not %d", len(data))
+	}
+	*id = ID(binary.BigEndian.Uint64(data))
+	return nil
+}
+
+// ParseID parses an ID in base62, which is the format of String.
+func ParseID(s string) (ID, error) {
+	if s == "" || len(s) > 11 {
+		return 0, fmt.Errorf("invalid wuid.ID: %q", s)
+	}
+	var u uint64
+	for i := 0; i < len(s); i++ {
+		d := base62Index(s[i])
+		if d < 0 {
+			return 0, fmt.Errorf("invalid wuid.ID: %q", s)
+		}
+		if u > (1<<63-1-uint64(d))/62 {
+			return 0, errors.New("wuid.ID out of range: " + strconv.Quote(s))
+		}
+		u = u*62 + uint64(d)
+	}
+	return ID(u), nil
+}
+
+func base62Index(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	default:
+		return -1
+	}
+}
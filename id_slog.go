@@ -0,0 +1,12 @@
+//go:build go1.21
+
+package wuid
+
+import (
+	"log/slog"
+)
+
+// LogValue implements slog.LogValuer, so that an ID is logged in base62 like String.
+func (id ID) LogValue() slog.Value {
+	return slog.StringValue(id.String())
+}
@@ -0,0 +1,19 @@
+//go:build go1.21
+
+package wuid
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestID_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("created", "id", ID(0x2A00000001))
+	if !strings.Contains(buf.String(), "id=3AtwIAj") {
+		t.Fatalf("the log is %q, which should contain id=3AtwIAj", buf.String())
+	}
+}
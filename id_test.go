@@ -0,0 +1,116 @@
+package wuid
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestID_Format(t *testing.T) {
+	id := ID(0x2A00000001)
+	for _, c := range []struct {
+		format string
+		want   string
+	}{
+		{"%s", "3AtwIAj"},
+		{"%v", "3AtwIAj"},
+		{"%q", `"3AtwIAj"`},
+		{"%10s", "   3AtwIAj"},
+		{"%-10s|", "3AtwIAj   |"},
+		{"%d", "180388626433"},
+		{"%x", "2a00000001"},
+		{"%#X", "0X2A00000001"},
+		{"%016x", "0000002a00000001"},
+		{"%t", "%!t(wuid.ID=3AtwIAj)"},
+	} {
+		if s := fmt.Sprintf(c.format, id); s != c.want {
+			t.Fatalf("fmt.Sprintf(%q) returned %q, while it should be %q", c.format, s, c.want)
+		}
+	}
+	if s := id.String(); s != "3AtwIAj" {
+		t.Fatalf("id.String() returned %q, while it should be 3AtwIAj", s)
+	}
+	if s := ID(0).String(); s != "0" {
+		t.Fatalf("ID(0).String() returned %q, while it should be 0", s)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	for _, id := range []ID{0, 1, 61, 62, 0x2A00000001, math.MaxInt64} {
+		v, err := ParseID(id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != id {
+			t.Fatalf("ParseID returned %d, while it should be %d", v, id)
+		}
+	}
+	for _, s := range []string{"", "3ZIc-Rb", "AzL8n0Y58m8", "zzzzzzzzzzzz"} {
+		if _, err := ParseID(s); err == nil {
+			t.Fatalf("ParseID(%q) should have failed", s)
+		}
+	}
+}
+
+func TestID_StringFixed(t *testing.T) {
+	ids := []ID{0, 9, 10, 61, 62, 0x2A00000001, 1<<53 - 1}
+	for i := 1; i < len(ids); i++ {
+		if s1, s2 := ids[i-1].StringFixed(9), ids[i].StringFixed(9); len(s1) != 9 || s1 >= s2 {
+			t.Fatalf("%q should precede %q in lexicographic order", s1, s2)
+		}
+	}
+	if s := ID(0x2A00000001).StringFixed(9); s != "003AtwIAj" {
+		t.Fatalf("StringFixed returned %q, while it should be 003AtwIAj", s)
+	}
+	if v, err := ParseID(ID(42).StringFixed(11)); err != nil || v != 42 {
+		t.Fatalf("ParseID should accept the padded form. v: %d, err: %v", v, err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("StringFixed should have panicked when id does not fit")
+		}
+	}()
+	ID(math.MaxInt64).StringFixed(9)
+}
+
+func TestID_MarshalBinary(t *testing.T) {
+	type record struct {
+		ID  ID
+		IDs []ID
+	}
+	r1 := record{ID: 0x2A00000001, IDs: []ID{1, math.MaxInt64}}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(r1); err != nil {
+		t.Fatal(err)
+	}
+	var r2 record
+	if err := gob.NewDecoder(&buf).Decode(&r2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r1, r2) {
+		t.Fatalf("gob: %v != %v", r1, r2)
+	}
+
+	data, err := msgpack.Marshal(r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r3 record
+	if err := msgpack.Unmarshal(data, &r3); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r1, r3) {
+		t.Fatalf("msgpack: %v != %v", r1, r3)
+	}
+
+	var id ID
+	if err := id.UnmarshalBinary([]byte{1, 2, 3}); err == nil {
+		t.Fatal("UnmarshalBinary should have failed")
+	}
+}
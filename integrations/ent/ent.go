@@ -0,0 +1,40 @@
+// Package ent provides an ent mixin that makes WUIDs the primary keys of a schema:
+//
+//	func (Order) Mixin() []ent.Mixin {
+//		return []ent.Mixin{
+//			wuident.IDMixin(w),
+//		}
+//	}
+//
+// The generator must be ready before the generated client creates any entity.
+package ent
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/mixin"
+	"github.com/driftboat/wuid"
+)
+
+// Mixin adds an int64 ID field filled by a WUID generator.
+type Mixin struct {
+	mixin.Schema
+	w wuid.WUID
+}
+
+// IDMixin creates a Mixin generating identifiers with w.
+func IDMixin(w wuid.WUID) Mixin {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	return Mixin{w: w}
+}
+
+// Fields implements ent.Mixin.
+func (m Mixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id").
+			DefaultFunc(m.w.Next).
+			Immutable(),
+	}
+}
@@ -0,0 +1,29 @@
+package ent
+
+import (
+	"testing"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestIDMixin(t *testing.T) {
+	w := wuidtest.NewDeterministicWUID(42)
+	fields := IDMixin(w).Fields()
+	if len(fields) != 1 {
+		t.Fatalf("len(fields) is %d, while it should be 1", len(fields))
+	}
+	d := fields[0].Descriptor()
+	if d.Name != "id" || !d.Immutable {
+		t.Fatal("the field should be an immutable id")
+	}
+	f, ok := d.Default.(func() int64)
+	if !ok {
+		t.Fatalf("the default of the field is %T, while it should be func() int64", d.Default)
+	}
+	if v := f(); v != 42<<32|1 {
+		t.Fatalf("the default is %#016x, while it should be %#016x", v, 42<<32|1)
+	}
+	if v := f(); v != 42<<32|2 {
+		t.Fatalf("the default is %#016x, while it should be %#016x", v, 42<<32|2)
+	}
+}
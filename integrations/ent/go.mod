@@ -0,0 +1,18 @@
+module github.com/driftboat/wuid/integrations/ent
+
+go 1.18
+
+require (
+	entgo.io/ent v0.10.1
+	github.com/driftboat/wuid v1.5.0
+)
+
+require (
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247 // indirect
+	github.com/stretchr/testify v1.8.1 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+)
+
+replace github.com/driftboat/wuid => ../..
@@ -0,0 +1,22 @@
+module github.com/driftboat/wuid/integrations/gorm
+
+go 1.18
+
+require (
+	github.com/driftboat/wuid v1.5.0
+	gorm.io/driver/sqlite v1.4.4
+	gorm.io/gorm v1.24.2
+)
+
+require (
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
+	github.com/stretchr/testify v1.8.1 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+)
+
+replace github.com/driftboat/wuid => ../..
@@ -0,0 +1,99 @@
+// Package gorm provides a gorm plugin that assigns WUIDs to the tagged fields on creation:
+//
+//	type Order struct {
+//		ID    int64 `gorm:"primaryKey;autoIncrement:false" wuid:""`
+//		Title string
+//	}
+//
+//	err := db.Use(gorm.NewPlugin(w))
+//
+// A tagged field must be an int64, a uint64 or a string. Fields that already hold a non-zero
+// value are left untouched.
+package gorm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/driftboat/wuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// TagName is the struct tag that marks the fields to be filled by the plugin.
+const TagName = "wuid"
+
+// Plugin assigns WUIDs to the tagged fields before records are created.
+type Plugin struct {
+	w wuid.WUID
+}
+
+// NewPlugin creates a Plugin generating identifiers with w.
+func NewPlugin(w wuid.WUID) *Plugin {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	return &Plugin{w: w}
+}
+
+// Name implements gorm.Plugin.
+func (p *Plugin) Name() string {
+	return "wuid"
+}
+
+// Initialize implements gorm.Plugin.
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register("wuid:assign", p.assign)
+}
+
+func (p *Plugin) assign(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	var fields []*schema.Field
+	for _, f := range db.Statement.Schema.Fields {
+		if _, ok := f.Tag.Lookup(TagName); ok {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			p.assignRecord(db, fields, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		p.assignRecord(db, fields, rv)
+	}
+}
+
+func (p *Plugin) assignRecord(db *gorm.DB, fields []*schema.Field, rv reflect.Value) {
+	ctx := db.Statement.Context
+	for _, f := range fields {
+		if _, zero := f.ValueOf(ctx, rv); !zero {
+			continue
+		}
+		var v interface{}
+		switch f.FieldType.Kind() {
+		case reflect.Int64:
+			v = p.w.Next()
+		case reflect.Uint64:
+			v = uint64(p.w.Next())
+		case reflect.String:
+			v = strconv.FormatInt(p.w.Next(), 10)
+		default:
+			_ = db.AddError(fmt.Errorf("the type of %s.%s should be int64, uint64 or string", db.Statement.Schema.Name, f.Name))
+			return
+		}
+		if err := f.Set(ctx, rv, v); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+	}
+}
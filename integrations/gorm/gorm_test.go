@@ -0,0 +1,60 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/driftboat/wuid/wuidtest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type order struct {
+	ID    int64  `gorm:"primaryKey;autoIncrement:false" wuid:""`
+	Ref   string `wuid:""`
+	Title string
+}
+
+type bad struct {
+	ID int32 `gorm:"primaryKey;autoIncrement:false" wuid:""`
+}
+
+func TestPlugin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wuidtest.NewDeterministicWUID(42)
+	if err := db.Use(NewPlugin(w)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&order{}, &bad{}); err != nil {
+		t.Fatal(err)
+	}
+
+	o := order{Title: "alpha"}
+	if err := db.Create(&o).Error; err != nil {
+		t.Fatal(err)
+	}
+	if o.ID != 42<<32|1 || o.Ref != "180388626434" {
+		t.Fatalf("the identifiers assigned are %#x and %s", o.ID, o.Ref)
+	}
+
+	orders := []order{{Title: "beta"}, {ID: 7, Ref: "x", Title: "gamma"}}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if orders[0].ID != 42<<32|3 || orders[1].ID != 7 || orders[1].Ref != "x" {
+		t.Fatalf("the identifiers assigned are %#x and %#x", orders[0].ID, orders[1].ID)
+	}
+
+	var n int64
+	db.Model(&order{}).Where("id = ?", 42<<32|3).Count(&n)
+	if n != 1 {
+		t.Fatal("the identifier assigned should have been saved")
+	}
+
+	if err := db.Create(&bad{}).Error; err == nil {
+		t.Fatal("Create should have failed for an int32 field")
+	}
+}
@@ -0,0 +1,122 @@
+// Code generated by wuidgen. DO NOT EDIT.
+
+package internal
+
+import (
+	"github.com/driftboat/wuid/core"
+)
+
+const (
+	PanicValue              = core.PanicValue
+	CriticalValue           = core.CriticalValue
+	RenewIntervalMask       = core.RenewIntervalMask
+	MaxStep                 = core.MaxStep
+	MinRenewHeadroom        = core.MinRenewHeadroom
+	Bye                     = core.Bye
+	H32Mask                 = core.H32Mask
+	L32Mask                 = core.L32Mask
+	NoFault                 = core.NoFault
+	FaultTimeout            = core.FaultTimeout
+	FaultError              = core.FaultError
+	FaultLostReply          = core.FaultLostReply
+	FaultDuplicateIncrement = core.FaultDuplicateIncrement
+	SignatureSize           = core.SignatureSize
+	NoSection               = core.NoSection
+	MaxSectionID            = core.MaxSectionID
+	ResumeGap               = core.ResumeGap
+	RenewMargin             = core.RenewMargin
+	DefaultRenewTimeout     = core.DefaultRenewTimeout
+	RateTimeConstant        = core.RateTimeConstant
+	NumIntervalBuckets      = core.NumIntervalBuckets
+)
+
+type (
+	Logger             = core.Logger
+	WUID               = core.WUID
+	Range              = core.Range
+	Fingerprint        = core.Fingerprint
+	Fault              = core.Fault
+	FaultInjector      = core.FaultInjector
+	FaultInjectorFunc  = core.FaultInjectorFunc
+	StringFormat       = core.StringFormat
+	ResetOption        = core.ResetOption
+	Option             = core.Option
+	H32Verifier        = core.H32Verifier
+	H32VerifierFunc    = core.H32VerifierFunc
+	SectionID          = core.SectionID
+	ParkedBlock        = core.ParkedBlock
+	Parker             = core.Parker
+	Pool               = core.Pool
+	Renewer            = core.Renewer
+	RenewerFunc        = core.RenewerFunc
+	Resumer            = core.Resumer
+	VerifyingRenewer   = core.VerifyingRenewer
+	Raiser             = core.Raiser
+	Mirror             = core.Mirror
+	SequenceAllocator  = core.SequenceAllocator
+	Seq                = core.Seq
+	StatsSnapshot      = core.StatsSnapshot
+	RateStats          = core.RateStats
+	LatencyStats       = core.LatencyStats
+	ExhaustionEstimate = core.ExhaustionEstimate
+	Attribute          = core.Attribute
+	Tracer             = core.Tracer
+	Span               = core.Span
+	LoadSpan           = core.LoadSpan
+	HighBits           = core.HighBits
+	Registry           = core.Registry
+	VerifierToken      = core.VerifierToken
+)
+
+var (
+	NewWUID                 = core.NewWUID
+	FaultSequence           = core.FaultSequence
+	ToUint64                = core.ToUint64
+	FromUint64              = core.FromUint64
+	AppendString            = core.AppendString
+	AnyStringFormat         = core.AnyStringFormat
+	ValidateChecksum        = core.ValidateChecksum
+	WithStrictInterlock     = core.WithStrictInterlock
+	AllowRewind             = core.AllowRewind
+	Withh32Verifier         = core.Withh32Verifier
+	WithVerifier            = core.WithVerifier
+	WithSequenceAllocator   = core.WithSequenceAllocator
+	WithReservedH32Ranges   = core.WithReservedH32Ranges
+	WithRegistry            = core.WithRegistry
+	WithH32ExhaustionAlarm  = core.WithH32ExhaustionAlarm
+	WithVerboseLogging      = core.WithVerboseLogging
+	WithQuietRenewals       = core.WithQuietRenewals
+	WithLogSampling         = core.WithLogSampling
+	WithDeterministic       = core.WithDeterministic
+	WithMaxH32Age           = core.WithMaxH32Age
+	WithDuplicateGuard      = core.WithDuplicateGuard
+	WithDuplicateCallback   = core.WithDuplicateCallback
+	WithChecksum            = core.WithChecksum
+	WithSigningKey          = core.WithSigningKey
+	WithResumePreviousBlock = core.WithResumePreviousBlock
+	WithFaultInjector       = core.WithFaultInjector
+	WithTransform           = core.WithTransform
+	WithRateLimit           = core.WithRateLimit
+	WithReadyTimeout        = core.WithReadyTimeout
+	WithMirror              = core.WithMirror
+	WithInstanceFingerprint = core.WithInstanceFingerprint
+	WithRenewExecutor       = core.WithRenewExecutor
+	WithSynchronousRenew    = core.WithSynchronousRenew
+	WithRenewCheckInterval  = core.WithRenewCheckInterval
+	WithRenewTimeout        = core.WithRenewTimeout
+	WithRandomSkip          = core.WithRandomSkip
+	WithShards              = core.WithShards
+	WithSection             = core.WithSection
+	TryWithSection          = core.TryWithSection
+	WithSectionID           = core.WithSectionID
+	SectionOf               = core.SectionOf
+	WithUint64              = core.WithUint64
+	WithStep                = core.WithStep
+	TryWithStep             = core.TryWithStep
+	WithObfuscation         = core.WithObfuscation
+	TryWithObfuscation      = core.TryWithObfuscation
+	WithPermutation         = core.WithPermutation
+	TryWithPermutation      = core.TryWithPermutation
+	Validate                = core.Validate
+	WithTracer              = core.WithTracer
+)
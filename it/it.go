@@ -0,0 +1,89 @@
+// Package it runs the conformance suite of wuidtest against real data sources started in
+// Docker by testcontainers-go, so that every adapter proves the uniqueness of its identifiers
+// across renewals and its recovery from failures with a single command:
+//
+//	cd it && go test ./...
+//
+// The tests are skipped where Docker is not available. A backend written by a user can be
+// checked the same way by starting its server with testcontainers-go and passing a
+// wuidtest.Target to wuidtest.Conformance.
+package it
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// ErrInjected is returned by Fault.Err while the fault is on.
+var ErrInjected = errors.New("the data source is broken by the test")
+
+// Fault breaks the client factories of a target while it is on, which fails the renewals
+// without stopping the container, whose mapped port would change after a restart. Its Break
+// and Heal methods can be used as wuidtest.Target.Break and wuidtest.Target.Heal.
+type Fault struct {
+	on int32
+}
+
+// Break turns the fault on.
+func (f *Fault) Break(testing.TB) {
+	atomic.StoreInt32(&f.on, 1)
+}
+
+// Heal turns the fault off.
+func (f *Fault) Heal(testing.TB) {
+	atomic.StoreInt32(&f.on, 0)
+}
+
+// Err returns ErrInjected while the fault is on. The client factories should return it before
+// connecting.
+func (f *Fault) Err() error {
+	if atomic.LoadInt32(&f.on) != 0 {
+		return ErrInjected
+	}
+	return nil
+}
+
+// StartRedis starts a Redis server for t and returns its address, e.g. localhost:32768. The
+// container is removed when t ends. t is skipped if Docker is not available.
+func StartRedis(t *testing.T) string {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+	c, err := tcredis.Run(ctx, "redis:7-alpine")
+	if c != nil {
+		t.Cleanup(func() { _ = c.Terminate(context.Background()) })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := c.ConnectionString(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(uri, "redis://")
+}
+
+// StartMongo starts a MongoDB server for t and returns its URI. The container is removed when t
+// ends. t is skipped if Docker is not available.
+func StartMongo(t *testing.T) string {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+	c, err := mongodb.Run(ctx, "mongo:7")
+	if c != nil {
+		t.Cleanup(func() { _ = c.Terminate(context.Background()) })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := c.ConnectionString(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uri
+}
@@ -0,0 +1,91 @@
+package it
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mongoWUID "github.com/driftboat/wuid/mongo/wuid"
+	redisv8WUID "github.com/driftboat/wuid/redis/v8/wuid"
+	redisWUID "github.com/driftboat/wuid/redis/wuid"
+	"github.com/driftboat/wuid/wuidtest"
+	"github.com/edwingeng/slog"
+	"github.com/go-redis/redis"
+	redisv8 "github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestRedis(t *testing.T) {
+	addr := StartRedis(t)
+	var f Fault
+	newClient := func() (redis.UniversalClient, bool, error) {
+		if err := f.Err(); err != nil {
+			return nil, false, err
+		}
+		return redis.NewClient(&redis.Options{Addr: addr}), true, nil
+	}
+	wuidtest.Conformance(t, wuidtest.Target{
+		New: func(t testing.TB) wuidtest.Instance {
+			w := redisWUID.NewWUID("alpha", slog.NewDumbLogger())
+			if err := w.Loadh32FromRedis(newClient, "wuid"); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(w.Stop)
+			return w
+		},
+		Break: f.Break,
+		Heal:  f.Heal,
+	})
+}
+
+func TestRedisV8(t *testing.T) {
+	addr := StartRedis(t)
+	var f Fault
+	newClient := func() (redisv8.UniversalClient, bool, error) {
+		if err := f.Err(); err != nil {
+			return nil, false, err
+		}
+		return redisv8.NewClient(&redisv8.Options{Addr: addr}), true, nil
+	}
+	wuidtest.Conformance(t, wuidtest.Target{
+		New: func(t testing.TB) wuidtest.Instance {
+			w := redisv8WUID.NewWUID("alpha", slog.NewDumbLogger())
+			if err := w.Loadh32FromRedis(newClient, "wuid"); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(w.Stop)
+			return w
+		},
+		Break: f.Break,
+		Heal:  f.Heal,
+	})
+}
+
+func TestMongo(t *testing.T) {
+	uri := StartMongo(t)
+	var f Fault
+	connect := mongoWUID.NewClientFromURI(uri, time.Second*5)
+	b := mongoWUID.Backend{
+		NewClient: func(ctx context.Context) (*mongo.Client, bool, error) {
+			if err := f.Err(); err != nil {
+				return nil, false, err
+			}
+			return connect(ctx)
+		},
+		Database:   "test",
+		Collection: "wuid",
+		DocID:      "alpha",
+	}
+	wuidtest.Conformance(t, wuidtest.Target{
+		New: func(t testing.TB) wuidtest.Instance {
+			w := mongoWUID.NewWUID("alpha", slog.NewDumbLogger())
+			if err := w.LoadHighBits(b); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(w.Stop)
+			return w
+		},
+		Break: f.Break,
+		Heal:  f.Heal,
+	})
+}
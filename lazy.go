@@ -0,0 +1,102 @@
+package wuid
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var errLoaderPanicked = errors.New("wuid: the loader of the lazy generator panicked")
+
+// LazyWUID is a generator initialized by its loader on first use. See Lazy.
+type LazyWUID struct {
+	loader func() (WUID, error)
+	w      atomic.Value // holder
+
+	mu   sync.Mutex
+	call *lazyCall
+}
+
+type lazyCall struct {
+	done chan struct{}
+	w    WUID
+	err  error
+}
+
+// Lazy returns a generator that calls loader on the first call to Next rather than right away,
+// e.g. for the CLI tools and the functions-as-a-service that should not connect to the data
+// source before an identifier is actually needed. Concurrent callers share a single call to
+// loader. If loader fails, the callers waiting for it get the same error, and the next call
+// tries again.
+func Lazy(loader func() (WUID, error)) *LazyWUID {
+	if loader == nil {
+		panic("loader cannot be nil")
+	}
+	return &LazyWUID{loader: loader}
+}
+
+// Get returns the generator made by the loader, calling the loader if it has not succeeded
+// yet.
+func (l *LazyWUID) Get() (WUID, error) {
+	if h, ok := l.w.Load().(holder); ok {
+		return h.w, nil
+	}
+
+	l.mu.Lock()
+	if h, ok := l.w.Load().(holder); ok {
+		l.mu.Unlock()
+		return h.w, nil
+	}
+	if c := l.call; c != nil {
+		l.mu.Unlock()
+		<-c.done
+		return c.w, c.err
+	}
+	c := &lazyCall{done: make(chan struct{})}
+	l.call = c
+	l.mu.Unlock()
+
+	l.load(c)
+	return c.w, c.err
+}
+
+func (l *LazyWUID) load(c *lazyCall) {
+	defer func() {
+		l.mu.Lock()
+		if c.err == nil {
+			l.w.Store(holder{w: c.w})
+		}
+		l.call = nil
+		l.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = errLoaderPanicked
+	c.w, c.err = l.loader()
+	if c.err == nil && c.w == nil {
+		c.err = errors.New("wuid: the loader returned a nil generator")
+	}
+}
+
+// Next returns a unique identifier, initializing the generator first if needed. It panics
+// with the error of the loader if the initialization fails.
+func (l *LazyWUID) Next() int64 {
+	w, err := l.Get()
+	if err != nil {
+		panic(err)
+	}
+	return w.Next()
+}
+
+// NextOrErr is like Next but returns the error of the loader instead of panicking. If the
+// generator has a NextOrErr method, e.g. any adapter's WUID, its errors are returned as well.
+func (l *LazyWUID) NextOrErr() (int64, error) {
+	w, err := l.Get()
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := w.(interface{ NextOrErr() (int64, error) }); ok {
+		return n.NextOrErr()
+	}
+	return w.Next(), nil
+}
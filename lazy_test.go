@@ -0,0 +1,75 @@
+package wuid
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestLazy(t *testing.T) {
+	var numCalls int32
+	l := Lazy(func() (WUID, error) {
+		atomic.AddInt32(&numCalls, 1)
+		time.Sleep(time.Millisecond * 20)
+		return wuidtest.NewDeterministicWUID(42), nil
+	})
+	if atomic.LoadInt32(&numCalls) != 0 {
+		t.Fatal("Lazy should not call the loader right away")
+	}
+
+	wuidtest.Run(t, l, wuidtest.Config{Goroutines: 8, PerGoroutine: 1000})
+	if n := atomic.LoadInt32(&numCalls); n != 1 {
+		t.Fatalf("the loader is called %d times, while it should be called once", n)
+	}
+	if _, err := l.NextOrErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLazy_Error(t *testing.T) {
+	errLoad := errors.New("boom")
+	var numCalls int32
+	l := Lazy(func() (WUID, error) {
+		if atomic.AddInt32(&numCalls, 1) == 1 {
+			time.Sleep(time.Millisecond * 20)
+			return nil, errLoad
+		}
+		return wuidtest.NewDeterministicWUID(42), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.NextOrErr(); !errors.Is(err, errLoad) {
+				t.Errorf("err is %v, while it should be errLoad", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&numCalls); n != 1 {
+		t.Fatalf("the loader is called %d times, while it should be called once", n)
+	}
+
+	if _, err := l.NextOrErr(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&numCalls); n != 2 {
+		t.Fatalf("the loader is called %d times, while it should be called twice", n)
+	}
+
+	l = Lazy(func() (WUID, error) {
+		return nil, nil
+	})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Next should have panicked")
+		}
+	}()
+	l.Next()
+}
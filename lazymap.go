@@ -0,0 +1,99 @@
+package wuid
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lazyMap caches a generator for each key, which is created by the create function on first
+// use. The creation, typically a load from the data source, runs outside the lock, and the
+// concurrent callers asking for the same key share a single call, so that a slow load only
+// holds up the callers of its own key.
+type lazyMap struct {
+	create func(key string) (WUID, error)
+
+	mu    sync.RWMutex
+	m     map[string]*lazyEntry
+	calls map[string]*lazyCall
+}
+
+type lazyEntry struct {
+	w        WUID
+	lastUsed int64
+}
+
+func newLazyMap(create func(key string) (WUID, error)) *lazyMap {
+	return &lazyMap{
+		create: create,
+		m:      make(map[string]*lazyEntry),
+		calls:  make(map[string]*lazyCall),
+	}
+}
+
+// get returns the generator of key, creating it if necessary. A failed creation is not
+// cached, so the next call tries again.
+func (lm *lazyMap) get(key string) (WUID, error) {
+	now := time.Now().UnixNano()
+	lm.mu.RLock()
+	e, ok := lm.m[key]
+	lm.mu.RUnlock()
+	if ok {
+		atomic.StoreInt64(&e.lastUsed, now)
+		return e.w, nil
+	}
+
+	lm.mu.Lock()
+	if e, ok := lm.m[key]; ok {
+		lm.mu.Unlock()
+		atomic.StoreInt64(&e.lastUsed, now)
+		return e.w, nil
+	}
+	if c, ok := lm.calls[key]; ok {
+		lm.mu.Unlock()
+		<-c.done
+		return c.w, c.err
+	}
+	c := &lazyCall{done: make(chan struct{})}
+	lm.calls[key] = c
+	lm.mu.Unlock()
+
+	lm.load(key, c)
+	return c.w, c.err
+}
+
+func (lm *lazyMap) load(key string, c *lazyCall) {
+	defer func() {
+		lm.mu.Lock()
+		if c.err == nil {
+			lm.m[key] = &lazyEntry{w: c.w, lastUsed: time.Now().UnixNano()}
+		}
+		delete(lm.calls, key)
+		lm.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = errLoaderPanicked
+	c.w, c.err = lm.create(key)
+}
+
+// len returns the number of the generators created.
+func (lm *lazyMap) len() int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return len(lm.m)
+}
+
+// evict removes and returns the generators not used since deadline, in Unix nanoseconds. A
+// creation in progress is left alone.
+func (lm *lazyMap) evict(deadline int64) (evicted []WUID) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for key, e := range lm.m {
+		if atomic.LoadInt64(&e.lastUsed) < deadline {
+			delete(lm.m, key)
+			evicted = append(evicted, e.w)
+		}
+	}
+	return evicted
+}
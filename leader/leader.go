@@ -0,0 +1,256 @@
+// Package leader lets one elected instance of a fleet, e.g. the replicas of a StatefulSet,
+// allocate the h32 of all the others from the backend. The followers ask the leader over HTTP,
+// so that a fleet restarting at once costs the backend a cheap lookup of the leader per
+// replica rather than a storm of increments on a hot key. The leader is elected through the
+// backend itself with a Lease, e.g. the one of the redis/v8 package. The uniqueness still comes
+// from the counter in the backend, so two instances believing they lead, or a follower falling
+// back to the backend when the leader is unreachable, never produce duplicates.
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Lease is a lock with an expiry held in the backend, which elects the leader.
+type Lease interface {
+	// Acquire takes the lease for holder if nobody holds it, or extends it by ttl if holder
+	// does already. It returns the current holder, which is holder itself on success.
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (string, error)
+	// Release gives up the lease if holder holds it.
+	Release(ctx context.Context, holder string) error
+}
+
+// DefaultTTL is the term of the leader unless WithTTL is used.
+const DefaultTTL = 15 * time.Second
+
+// Option configures an Election.
+type Option func(e *Election)
+
+// WithTTL sets the term of the leader, which is extended while it keeps allocating. The
+// followers check the leader again after half of it.
+func WithTTL(ttl time.Duration) Option {
+	if ttl <= 0 {
+		panic("ttl must be positive")
+	}
+	return func(e *Election) {
+		e.ttl = ttl
+	}
+}
+
+// WithHTTPClient sets the client the followers ask the leader with. It is http.DefaultClient
+// by default.
+func WithHTTPClient(c *http.Client) Option {
+	if c == nil {
+		panic("c cannot be nil")
+	}
+	return func(e *Election) {
+		e.client = c
+	}
+}
+
+// Stats is the number of the allocations made by an Election.
+type Stats struct {
+	// NumLocal is the number of the h32 allocated from the backend while leading.
+	NumLocal int64
+	// NumServed is the number of the h32 allocated for the followers.
+	NumServed int64
+	// NumForwarded is the number of the h32 received from the leader.
+	NumForwarded int64
+	// NumFallbacks is the number of the h32 allocated from the backend by a follower, because
+	// the leader could not be found or reached.
+	NumFallbacks int64
+}
+
+// Election takes part in the election of the leader of a fleet on behalf of an instance, and
+// allocates the h32 of its generators accordingly. Serve it over HTTP at addr, e.g. with
+// http.Handle, so that it can serve the followers once elected.
+type Election struct {
+	lease  Lease
+	addr   string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	holder    string
+	checkedAt time.Time
+	directs   map[string]func(ctx context.Context) (int64, error)
+	stats     Stats
+}
+
+// NewElection creates an Election. addr is the URL the other instances reach this one at,
+// e.g. http://wuid-0.wuid:8080/wuid/leader, which is also its name in the lease.
+func NewElection(lease Lease, addr string, opts ...Option) *Election {
+	if lease == nil {
+		panic("lease cannot be nil")
+	}
+	if _, err := url.ParseRequestURI(addr); err != nil {
+		panic(fmt.Errorf("invalid addr: %w", err))
+	}
+	e := &Election{
+		lease:   lease,
+		addr:    addr,
+		ttl:     DefaultTTL,
+		client:  http.DefaultClient,
+		directs: make(map[string]func(ctx context.Context) (int64, error)),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Allocate returns an h32 for key. The leader allocates it from the backend with direct, and
+// a follower asks the leader for it. direct is also used by the leader to serve the followers,
+// and by a follower when the leader cannot be found or reached. The adapters call it for the
+// generators whose Backend sets the Election.
+func (e *Election) Allocate(ctx context.Context, key string, direct func(ctx context.Context) (int64, error)) (int64, error) {
+	e.mu.Lock()
+	e.directs[key] = direct
+	e.mu.Unlock()
+
+	holder, err := e.leader(ctx)
+	switch {
+	case err == nil && holder == e.addr:
+		e.count(&e.stats.NumLocal)
+		return direct(ctx)
+	case err == nil && holder != "":
+		h32, err := e.ask(ctx, holder, key)
+		if err == nil {
+			e.count(&e.stats.NumForwarded)
+			return h32, nil
+		}
+		e.forget()
+	}
+	e.count(&e.stats.NumFallbacks)
+	return direct(ctx)
+}
+
+// leader returns the current holder of the lease, trying to take it if nobody holds it. The
+// answer is cached for half of the TTL.
+func (e *Election) leader(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	if e.holder != "" && time.Since(e.checkedAt) < e.ttl/2 {
+		holder := e.holder
+		e.mu.Unlock()
+		return holder, nil
+	}
+	e.mu.Unlock()
+
+	holder, err := e.lease.Acquire(ctx, e.addr, e.ttl)
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	e.holder, e.checkedAt = holder, time.Now()
+	e.mu.Unlock()
+	return holder, nil
+}
+
+// forget drops the cached leader, so that the next allocation checks the lease again.
+func (e *Election) forget() {
+	e.mu.Lock()
+	e.holder = ""
+	e.mu.Unlock()
+}
+
+func (e *Election) count(p *int64) {
+	e.mu.Lock()
+	*p++
+	e.mu.Unlock()
+}
+
+type response struct {
+	H32 int64 `json:"h32"`
+}
+
+// ask asks the leader at holder for an h32 of key.
+func (e *Election) ask(ctx context.Context, holder, key string) (int64, error) {
+	u, err := url.Parse(holder)
+	if err != nil {
+		return 0, err
+	}
+	q := u.Query()
+	q.Set("key", key)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("the leader %s refused to allocate: %s %s", holder, resp.Status, msg)
+	}
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return 0, err
+	}
+	if r.H32 <= 0 {
+		return 0, errors.New("the leader returned an invalid h32")
+	}
+	return r.H32, nil
+}
+
+// ServeHTTP allocates an h32 for a follower while e leads. It answers 503 Service Unavailable
+// if e does not lead, and 404 Not Found for a key none of the generators of e loads, in which
+// case the follower falls back to the backend.
+func (e *Election) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	e.mu.Lock()
+	direct := e.directs[key]
+	e.mu.Unlock()
+	if direct == nil {
+		http.Error(w, "unknown key", http.StatusNotFound)
+		return
+	}
+	if holder, err := e.leader(r.Context()); err != nil || holder != e.addr {
+		http.Error(w, "not the leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	h32, err := direct(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	e.count(&e.stats.NumServed)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response{H32: h32})
+}
+
+// IsLeader reports whether e led when the lease was last checked.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.holder == e.addr
+}
+
+// Stats returns the number of the allocations made so far.
+func (e *Election) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// Resign gives up the lease if e holds it, e.g. before a graceful shutdown, so that another
+// instance takes over without waiting for the TTL to expire.
+func (e *Election) Resign(ctx context.Context) error {
+	e.forget()
+	return e.lease.Release(ctx, e.addr)
+}
@@ -0,0 +1,112 @@
+package leader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memLease struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+func (l *memLease) Acquire(_ context.Context, holder string, ttl time.Duration) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == "" || l.holder == holder || time.Now().After(l.expires) {
+		l.holder, l.expires = holder, time.Now().Add(ttl)
+	}
+	return l.holder, nil
+}
+
+func (l *memLease) Release(_ context.Context, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+func TestElection(t *testing.T) {
+	var counter int64
+	var numDirect [2]int64
+	direct := func(i int) func(context.Context) (int64, error) {
+		return func(context.Context) (int64, error) {
+			atomic.AddInt64(&numDirect[i], 1)
+			return atomic.AddInt64(&counter, 1), nil
+		}
+	}
+
+	lease := &memLease{}
+	var elections [2]*Election
+	var servers [2]*httptest.Server
+	for i := range elections {
+		mux := &lazyHandler{}
+		servers[i] = httptest.NewServer(mux)
+		defer servers[i].Close()
+		elections[i] = NewElection(lease, servers[i].URL+"/leader", WithTTL(time.Minute))
+		mux.e = elections[i]
+	}
+
+	ctx := context.Background()
+	if h32, err := elections[0].Allocate(ctx, "alpha", direct(0)); err != nil || h32 != 1 {
+		t.Fatalf("the leader should allocate from the backend. h32: %d, err: %v", h32, err)
+	}
+	if !elections[0].IsLeader() {
+		t.Fatal("the first instance should lead")
+	}
+	for i := 0; i < 3; i++ {
+		if h32, err := elections[1].Allocate(ctx, "alpha", direct(1)); err != nil || h32 != int64(i+2) {
+			t.Fatalf("the follower should get h32 from the leader. h32: %d, err: %v", h32, err)
+		}
+	}
+	if numDirect[1] != 0 || numDirect[0] != 4 {
+		t.Fatalf("only the leader should touch the backend. numDirect: %v", numDirect)
+	}
+	if s := elections[1].Stats(); s.NumForwarded != 3 || s.NumFallbacks != 0 {
+		t.Fatalf("unexpected stats of the follower: %+v", s)
+	}
+	if s := elections[0].Stats(); s.NumLocal != 1 || s.NumServed != 3 {
+		t.Fatalf("unexpected stats of the leader: %+v", s)
+	}
+
+	// An unknown key falls back to the backend.
+	if _, err := elections[1].Allocate(ctx, "beta", direct(1)); err != nil || numDirect[1] != 1 {
+		t.Fatalf("the follower should have fallen back to the backend. err: %v", err)
+	}
+
+	// An unreachable leader falls back to the backend, and the follower takes over once the
+	// leader resigns.
+	servers[0].Close()
+	if _, err := elections[1].Allocate(ctx, "alpha", direct(1)); err != nil {
+		t.Fatal(err)
+	}
+	if s := elections[1].Stats(); s.NumFallbacks != 2 {
+		t.Fatalf("the follower should have fallen back to the backend. stats: %+v", s)
+	}
+	if err := elections[0].Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := elections[1].Allocate(ctx, "alpha", direct(1)); err != nil {
+		t.Fatal(err)
+	}
+	if !elections[1].IsLeader() || elections[1].Stats().NumLocal != 1 {
+		t.Fatalf("the second instance should lead. stats: %+v", elections[1].Stats())
+	}
+}
+
+// lazyHandler lets the server start before the Election, which needs its URL.
+type lazyHandler struct {
+	e *Election
+}
+
+func (h *lazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.e.ServeHTTP(w, r)
+}
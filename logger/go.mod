@@ -0,0 +1,22 @@
+module github.com/driftboat/wuid/logger
+
+go 1.18
+
+require (
+	github.com/driftboat/wuid v1.5.0
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247
+	github.com/rs/zerolog v1.28.0
+	github.com/sirupsen/logrus v1.9.0
+	go.uber.org/zap v1.23.0
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.12 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/stretchr/testify v1.8.1 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+)
+
+replace github.com/driftboat/wuid => ..
@@ -0,0 +1,7 @@
+// Package logger adapts popular logging libraries to the Logger interface accepted by NewWUID.
+//
+// A slog.Logger from github.com/edwingeng/slog, a *zap.SugaredLogger, a *logrus.Logger and a
+// *logrus.Entry can be passed to NewWUID as they are and need no adapter. A *slog.Logger of the
+// standard library has no Infof and Warnf, so it must be wrapped with FromSlog, which requires
+// Go 1.21, and so must a *zap.Logger and a zerolog.Logger with FromZap and FromZerolog.
+package logger
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+	"github.com/rs/zerolog"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+)
+
+var (
+	_ internal.Logger = slog.NewDumbLogger()
+	_ internal.Logger = logrus.New()
+	_ internal.Logger = logrus.NewEntry(logrus.New())
+	_ internal.Logger = FromZap(zap.NewNop())
+	_ internal.Logger = FromLogrus(nil)
+	_ internal.Logger = FromZerolog(zerolog.Nop())
+)
+
+func TestFromZerolog(t *testing.T) {
+	var buf bytes.Buffer
+	w := internal.NewWUID("alpha", FromZerolog(zerolog.New(&buf)))
+	w.Infof("<wuid> new h32: %d. name: %s", 1, w.Name)
+	w.Warnf("<wuid> renew failed. name: %s", w.Name)
+	out := buf.String()
+	if !strings.Contains(out, `"level":"info","message":"<wuid> new h32: 1. name: alpha"`) {
+		t.Fatal(out)
+	}
+	if !strings.Contains(out, `"level":"warn","message":"<wuid> renew failed. name: alpha"`) {
+		t.Fatal(out)
+	}
+}
+
+func TestFromLogrus(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	w := internal.NewWUID("alpha", FromLogrus(l.WithField("service", "beta")))
+	w.Warnf("<wuid> renew failed. name: %s", w.Name)
+	if out := buf.String(); !strings.Contains(out, `level=warning msg="<wuid> renew failed. name: alpha" service=beta`) {
+		t.Fatal(out)
+	}
+}
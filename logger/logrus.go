@@ -0,0 +1,15 @@
+package logger
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// FromLogrus adapts a logrus logger, e.g. a *logrus.Entry carrying the fields of a service. A
+// *logrus.Logger and a *logrus.Entry satisfy the Logger interface as they are, so FromLogrus
+// only picks logrus.StandardLogger() for a nil l.
+func FromLogrus(l logrus.FieldLogger) logrus.FieldLogger {
+	if l == nil {
+		return logrus.StandardLogger()
+	}
+	return l
+}
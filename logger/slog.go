@@ -0,0 +1,38 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Slog adapts a *slog.Logger from the standard library.
+type Slog struct {
+	l *slog.Logger
+}
+
+// FromSlog adapts a *slog.Logger from the standard library. A nil l means slog.Default().
+func FromSlog(l *slog.Logger) *Slog {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Slog{l: l}
+}
+
+func (s *Slog) Infof(format string, args ...interface{}) {
+	s.log(slog.LevelInfo, format, args...)
+}
+
+func (s *Slog) Warnf(format string, args ...interface{}) {
+	s.log(slog.LevelWarn, format, args...)
+}
+
+func (s *Slog) log(level slog.Level, format string, args ...interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,31 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+var (
+	_ internal.Logger = FromSlog(nil)
+)
+
+func TestFromSlog(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	w := internal.NewWUID("alpha", FromSlog(l))
+	w.Infof("<wuid> new h32: %d. name: %s", 1, w.Name)
+	w.Warnf("<wuid> renew failed. name: %s", w.Name)
+	out := buf.String()
+	if strings.Contains(out, "new h32") {
+		t.Fatal(`strings.Contains(out, "new h32")`)
+	}
+	if !strings.Contains(out, `level=WARN msg="<wuid> renew failed. name: alpha"`) {
+		t.Fatal(out)
+	}
+}
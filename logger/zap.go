@@ -0,0 +1,10 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+)
+
+// FromZap adapts a *zap.Logger.
+func FromZap(l *zap.Logger) *zap.SugaredLogger {
+	return l.Sugar()
+}
@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Zerolog adapts a zerolog.Logger.
+type Zerolog struct {
+	l zerolog.Logger
+}
+
+// FromZerolog adapts a zerolog.Logger.
+func FromZerolog(l zerolog.Logger) *Zerolog {
+	return &Zerolog{l: l}
+}
+
+func (z *Zerolog) Infof(format string, args ...interface{}) {
+	z.l.Info().Msgf(format, args...)
+}
+
+func (z *Zerolog) Warnf(format string, args ...interface{}) {
+	z.l.Warn().Msgf(format, args...)
+}
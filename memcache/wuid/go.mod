@@ -0,0 +1,19 @@
+module github.com/driftboat/wuid/memcache/wuid
+
+go 1.18
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
+	github.com/driftboat/wuid v1.5.0
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247
+	go.opentelemetry.io/otel/trace v1.11.2
+)
+
+require (
+	go.opentelemetry.io/otel v1.11.2 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+)
+
+replace github.com/driftboat/wuid => ../..
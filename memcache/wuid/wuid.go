@@ -0,0 +1,124 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/driftboat/wuid/internal"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+
+	warnOnce sync.Once
+}
+
+type NewClient func() (client *memcache.Client, autoClose bool, err error)
+
+// Backend describes the number in memcached to load the high bits from. See LoadHighBits
+// for the meaning of Floor.
+type Backend struct {
+	NewClient NewClient
+	Key       string
+	Floor     int64
+}
+
+// LoadHighBits adds 1 to the number at b.Key in memcached and fetches its new value. The new
+// value is used as the high bits of all generated numbers. In addition, b is saved for
+// future renewal.
+//
+// Memcached is not a durable store. The key can be evicted or lost when the server restarts,
+// and then the counter starts over. LoadHighBits therefore works in a warning mode: it
+// refuses to run unless b.Floor is positive or an h32 verifier is installed with
+// Withh32Verifier, and it logs a warning on the first load. When the key is missing, the
+// counter is seeded with b.Floor before being incremented. The loads are bound to ctx, which
+// carries the timeout set by WithRenewTimeout, even though the client takes no context.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromMemcache(ctx, b.NewClient, b.Key, b.Floor)
+}
+
+// Loadh32FromMemcache is the same as LoadHighBits(Backend{NewClient: newClient, Key: key, Floor: floor}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32FromMemcache(newClient NewClient, key string, floor int64) error {
+	return w.LoadHighBits(Backend{NewClient: newClient, Key: key, Floor: floor})
+}
+
+// loadh32FromMemcache implements LoadHighBitsContext.
+func (w *WUID) loadh32FromMemcache(ctx context.Context, newClient NewClient, key string, floor int64) error {
+	if len(key) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	if floor < 0 {
+		return errors.New("floor cannot be negative")
+	}
+	if floor == 0 && !w.w.HasVerifier() {
+		return errors.New("memcached is not durable, either a floor or an h32 verifier is required")
+	}
+	if err := w.w.Interlock("memcache", key); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (int64, error) {
+		return w.fetchh32FromMemcache(ctx, newClient, key, floor)
+	}))
+}
+
+// fetchh32FromMemcache adds 1 to the number at key and returns its new value.
+func (w *WUID) fetchh32FromMemcache(ctx context.Context, newClient NewClient, key string, floor int64) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("memcache", key)
+	defer func() {
+		span.End(err)
+	}()
+
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	w.warnOnce.Do(func() {
+		w.w.Logger.Warnf("<wuid> memcached is not durable, h32 may be reused if the key is lost. name: %s, key: %s", w.w.Name, key)
+	})
+	var v uint64
+	err = w.w.CallWithContext(ctx, func() (err error) {
+		v, err = client.Increment(key, 1)
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			seed := &memcache.Item{Key: key, Value: []byte(strconv.FormatInt(floor, 10))}
+			if err = client.Add(seed); err != nil && !errors.Is(err, memcache.ErrNotStored) {
+				return err
+			}
+			v, err = client.Increment(key, 1)
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(v), nil
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
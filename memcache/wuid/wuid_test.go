@@ -0,0 +1,175 @@
+package wuid
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+var (
+	cfg struct {
+		addr  string
+		key   string
+		floor int64
+	}
+)
+
+func init() {
+	cfg.addr = "127.0.0.1:11211"
+	cfg.key = "wuid"
+	cfg.floor = 1000
+}
+
+func connect() *memcache.Client {
+	return memcache.New(cfg.addr)
+}
+
+func TestWUID_Loadh32FromMemcache(t *testing.T) {
+	newClient := func() (*memcache.Client, bool, error) {
+		return connect(), true, nil
+	}
+	w := NewWUID("alpha", dumb)
+	err := w.Loadh32FromMemcache(newClient, cfg.key, cfg.floor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	if initial>>32 <= cfg.floor {
+		t.Fatalf("h32 should be greater than the floor. h32: %d", initial>>32)
+	}
+	for i := 1; i < 100; i++ {
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+}
+
+func TestWUID_Loadh32FromMemcache_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32FromMemcache(nil, "", cfg.floor) == nil {
+		t.Fatal("key is not properly checked")
+	}
+	if w.Loadh32FromMemcache(nil, "beta", -1) == nil {
+		t.Fatal("floor is not properly checked")
+	}
+	if w.Loadh32FromMemcache(nil, "beta", 0) == nil {
+		t.Fatal("the durability warning mode is not properly enforced")
+	}
+
+	newErrorClient := func() (*memcache.Client, bool, error) {
+		return nil, true, errors.New("beta")
+	}
+	if w.Loadh32FromMemcache(newErrorClient, "beta", cfg.floor) == nil {
+		t.Fatal(`w.Loadh32FromMemcache(newErrorClient, "beta", cfg.floor) == nil`)
+	}
+
+	w2 := NewWUID("alpha", dumb, Withh32Verifier(func(h32 int64) error {
+		return nil
+	}))
+	if w2.Loadh32FromMemcache(newErrorClient, "beta", 0) == nil {
+		t.Fatal(`w2.Loadh32FromMemcache(newErrorClient, "beta", 0) == nil`)
+	}
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestWUID_Next_Renew(t *testing.T) {
+	client := connect()
+	newClient := func() (*memcache.Client, bool, error) {
+		return client, false, nil
+	}
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	err := w.Loadh32FromMemcache(newClient, cfg.key, cfg.floor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h32 := atomic.LoadInt64(&w.w.N) >> 32
+	atomic.StoreInt64(&w.w.N, (h32<<32)|internal.Bye)
+	n1a := w.Next()
+	if n1a>>32 != h32 {
+		t.Fatal(`n1a>>32 != h32`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != (h32+1)<<32+1 {
+		t.Fatal(`n1b != (h32+1)<<32+1`)
+	}
+
+	atomic.StoreInt64(&w.w.N, ((h32+1)<<32)|internal.Bye)
+	n2a := w.Next()
+	if n2a>>32 != h32+1 {
+		t.Fatal(`n2a>>32 != h32+1`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 2)
+	n2b := w.Next()
+	if n2b != (h32+2)<<32+1 {
+		t.Fatal(`n2b != (h32+2)<<32+1`)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelWarn && strings.Contains(msg, "not durable") {
+			num++
+		}
+		return true
+	})
+	if num != 1 {
+		t.Fatal(`num != 1`)
+	}
+}
+
+func Example() {
+	newClient := func() (*memcache.Client, bool, error) {
+		var client *memcache.Client
+		// ...
+		return client, true, nil
+	}
+
+	// Setup
+	w := NewWUID("alpha", nil)
+	err := w.LoadHighBits(Backend{NewClient: newClient, Key: "wuid", Floor: 1000})
+	if err != nil {
+		panic(err)
+	}
+
+	// Generate
+	for i := 0; i < 10; i++ {
+		fmt.Printf("%#016x\n", w.Next())
+	}
+}
@@ -0,0 +1,116 @@
+// Package mirror provides the secondary stores of h32 to be passed to WithMirror. A mirror
+// keeps the greatest h32 allocated by the generators sharing it, so that the primary data
+// source can be recovered from a safe value after a disaster.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// File saves h32 in a local file. The file is replaced atomically on every update.
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFile creates a File mirror saving h32 at path.
+func NewFile(path string) *File {
+	if path == "" {
+		panic("path cannot be empty")
+	}
+	return &File{path: path}
+}
+
+// Store saves h32 unless the file holds a greater value.
+func (f *File) Store(ctx context.Context, h32 int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, err := f.load()
+	switch {
+	case err == nil:
+		if h32 <= current {
+			return nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.WriteString(strconv.FormatInt(h32, 10)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Load returns the h32 saved in the file.
+func (f *File) Load(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.load()
+}
+
+func (f *File) load() (int64, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+var storeMax = redis.NewScript(`
+local v = tonumber(redis.call('GET', KEYS[1]) or '0')
+if v < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// Redis saves h32 in a Redis key, which should not be on the same Redis as the primary one.
+type Redis struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedis creates a Redis mirror saving h32 at key.
+func NewRedis(client redis.UniversalClient, key string) *Redis {
+	if client == nil {
+		panic("client cannot be nil")
+	}
+	if key == "" {
+		panic("key cannot be empty")
+	}
+	return &Redis{client: client, key: key}
+}
+
+// Store saves h32 unless the key holds a greater value.
+func (r *Redis) Store(ctx context.Context, h32 int64) error {
+	return storeMax.Run(ctx, r.client, []string{r.key}, h32).Err()
+}
+
+// Load returns the h32 saved in the key.
+func (r *Redis) Load(ctx context.Context) (int64, error) {
+	return r.client.Get(ctx, r.key).Int64()
+}
@@ -0,0 +1,68 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type mirror interface {
+	Store(ctx context.Context, h32 int64) error
+	Load(ctx context.Context) (int64, error)
+}
+
+func testMirror(t *testing.T, m mirror) {
+	t.Helper()
+	ctx := context.Background()
+	for _, c := range []struct {
+		store int64
+		want  int64
+	}{
+		{10, 10},
+		{12, 12},
+		{11, 12},
+		{13, 13},
+	} {
+		if err := m.Store(ctx, c.store); err != nil {
+			t.Fatal(err)
+		}
+		h32, err := m.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h32 != c.want {
+			t.Fatalf("h32 is %d, while it should be %d", h32, c.want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wuid.h32")
+	f := NewFile(path)
+	if _, err := f.Load(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err is %v, while it should be os.ErrNotExist", err)
+	}
+	testMirror(t, f)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d files are left, while it should be 1", len(entries))
+	}
+}
+
+func TestRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	defer client.Close()
+	const key = "v8:wuid:mirror"
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	testMirror(t, NewRedis(client, key))
+}
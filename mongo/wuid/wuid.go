@@ -0,0 +1,188 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/driftboat/wuid/credentials"
+	"github.com/driftboat/wuid/internal"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+}
+
+// NewClient returns the client to load the high bits with. If autoClose is true, the client
+// is disconnected once the load is done.
+type NewClient func(ctx context.Context) (client *mongo.Client, autoClose bool, err error)
+
+// NewClientFromURI returns a NewClient connecting to uri on every load and disconnecting
+// afterwards. serverSelectionTimeout bounds how long the driver waits for a suitable server,
+// and zero means the default of the driver.
+func NewClientFromURI(uri string, serverSelectionTimeout time.Duration) NewClient {
+	return func(ctx context.Context) (*mongo.Client, bool, error) {
+		opts := options.Client().ApplyURI(uri)
+		if serverSelectionTimeout > 0 {
+			opts.SetServerSelectionTimeout(serverSelectionTimeout)
+		}
+		client, err := mongo.Connect(opts)
+		if err != nil {
+			return nil, false, err
+		}
+		return client, true, nil
+	}
+}
+
+// NewClientWithCredentials is like NewClientFromURI, but authenticates with the credentials
+// of p instead of those in uri, which are fetched again on every load, so that a rotated
+// password is picked up by the next renewal. The other authentication options of uri, e.g.
+// authSource, are kept.
+func NewClientWithCredentials(uri string, p credentials.Provider, serverSelectionTimeout time.Duration) NewClient {
+	if p == nil {
+		panic("p cannot be nil")
+	}
+	return func(ctx context.Context) (*mongo.Client, bool, error) {
+		c, err := p.Credentials(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get the credentials: %w", err)
+		}
+		opts := options.Client().ApplyURI(uri)
+		var auth options.Credential
+		if opts.Auth != nil {
+			auth = *opts.Auth
+		}
+		auth.Username, auth.Password, auth.PasswordSet = c.Username, c.Password, true
+		opts.SetAuth(auth)
+		if serverSelectionTimeout > 0 {
+			opts.SetServerSelectionTimeout(serverSelectionTimeout)
+		}
+		client, err := mongo.Connect(opts)
+		if err != nil {
+			return nil, false, err
+		}
+		return client, true, nil
+	}
+}
+
+// Backend describes the number in MongoDB to load the high bits from. Either Client or
+// NewClient must be set.
+type Backend struct {
+	// Client is an existing client shared with the rest of the application. It is never
+	// disconnected by WUID.
+	Client    *mongo.Client
+	NewClient NewClient
+	// Database, Collection and DocID locate the document holding the number in its field n.
+	Database   string
+	Collection string
+	DocID      string
+}
+
+// LoadHighBits adds 1 to the number in the document b.DocID of b.Collection and fetches its
+// new value. The document is created if it does not exist. The new value is used as the high
+// bits of all generated numbers. In addition, b is saved for future renewal.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromMongo(ctx, b)
+}
+
+// loadh32FromMongo implements LoadHighBitsContext.
+func (w *WUID) loadh32FromMongo(ctx context.Context, b Backend) error {
+	if b.Client == nil && b.NewClient == nil {
+		return errors.New("either a client or newClient is required")
+	}
+	if len(b.Database) == 0 {
+		return errors.New("database cannot be empty")
+	}
+	if len(b.Collection) == 0 {
+		return errors.New("collection cannot be empty")
+	}
+	if len(b.DocID) == 0 {
+		return errors.New("docID cannot be empty")
+	}
+	if err := w.w.Interlock("mongo", b.Database+"."+b.Collection+"/"+b.DocID); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, &renewer{w: w, b: b})
+}
+
+// renewer fetches h32 from the document of b, and raises the number in it past the reserved
+// ranges.
+type renewer struct {
+	w *WUID
+	b Backend
+}
+
+func (r *renewer) Renew(ctx context.Context) (int64, error) {
+	return r.w.fetchh32FromMongo(ctx, r.b)
+}
+
+func (r *renewer) Raise(ctx context.Context, h32 int64) error {
+	return r.w.withCollection(ctx, r.b, func(coll *mongo.Collection) error {
+		update := bson.M{"$max": bson.M{"n": h32}}
+		_, err := coll.UpdateOne(ctx, bson.M{"_id": r.b.DocID}, update, options.UpdateOne().SetUpsert(true))
+		return err
+	})
+}
+
+// withCollection calls f with the collection of b.
+func (w *WUID) withCollection(ctx context.Context, b Backend, f func(coll *mongo.Collection) error) error {
+	client, autoClose := b.Client, false
+	if client == nil {
+		var err error
+		client, autoClose, err = b.NewClient(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Disconnect(context.Background())
+		}
+	}()
+	return f(client.Database(b.Database).Collection(b.Collection))
+}
+
+// fetchh32FromMongo adds 1 to the number in the document of b and returns its new value.
+func (w *WUID) fetchh32FromMongo(ctx context.Context, b Backend) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("mongo", b.Database+"."+b.Collection+"/"+b.DocID)
+	defer func() {
+		span.End(err)
+	}()
+
+	var doc struct {
+		N int64 `bson:"n"`
+	}
+	filter := bson.M{"_id": b.DocID}
+	update := bson.M{"$inc": bson.M{"n": int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err = w.withCollection(ctx, b, func(coll *mongo.Collection) error {
+		return coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return doc.N, nil
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
@@ -0,0 +1,129 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edwingeng/slog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+var (
+	cfg struct {
+		uri        string
+		database   string
+		collection string
+		docID      string
+	}
+)
+
+func init() {
+	cfg.uri = "mongodb://127.0.0.1:27017"
+	cfg.database = "test"
+	cfg.collection = "wuid"
+	cfg.docID = "default"
+}
+
+func connect(t *testing.T) *mongo.Client {
+	client, _, err := NewClientFromURI(cfg.uri, time.Second)(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Disconnect(context.Background())
+	})
+	if err := client.Ping(context.Background(), nil); err != nil {
+		t.Skipf("MongoDB is not available: %v", err)
+	}
+	return client
+}
+
+func TestWUID_LoadHighBits(t *testing.T) {
+	client := connect(t)
+	w := NewWUID("alpha", dumb)
+	err := w.LoadHighBits(Backend{Client: client, Database: cfg.database, Collection: cfg.collection, DocID: cfg.docID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	for i := 1; i < 100; i++ {
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+}
+
+func TestWUID_LoadHighBits_NewClient(t *testing.T) {
+	connect(t)
+	w := NewWUID("alpha", dumb)
+	b := Backend{NewClient: NewClientFromURI(cfg.uri, time.Second), Database: cfg.database, Collection: cfg.collection, DocID: cfg.docID}
+	if err := w.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	h32 := atomic.LoadInt64(&w.w.N) >> 32
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.w.N)>>32 != h32+1 {
+		t.Fatalf("h32 should have been renewed to %d", h32+1)
+	}
+}
+
+func TestWUID_LoadHighBits_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	b := Backend{Client: &mongo.Client{}, Database: cfg.database, Collection: cfg.collection, DocID: cfg.docID}
+	for _, fn := range []func(b *Backend){
+		func(b *Backend) { b.Client = nil },
+		func(b *Backend) { b.Database = "" },
+		func(b *Backend) { b.Collection = "" },
+		func(b *Backend) { b.DocID = "" },
+	} {
+		b := b
+		fn(&b)
+		if w.LoadHighBits(b) == nil {
+			t.Fatalf("the backend is not properly checked: %+v", b)
+		}
+	}
+
+	newErrorClient := func(ctx context.Context) (*mongo.Client, bool, error) {
+		return nil, true, errors.New("beta")
+	}
+	b.Client, b.NewClient = nil, newErrorClient
+	if w.LoadHighBits(b) == nil {
+		t.Fatal("an error should be returned when newClient fails")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.NewClient = NewClientFromURI(cfg.uri, time.Second)
+	if err := w.LoadHighBitsContext(ctx, b); !errors.Is(err, context.Canceled) {
+		t.Fatalf("the load should have been bound to ctx, err: %v", err)
+	}
+}
+
+func TestWithDeterministic(t *testing.T) {
+	w := NewWUID("alpha", dumb, WithDeterministic(7))
+	if err := w.LoadHighBits(Backend{}); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v != 7<<32+1 {
+		t.Fatalf("the first identifier is %d", v)
+	}
+}
@@ -0,0 +1,49 @@
+package wuid
+
+import (
+	"fmt"
+)
+
+// Backend creates a generator for a kind of identifiers, typically by loading the high bits
+// from a key derived from kind, e.g. "wuid:order".
+type Backend func(kind string) (WUID, error)
+
+// Namespace manages a generator for each kind of identifiers, e.g. orders and users. The
+// generators are created by the backend on first use and cached afterwards.
+type Namespace struct {
+	m *lazyMap
+}
+
+// NewNamespace creates a Namespace whose generators are created by backend.
+func NewNamespace(backend Backend) *Namespace {
+	if backend == nil {
+		panic("backend cannot be nil")
+	}
+	return &Namespace{m: newLazyMap(func(kind string) (WUID, error) {
+		w, err := backend(kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the generator of %q: %w", kind, err)
+		}
+		if w == nil {
+			return nil, fmt.Errorf("the backend returned a nil generator for %q", kind)
+		}
+		return w, nil
+	})}
+}
+
+// Get returns the generator of kind, creating it if necessary. The generators of the other
+// kinds stay available while it is being created. A failed creation is not cached, so the
+// next call tries again.
+func (ns *Namespace) Get(kind string) (WUID, error) {
+	return ns.m.get(kind)
+}
+
+// For is like Get but panics if the generator cannot be created, so that it can be chained,
+// e.g. ns.For("order").Next().
+func (ns *Namespace) For(kind string) WUID {
+	w, err := ns.Get(kind)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
@@ -0,0 +1,110 @@
+package wuid
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestNamespace(t *testing.T) {
+	b := wuidtest.NewFakeBackend()
+	var mu sync.Mutex
+	var kinds []string
+	foo := errors.New("foo")
+	ns := NewNamespace(func(kind string) (WUID, error) {
+		if kind == "bad" {
+			return nil, foo
+		}
+		mu.Lock()
+		kinds = append(kinds, kind)
+		mu.Unlock()
+		w := wuidtest.NewWUID(kind, nil)
+		if err := w.LoadHighBits(b); err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ns.For("order").Next()
+			ns.For("user").Next()
+		}()
+	}
+	wg.Wait()
+	if len(kinds) != 2 {
+		t.Fatalf("the generators are created %d times, while it should be 2", len(kinds))
+	}
+	if ns.For("order") == ns.For("user") {
+		t.Fatal("each kind should have its own generator")
+	}
+	if ns.For("order").Next()>>32 == ns.For("user").Next()>>32 {
+		t.Fatal("each kind should have its own h32")
+	}
+
+	if _, err := ns.Get("bad"); !errors.Is(err, foo) {
+		t.Fatalf("err is %v, while it should be foo", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("For should have panicked")
+			}
+		}()
+		ns.For("bad")
+	}()
+}
+
+func TestNamespace_SlowBackend(t *testing.T) {
+	b := wuidtest.NewFakeBackend()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	ns := NewNamespace(func(kind string) (WUID, error) {
+		mu.Lock()
+		calls[kind]++
+		mu.Unlock()
+		if kind == "slow" {
+			<-release
+		}
+		w := wuidtest.NewWUID(kind, nil)
+		if err := w.LoadHighBits(b); err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+	ns.For("order")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ns.For("slow").Next()
+		}()
+	}
+	// The cached and the other kinds are served while slow is being created.
+	for _, kind := range []string{"order", "user"} {
+		done := make(chan struct{})
+		go func() {
+			ns.For(kind).Next()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Get(%q) is blocked by the creation of another kind", kind)
+		}
+	}
+	close(release)
+	wg.Wait()
+	if calls["slow"] != 1 {
+		t.Fatalf("the concurrent callers should share one creation. calls: %d", calls["slow"])
+	}
+}
@@ -0,0 +1,192 @@
+// Package wuid is a facade of WUID for TinyGo, WASM and the other constrained targets. The
+// high bits are loaded with a plain function, so that no driver is imported, and the package
+// depends on the standard library only. Build with -tags wuid_nodeps to leave out expvar as
+// well, which TinyGo does not support:
+//
+//	tinygo build -tags wuid_nodeps -target wasm ./cmd/app
+//
+// With the tag, PublishExpvar of the other packages returns an error.
+package wuid
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+}
+
+// Logger is the logging interface accepted by NewWUID.
+type Logger = internal.Logger
+
+// NewWUID creates a new WUID instance. A nil logger means no logs unless WithVerboseLogging
+// is passed in.
+func NewWUID(name string, logger Logger, opts ...Option) *WUID {
+	return &WUID{w: internal.NewWUID(name, logger, opts...)}
+}
+
+// Next returns a unique identifier.
+func (w *WUID) Next() int64 {
+	return w.w.Next()
+}
+
+// NextOrErr is like Next but returns an error instead of waiting or panicking, e.g.
+// wuiderr.ErrRateLimited when the rate limit set by WithRateLimit is exceeded.
+func (w *WUID) NextOrErr() (int64, error) {
+	return w.w.NextOrErr()
+}
+
+// NextString returns a unique identifier in decimal, which is unsigned with WithUint64.
+func (w *WUID) NextString() string {
+	return w.w.NextString()
+}
+
+// NextUint64 returns a unique identifier as an unsigned integer, which covers the identifiers
+// generated with WithUint64 whose sign bit is set.
+func (w *WUID) NextUint64() uint64 {
+	return w.w.NextUint64()
+}
+
+// AppendNext appends a unique identifier in decimal to dst and returns the extended buffer,
+// like strconv.AppendInt. It does not allocate when dst has room for it.
+func (w *WUID) AppendNext(dst []byte) []byte {
+	return w.w.AppendNext(dst)
+}
+
+// LoadHighBits calls load to get a number, and uses it as the high bits of all generated
+// numbers. In addition, load is saved for future renewal. The context passed to load is
+// canceled when the renewal timeout set by WithRenewTimeout expires.
+func (w *WUID) LoadHighBits(load func(ctx context.Context) (h32 int64, err error)) error {
+	return w.LoadHighBitsContext(context.Background(), load)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, load func(ctx context.Context) (h32 int64, err error)) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	if load == nil {
+		return errors.New("load cannot be nil")
+	}
+	return w.w.Load(ctx, internal.RenewerFunc(load))
+}
+
+// RenewNow reacquires the high 28 bits immediately.
+func (w *WUID) RenewNow() error {
+	return w.w.RenewNow()
+}
+
+type StatsSnapshot = internal.StatsSnapshot
+
+// Stats returns a snapshot of the statistics, e.g. the current h32, the usage of the low bits,
+// the number of identifiers issued and the outcome of the renewals.
+func (w *WUID) Stats() StatsSnapshot {
+	return w.w.Stats()
+}
+
+type RateStats = internal.RateStats
+
+// RateStats returns the issuance rate, i.e. a moving average of the identifiers issued per
+// second and a histogram of the intervals between them. A renewal starts before the usual
+// threshold when the low bits would run out within twice the renew timeout at that rate.
+func (w *WUID) RateStats() RateStats {
+	return w.w.RateStats()
+}
+
+type LatencyStats = internal.LatencyStats
+
+// RenewLatency returns the latency of the backend measured by the latest loads and renewals.
+// When the backend is slow, the renewal threshold moves earlier, so that the low bits left
+// last for RenewMargin times the p99 latency at the current issuance rate.
+func (w *WUID) RenewLatency() LatencyStats {
+	return w.w.RenewLatency()
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
+
+type Option = internal.Option
+
+// Withh32Verifier adds an extra verifier for the high 28 bits.
+func Withh32Verifier(cb func(h32 int64) error) Option {
+	return internal.Withh32Verifier(cb)
+}
+
+// WithSection brands a section ID on each generated number. A section ID must be in between [0, 7].
+func WithSection(section int8) Option {
+	return internal.WithSection(section)
+}
+
+// WithUint64 lets the high bits take the sign bit as well, for the systems storing identifiers
+// as unsigned 64-bit integers. Take the identifiers with NextUint64.
+func WithUint64() Option {
+	return internal.WithUint64()
+}
+
+// WithStep sets the step and the floor for each generated number.
+func WithStep(step int64, floor int64) Option {
+	return internal.WithStep(step, floor)
+}
+
+// WithObfuscation enables number obfuscation.
+func WithObfuscation(seed int) Option {
+	return internal.WithObfuscation(seed)
+}
+
+// WithPermutation applies a keyed permutation to the step blocks of the low 32 bits, so that
+// consecutive numbers do not reveal the issuance rate. The step must be a power of 2.
+func WithPermutation(seed int) Option {
+	return internal.WithPermutation(seed)
+}
+
+// WithRenewTimeout sets the timeout of loading the high 28 bits, which is 5 seconds by default.
+func WithRenewTimeout(d time.Duration) Option {
+	return internal.WithRenewTimeout(d)
+}
+
+// WithMaxH32Age renews the high 28 bits in the background whenever they get older than d,
+// regardless of the consumption of the low bits. Call Stop to stop the background renewal.
+func WithMaxH32Age(d time.Duration) Option {
+	return internal.WithMaxH32Age(d)
+}
+
+// WithVerboseLogging makes NewWUID log to stderr with the standard log package when the
+// logger passed in is nil. Without it, a nil logger means no logs at all.
+func WithVerboseLogging() Option {
+	return internal.WithVerboseLogging()
+}
+
+// WithRateLimit limits the instance to perSecond identifiers per second, with bursts of up
+// to one second's worth. Next waits when the limit is exceeded, while NextOrErr returns
+// wuiderr.ErrRateLimited.
+func WithRateLimit(perSecond int) Option {
+	return internal.WithRateLimit(perSecond)
+}
+
+// WithDeterministic makes an instance reproducible for golden-file and snapshot tests: h32 is
+// fixed to seed, LoadHighBits does not call load, and no goroutine is started for the
+// renewal. The low bits are never renewed.
+func WithDeterministic(seed int64) Option {
+	return internal.WithDeterministic(seed)
+}
+
+// WithSynchronousRenew renews the high bits on the goroutine of the Next call crossing the
+// renewal boundary, bounded by budget instead of the renew timeout, rather than in the
+// background. It is recommended on WASM, where background goroutines are costly. It cannot
+// be combined with WithMaxH32Age.
+func WithSynchronousRenew(budget time.Duration) Option {
+	return internal.WithSynchronousRenew(budget)
+}
+
+// WithRenewCheckInterval sets how many identifiers an instance generates between two renewal
+// attempts once the renewal is due, which is about 33 million divided by the step by default.
+func WithRenewCheckInterval(ids int64) Option {
+	return internal.WithRenewCheckInterval(ids)
+}
@@ -0,0 +1,61 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWUID_LoadHighBits(t *testing.T) {
+	var h32 int64 = 100
+	w := NewWUID("alpha", nil, WithSynchronousRenew(time.Second))
+	err := w.LoadHighBits(func(ctx context.Context) (int64, error) {
+		h32++
+		return h32, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v>>32 != 101 {
+		t.Fatalf("v>>32 != 101. v: %x", v)
+	}
+
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v>>32 != 102 {
+		t.Fatalf("v>>32 != 102. v: %x", v)
+	}
+	if ss := w.Stats(); ss.H32 != 102 {
+		t.Fatalf("ss.H32 != 102. ss.H32: %d", ss.H32)
+	}
+}
+
+func TestWUID_LoadHighBits_Error(t *testing.T) {
+	w := NewWUID("alpha", nil)
+	if err := w.LoadHighBits(nil); err == nil {
+		t.Fatal("LoadHighBits should fail when load is nil")
+	}
+
+	errLoad := errors.New("boom")
+	err := w.LoadHighBits(func(ctx context.Context) (int64, error) {
+		return 0, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.LoadHighBits(func(ctx context.Context) (int64, error) { return 0, nil }); err == nil {
+		t.Fatal("LoadHighBits should fail when h32 is 0")
+	}
+}
+
+func TestWithDeterministic(t *testing.T) {
+	w1 := NewWUID("alpha", nil, WithDeterministic(7))
+	w2 := NewWUID("alpha", nil, WithDeterministic(7))
+	for i := 0; i < 10; i++ {
+		if v1, v2 := w1.Next(), w2.Next(); v1 != v2 {
+			t.Fatalf("v1 != v2. v1: %d, v2: %d", v1, v2)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/driftboat/wuid/credentials"
+	"github.com/driftboat/wuid/internal"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+var (
+	// ErrObjectNotFound should be returned by Bucket.Read when the object does not exist.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrPreconditionFailed should be returned by Bucket.WriteIf when the version does not match.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Bucket is the minimal object storage API needed by Loadh32FromObjectStore. It is usually
+// a thin wrapper of an S3 or GCS client.
+type Bucket interface {
+	// Read returns the content of an object and its version, i.e. the ETag in S3 or
+	// the generation in GCS.
+	Read(ctx context.Context, name string) (data []byte, version string, err error)
+	// WriteIf stores the content only if the current version of the object equals version,
+	// i.e. If-Match in S3 or ifGenerationMatch in GCS. An empty version means that the object
+	// must not exist yet.
+	WriteIf(ctx context.Context, name string, data []byte, version string) error
+}
+
+const maxAttempts = 10
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+}
+
+type NewBucket func() (bucket Bucket, err error)
+
+// NewBucketWithCredentials returns a NewBucket fetching the credentials of p on every load and
+// passing them to newBucket, e.g. an access key ID in Username and its secret in Password for a
+// client of S3, so that rotated keys are picked up by the next renewal.
+func NewBucketWithCredentials(p credentials.Provider, newBucket func(ctx context.Context, c credentials.Credentials) (Bucket, error)) NewBucket {
+	if p == nil || newBucket == nil {
+		panic("p and newBucket cannot be nil")
+	}
+	return func() (Bucket, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), internal.DefaultRenewTimeout)
+		defer cancel()
+		c, err := p.Credentials(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the credentials: %w", err)
+		}
+		return newBucket(ctx, c)
+	}
+}
+
+// Backend describes the object to load the high bits from.
+type Backend struct {
+	NewBucket NewBucket
+	Name      string
+}
+
+// LoadHighBits adds 1 to the number stored in the object b.Name and fetches its new value.
+// The object is updated with conditional writes, and a conflicting write is retried with
+// backoff. The new value is used as the high bits of all generated numbers. In addition, b
+// is saved for future renewal.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromObjectStore(ctx, b.NewBucket, b.Name)
+}
+
+// Loadh32FromObjectStore is the same as LoadHighBits(Backend{NewBucket: newBucket, Name: name}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32FromObjectStore(newBucket NewBucket, name string) error {
+	return w.LoadHighBits(Backend{NewBucket: newBucket, Name: name})
+}
+
+// loadh32FromObjectStore implements LoadHighBitsContext.
+func (w *WUID) loadh32FromObjectStore(ctx context.Context, newBucket NewBucket, name string) error {
+	if len(name) == 0 {
+		return errors.New("name cannot be empty")
+	}
+	if err := w.w.Interlock("objectstore", name); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (int64, error) {
+		return w.fetchh32FromObjectStore(ctx, newBucket, name)
+	}))
+}
+
+// fetchh32FromObjectStore adds 1 to the number stored in the object name and returns its new
+// value.
+func (w *WUID) fetchh32FromObjectStore(ctx context.Context, newBucket NewBucket, name string) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("objectstore", name)
+	defer func() {
+		span.End(err)
+	}()
+
+	bucket, err := newBucket()
+	if err != nil {
+		return 0, err
+	}
+	return incr(ctx, bucket, name)
+}
+
+func incr(ctx context.Context, bucket Bucket, name string) (int64, error) {
+	backoff := time.Millisecond * 10
+	for i := 0; i < maxAttempts; i++ {
+		var current int64
+		data, version, err := bucket.Read(ctx, name)
+		switch {
+		case err == nil:
+			current, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("the content of the object is not a number: %w", err)
+			}
+		case errors.Is(err, ErrObjectNotFound):
+			version = ""
+		default:
+			return 0, err
+		}
+
+		next := current + 1
+		err = bucket.WriteIf(ctx, name, []byte(strconv.FormatInt(next, 10)), version)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return 0, err
+		}
+		if i == maxAttempts-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return 0, fmt.Errorf("too many conflicting writes. name: %s", name)
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
@@ -0,0 +1,272 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/credentials"
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+type memBucket struct {
+	sync.Mutex
+	objects   map[string][]byte
+	versions  map[string]int
+	conflicts int
+}
+
+func newMemBucket() *memBucket {
+	return &memBucket{
+		objects:  make(map[string][]byte),
+		versions: make(map[string]int),
+	}
+}
+
+func (b *memBucket) Read(_ context.Context, name string) ([]byte, string, error) {
+	b.Lock()
+	defer b.Unlock()
+	data, ok := b.objects[name]
+	if !ok {
+		return nil, "", ErrObjectNotFound
+	}
+	return data, strconv.Itoa(b.versions[name]), nil
+}
+
+func (b *memBucket) WriteIf(_ context.Context, name string, data []byte, version string) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.conflicts > 0 {
+		b.conflicts--
+		b.versions[name]++
+		return ErrPreconditionFailed
+	}
+	_, ok := b.objects[name]
+	switch {
+	case version == "" && ok:
+		return ErrPreconditionFailed
+	case version != "" && version != strconv.Itoa(b.versions[name]):
+		return ErrPreconditionFailed
+	}
+	b.objects[name] = data
+	b.versions[name]++
+	return nil
+}
+
+func TestWUID_Loadh32FromObjectStore(t *testing.T) {
+	bucket := newMemBucket()
+	newBucket := func() (Bucket, error) {
+		return bucket, nil
+	}
+	w := NewWUID("alpha", dumb)
+	err := w.Loadh32FromObjectStore(newBucket, "wuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	if initial != 1<<32 {
+		t.Fatalf("w.w.N is %d, while it should be %d", initial, int64(1<<32))
+	}
+	for i := 1; i < 100; i++ {
+		bucket.Lock()
+		bucket.conflicts = rand.Intn(3)
+		bucket.Unlock()
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+}
+
+func TestNewBucketWithCredentials(t *testing.T) {
+	bucket := newMemBucket()
+	var keys []string
+	newBucket := NewBucketWithCredentials(credentials.Static("alpha", "beta"), func(_ context.Context, c credentials.Credentials) (Bucket, error) {
+		keys = append(keys, c.Username+":"+c.Password)
+		return bucket, nil
+	})
+	w := NewWUID("alpha", dumb)
+	if err := w.LoadHighBits(Backend{NewBucket: newBucket, Name: "wuid"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "alpha:beta" {
+		t.Fatalf("the credentials should have been fetched on every load. keys: %v", keys)
+	}
+
+	failed := NewBucketWithCredentials(credentials.ProviderFunc(func(context.Context) (credentials.Credentials, error) {
+		return credentials.Credentials{}, errors.New("beta")
+	}), func(context.Context, credentials.Credentials) (Bucket, error) {
+		return bucket, nil
+	})
+	if err := NewWUID("alpha", dumb).LoadHighBits(Backend{NewBucket: failed, Name: "wuid"}); err == nil {
+		t.Fatal("the error of the credentials should have failed the load")
+	}
+}
+
+func TestWUID_Loadh32FromObjectStore_Concurrent(t *testing.T) {
+	bucket := newMemBucket()
+	newBucket := func() (Bucket, error) {
+		return bucket, nil
+	}
+
+	const total = 5
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[int64]bool)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := NewWUID("alpha", dumb)
+			if err := w.Loadh32FromObjectStore(newBucket, "wuid"); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			seen[atomic.LoadInt64(&w.w.N)>>32] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(seen) != total {
+		t.Fatalf("duplication detected. len(seen): %d", len(seen))
+	}
+}
+
+func TestWUID_Loadh32FromObjectStore_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32FromObjectStore(nil, "") == nil {
+		t.Fatal("name is not properly checked")
+	}
+
+	newErrorBucket := func() (Bucket, error) {
+		return nil, errors.New("beta")
+	}
+	if w.Loadh32FromObjectStore(newErrorBucket, "beta") == nil {
+		t.Fatal(`w.Loadh32FromObjectStore(newErrorBucket, "beta") == nil`)
+	}
+
+	bucket := newMemBucket()
+	bucket.objects["beta"] = []byte("gamma")
+	newBucket := func() (Bucket, error) {
+		return bucket, nil
+	}
+	if w.Loadh32FromObjectStore(newBucket, "beta") == nil {
+		t.Fatal("the content of the object is not properly checked")
+	}
+
+	bucket.conflicts = maxAttempts
+	startTime := time.Now()
+	if w.Loadh32FromObjectStore(newBucket, "delta") == nil {
+		t.Fatal("conflicting writes are not properly handled")
+	}
+	// No backoff after the last attempt.
+	if d := time.Since(startTime); d >= 10*time.Millisecond<<(maxAttempts-1)*3/2 {
+		t.Fatalf("the load gave up after %s", d)
+	}
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestWUID_Next_Renew(t *testing.T) {
+	bucket := newMemBucket()
+	newBucket := func() (Bucket, error) {
+		return bucket, nil
+	}
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	err := w.Loadh32FromObjectStore(newBucket, "wuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h32 := atomic.LoadInt64(&w.w.N) >> 32
+	atomic.StoreInt64(&w.w.N, (h32<<32)|internal.Bye)
+	n1a := w.Next()
+	if n1a>>32 != h32 {
+		t.Fatal(`n1a>>32 != h32`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != (h32+1)<<32+1 {
+		t.Fatal(`n1b != (h32+1)<<32+1`)
+	}
+
+	atomic.StoreInt64(&w.w.N, ((h32+1)<<32)|internal.Bye)
+	n2a := w.Next()
+	if n2a>>32 != h32+1 {
+		t.Fatal(`n2a>>32 != h32+1`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 2)
+	n2b := w.Next()
+	if n2b != (h32+2)<<32+1 {
+		t.Fatal(`n2b != (h32+2)<<32+1`)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 2 {
+		t.Fatal(`num != 2`)
+	}
+}
+
+func Example() {
+	newBucket := func() (Bucket, error) {
+		var bucket Bucket
+		// ...
+		return bucket, nil
+	}
+
+	// Setup
+	w := NewWUID("alpha", nil)
+	err := w.LoadHighBits(Backend{NewBucket: newBucket, Name: "wuid/counter"})
+	if err != nil {
+		panic(err)
+	}
+
+	// Generate
+	for i := 0; i < 10; i++ {
+		fmt.Printf("%#016x\n", w.Next())
+	}
+}
@@ -0,0 +1,37 @@
+package wuid
+
+// PartitionLayout decides which bits of an identifier PartitionKeyOf derives the partition from.
+type PartitionLayout int
+
+const (
+	// PartitionByH32 maps the identifiers sharing the same high bits, i.e. those issued by an
+	// instance between two renewals, to the same partition, so that they stay in order.
+	PartitionByH32 PartitionLayout = iota
+	// PartitionBySection maps all the identifiers of a section to the same partition, which
+	// does not change with renewals. The generators should be created with WithSection.
+	PartitionBySection
+)
+
+// PartitionKey returns the partition of id in between [0, partitions) with PartitionByH32.
+func PartitionKey(id int64, partitions int) int {
+	return PartitionKeyOf(id, partitions, PartitionByH32)
+}
+
+// PartitionKeyOf returns the partition of id in between [0, partitions). The same id is always
+// mapped to the same partition as long as the number of partitions does not change.
+func PartitionKeyOf(id int64, partitions int, layout PartitionLayout) int {
+	if partitions < 1 {
+		panic("partitions must be positive")
+	}
+	if id < 0 {
+		panic("id cannot be negative")
+	}
+	switch layout {
+	case PartitionByH32:
+		return int(uint64(id>>32) % uint64(partitions))
+	case PartitionBySection:
+		return int(uint64(id>>60&7) % uint64(partitions))
+	default:
+		panic("unknown partition layout")
+	}
+}
@@ -0,0 +1,50 @@
+package wuid
+
+import (
+	"testing"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestPartitionKey(t *testing.T) {
+	w := wuidtest.NewDeterministicWUID(42)
+	p := PartitionKey(w.Next(), 8)
+	for i := 0; i < 100; i++ {
+		if v := PartitionKey(w.Next(), 8); v != p {
+			t.Fatalf("the partition is %d, while it should be %d", v, p)
+		}
+	}
+	if p != 42%8 {
+		t.Fatalf("the partition is %d, while it should be %d", p, 42%8)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if v := PartitionKey(w.Next(), 8); v != 43%8 {
+		t.Fatalf("the partition is %d, while it should be %d", v, 43%8)
+	}
+
+	for _, id := range []int64{5<<60 | 42<<32 | 1, 5<<60 | 43<<32 | 7} {
+		if v := PartitionKeyOf(id, 4, PartitionBySection); v != 1 {
+			t.Fatalf("the partition of %#016x is %d, while it should be 1", id, v)
+		}
+	}
+	if v := PartitionKeyOf(1<<62|1, 1, PartitionByH32); v != 0 {
+		t.Fatalf("the partition is %d, while it should be 0", v)
+	}
+
+	for _, f := range []func(){
+		func() { PartitionKey(1, 0) },
+		func() { PartitionKey(-1, 8) },
+		func() { PartitionKeyOf(1, 8, PartitionLayout(9)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("PartitionKeyOf should have panicked")
+				}
+			}()
+			f()
+		}()
+	}
+}
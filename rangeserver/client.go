@@ -0,0 +1,111 @@
+package rangeserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Client generates identifiers from the leases granted by a Leaser, e.g. a remote Server. It
+// leases a new range when the current one runs out or expires, and renews the current lease
+// once half of its TTL has passed. A Client is safe for concurrent use.
+type Client struct {
+	leaser  Leaser
+	name    string
+	size    int64
+	timeout time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	lease   Lease
+	next    int64
+	renewAt time.Time
+}
+
+// NewClient creates a Client leasing ranges of size identifiers from leaser under name.
+func NewClient(leaser Leaser, name string, size int64) *Client {
+	if leaser == nil {
+		panic("leaser cannot be nil")
+	}
+	if size < 1 {
+		panic("size must be positive")
+	}
+	return &Client{leaser: leaser, name: name, size: size, timeout: 5 * time.Second, now: time.Now}
+}
+
+// Next returns a unique identifier. It only makes a call to the Leaser when the current lease
+// runs out, expires, or is due for a renewal.
+func (c *Client) Next() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.lease.ID != "" && now.Before(c.lease.Expires) && !now.Before(c.renewAt) && c.next <= c.lease.Range.End {
+		c.renew(now)
+	}
+	if c.lease.ID == "" || !now.Before(c.lease.Expires) || c.next > c.lease.Range.End {
+		if err := c.acquire(now); err != nil {
+			return 0, err
+		}
+	}
+	id := c.next
+	c.next++
+	return id, nil
+}
+
+// Lease returns the current lease, which is empty before the first call to Next.
+func (c *Client) Lease() Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lease
+}
+
+// Close releases the current lease. The identifiers left in it are never used again.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lease.ID == "" {
+		return nil
+	}
+	id := c.lease.ID
+	c.lease = Lease{}
+	err := c.leaser.Release(ctx, id)
+	if errors.Is(err, ErrLeaseNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) acquire(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	l, err := c.leaser.Lease(ctx, c.name, c.size)
+	if err != nil {
+		return err
+	}
+	if c.lease.ID != "" {
+		_ = c.leaser.Release(ctx, c.lease.ID)
+	}
+	c.lease, c.next = l, l.Range.Start
+	c.renewAt = now.Add(l.Expires.Sub(now) / 2)
+	return nil
+}
+
+// renew extends the current lease. A failure is tolerated until the lease expires, except
+// that a lease unknown to the Leaser is dropped at once.
+func (c *Client) renew(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	l, err := c.leaser.Renew(ctx, c.lease.ID)
+	switch {
+	case errors.Is(err, ErrLeaseNotFound):
+		c.lease = Lease{}
+	case err != nil:
+		// Retry after a tenth of the remaining TTL.
+		c.renewAt = now.Add(c.lease.Expires.Sub(now) / 10)
+	default:
+		c.lease.Expires = l.Expires
+		c.renewAt = now.Add(l.Expires.Sub(now) / 2)
+	}
+}
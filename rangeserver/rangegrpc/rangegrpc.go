@@ -0,0 +1,215 @@
+// Package rangegrpc serves a rangeserver.Server over gRPC, and provides the client leasing the
+// ranges from it. The messages are encoded in JSON with the codec registered under
+// CodecName, so that no generated code is needed on either side.
+package rangegrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/driftboat/wuid/rangeserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "wuid.rangeserver.RangeServer"
+
+// CodecName is the content subtype of the requests, i.e. application/grpc+wuid-json.
+const CodecName = "wuid-json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+// LeaseRequest is the request of the Lease method.
+type LeaseRequest struct {
+	Client string `json:"client"`
+	N      int64  `json:"n"`
+}
+
+// LeaseIDRequest is the request of the Renew and the Release methods.
+type LeaseIDRequest struct {
+	ID string `json:"id"`
+}
+
+// LeaseReply is the reply of the Lease and the Renew methods.
+type LeaseReply struct {
+	ID      string `json:"id"`
+	Client  string `json:"client"`
+	Start   int64  `json:"start"`
+	End     int64  `json:"end"`
+	Expires int64  `json:"expires"` // Unix time in nanoseconds
+}
+
+// Empty is the reply of the Release method.
+type Empty struct{}
+
+func toReply(l rangeserver.Lease) *LeaseReply {
+	return &LeaseReply{ID: l.ID, Client: l.Client, Start: l.Range.Start, End: l.Range.End, Expires: l.Expires.UnixNano()}
+}
+
+func fromReply(r *LeaseReply) rangeserver.Lease {
+	return rangeserver.Lease{
+		ID:      r.ID,
+		Client:  r.Client,
+		Range:   rangeserver.Range{Start: r.Start, End: r.End},
+		Expires: time.Unix(0, r.Expires),
+	}
+}
+
+// toStatus converts the errors of the Leaser to the gRPC status, which toError converts back.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, rangeserver.ErrLeaseNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+func toError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return rangeserver.ErrLeaseNotFound
+	}
+	return err
+}
+
+// Register registers the service leasing the ranges of srv with s, e.g. a *grpc.Server.
+func Register(s grpc.ServiceRegistrar, srv rangeserver.Leaser) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*rangeserver.Leaser)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Lease", Handler: leaseHandler},
+		{MethodName: "Renew", Handler: renewHandler},
+		{MethodName: "Release", Handler: releaseHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func leaseHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		r := req.(*LeaseRequest)
+		l, err := srv.(rangeserver.Leaser).Lease(ctx, r.Client, r.N)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return toReply(l), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Lease"}
+	return interceptor(ctx, in, info, handler)
+}
+
+func renewHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaseIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		l, err := srv.(rangeserver.Leaser).Renew(ctx, req.(*LeaseIDRequest).ID)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return toReply(l), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Renew"}
+	return interceptor(ctx, in, info, handler)
+}
+
+func releaseHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaseIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if err := srv.(rangeserver.Leaser).Release(ctx, req.(*LeaseIDRequest).ID); err != nil {
+			return nil, toStatus(err)
+		}
+		return &Empty{}, nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Release"}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Client is a rangeserver.Leaser calling a remote Server over gRPC. Pass it to
+// rangeserver.NewClient to generate identifiers from the leased ranges.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a Client calling the service through cc, e.g. a *grpc.ClientConn.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	if cc == nil {
+		panic("cc cannot be nil")
+	}
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out interface{}) error {
+	err := c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, grpc.CallContentSubtype(CodecName))
+	return toError(err)
+}
+
+// Lease grants a range of n identifiers to client.
+func (c *Client) Lease(ctx context.Context, client string, n int64) (rangeserver.Lease, error) {
+	out := new(LeaseReply)
+	if err := c.invoke(ctx, "Lease", &LeaseRequest{Client: client, N: n}, out); err != nil {
+		return rangeserver.Lease{}, err
+	}
+	return fromReply(out), nil
+}
+
+// Renew extends the lease with the given ID by another TTL.
+func (c *Client) Renew(ctx context.Context, id string) (rangeserver.Lease, error) {
+	out := new(LeaseReply)
+	if err := c.invoke(ctx, "Renew", &LeaseIDRequest{ID: id}, out); err != nil {
+		return rangeserver.Lease{}, err
+	}
+	return fromReply(out), nil
+}
+
+// Release gives up the lease with the given ID.
+func (c *Client) Release(ctx context.Context, id string) error {
+	return c.invoke(ctx, "Release", &LeaseIDRequest{ID: id}, new(Empty))
+}
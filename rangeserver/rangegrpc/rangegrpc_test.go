@@ -0,0 +1,68 @@
+package rangegrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/rangeserver"
+	"github.com/edwingeng/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestService(t *testing.T) {
+	w := internal.NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(1 << 32)
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	Register(s, rangeserver.NewServer(w))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx := context.Background()
+	c := NewClient(cc)
+	l, err := c.Lease(ctx, "pod-1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Range.Len() != 100 || l.Client != "pod-1" {
+		t.Fatalf("unexpected lease: %+v", l)
+	}
+	if v := w.Next(); l.Range.Contains(v) {
+		t.Fatalf("%d is leased", v)
+	}
+	if _, err := c.Renew(ctx, l.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Release(ctx, l.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Renew(ctx, l.ID); !errors.Is(err, rangeserver.ErrLeaseNotFound) {
+		t.Fatalf("err should be rangeserver.ErrLeaseNotFound. err: %v", err)
+	}
+
+	g := rangeserver.NewClient(c, "pod-2", 10)
+	for i := 0; i < 25; i++ {
+		if _, err := g.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,201 @@
+// Package rangeserver lets one central generator lease blocks of identifiers to downstream
+// processes, so that a fleet of thousands of pods does not need an h32 of its own per pod,
+// nor a round trip to the backend for every renewal. The ranges come from AllocateRange, so
+// the central generator never issues them itself. A lease expires after a TTL unless it is
+// renewed, which bounds the age of the identifiers minted downstream, just like
+// WithMaxH32Age. The package rangegrpc serves a Server over gRPC.
+package rangeserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+// Range is a block of identifiers. Both ends are inclusive.
+type Range = internal.Range
+
+// Allocator hands out the ranges that it never issues itself. All the generators of this
+// module implement it.
+type Allocator interface {
+	AllocateRange(n int64) (Range, error)
+}
+
+// ErrLeaseNotFound is returned for a lease that has expired, has been released, or has never
+// been granted.
+var ErrLeaseNotFound = errors.New("the lease is not found")
+
+// Lease is a range granted to a client until Expires.
+type Lease struct {
+	ID      string
+	Client  string
+	Range   Range
+	Expires time.Time
+}
+
+// Leaser is implemented by Server and by the clients of its remote forms, e.g. rangegrpc.
+type Leaser interface {
+	// Lease grants a range of n identifiers to client.
+	Lease(ctx context.Context, client string, n int64) (Lease, error)
+	// Renew extends the lease with the given ID by another TTL.
+	Renew(ctx context.Context, id string) (Lease, error)
+	// Release gives up the lease with the given ID. The rest of its range is never used again.
+	Release(ctx context.Context, id string) error
+}
+
+// DefaultTTL is the TTL of the leases unless WithTTL is used.
+const DefaultTTL = 10 * time.Minute
+
+// Option configures a Server.
+type Option func(s *Server)
+
+// WithTTL sets the TTL of the leases.
+func WithTTL(ttl time.Duration) Option {
+	if ttl <= 0 {
+		panic("ttl must be positive")
+	}
+	return func(s *Server) {
+		s.ttl = ttl
+	}
+}
+
+// WithMaxRangeSize limits the number of identifiers in a lease. It is 65536 by default.
+func WithMaxRangeSize(n int64) Option {
+	if n < 1 {
+		panic("n must be positive")
+	}
+	return func(s *Server) {
+		s.maxN = n
+	}
+}
+
+// Server grants leases of the ranges allocated from a central generator.
+type Server struct {
+	alloc Allocator
+	ttl   time.Duration
+	maxN  int64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]*Lease
+}
+
+// NewServer creates a Server leasing the ranges of alloc.
+func NewServer(alloc Allocator, opts ...Option) *Server {
+	if alloc == nil {
+		panic("alloc cannot be nil")
+	}
+	s := &Server{
+		alloc:  alloc,
+		ttl:    DefaultTTL,
+		maxN:   1 << 16,
+		now:    time.Now,
+		leases: make(map[string]*Lease),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// TTL returns the TTL of the leases.
+func (s *Server) TTL() time.Duration {
+	return s.ttl
+}
+
+// Lease grants a range of n identifiers to client.
+func (s *Server) Lease(ctx context.Context, client string, n int64) (Lease, error) {
+	if err := ctx.Err(); err != nil {
+		return Lease{}, err
+	}
+	if n < 1 || n > s.maxN {
+		return Lease{}, fmt.Errorf("n must be in between [1, %d]", s.maxN)
+	}
+	rng, err := s.alloc.AllocateRange(n)
+	if err != nil {
+		return Lease{}, err
+	}
+	id, err := newLeaseID()
+	if err != nil {
+		return Lease{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	l := &Lease{ID: id, Client: client, Range: rng, Expires: now.Add(s.ttl)}
+	s.leases[id] = l
+	return *l, nil
+}
+
+// Renew extends the lease with the given ID by another TTL from now.
+func (s *Server) Renew(ctx context.Context, id string) (Lease, error) {
+	if err := ctx.Err(); err != nil {
+		return Lease{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	l, ok := s.leases[id]
+	if !ok {
+		return Lease{}, ErrLeaseNotFound
+	}
+	l.Expires = now.Add(s.ttl)
+	return *l, nil
+}
+
+// Release gives up the lease with the given ID.
+func (s *Server) Release(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(s.now())
+	if _, ok := s.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+	delete(s.leases, id)
+	return nil
+}
+
+// Leases returns the leases that have not expired, ordered by their ranges.
+func (s *Server) Leases() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(s.now())
+	leases := make([]Lease, 0, len(s.leases))
+	for _, l := range s.leases {
+		leases = append(leases, *l)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].Range.Start < leases[j].Range.Start
+	})
+	return leases
+}
+
+// sweep forgets the leases expired by now.
+func (s *Server) sweep(now time.Time) {
+	for id, l := range s.leases {
+		if !now.Before(l.Expires) {
+			delete(s.leases, id)
+		}
+	}
+}
+
+func newLeaseID() (string, error) {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,123 @@
+package rangeserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newServer(t *testing.T, opts ...Option) (*Server, *internal.WUID, *fakeClock) {
+	t.Helper()
+	w := internal.NewWUID("alpha", slog.NewDumbLogger())
+	w.Reset(1 << 32)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	s := NewServer(w, opts...)
+	s.now = clock.now
+	return s, w, clock
+}
+
+func TestServer(t *testing.T) {
+	s, w, clock := newServer(t, WithTTL(time.Minute), WithMaxRangeSize(100))
+	ctx := context.Background()
+	l1, err := s.Lease(ctx, "pod-1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := s.Lease(ctx, "pod-2", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.Range.Len() != 100 || l2.Range.Len() != 10 || l2.Range.Start <= l1.Range.End {
+		t.Fatalf("unexpected ranges: %+v, %+v", l1.Range, l2.Range)
+	}
+	if v := w.Next(); l1.Range.Contains(v) || l2.Range.Contains(v) {
+		t.Fatalf("%d is leased", v)
+	}
+	if _, err := s.Lease(ctx, "pod-3", 101); err == nil {
+		t.Fatal("Lease should have failed")
+	}
+	if n := len(s.Leases()); n != 2 {
+		t.Fatalf("len(s.Leases()) != 2. n: %d", n)
+	}
+
+	clock.t = clock.t.Add(40 * time.Second)
+	l1, err = s.Renew(ctx, l1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l1.Expires.Equal(clock.t.Add(time.Minute)) {
+		t.Fatalf("unexpected expiration: %s", l1.Expires)
+	}
+
+	clock.t = clock.t.Add(30 * time.Second)
+	if _, err := s.Renew(ctx, l2.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("err should be ErrLeaseNotFound. err: %v", err)
+	}
+	if leases := s.Leases(); len(leases) != 1 || leases[0].ID != l1.ID {
+		t.Fatalf("unexpected leases: %+v", leases)
+	}
+	if err := s.Release(ctx, l1.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Release(ctx, l1.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("err should be ErrLeaseNotFound. err: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	s, _, clock := newServer(t, WithTTL(time.Minute))
+	c := NewClient(s, "pod-1", 10)
+	c.now = clock.now
+	m := make(map[int64]struct{})
+	next := func() int64 {
+		t.Helper()
+		v, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m[v]; ok {
+			t.Fatalf("duplicate: %d", v)
+		}
+		m[v] = struct{}{}
+		return v
+	}
+
+	for i := 0; i < 25; i++ {
+		next()
+	}
+	if n := len(s.Leases()); n != 1 {
+		t.Fatalf("the used leases should have been released. n: %d", n)
+	}
+
+	l := c.Lease()
+	clock.t = clock.t.Add(31 * time.Second)
+	next()
+	if c.Lease().ID != l.ID || !c.Lease().Expires.After(l.Expires) {
+		t.Fatal("the lease should have been renewed")
+	}
+
+	clock.t = clock.t.Add(2 * time.Minute)
+	next()
+	if c.Lease().ID == l.ID {
+		t.Fatal("the expired lease should have been replaced")
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Leases()); n != 0 {
+		t.Fatalf("len(s.Leases()) != 0. n: %d", n)
+	}
+}
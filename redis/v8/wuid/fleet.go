@@ -0,0 +1,198 @@
+package wuid
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// FleetStats is the consumption of a shared key by all the generators announcing their
+// allocations, as seen by one of them since it subscribed. See Backend.Announce.
+type FleetStats struct {
+	// Since is when the subscription started.
+	Since time.Time
+	// NumAllocations is the number of allocations announced since then, the renewals of this
+	// generator included.
+	NumAllocations int64
+	// NumInstances is the number of distinct processes that announced an allocation.
+	NumInstances int
+	// LastAllocation is when the latest allocation was announced.
+	LastAllocation time.Time
+	// Exhaustion is the h32 headroom left in the key. Its Rate is the number of h32 values
+	// consumed per second by the whole fleet, including the generators not announcing, because
+	// they all increment the same key.
+	Exhaustion ExhaustionEstimate
+}
+
+// announcement is the message published on the channel of a key for every allocation.
+type announcement struct {
+	Name string `json:"name"`
+	H32  int64  `json:"h32"`
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+	Time int64  `json:"time"` // Unix time in nanoseconds
+}
+
+// announcementChannel returns the channel the allocations from fullKey are published on.
+func announcementChannel(fullKey string) string {
+	return fullKey + ":allocations"
+}
+
+// announce publishes the allocation of h32 from fullKey. A failure is logged but does not fail
+// the load.
+func (w *WUID) announce(ctx context.Context, client redis.UniversalClient, fullKey string, h32 int64) {
+	fp, _ := w.w.Fingerprint()
+	data, err := json.Marshal(announcement{
+		Name: w.w.Name,
+		H32:  h32,
+		Host: fp.Host,
+		PID:  fp.PID,
+		Time: time.Now().UnixNano(),
+	})
+	if err == nil {
+		err = client.Publish(ctx, announcementChannel(fullKey), data).Err()
+	}
+	if err != nil {
+		w.w.Warnf("<wuid> failed to announce the allocation of h32. name: %s, h32: %d, reason: %s", w.w.Name, h32, err)
+	}
+}
+
+// fleet follows the allocations announced on the channel of a key.
+type fleet struct {
+	ps        *redis.PubSub
+	client    redis.UniversalClient
+	autoClose bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+	stopOnce  sync.Once
+
+	mu        sync.Mutex
+	since     time.Time
+	num       int64
+	instances map[string]struct{}
+	firstH32  int64
+	firstTime time.Time
+	lastH32   int64
+	lastTime  time.Time
+}
+
+// watchFleet subscribes to the allocations announced on the channel of b.Key, once for the
+// lifetime of w. The subscription lives until Stop, whatever happens to ctx, which only bounds
+// the confirmation of the subscription. A failure is logged and retried on the next load.
+func (w *WUID) watchFleet(ctx context.Context, b Backend) {
+	w.fleetMu.Lock()
+	defer w.fleetMu.Unlock()
+	if w.fleet != nil {
+		return
+	}
+
+	client, autoClose, err := b.NewClient()
+	if err != nil {
+		w.w.Warnf("<wuid> failed to watch the fleet. name: %s, reason: %s", w.w.Name, err)
+		return
+	}
+	subCtx, cancel := context.WithCancel(context.Background())
+	ps := client.Subscribe(subCtx, announcementChannel(w.w.KeyPrefix+b.Key))
+	ctx1, cancel1 := context.WithTimeout(ctx, w.w.RenewTimeout())
+	defer cancel1()
+	if _, err := ps.Receive(ctx1); err != nil {
+		cancel()
+		_ = ps.Close()
+		if autoClose {
+			_ = client.Close()
+		}
+		w.w.Warnf("<wuid> failed to watch the fleet. name: %s, reason: %s", w.w.Name, err)
+		return
+	}
+
+	f := &fleet{
+		ps:        ps,
+		client:    client,
+		autoClose: autoClose,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		since:     time.Now(),
+		instances: make(map[string]struct{}),
+	}
+	go f.run()
+	w.fleet = f
+}
+
+func (f *fleet) run() {
+	defer close(f.done)
+	for msg := range f.ps.Channel() {
+		var a announcement
+		if err := json.Unmarshal([]byte(msg.Payload), &a); err != nil {
+			continue
+		}
+		f.add(a)
+	}
+}
+
+func (f *fleet) add(a announcement) {
+	t := time.Unix(0, a.Time)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.num++
+	f.instances[a.Host+":"+strconv.Itoa(a.PID)] = struct{}{}
+	if f.firstTime.IsZero() || a.H32 < f.firstH32 {
+		f.firstH32, f.firstTime = a.H32, t
+	}
+	if a.H32 > f.lastH32 {
+		f.lastH32, f.lastTime = a.H32, t
+	}
+}
+
+func (f *fleet) stats(maxH32 int64) FleetStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := FleetStats{
+		Since:          f.since,
+		NumAllocations: f.num,
+		NumInstances:   len(f.instances),
+		LastAllocation: f.lastTime,
+		Exhaustion: ExhaustionEstimate{
+			Current: f.lastH32,
+			Max:     maxH32,
+		},
+	}
+	est := &s.Exhaustion
+	est.Remaining = est.Max - est.Current
+	if est.Remaining < 0 {
+		est.Remaining = 0
+	}
+	est.Usage = float64(est.Current) / float64(est.Max)
+	if elapsed := f.lastTime.Sub(f.firstTime); f.lastH32 > f.firstH32 && elapsed > 0 {
+		est.Rate = float64(f.lastH32-f.firstH32) / elapsed.Seconds()
+		est.ETA = time.Duration(float64(est.Remaining) / est.Rate * float64(time.Second))
+	}
+	return s
+}
+
+func (f *fleet) stop() {
+	f.stopOnce.Do(func() {
+		f.cancel()
+		_ = f.ps.Close()
+		<-f.done
+		if f.autoClose {
+			_ = f.client.Close()
+		}
+	})
+}
+
+// FleetStats returns the consumption of the key by all the generators announcing their
+// allocations, and false if w does not watch them, i.e. Backend.Announce is not set or the
+// subscription failed.
+func (w *WUID) FleetStats() (FleetStats, bool) {
+	w.fleetMu.Lock()
+	f := w.fleet
+	w.fleetMu.Unlock()
+	if f == nil {
+		return FleetStats{}, false
+	}
+	return f.stats(w.w.MaxH32()), true
+}
@@ -2,38 +2,513 @@ package wuid
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/driftboat/wuid/credentials"
 	"github.com/driftboat/wuid/internal"
-	"github.com/edwingeng/slog"
+	"github.com/driftboat/wuid/leader"
+	"github.com/driftboat/wuid/wuiderr"
 	"github.com/go-redis/redis/v8"
 )
 
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
 // WUID is an extremely fast universal unique identifier generator.
 type WUID struct {
 	w *internal.WUID
+
+	fleetMu sync.Mutex
+	fleet   *fleet
 }
 
-// NewWUID creates a new WUID instance.
-func NewWUID(name string, logger slog.Logger, opts ...Option) *WUID {
-	return &WUID{w: internal.NewWUID(name, logger, opts...)}
+type NewClient func() (client redis.UniversalClient, autoClose bool, err error)
+
+// AuthOnConnect returns an OnConnect hook of the options of go-redis that authenticates every
+// new connection as username with the password returned by password, e.g. the Token method of
+// the iamauth package, which mints the short-lived IAM tokens of ElastiCache, and then selects
+// the database db. Leave Username, Password and DB of the options empty, because go-redis
+// would use them before the hook, and pass the database in db instead.
+func AuthOnConnect(username string, password func(ctx context.Context) (string, error), db int) func(ctx context.Context, cn *redis.Conn) error {
+	if password == nil {
+		panic("password cannot be nil")
+	}
+	return CredentialsOnConnect(credentials.ProviderFunc(func(ctx context.Context) (credentials.Credentials, error) {
+		p, err := password(ctx)
+		return credentials.Credentials{Username: username, Password: p}, err
+	}), db)
 }
 
-// Next returns a unique identifier.
-func (w *WUID) Next() int64 {
-	return w.w.Next()
+// CredentialsOnConnect is like AuthOnConnect, but authenticates with the credentials of p, so
+// that a long-lived client picks up a rotated password on its next new connection.
+func CredentialsOnConnect(p credentials.Provider, db int) func(ctx context.Context, cn *redis.Conn) error {
+	if p == nil {
+		panic("p cannot be nil")
+	}
+	return func(ctx context.Context, cn *redis.Conn) error {
+		c, err := p.Credentials(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the credentials: %w", err)
+		}
+		if c.Username == "" {
+			err = cn.Auth(ctx, c.Password).Err()
+		} else {
+			err = cn.AuthACL(ctx, c.Username, c.Password).Err()
+		}
+		if err != nil || db == 0 {
+			return err
+		}
+		return cn.Select(ctx, db).Err()
+	}
 }
 
-type NewClient func() (client redis.UniversalClient, autoClose bool, err error)
+// Backend describes the number in Redis to load the high bits from.
+type Backend struct {
+	NewClient NewClient
+	Key       string
+	// TTL sets the expiration of the key, which is refreshed on every load. The number is lost
+	// when the key expires, so TTL must be much longer than the interval between renewals,
+	// e.g. with WithMaxH32Age. Zero means no expiration.
+	TTL time.Duration
+	// Coordinator batches the loads of many generators into one pipeline. See
+	// NewRenewCoordinator.
+	Coordinator *RenewCoordinator
+	// Announce publishes every allocation on the channel named after the key followed by
+	// :allocations, and subscribes to it, so that FleetStats reports how fast the generators
+	// of all the processes consume the key.
+	Announce bool
+	// Election lets the leader of the fleet, elected with a lease such as NewLease, increment
+	// the key for all the instances, which ask it over HTTP. An instance falls back to Redis
+	// when the leader cannot be reached. The fingerprint and the announcement of an h32 are
+	// those of the leader. See the leader package.
+	Election *leader.Election
+	// BlockSize makes a load add BlockSize to the number at Key with INCRBY, which reserves
+	// as many consecutive h32 values. The renewals take them one by one before going to Redis
+	// again, so that many processes share a key, whatever their steps, with far fewer round
+	// trips. With Election, the leader serves the followers from its blocks as well. The rest
+	// of a block is lost when the process exits. Zero means 1, i.e. INCR.
+	BlockSize int64
+}
 
-// Loadh32FromRedis adds 1 to a specific number in Redis and fetches its new value.
-// The new value is used as the high 28 bits of all generated numbers. In addition, all the
-// arguments passed in are saved for future renewal.
+// LoadHighBits adds 1 to the number at b.Key in Redis and fetches its new value. The new
+// value is used as the high bits of all generated numbers. In addition, b is saved for
+// future renewal.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromRedis(ctx, b)
+}
+
+// Loadh32FromRedis is the same as LoadHighBits(Backend{NewClient: newClient, Key: key}).
+//
+// Deprecated: Use LoadHighBits instead.
 func (w *WUID) Loadh32FromRedis(newClient NewClient, key string) error {
+	return w.LoadHighBits(Backend{NewClient: newClient, Key: key})
+}
+
+// loadh32FromRedis implements LoadHighBitsContext.
+func (w *WUID) loadh32FromRedis(ctx context.Context, b Backend) error {
+	if len(b.Key) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	if b.TTL < 0 {
+		return errors.New("ttl cannot be negative")
+	}
+	if b.BlockSize < 0 {
+		return errors.New("the block size cannot be negative")
+	}
+	if err := w.w.Interlock("redis", w.w.KeyPrefix+b.Key); err != nil {
+		return err
+	}
+	if err := w.w.Load(ctx, w.renewer(b)); err != nil {
+		return err
+	}
+	if b.Announce {
+		w.watchFleet(ctx, b)
+	}
+	return nil
+}
+
+// renewer returns the Renewer fetching h32 from b.
+func (w *WUID) renewer(b Backend) *renewer {
+	return &renewer{w: w, b: b}
+}
+
+// renewer fetches h32 from b, and raises the number at b.Key past the reserved ranges.
+type renewer struct {
+	w *WUID
+	b Backend
+
+	// blockMu guards the rest of the block reserved with b.BlockSize, from next to last.
+	blockMu    sync.Mutex
+	next, last int64
+}
+
+func (r *renewer) Renew(ctx context.Context) (int64, error) {
+	if r.b.Election != nil {
+		return r.b.Election.Allocate(ctx, r.w.w.KeyPrefix+r.b.Key, r.fetch)
+	}
+	return r.fetch(ctx)
+}
+
+// fetch takes the next h32 of the block, and reserves a new block from Redis when it runs out.
+func (r *renewer) fetch(ctx context.Context) (int64, error) {
+	if r.b.BlockSize <= 1 {
+		return r.w.fetchh32FromRedis(ctx, r.b)
+	}
+	r.blockMu.Lock()
+	defer r.blockMu.Unlock()
+	if r.next == 0 || r.next > r.last {
+		last, err := r.w.fetchh32FromRedis(ctx, r.b)
+		if err != nil {
+			return 0, err
+		}
+		r.setBlock(last-r.b.BlockSize+1, last)
+	}
+	h32 := r.next
+	r.next++
+	return h32, nil
+}
+
+// setBlock sets the rest of the block. blockMu must be held unless r is not shared yet.
+func (r *renewer) setBlock(next, last int64) {
+	r.next, r.last = next, last
+}
+
+func (r *renewer) Raise(ctx context.Context, h32 int64) error {
+	// The rest of the block up to h32 would be reserved as well.
+	r.blockMu.Lock()
+	if r.next <= h32 {
+		r.setBlock(0, 0)
+	}
+	r.blockMu.Unlock()
+
+	client, autoClose, err := r.b.NewClient()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	return raiseTo.Run(ctx, client, []string{r.w.w.KeyPrefix + r.b.Key}, h32).Err()
+}
+
+// Park pushes b to the list at the key followed by :parked: and the layout fingerprint, for
+// WithResumePreviousBlock.
+func (r *renewer) Park(ctx context.Context, b internal.ParkedBlock) error {
+	client, autoClose, err := r.b.NewClient()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	parkedKey := r.w.w.KeyPrefix + r.b.Key + ":parked:" + b.Fingerprint
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, parkedKey, fmt.Sprintf("%d:%d", b.H32, b.Low))
+		if r.b.TTL > 0 {
+			pipe.PExpire(ctx, parkedKey, r.b.TTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// Unpark pops a block from the list Park pushes to. LPOP hands every block to one generator
+// only.
+func (r *renewer) Unpark(ctx context.Context, fingerprint string) (internal.ParkedBlock, bool, error) {
+	client, autoClose, err := r.b.NewClient()
+	if err != nil {
+		return internal.ParkedBlock{}, false, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	v, err := client.LPop(ctx, r.w.w.KeyPrefix+r.b.Key+":parked:"+fingerprint).Result()
+	if errors.Is(err, redis.Nil) {
+		return internal.ParkedBlock{}, false, nil
+	}
+	if err != nil {
+		return internal.ParkedBlock{}, false, err
+	}
+	b := internal.ParkedBlock{Fingerprint: fingerprint}
+	if _, err := fmt.Sscanf(v, "%d:%d", &b.H32, &b.Low); err != nil {
+		return internal.ParkedBlock{}, false, fmt.Errorf("invalid parked block %q: %w", v, err)
+	}
+	return b, true, nil
+}
+
+// fetchh32FromRedis adds 1, or b.BlockSize, to the number at b.Key and returns its new value.
+func (w *WUID) fetchh32FromRedis(ctx context.Context, b Backend) (h32 int64, err error) {
+	fullKey := w.w.KeyPrefix + b.Key
+	span := w.w.StartLoadSpan("redis", fullKey)
+	defer func() {
+		span.End(err)
+	}()
+
+	client, autoClose, err := b.NewClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	n := blockSize(b)
+	switch {
+	case b.Coordinator != nil:
+		h32, err = b.Coordinator.incr(ctx, fullKey, n, b.TTL)
+	case b.TTL > 0:
+		var incr *redis.IntCmd
+		_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			incr = pipe.IncrBy(ctx, fullKey, n)
+			pipe.PExpire(ctx, fullKey, b.TTL)
+			return nil
+		})
+		h32 = incr.Val()
+	default:
+		h32, err = client.IncrBy(ctx, fullKey, n).Result()
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.recordOwner(ctx, client, fullKey, h32-n+1, h32)
+	if b.Announce {
+		w.announce(ctx, client, fullKey, h32)
+	}
+	return h32, nil
+}
+
+type incrResult struct {
+	h32 int64
+	err error
+}
+
+// blockSize returns the number of h32 values a load reserves from b.
+func blockSize(b Backend) int64 {
+	if b.BlockSize > 1 {
+		return b.BlockSize
+	}
+	return 1
+}
+
+type incrRequest struct {
+	ctx     context.Context
+	fullKey string
+	n       int64
+	ttl     time.Duration
+	result  chan incrResult
+}
+
+// RenewCoordinator batches the loads of the generators sharing a Redis, so that hundreds of
+// renewals cost a handful of round trips. Pass it to LoadHighBits in Backend.Coordinator.
+type RenewCoordinator struct {
+	newClient NewClient
+	interval  time.Duration
+	mu        sync.Mutex
+	pending   []*incrRequest
+}
+
+// NewRenewCoordinator creates a RenewCoordinator, which waits for at most interval to gather
+// the loads of the generators, and then sends them to Redis in one pipeline. interval is added
+// to the latency of every load, so it should be far below the renewal timeout, e.g. 10ms.
+func NewRenewCoordinator(newClient NewClient, interval time.Duration) *RenewCoordinator {
+	if newClient == nil {
+		panic("newClient cannot be nil")
+	}
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+	return &RenewCoordinator{newClient: newClient, interval: interval}
+}
+
+func (c *RenewCoordinator) incr(ctx context.Context, fullKey string, n int64, ttl time.Duration) (int64, error) {
+	req := &incrRequest{ctx: ctx, fullKey: fullKey, n: n, ttl: ttl, result: make(chan incrResult, 1)}
+	c.mu.Lock()
+	c.pending = append(c.pending, req)
+	if len(c.pending) == 1 {
+		time.AfterFunc(c.interval, c.flush)
+	}
+	c.mu.Unlock()
+
+	select {
+	case r := <-req.result:
+		return r.h32, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (c *RenewCoordinator) flush() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	// The loads that gave up while waiting are left out, so that they do not waste an h32.
+	batch := pending[:0]
+	for _, req := range pending {
+		if err := req.ctx.Err(); err != nil {
+			req.result <- incrResult{err: err}
+			continue
+		}
+		batch = append(batch, req)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	client, autoClose, err := c.newClient()
+	if err != nil {
+		for _, req := range batch {
+			req.result <- incrResult{err: err}
+		}
+		return
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	ctx1, cancel1 := batchContext(batch)
+	defer cancel1()
+	cmds := make([]*redis.IntCmd, len(batch))
+	// The errors are reported by the commands one by one.
+	_, _ = client.Pipelined(ctx1, func(p redis.Pipeliner) error {
+		for i, req := range batch {
+			cmds[i] = p.IncrBy(ctx1, req.fullKey, req.n)
+			if req.ttl > 0 {
+				p.PExpire(ctx1, req.fullKey, req.ttl)
+			}
+		}
+		return nil
+	})
+	for i, req := range batch {
+		h32, err := cmds[i].Result()
+		req.result <- incrResult{h32: h32, err: err}
+	}
+}
+
+// batchContext returns the context of the pipeline serving batch, which is done once the
+// contexts of all the loads are, i.e. when the longest renew timeout among them expires or
+// every one of them is cancelled. A load giving up early does not fail the others.
+func batchContext(batch []*incrRequest) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, req := range batch {
+			select {
+			case <-req.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// recordOwner saves the fingerprint of the process as the owner of the h32 from first to last
+// at fullKey:owners if WithInstanceFingerprint is used. A failure is logged but does not fail
+// the load.
+func (w *WUID) recordOwner(ctx context.Context, client redis.UniversalClient, fullKey string, first, last int64) {
+	fp, ok := w.w.Fingerprint()
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(fp)
+	if err == nil {
+		values := make([]interface{}, 0, 2*(last-first+1))
+		for h32 := first; h32 <= last; h32++ {
+			values = append(values, strconv.FormatInt(h32, 10), data)
+		}
+		err = client.HSet(ctx, fullKey+":owners", values...).Err()
+	}
+	if err != nil {
+		w.w.Warnf("<wuid> failed to record the owner of h32. name: %s, h32: %d, reason: %s", w.w.Name, last, err)
+	}
+}
+
+// WhoOwns returns the fingerprint of the process that allocated h32 from key, which was
+// recorded with WithInstanceFingerprint. key must include the prefix set by
+// WithRedisKeyPrefix, if any. It returns wuiderr.ErrOwnerUnknown if nothing is recorded. The
+// call is bound to DefaultRenewTimeout.
+func WhoOwns(newClient NewClient, key string, h32 int64) (Fingerprint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), internal.DefaultRenewTimeout)
+	defer cancel()
+	return WhoOwnsContext(ctx, newClient, key, h32)
+}
+
+// WhoOwnsContext is like WhoOwns but bound to ctx instead of DefaultRenewTimeout.
+func WhoOwnsContext(ctx context.Context, newClient NewClient, key string, h32 int64) (Fingerprint, error) {
+	if len(key) == 0 {
+		return Fingerprint{}, errors.New("key cannot be empty")
+	}
+	client, autoClose, err := newClient()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	data, err := client.HGet(ctx, key+":owners", strconv.FormatInt(h32, 10)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Fingerprint{}, fmt.Errorf("%w: %d", wuiderr.ErrOwnerUnknown, h32)
+	}
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	var fp Fingerprint
+	if err := json.Unmarshal(data, &fp); err != nil {
+		return Fingerprint{}, err
+	}
+	return fp, nil
+}
+
+var raiseTo = redis.NewScript(`
+local v = tonumber(redis.call('GET', KEYS[1]) or '0')
+if v < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// RecoverFromMirror raises the number in Redis to the h32 saved in the mirror set by
+// WithMirror, unless it is greater already, and then loads h32 like Loadh32FromRedis. Use it
+// to bootstrap a Redis that lost the number in a disaster.
+func (w *WUID) RecoverFromMirror(newClient NewClient, key string) error {
 	if len(key) == 0 {
 		return errors.New("key cannot be empty")
 	}
+	h32, err := w.w.LoadMirror()
+	if err != nil {
+		return fmt.Errorf("failed to load h32 from the mirror: %w", err)
+	}
 
 	client, autoClose, err := newClient()
 	if err != nil {
@@ -45,55 +520,395 @@ func (w *WUID) Loadh32FromRedis(newClient NewClient, key string) error {
 		}
 	}()
 
-	ctx1, cancel1 := context.WithTimeout(context.Background(), time.Second*5)
+	ctx1, cancel1 := context.WithTimeout(context.Background(), w.w.RenewTimeout())
 	defer cancel1()
-	h32, err := client.Incr(ctx1, key).Result()
-	if err != nil {
+	if err := raiseTo.Run(ctx1, client, []string{w.w.KeyPrefix + key}, h32).Err(); err != nil {
 		return err
 	}
-	if err = w.w.Verifyh32(h32); err != nil {
+	w.w.Warnf("<wuid> the number in Redis is recovered from the mirror. name: %s, h32: %d", w.w.Name, h32)
+	return w.loadh32FromRedis(context.Background(), Backend{NewClient: newClient, Key: key})
+}
+
+var migrate = redis.NewScript(`
+local v = tonumber(redis.call('GET', KEYS[1]) or '0') + tonumber(ARGV[1])
+local w = tonumber(redis.call('GET', KEYS[2]) or '0')
+if w < v then
+	redis.call('SET', KEYS[2], v)
+	return v
+end
+return w
+`)
+
+// MigrateKey atomically copies the number at oldKey to newKey, adding margin to it, so that
+// the generators still loading from oldKey during the migration get no h32 that those
+// loading from newKey will get. newKey is left as is if it holds a greater number already.
+// It returns the number at newKey. oldKey is not deleted. In a Redis Cluster, the two keys
+// must be in the same hash slot, e.g. by sharing a hash tag. The call is bound to
+// DefaultRenewTimeout.
+func MigrateKey(newClient NewClient, oldKey, newKey string, margin int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), internal.DefaultRenewTimeout)
+	defer cancel()
+	return MigrateKeyContext(ctx, newClient, oldKey, newKey, margin)
+}
+
+// MigrateKeyContext is like MigrateKey but bound to ctx instead of DefaultRenewTimeout.
+func MigrateKeyContext(ctx context.Context, newClient NewClient, oldKey, newKey string, margin int64) (int64, error) {
+	if len(oldKey) == 0 || len(newKey) == 0 {
+		return 0, errors.New("key cannot be empty")
+	}
+	if oldKey == newKey {
+		return 0, errors.New("oldKey and newKey cannot be the same")
+	}
+	if margin < 0 {
+		return 0, errors.New("margin cannot be negative")
+	}
+
+	client, autoClose, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	return migrate.Run(ctx, client, []string{oldKey, newKey}, margin).Int64()
+}
+
+type sequenceAllocator struct {
+	newClient NewClient
+	prefix    string
+}
+
+// NewSequenceAllocator creates a SequenceAllocator in Redis to be passed to
+// WithSequenceAllocator. The sequence of a key is stored at prefix:key.
+func NewSequenceAllocator(newClient NewClient, prefix string) SequenceAllocator {
+	if newClient == nil {
+		panic("newClient cannot be nil")
+	}
+	if prefix == "" {
+		panic("prefix cannot be empty")
+	}
+	return &sequenceAllocator{newClient: newClient, prefix: prefix}
+}
+
+func (a *sequenceAllocator) Allocate(ctx context.Context, key string, n int64) (int64, error) {
+	client, autoClose, err := a.newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	return client.IncrBy(ctx, a.prefix+":"+key, n).Result()
+}
+
+var claim = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'NX')
+return redis.call('GET', KEYS[1])
+`)
+
+type registry struct {
+	newClient NewClient
+	prefix    string
+}
+
+// NewRegistry creates a Registry in Redis to be passed to WithRegistry. An h32 of a section is
+// recorded at prefix:section:h32.
+func NewRegistry(newClient NewClient, prefix string) Registry {
+	if newClient == nil {
+		panic("newClient cannot be nil")
+	}
+	if prefix == "" {
+		panic("prefix cannot be empty")
+	}
+	return &registry{newClient: newClient, prefix: prefix}
+}
+
+func (r *registry) Claim(ctx context.Context, section int8, h32 int64, owner string) (string, error) {
+	client, autoClose, err := r.newClient()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	key := fmt.Sprintf("%s:%d:%d", r.prefix, section, h32)
+	return claim.Run(ctx, client, []string{key}, owner).Text()
+}
+
+var acquireLease = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v or v == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return ARGV[1]
+end
+return v
+`)
+
+var releaseLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type lease struct {
+	newClient NewClient
+	key       string
+}
+
+// NewLease creates a leader.Lease held at key in Redis, which elects the instance
+// incrementing the key for the whole fleet. See Backend.Election.
+func NewLease(newClient NewClient, key string) leader.Lease {
+	if newClient == nil {
+		panic("newClient cannot be nil")
+	}
+	if key == "" {
+		panic("key cannot be empty")
+	}
+	return &lease{newClient: newClient, key: key}
+}
+
+func (l *lease) Acquire(ctx context.Context, holder string, ttl time.Duration) (string, error) {
+	client, autoClose, err := l.newClient()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	return acquireLease.Run(ctx, client, []string{l.key}, holder, ttl.Milliseconds()).Text()
+}
+
+func (l *lease) Release(ctx context.Context, holder string) error {
+	client, autoClose, err := l.newClient()
+	if err != nil {
 		return err
 	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+	return releaseLease.Run(ctx, client, []string{l.key}, holder).Err()
+}
+
+// Loadh32FromRedisGroup is like Loadh32FromRedis, but loads the high 28 bits of several
+// generators, keyed by their keys in Redis, in one MULTI/EXEC. With a Redis cluster, all the
+// keys must be in the same hash slot, which WithRedisKeyPrefix(prefix, true) guarantees.
+// Afterwards, each generator renews on its own.
+func Loadh32FromRedisGroup(newClient NewClient, group map[string]*WUID) error {
+	return Loadh32FromRedisGroupContext(context.Background(), newClient, group)
+}
 
-	w.w.Reset(h32 << 32)
-	w.w.Logger.Infof("<wuid> new h32: %d. name: %s", h32, w.w.Name)
+// Loadh32FromRedisGroupContext is like Loadh32FromRedisGroup but the load is bound to ctx as
+// well.
+func Loadh32FromRedisGroupContext(ctx context.Context, newClient NewClient, group map[string]*WUID) error {
+	return LoadGroupFromRedis(ctx, Backend{NewClient: newClient}, group)
+}
 
-	w.w.Lock()
-	defer w.w.Unlock()
+// LoadGroupFromRedis is like Loadh32FromRedisGroupContext, but b sets up every key of group
+// just like LoadHighBits does, i.e. its TTL, Announce, Coordinator and BlockSize, which batches the
+// renewals. b.Key must be empty. If a generator fails to load, the ones loaded before it are
+// stopped, and none of group should be used.
+func LoadGroupFromRedis(ctx context.Context, b Backend, group map[string]*WUID) error {
+	return loadGroup(ctx, b, group, true)
+}
 
-	if w.w.Renew != nil {
+// LoadManyFromRedis creates a generator for each key, named after the key, and loads their
+// high 28 bits in one round trip, which speeds up the startup of the services with many
+// generators. Unlike Loadh32FromRedisGroup, the keys can be in different hash slots.
+func LoadManyFromRedis(newClient NewClient, keys []string, logger Logger, opts ...Option) (map[string]*WUID, error) {
+	return LoadManyFromRedisContext(context.Background(), newClient, keys, logger, opts...)
+}
+
+// LoadManyFromRedisContext is like LoadManyFromRedis but the load is bound to ctx as well.
+func LoadManyFromRedisContext(ctx context.Context, newClient NewClient, keys []string, logger Logger, opts ...Option) (map[string]*WUID, error) {
+	return LoadManyWithBackend(ctx, Backend{NewClient: newClient}, keys, logger, opts...)
+}
+
+// LoadManyWithBackend is like LoadManyFromRedisContext, but b sets up every key just like
+// LoadHighBits does, i.e. its TTL, Announce, Coordinator and BlockSize. b.Key must be empty. It returns
+// either all the generators or none: if one fails to load, the ones loaded before it are
+// stopped.
+func LoadManyWithBackend(ctx context.Context, b Backend, keys []string, logger Logger, opts ...Option) (map[string]*WUID, error) {
+	group := make(map[string]*WUID, len(keys))
+	for _, key := range keys {
+		if _, ok := group[key]; ok {
+			return nil, fmt.Errorf("duplicate key: %s", key)
+		}
+		group[key] = NewWUID(key, logger, opts...)
+	}
+	if err := loadGroup(ctx, b, group, false); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// loadGroup increases the keys of group in a pipeline, which is wrapped in MULTI/EXEC if tx
+// is true. Every key is set up with b, whose Key is replaced.
+func loadGroup(ctx context.Context, b Backend, group map[string]*WUID, tx bool) error {
+	if len(group) == 0 {
 		return nil
 	}
-	w.w.Renew = func() error {
-		return w.Loadh32FromRedis(newClient, key)
+	if b.NewClient == nil {
+		return errors.New("newClient cannot be nil")
+	}
+	if len(b.Key) != 0 {
+		return errors.New("the key of the backend must be empty, the keys of the group are used instead")
+	}
+	if b.TTL < 0 {
+		return errors.New("ttl cannot be negative")
+	}
+	if b.BlockSize < 0 {
+		return errors.New("the block size cannot be negative")
+	}
+	keys := make([]string, 0, len(group))
+	for key := range group {
+		if len(key) == 0 {
+			return errors.New("key cannot be empty")
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	client, autoClose, err := b.NewClient()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if autoClose {
+			_ = client.Close()
+		}
+	}()
+
+	if _, ok := client.(*redis.ClusterClient); ok && tx {
+		first := group[keys[0]].w.KeyPrefix + keys[0]
+		for _, key := range keys[1:] {
+			if fullKey := group[key].w.KeyPrefix + key; HashSlot(fullKey) != HashSlot(first) {
+				return fmt.Errorf("%s and %s are in different hash slots, use WithRedisKeyPrefix with a hash tag", first, fullKey)
+			}
+		}
+	}
+
+	ctx1, cancel1 := context.WithTimeout(ctx, group[keys[0]].w.RenewTimeout())
+	defer cancel1()
+	cmds := make([]*redis.IntCmd, len(keys))
+	n := blockSize(b)
+	pipelined := client.Pipelined
+	if tx {
+		pipelined = client.TxPipelined
+	}
+	_, err = pipelined(ctx1, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			fullKey := group[key].w.KeyPrefix + key
+			cmds[i] = p.IncrBy(ctx1, fullKey, n)
+			if b.TTL > 0 {
+				p.PExpire(ctx1, fullKey, b.TTL)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	for i, key := range keys {
+		w, fullKey := group[key], group[key].w.KeyPrefix+key
+		w.recordOwner(ctx1, client, fullKey, cmds[i].Val()-n+1, cmds[i].Val())
+		if b.Announce {
+			w.announce(ctx1, client, fullKey, cmds[i].Val())
+		}
+	}
+	for i, key := range keys {
+		kb := b
+		kb.Key = key
+		w := group[key]
+		// The first h32 of the block is applied, and the renewals take the rest.
+		r, first := w.renewer(kb), cmds[i].Val()-n+1
+		r.setBlock(first+1, cmds[i].Val())
+		err := w.w.Interlock("redis", w.w.KeyPrefix+key)
+		if err == nil {
+			err = w.w.Apply(ctx, first, r)
+		}
+		if err != nil {
+			for _, loaded := range keys[:i] {
+				group[loaded].Stop()
+			}
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if b.Announce {
+			w.watchFleet(ctx, kb)
+		}
+	}
 	return nil
 }
 
-// RenewNow reacquires the high 28 bits immediately.
-func (w *WUID) RenewNow() error {
-	return w.w.RenewNow()
+// HashSlot returns the hash slot of key in a Redis cluster. Only the hash tag is hashed if key
+// has one, e.g. {user}.followers and {user}.following are in the same slot.
+func HashSlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc % 16384)
 }
 
-type Option = internal.Option
-
-// Withh32Verifier adds an extra verifier for the high 28 bits.
-func Withh32Verifier(cb func(h32 int64) error) Option {
-	return internal.Withh32Verifier(cb)
+// Stop stops the background renewal started by WithMaxH32Age, and the subscription to the
+// allocations of the fleet.
+func (w *WUID) Stop() {
+	w.w.Stop()
+	w.fleetMu.Lock()
+	f := w.fleet
+	w.fleetMu.Unlock()
+	if f != nil {
+		f.stop()
+	}
 }
 
-// WithSection brands a section ID on each generated number. A section ID must be in between [0, 7].
-func WithSection(section int8) Option {
-	return internal.WithSection(section)
+// WithRedisKeyPrefix prepends prefix to the keys in Redis. If hashTag is true, prefix is
+// wrapped in braces, e.g. {orders}, so that all the keys with the prefix are in the same hash
+// slot of a Redis cluster, and can be loaded together by Loadh32FromRedisGroup.
+func WithRedisKeyPrefix(prefix string, hashTag bool) Option {
+	if hashTag {
+		if prefix == "" || strings.ContainsAny(prefix, "{}") {
+			panic("a hash tag cannot be empty or contain braces")
+		}
+		prefix = "{" + prefix + "}"
+	}
+	return func(w *internal.WUID) {
+		w.KeyPrefix = prefix
+	}
 }
 
-// WithStep sets the step and the floor for each generated number.
-func WithStep(step int64, floor int64) Option {
-	return internal.WithStep(step, floor)
-}
+// Fingerprint identifies the process that allocated an h32.
+type Fingerprint = internal.Fingerprint
 
-// WithObfuscation enables number obfuscation.
-func WithObfuscation(seed int) Option {
-	return internal.WithObfuscation(seed)
+// WithInstanceFingerprint records the hostname, the pid and the start time of the process
+// alongside each allocation, in a hash at the key followed by ":owners", so that WhoOwns can
+// trace a problematic identifier back to the instance that generated it.
+func WithInstanceFingerprint() Option {
+	return internal.WithInstanceFingerprint()
 }
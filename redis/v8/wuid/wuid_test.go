@@ -1,16 +1,26 @@
 package wuid
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/driftboat/wuid/credentials"
 	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/leader"
+	"github.com/driftboat/wuid/mirror"
+	"github.com/driftboat/wuid/wuiderr"
 	"github.com/edwingeng/slog"
 	"github.com/go-redis/redis/v8"
 )
@@ -88,11 +98,674 @@ func TestWUID_Loadh32FromRedis_Error(t *testing.T) {
 	}
 }
 
+func TestAuthOnConnect(t *testing.T) {
+	// The default user of a server without a password accepts any password.
+	var numCalls int32
+	onConnect := AuthOnConnect("default", func(context.Context) (string, error) {
+		atomic.AddInt32(&numCalls, 1)
+		return "alpha", nil
+	}, 0)
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return redis.NewClient(&redis.Options{Addr: cfg.addrs[0], OnConnect: onConnect}), true, nil
+	}
+	w := NewWUID("alpha", dumb)
+	if err := w.Loadh32FromRedis(newClient, cfg.key); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&numCalls) == 0 {
+		t.Fatal("the password should have been fetched for the new connection")
+	}
+
+	failed := AuthOnConnect("default", func(context.Context) (string, error) {
+		return "", errors.New("beta")
+	}, 0)
+	newFailedClient := func() (redis.UniversalClient, bool, error) {
+		return redis.NewClient(&redis.Options{Addr: cfg.addrs[0], OnConnect: failed}), true, nil
+	}
+	if err := NewWUID("alpha", dumb).Loadh32FromRedis(newFailedClient, cfg.key); err == nil {
+		t.Fatal("the error of the password should have failed the load")
+	}
+}
+
+func TestCredentialsOnConnect(t *testing.T) {
+	c := credentials.NewCache(credentials.Static("default", "alpha"), time.Minute)
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return redis.NewClient(&redis.Options{Addr: cfg.addrs[0], OnConnect: CredentialsOnConnect(c, 1)}), true, nil
+	}
+	w := NewWUID("alpha", dumb)
+	if err := w.Loadh32FromRedis(newClient, cfg.key); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hook selects the database after AUTH.
+	client, _, _ := newClient()
+	defer client.Close()
+	n, err := client.Get(context.Background(), cfg.key).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb := w.CurrentHighBits(); n != hb.Value {
+		t.Fatalf("the counter in the database 1 is %d, while it should be %d", n, hb.Value)
+	}
+}
+
+func TestWithDeterministic(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return nil, true, errors.New("the data source should not be touched")
+	}
+	w := NewWUID("alpha", dumb, WithDeterministic(42))
+	if err := w.LoadHighBits(Backend{NewClient: newClient, Key: "v8:wuid"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v != 42<<32|1 {
+		t.Fatalf("v is %#016x, while it should be %#016x", v, 42<<32|1)
+	}
+}
+
+func TestWithRedisKeyPrefix(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	w := NewWUID("alpha", dumb, WithRedisKeyPrefix("orders", true))
+	if err := w.Loadh32FromRedis(newClient, cfg.key); err != nil {
+		t.Fatal(err)
+	}
+	client := connect()
+	defer client.Close()
+	h32, err := client.Get(context.Background(), "{orders}"+cfg.key).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt64(&w.w.N) >> 32; v != h32 {
+		t.Fatalf("h32 is %d, while it should be %d", v, h32)
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		WithRedisKeyPrefix("{orders}", true)
+		t.Fatal("WithRedisKeyPrefix should have panicked")
+	}()
+}
+
+func TestHashSlot(t *testing.T) {
+	if v := HashSlot("123456789"); v != 12739 {
+		t.Fatalf("HashSlot returned %d, while it should be 12739", v)
+	}
+	if HashSlot("{user1000}.following") != HashSlot("{user1000}.followers") {
+		t.Fatal("the keys with the same hash tag should be in the same slot")
+	}
+	if HashSlot("foo{}{bar}") == HashSlot("bar") {
+		t.Fatal("an empty hash tag should be ignored")
+	}
+}
+
+func TestLoadh32FromRedisGroup(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	group := make(map[string]*WUID)
+	for _, name := range []string{"order", "user", "payment"} {
+		group[cfg.key+":"+name] = NewWUID(name, dumb, WithRedisKeyPrefix("group", true))
+	}
+	if err := Loadh32FromRedisGroup(newClient, group); err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect()
+	defer client.Close()
+	for key, w := range group {
+		h32, err := client.Get(context.Background(), "{group}"+key).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := atomic.LoadInt64(&w.w.N) >> 32; v != h32 {
+			t.Fatalf("h32 is %d, while it should be %d. key: %s", v, h32, key)
+		}
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		if v := atomic.LoadInt64(&w.w.N) >> 32; v != h32+1 {
+			t.Fatalf("h32 is %d, while it should be %d. key: %s", v, h32+1, key)
+		}
+	}
+
+	group[""] = NewWUID("alpha", dumb)
+	if Loadh32FromRedisGroup(newClient, group) == nil {
+		t.Fatal("key is not properly checked")
+	}
+}
+
+func TestLoadManyFromRedis(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	keys := []string{cfg.key + ":order", cfg.key + ":user", cfg.key + ":payment"}
+	m, err := LoadManyFromRedis(newClient, keys, dumb, WithSection(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 {
+		t.Fatalf("len(m) is %d, while it should be 3", len(m))
+	}
+
+	client := connect()
+	defer client.Close()
+	for _, key := range keys {
+		h32, err := client.Get(context.Background(), key).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := atomic.LoadInt64(&m[key].w.N) >> 32 & 0x0FFFFFFF; v != h32 {
+			t.Fatalf("h32 is %d, while it should be %d. key: %s", v, h32, key)
+		}
+		if m[key].w.Name != key {
+			t.Fatalf("the name is %s, while it should be %s", m[key].w.Name, key)
+		}
+		if m[key].Next()>>60 != 1 {
+			t.Fatal("the options should be applied to every generator")
+		}
+	}
+
+	if _, err := LoadManyFromRedis(newClient, []string{"a", "a"}, dumb); err == nil {
+		t.Fatal("duplicate keys are not properly checked")
+	}
+}
+
+func TestLoadManyWithBackend(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	keys := []string{cfg.key + ":many:0", cfg.key + ":many:1"}
+	if err := client.Del(context.Background(), keys...).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManyWithBackend(context.Background(), Backend{NewClient: newClient, TTL: time.Hour}, keys, dumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if ttl := client.PTTL(context.Background(), key).Val(); ttl <= 0 {
+			t.Fatalf("the ttl of %s is %v", key, ttl)
+		}
+		if err := m[key].RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A rejected h32 fails the whole load.
+	reject := WithVerifier(H32VerifierFunc(func(name string, section int64, h32 int64) error {
+		if name == keys[1] {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+	m, err = LoadManyWithBackend(context.Background(), Backend{NewClient: newClient}, keys, dumb, reject)
+	if err == nil || m != nil {
+		t.Fatal("a failed load should return no generator")
+	}
+	if _, err := LoadManyWithBackend(context.Background(), Backend{NewClient: newClient, Key: "x"}, keys, dumb); err == nil {
+		t.Fatal("the key of the backend is not properly checked")
+	}
+}
+
+func TestWUID_RecoverFromMirror(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const key = "v8:wuid:recover"
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := mirror.NewFile(filepath.Join(t.TempDir(), "wuid.h32"))
+	if err := m.Store(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWUID("alpha", dumb, WithMirror(m))
+	if err := w.RecoverFromMirror(newClient, key); err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt64(&w.w.N) >> 32; v != 43 {
+		t.Fatalf("h32 is %d, while it should be 43", v)
+	}
+
+	startTime := time.Now()
+	for {
+		if h32, err := m.Load(context.Background()); err == nil && h32 == 43 {
+			break
+		}
+		if time.Since(startTime) > time.Second*5 {
+			t.Fatal("h32 should have been mirrored")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestBackend_TTL(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const key = "v8:wuid:ttl"
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWUID("alpha", dumb)
+	if err := w.LoadHighBits(Backend{NewClient: newClient, Key: key, TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	ttl, err := client.PTTL(context.Background(), key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("the ttl of the key is %v, while it should be in (0, 1h]", ttl)
+	}
+	if err := w.LoadHighBits(Backend{NewClient: newClient, Key: key, TTL: -1}); err == nil {
+		t.Fatal("a negative ttl should be rejected")
+	}
+}
+
+func TestMigrateKey(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	oldKey, newKey := "{v8:wuid:migrate}:old", "{v8:wuid:migrate}:new"
+	if err := client.Set(context.Background(), oldKey, 42, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Del(context.Background(), newKey).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := MigrateKey(newClient, oldKey, newKey, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 142 {
+		t.Fatalf("MigrateKey returned %d, while it should be 142", v)
+	}
+	if err := client.Set(context.Background(), oldKey, 10, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := MigrateKey(newClient, oldKey, newKey, 100); v != 142 {
+		t.Fatalf("MigrateKey returned %d, while it should keep the greater number 142", v)
+	}
+
+	w := NewWUID("alpha", dumb)
+	if err := w.LoadHighBits(Backend{NewClient: newClient, Key: newKey}); err != nil {
+		t.Fatal(err)
+	}
+	if h32 := w.CurrentHighBits().Value; h32 != 143 {
+		t.Fatalf("h32 is %d, while it should be 143", h32)
+	}
+
+	if _, err := MigrateKey(newClient, oldKey, oldKey, 0); err == nil {
+		t.Fatal("the same keys should be rejected")
+	}
+	if _, err := MigrateKey(newClient, oldKey, newKey, -1); err == nil {
+		t.Fatal("a negative margin should be rejected")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MigrateKeyContext(ctx, newClient, oldKey, newKey, 100); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err is %v, while it should be context.Canceled", err)
+	}
+}
+
+func TestWithInstanceFingerprint(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const key = "v8:wuid:fingerprint"
+	if err := client.Del(context.Background(), key, key+":owners").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWUID("alpha", dumb, WithInstanceFingerprint())
+	if err := w.LoadHighBits(Backend{NewClient: newClient, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := WhoOwns(newClient, key, w.CurrentHighBits().Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.PID != os.Getpid() || fp.StartTime.IsZero() {
+		t.Fatalf("unexpected fingerprint: %+v", fp)
+	}
+	if _, err := WhoOwns(newClient, key, 12345); !errors.Is(err, wuiderr.ErrOwnerUnknown) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrOwnerUnknown", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WhoOwnsContext(ctx, newClient, key, w.CurrentHighBits().Value); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err is %v, while it should be context.Canceled", err)
+	}
+}
+
+func TestBackend_Announce(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const key = "v8:wuid:announce"
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w1, w2 := NewWUID("alpha", dumb), NewWUID("beta", dumb)
+	if _, ok := w1.FleetStats(); ok {
+		t.Fatal("FleetStats should not be available before the load")
+	}
+	for _, w := range []*WUID{w1, w2} {
+		// The subscription must outlive the context of the load.
+		ctx, cancel := context.WithCancel(context.Background())
+		err := w.LoadHighBitsContext(ctx, Backend{NewClient: newClient, Key: key, Announce: true})
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Stop()
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := w2.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats FleetStats
+	for i := 0; i < 100; i++ {
+		stats, _ = w1.FleetStats()
+		if stats.NumAllocations >= 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// w1 subscribed after its own load, and sees the loads of w2 only.
+	if stats.NumAllocations != 4 || stats.NumInstances != 1 || stats.Exhaustion.Current != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Exhaustion.Rate <= 0 || stats.Exhaustion.ETA <= 0 {
+		t.Fatalf("the rate should be known: %+v", stats.Exhaustion)
+	}
+}
+
+func TestRenewCoordinator(t *testing.T) {
+	var numClients int64
+	newClient := func() (redis.UniversalClient, bool, error) {
+		atomic.AddInt64(&numClients, 1)
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	keys := []string{"v8:wuid:coordinated:0", "v8:wuid:coordinated:1", "v8:wuid:coordinated:2"}
+	if err := client.Del(context.Background(), keys...).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewRenewCoordinator(newClient, 20*time.Millisecond)
+	var wg sync.WaitGroup
+	ws := make([]*WUID, 0, len(keys)*2)
+	for _, key := range keys {
+		for i := 0; i < 2; i++ {
+			ws = append(ws, NewWUID(key, dumb))
+		}
+	}
+	for i, w := range ws {
+		wg.Add(1)
+		go func(w *WUID, key string) {
+			defer wg.Done()
+			if err := w.LoadHighBits(Backend{NewClient: newClient, Key: key, TTL: time.Hour, Coordinator: c}); err != nil {
+				t.Error(err)
+			}
+		}(w, keys[i/2])
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for i := 0; i < len(ws); i += 2 {
+		h1, h2 := ws[i].CurrentHighBits().Value, ws[i+1].CurrentHighBits().Value
+		if h1 == h2 || h1+h2 != 3 {
+			t.Fatalf("the generators of %s got h32 %d and %d", keys[i/2], h1, h2)
+		}
+	}
+	// One client for each generator plus one for the batch.
+	if n := atomic.LoadInt64(&numClients); n > int64(len(ws))+2 {
+		t.Fatalf("%d clients were created, while the loads should have been batched", n)
+	}
+	if ttl := client.PTTL(context.Background(), keys[0]).Val(); ttl <= 0 {
+		t.Fatalf("the ttl of the key is %v", ttl)
+	}
+
+	// A load giving up before the flush does not consume an h32.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := c.incr(ctx, keys[0], 1, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err is %v, while it should be context.DeadlineExceeded", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if v := client.Get(context.Background(), keys[0]).Val(); v != "2" {
+		t.Fatalf("the number at %s is %s, while it should still be 2", keys[0], v)
+	}
+}
+
+func TestBackend_BlockSize(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const key = "v8:wuid:block"
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Backend{NewClient: newClient, Key: key, BlockSize: 4}
+	w1, w2 := NewWUID("alpha", dumb), NewWUID("alpha", dumb)
+	if err := w1.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	if h1, h2 := w1.CurrentHighBits().Value, w2.CurrentHighBits().Value; h1 != 1 || h2 != 5 {
+		t.Fatalf("every generator should start at its own block. h1: %d, h2: %d", h1, h2)
+	}
+	for i := int64(2); i <= 5; i++ {
+		if err := w1.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		if h32 := w1.CurrentHighBits().Value; i <= 4 && h32 != i || i == 5 && h32 != 9 {
+			t.Fatalf("the renewals should take the block first. h32: %d", h32)
+		}
+	}
+	if v := client.Get(context.Background(), key).Val(); v != "12" {
+		t.Fatalf("the number at %s is %s, while it should be 12", key, v)
+	}
+
+	b.Key = ""
+	group := map[string]*WUID{key: NewWUID("alpha", dumb)}
+	if err := LoadGroupFromRedis(context.Background(), b, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := group[key].RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if h32 := group[key].CurrentHighBits().Value; h32 != 14 {
+		t.Fatalf("the group should reserve a block as well. h32: %d", h32)
+	}
+}
+
+func TestNewSequenceAllocator(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const prefix = "v8:wuid:seq"
+	if err := client.Del(context.Background(), prefix+":acme").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewSequenceAllocator(newClient, prefix)
+	w1 := NewWUID("alpha", dumb, WithSequenceAllocator(a, 1))
+	w2 := NewWUID("alpha", dumb, WithSequenceAllocator(a, 1))
+	for i := int64(1); i <= 6; i += 2 {
+		v1, err := w1.Sequence("acme").Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := w2.Sequence("acme").Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v1 != i || v2 != i+1 {
+			t.Fatalf("v1: %d, v2: %d, while the sequence should be dense", v1, v2)
+		}
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	keys := []string{"v8:wuid:alpha", "v8:wuid:beta"}
+	for _, key := range keys {
+		if err := client.Set(context.Background(), key, 100, 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const prefix = "v8:wuid:registry"
+	for _, key := range []string{prefix + ":0:101", prefix + ":1:101"} {
+		if err := client.Del(context.Background(), key).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry(newClient, prefix)
+	w1 := NewWUID("alpha", dumb, WithRegistry(r))
+	if err := w1.LoadHighBits(Backend{NewClient: newClient, Key: keys[0]}); err != nil {
+		t.Fatal(err)
+	}
+	w2 := NewWUID("beta", dumb, WithRegistry(r))
+	if err := w2.LoadHighBits(Backend{NewClient: newClient, Key: keys[1]}); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	if err := client.Set(context.Background(), keys[1], 100, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	w3 := NewWUID("beta", dumb, WithRegistry(r), WithSection(1))
+	if err := w3.LoadHighBits(Backend{NewClient: newClient, Key: keys[1]}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackend_Election(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	client := connect()
+	defer client.Close()
+	const leaseKey = "v8:wuid:leader"
+	if err := client.Del(context.Background(), leaseKey).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	lease := NewLease(newClient, leaseKey)
+	var ws [2]*WUID
+	var elections [2]*leader.Election
+	for i := range ws {
+		mux := http.NewServeMux()
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		elections[i] = leader.NewElection(lease, srv.URL)
+		mux.Handle("/", elections[i])
+		ws[i] = NewWUID("alpha", dumb)
+		if err := ws[i].LoadHighBits(Backend{NewClient: newClient, Key: cfg.key, Election: elections[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !elections[0].IsLeader() || elections[1].IsLeader() {
+		t.Fatal("the first instance should lead")
+	}
+	if s := elections[1].Stats(); s.NumForwarded != 1 || s.NumFallbacks != 0 {
+		t.Fatalf("the follower should have got h32 from the leader. stats: %+v", s)
+	}
+	if ws[0].CurrentHighBits().Value+1 != ws[1].CurrentHighBits().Value {
+		t.Fatal("the follower should have got the next h32")
+	}
+
+	if err := elections[0].Resign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := lease.Acquire(context.Background(), "beta", time.Second); err != nil || holder != "beta" {
+		t.Fatalf("the lease should have been released. holder: %s, err: %v", holder, err)
+	}
+}
+
+func TestWUID_ResumePreviousBlock(t *testing.T) {
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return connect(), true, nil
+	}
+	b := Backend{NewClient: newClient, Key: cfg.key}
+	w1 := NewWUID("alpha", dumb, WithResumePreviousBlock())
+	if err := w1.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	last := w1.Next()
+	if err := w1.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w2 := NewWUID("alpha", dumb, WithResumePreviousBlock())
+	if err := w2.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	if w2.CurrentHighBits().Value != w1.CurrentHighBits().Value {
+		t.Fatal("the previous block should have been resumed")
+	}
+	if w2.Next() <= last {
+		t.Fatal("the resumed block should continue above the watermark")
+	}
+
+	w3 := NewWUID("alpha", dumb, WithResumePreviousBlock())
+	if err := w3.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	if w3.CurrentHighBits().Value == w2.CurrentHighBits().Value {
+		t.Fatal("a parked block should be resumed only once")
+	}
+}
+
 func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
 	t.Helper()
 	startTime := time.Now()
 	for time.Since(startTime) < time.Second*3 {
-		if atomic.LoadInt64(&w.w.Stats.NumRenewed) == expected {
+		if w.Stats().NumRenewed == expected {
 			return
 		}
 		time.Sleep(time.Millisecond * 10)
@@ -153,8 +826,8 @@ func TestWUID_Next_Renew(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		w.Next()
 	}
-	if atomic.LoadInt64(&w.w.Stats.NumRenewAttempts) != 3 {
-		t.Fatal(`atomic.LoadInt64(&w.w.Stats.NumRenewAttempts) != 3`)
+	if w.Stats().NumRenewAttempts != 3 {
+		t.Fatal(`w.Stats().NumRenewAttempts != 3`)
 	}
 
 	var num int
@@ -179,7 +852,7 @@ func Example() {
 
 	// Setup
 	w := NewWUID("alpha", nil)
-	err := w.Loadh32FromRedis(newClient, "wuid")
+	err := w.LoadHighBits(Backend{NewClient: newClient, Key: "wuid"})
 	if err != nil {
 		panic(err)
 	}
@@ -1,41 +1,107 @@
 package wuid
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/driftboat/wuid/credentials"
 	"github.com/driftboat/wuid/internal"
-	"github.com/edwingeng/slog"
 	"github.com/go-redis/redis"
 )
 
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
 // WUID is an extremely fast universal unique identifier generator.
 type WUID struct {
 	w *internal.WUID
 }
 
-// NewWUID creates a new WUID instance.
-func NewWUID(name string, logger slog.Logger, opts ...Option) *WUID {
-	return &WUID{w: internal.NewWUID(name, logger, opts...)}
+type NewClient func() (client redis.UniversalClient, autoClose bool, err error)
+
+// CredentialsOnConnect returns an OnConnect hook of the options of go-redis that authenticates
+// every new connection with the credentials of p, so that a long-lived client picks up a
+// rotated password on its next new connection, and then selects the database db. Leave
+// Password and DB of the options empty, because go-redis would use them before the hook, and
+// pass the database in db instead.
+func CredentialsOnConnect(p credentials.Provider, db int) func(cn *redis.Conn) error {
+	if p == nil {
+		panic("p cannot be nil")
+	}
+	return func(cn *redis.Conn) error {
+		ctx, cancel := context.WithTimeout(context.Background(), internal.DefaultRenewTimeout)
+		defer cancel()
+		c, err := p.Credentials(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the credentials: %w", err)
+		}
+		if c.Username == "" {
+			err = cn.Auth(c.Password).Err()
+		} else {
+			// This version of go-redis has no AuthACL.
+			err = cn.Do("AUTH", c.Username, c.Password).Err()
+		}
+		if err != nil || db == 0 {
+			return err
+		}
+		return cn.Select(db).Err()
+	}
 }
 
-// Next returns a unique identifier.
-func (w *WUID) Next() int64 {
-	return w.w.Next()
+// Backend describes the number in Redis to load the high bits from.
+type Backend struct {
+	NewClient NewClient
+	Key       string
 }
 
-type NewClient func() (client redis.UniversalClient, autoClose bool, err error)
+// LoadHighBits adds 1 to the number at b.Key in Redis and fetches its new value. The new
+// value is used as the high bits of all generated numbers. In addition, b is saved for
+// future renewal.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromRedis(ctx, b.NewClient, b.Key)
+}
 
-// Loadh32FromRedis adds 1 to a specific number in Redis and fetches its new value.
-// The new value is used as the high 28 bits of all generated numbers. In addition, all the
-// arguments passed in are saved for future renewal.
+// Loadh32FromRedis is the same as LoadHighBits(Backend{NewClient: newClient, Key: key}).
+//
+// Deprecated: Use LoadHighBits instead.
 func (w *WUID) Loadh32FromRedis(newClient NewClient, key string) error {
+	return w.LoadHighBits(Backend{NewClient: newClient, Key: key})
+}
+
+// loadh32FromRedis implements LoadHighBitsContext.
+func (w *WUID) loadh32FromRedis(ctx context.Context, newClient NewClient, key string) error {
 	if len(key) == 0 {
 		return errors.New("key cannot be empty")
 	}
+	if err := w.w.Interlock("redis", key); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (int64, error) {
+		return w.fetchh32FromRedis(newClient, key)
+	}))
+}
+
+// fetchh32FromRedis adds 1 to the number at key and returns its new value.
+func (w *WUID) fetchh32FromRedis(newClient NewClient, key string) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("redis", key)
+	defer func() {
+		span.End(err)
+	}()
 
 	client, autoClose, err := newClient()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		if autoClose {
@@ -43,53 +109,14 @@ func (w *WUID) Loadh32FromRedis(newClient NewClient, key string) error {
 		}
 	}()
 
-	h32, err := client.Incr(key).Result()
-	if err != nil {
+	err = w.w.CallWithTimeout(func() (err error) {
+		h32, err = client.Incr(key).Result()
 		return err
-	}
-	if err = w.w.Verifyh32(h32); err != nil {
-		return err
-	}
-
-	w.w.Reset(h32 << 32)
-	w.w.Logger.Infof("<wuid> new h32: %d. name: %s", h32, w.w.Name)
-
-	w.w.Lock()
-	defer w.w.Unlock()
-
-	if w.w.Renew != nil {
-		return nil
-	}
-	w.w.Renew = func() error {
-		return w.Loadh32FromRedis(newClient, key)
-	}
-
-	return nil
-}
-
-// RenewNow reacquires the high 28 bits immediately.
-func (w *WUID) RenewNow() error {
-	return w.w.RenewNow()
-}
-
-type Option = internal.Option
-
-// Withh32Verifier adds an extra verifier for the high 28 bits.
-func Withh32Verifier(cb func(h32 int64) error) Option {
-	return internal.Withh32Verifier(cb)
-}
-
-// WithSection brands a section ID on each generated number. A section ID must be in between [0, 7].
-func WithSection(section int8) Option {
-	return internal.WithSection(section)
-}
-
-// WithStep sets the step and the floor for each generated number.
-func WithStep(step int64, floor int64) Option {
-	return internal.WithStep(step, floor)
+	})
+	return h32, err
 }
 
-// WithObfuscation enables number obfuscation.
-func WithObfuscation(seed int) Option {
-	return internal.WithObfuscation(seed)
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
 }
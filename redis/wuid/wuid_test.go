@@ -1,6 +1,7 @@
 package wuid
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/driftboat/wuid/credentials"
 	"github.com/driftboat/wuid/internal"
 	"github.com/edwingeng/slog"
 	"github.com/go-redis/redis"
@@ -92,7 +94,7 @@ func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
 	t.Helper()
 	startTime := time.Now()
 	for time.Since(startTime) < time.Second*3 {
-		if atomic.LoadInt64(&w.w.Stats.NumRenewed) == expected {
+		if w.Stats().NumRenewed == expected {
 			return
 		}
 		time.Sleep(time.Millisecond * 10)
@@ -100,6 +102,38 @@ func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
 	t.Fatal("timeout")
 }
 
+func TestCredentialsOnConnect(t *testing.T) {
+	// The default user of a server without a password accepts any password.
+	onConnect := CredentialsOnConnect(credentials.Static("default", "alpha"), 1)
+	newClient := func() (redis.UniversalClient, bool, error) {
+		return redis.NewClient(&redis.Options{Addr: cfg.addrs[0], OnConnect: onConnect}), true, nil
+	}
+	w := NewWUID("alpha", dumb)
+	if err := w.Loadh32FromRedis(newClient, cfg.key); err != nil {
+		t.Fatal(err)
+	}
+	// The hook selects the database after AUTH.
+	client, _, _ := newClient()
+	defer client.Close()
+	n, err := client.Get(cfg.key).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb := w.CurrentHighBits(); n != hb.Value {
+		t.Fatalf("the counter in the database 1 is %d, while it should be %d", n, hb.Value)
+	}
+
+	failed := CredentialsOnConnect(credentials.ProviderFunc(func(context.Context) (credentials.Credentials, error) {
+		return credentials.Credentials{}, errors.New("beta")
+	}), 0)
+	newFailedClient := func() (redis.UniversalClient, bool, error) {
+		return redis.NewClient(&redis.Options{Addr: cfg.addrs[0], OnConnect: failed}), true, nil
+	}
+	if err := NewWUID("alpha", dumb).Loadh32FromRedis(newFailedClient, cfg.key); err == nil {
+		t.Fatal("the error of the credentials should have failed the load")
+	}
+}
+
 func TestWUID_Next_Renew(t *testing.T) {
 	client := connect()
 	newClient := func() (redis.UniversalClient, bool, error) {
@@ -153,8 +187,8 @@ func TestWUID_Next_Renew(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		w.Next()
 	}
-	if atomic.LoadInt64(&w.w.Stats.NumRenewAttempts) != 3 {
-		t.Fatal(`atomic.LoadInt64(&w.w.Stats.NumRenewAttempts) != 3`)
+	if w.Stats().NumRenewAttempts != 3 {
+		t.Fatal(`w.Stats().NumRenewAttempts != 3`)
 	}
 
 	var num int
@@ -179,7 +213,7 @@ func Example() {
 
 	// Setup
 	w := NewWUID("alpha", nil)
-	err := w.Loadh32FromRedis(newClient, "wuid")
+	err := w.LoadHighBits(Backend{NewClient: newClient, Key: "wuid"})
 	if err != nil {
 		panic(err)
 	}
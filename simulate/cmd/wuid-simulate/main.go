@@ -0,0 +1,63 @@
+// Command wuid-simulate estimates the renewal frequency, the h32 burn rate and the years until
+// the h32 space runs out for a given load. See the simulate package for details.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/driftboat/wuid/simulate"
+)
+
+func main() {
+	var cfg simulate.Config
+	flag.Float64Var(&cfg.QPS, "qps", 1000, "identifiers generated per second by all the instances")
+	flag.IntVar(&cfg.Instances, "instances", 1, "number of the instances sharing the counter")
+	flag.Int64Var(&cfg.Step, "step", 1, "the step of WithStep")
+	flag.Int64Var(&cfg.Floor, "floor", 0, "the floor of WithStep")
+	flag.BoolVar(&cfg.Sectioned, "section", false, "whether WithSection is used")
+	flag.Int64Var(&cfg.CurrentH32, "h32", 0, "the current number in the data source")
+	flag.Float64Var(&cfg.RestartsPerDay, "restarts", 1, "restarts of each instance per day")
+	flag.Int64Var(&cfg.Seed, "seed", 1, "the seed of the sampling")
+	latency := flag.String("latency", "10ms", "the latency of the data source, e.g. 20ms, or 5ms-80ms for a uniform range")
+	flag.Parse()
+
+	l, err := parseLatency(*latency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg.Latency = l
+
+	r, err := simulate.Run(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_ = r.Print(os.Stdout)
+}
+
+func parseLatency(s string) (simulate.Latency, error) {
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		min, err := time.ParseDuration(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		max, err := time.ParseDuration(s[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, fmt.Errorf("invalid latency range: %s", s)
+		}
+		return simulate.Uniform(min, max), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	return simulate.Constant(d), nil
+}
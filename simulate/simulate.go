@@ -0,0 +1,202 @@
+// Package simulate estimates how a WUID configuration behaves under a given load without
+// touching a data source, which helps with the capacity planning: how often the instances
+// renew, how fast the h32 space is burned, and how many years are left until it runs out.
+//
+//	r, err := simulate.Run(simulate.Config{
+//		QPS:       50000,
+//		Instances: 20,
+//		Latency:   simulate.Uniform(5*time.Millisecond, 80*time.Millisecond),
+//	})
+//
+// The same is available from the command line:
+//
+//	go run github.com/driftboat/wuid/simulate/cmd/wuid-simulate -qps 50000 -instances 20 -latency 5ms-80ms
+package simulate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+)
+
+// Latency draws a latency of the data source.
+type Latency func(r *rand.Rand) time.Duration
+
+// Constant returns a Latency that is always d.
+func Constant(d time.Duration) Latency {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// Uniform returns a Latency distributed uniformly in [min, max].
+func Uniform(min, max time.Duration) Latency {
+	if min < 0 || max < min {
+		panic("the range of the latency is invalid")
+	}
+	return func(r *rand.Rand) time.Duration {
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	}
+}
+
+// Samples returns a Latency drawn from the observed latencies, e.g. those exported by the
+// tracing of the loaders.
+func Samples(ds ...time.Duration) Latency {
+	if len(ds) == 0 {
+		panic("ds cannot be empty")
+	}
+	return func(r *rand.Rand) time.Duration {
+		return ds[r.Intn(len(ds))]
+	}
+}
+
+// Config describes the load and the configuration to simulate.
+type Config struct {
+	// QPS is the number of identifiers generated per second by all the instances together.
+	QPS float64
+	// Instances is the number of the instances sharing the counter. The default is 1.
+	Instances int
+	// Step and Floor are the arguments of WithStep. The default step is 1.
+	Step  int64
+	Floor int64
+	// Sectioned indicates that WithSection is used, which widens h32 to 24 bits.
+	Sectioned bool
+	// CurrentH32 is the number in the data source, which has been burned already.
+	CurrentH32 int64
+	// RestartsPerDay is the number of times each instance restarts every day. Every restart
+	// burns an h32.
+	RestartsPerDay float64
+	// Latency is the latency of loading h32 from the data source. The default is 10ms.
+	Latency Latency
+	// Trials is the number of the renewals to sample. The default is 10000.
+	Trials int
+	// Seed seeds the sampling, which makes a report reproducible.
+	Seed int64
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	// IDsPerH32 is the number of identifiers an instance generates with an h32 before it
+	// renews.
+	IDsPerH32 int64
+	// RenewalInterval is the time between two renewals of an instance.
+	RenewalInterval time.Duration
+	// RenewalsPerDay is the number of renewals of all the instances every day.
+	RenewalsPerDay float64
+	// H32PerDay is the number of h32 burned every day, including the restarts.
+	H32PerDay float64
+	// RemainingH32 is the number of h32 left in the data source.
+	RemainingH32 int64
+	// YearsToExhaustion is the estimated time until the h32 space runs out.
+	YearsToExhaustion float64
+	// Headroom is the time an instance can keep generating identifiers after a renewal starts
+	// and before Next panics.
+	Headroom time.Duration
+	// P50Latency and P99Latency are the percentiles of the sampled latencies.
+	P50Latency time.Duration
+	P99Latency time.Duration
+	// PanicRisk is the fraction of the renewals slower than Headroom, which would make Next
+	// panic with wuiderr.ErrLowBitsExhausted.
+	PanicRisk float64
+}
+
+// Run simulates cfg.
+func Run(cfg Config) (Report, error) {
+	if cfg.QPS <= 0 {
+		return Report{}, errors.New("qps must be positive")
+	}
+	if cfg.Instances == 0 {
+		cfg.Instances = 1
+	}
+	if cfg.Instances < 0 {
+		return Report{}, errors.New("instances cannot be negative")
+	}
+	if cfg.Step == 0 {
+		cfg.Step = 1
+	}
+	if cfg.RestartsPerDay < 0 {
+		return Report{}, errors.New("restartsPerDay cannot be negative")
+	}
+	if cfg.Latency == nil {
+		cfg.Latency = Constant(10 * time.Millisecond)
+	}
+	if cfg.Trials == 0 {
+		cfg.Trials = 10000
+	}
+	if cfg.Trials < 0 {
+		return Report{}, errors.New("trials cannot be negative")
+	}
+
+	opt, err := core.TryWithStep(cfg.Step, cfg.Floor)
+	if err != nil {
+		return Report{}, err
+	}
+	opts := []core.Option{opt}
+	if cfg.Sectioned {
+		opts = append(opts, core.WithSection(1))
+	}
+	if err := core.Validate(opts...); err != nil {
+		return Report{}, err
+	}
+	w := core.NewWUID("simulate", nil, opts...)
+	maxH32 := w.MaxH32()
+	if cfg.CurrentH32 < 0 || cfg.CurrentH32 > maxH32 {
+		return Report{}, fmt.Errorf("currentH32 must be in between [0, %d]", maxH32)
+	}
+
+	var r Report
+	perInstance := cfg.QPS / float64(cfg.Instances)
+	critical := w.RenewalThreshold()
+	r.IDsPerH32 = critical / cfg.Step
+	r.RenewalInterval = seconds(float64(r.IDsPerH32) / perInstance)
+	r.RenewalsPerDay = cfg.QPS / float64(r.IDsPerH32) * 86400
+	r.H32PerDay = r.RenewalsPerDay + cfg.RestartsPerDay*float64(cfg.Instances)
+	r.RemainingH32 = maxH32 - cfg.CurrentH32
+	r.YearsToExhaustion = float64(r.RemainingH32) / r.H32PerDay / 365
+	r.Headroom = seconds(float64((core.PanicValue-critical)/cfg.Step) / perInstance)
+
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	samples := make([]time.Duration, cfg.Trials)
+	var numSlow int
+	for i := range samples {
+		samples[i] = cfg.Latency(rnd)
+		if samples[i] > r.Headroom {
+			numSlow++
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	r.P50Latency = samples[len(samples)*50/100]
+	r.P99Latency = samples[len(samples)*99/100]
+	r.PanicRisk = float64(numSlow) / float64(len(samples))
+	return r, nil
+}
+
+func seconds(s float64) time.Duration {
+	if s > float64(1<<63-1)/float64(time.Second) {
+		return 1<<63 - 1
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// Print writes r as a table.
+func (r Report) Print(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "identifiers per h32\t%d\n", r.IDsPerH32)
+	_, _ = fmt.Fprintf(tw, "renewal interval per instance\t%v\n", r.RenewalInterval)
+	_, _ = fmt.Fprintf(tw, "renewals per day\t%.1f\n", r.RenewalsPerDay)
+	_, _ = fmt.Fprintf(tw, "h32 burned per day\t%.1f\n", r.H32PerDay)
+	_, _ = fmt.Fprintf(tw, "remaining h32\t%d\n", r.RemainingH32)
+	_, _ = fmt.Fprintf(tw, "years to exhaustion\t%.1f\n", r.YearsToExhaustion)
+	_, _ = fmt.Fprintf(tw, "renewal headroom\t%v\n", r.Headroom)
+	_, _ = fmt.Fprintf(tw, "latency p50 / p99\t%v / %v\n", r.P50Latency, r.P99Latency)
+	_, _ = fmt.Fprintf(tw, "panic risk per renewal\t%.4f%%\n", r.PanicRisk*100)
+	return tw.Flush()
+}
@@ -0,0 +1,80 @@
+package simulate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+)
+
+func TestRun(t *testing.T) {
+	r, err := Run(Config{
+		QPS:            float64(core.CriticalValue) / 86400 * 4,
+		Instances:      2,
+		RestartsPerDay: 1,
+		CurrentH32:     1000,
+		Latency:        Constant(time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.IDsPerH32 != core.CriticalValue {
+		t.Fatalf("r.IDsPerH32 is %d, while it should be %d", r.IDsPerH32, core.CriticalValue)
+	}
+	if d := r.RenewalInterval - 12*time.Hour; d < -time.Second || d > time.Second {
+		t.Fatalf("r.RenewalInterval is %v, while it should be 12h", r.RenewalInterval)
+	}
+	if r.RenewalsPerDay < 3.99 || r.RenewalsPerDay > 4.01 || r.H32PerDay < 5.99 || r.H32PerDay > 6.01 {
+		t.Fatalf("r.RenewalsPerDay: %v, r.H32PerDay: %v", r.RenewalsPerDay, r.H32PerDay)
+	}
+	if r.RemainingH32 != 0x1FFFFF-1000 {
+		t.Fatalf("r.RemainingH32 is %d, while it should be %d", r.RemainingH32, 0x1FFFFF-1000)
+	}
+	if r.PanicRisk != 0 || r.P99Latency != time.Millisecond {
+		t.Fatalf("r.PanicRisk: %v, r.P99Latency: %v", r.PanicRisk, r.P99Latency)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "years to exhaustion") {
+		t.Fatal("the report is incomplete")
+	}
+}
+
+func TestRun_PanicRisk(t *testing.T) {
+	r, err := Run(Config{
+		QPS:     float64(core.PanicValue - core.CriticalValue),
+		Latency: Uniform(0, 2*time.Second),
+		Seed:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Headroom != time.Second {
+		t.Fatalf("r.Headroom is %v, while it should be 1s", r.Headroom)
+	}
+	if r.PanicRisk < 0.45 || r.PanicRisk > 0.55 {
+		t.Fatalf("r.PanicRisk is %v, while it should be about 0.5", r.PanicRisk)
+	}
+}
+
+func TestRun_Error(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{QPS: 1, Instances: -1},
+		{QPS: 1, Step: 16, Floor: 20},
+		{QPS: 1, CurrentH32: 0x1FFFFF + 1},
+		{QPS: 1, RestartsPerDay: -1},
+	} {
+		if _, err := Run(cfg); err == nil {
+			t.Fatalf("Run should have failed. cfg: %+v", cfg)
+		}
+	}
+	if _, err := Run(Config{QPS: 1, Sectioned: true, CurrentH32: 0x1FFFFF + 1}); err != nil {
+		t.Fatal(err)
+	}
+}
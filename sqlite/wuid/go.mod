@@ -0,0 +1,26 @@
+module github.com/driftboat/wuid/sqlite/wuid
+
+go 1.18
+
+require (
+	github.com/driftboat/wuid v1.5.0
+	github.com/driftboat/wuid/mirror v1.5.0
+	github.com/edwingeng/slog v0.0.0-20221027170832-482f0dfb6247
+	github.com/mattn/go-sqlite3 v1.14.16
+	go.opentelemetry.io/otel/trace v1.11.2
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-redis/redis/v8 v8.11.5 // indirect
+	go.opentelemetry.io/otel v1.11.2 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+)
+
+replace (
+	github.com/driftboat/wuid => ../..
+	github.com/driftboat/wuid/mirror => ../../mirror
+)
@@ -0,0 +1,403 @@
+package wuid
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+//go:generate go run github.com/driftboat/wuid/cmd/wuidgen
+
+// WUID is an extremely fast universal unique identifier generator.
+type WUID struct {
+	w *internal.WUID
+}
+
+type OpenDB func() (db *sql.DB, autoClose bool, err error)
+
+// Backend describes the SQLite table to load the high bits from.
+type Backend struct {
+	OpenDB OpenDB
+	Table  string
+}
+
+// LoadHighBits adds 1 to the number stored in the table b.Table and fetches its new value.
+// The new value is used as the high bits of all generated numbers. In addition, b is saved
+// for future renewal.
+//
+// The number is updated with a single UPSERT ... RETURNING statement, which requires SQLite
+// 3.35.0 or later. If several processes share one database file, set a busy timeout on the
+// connection.
+func (w *WUID) LoadHighBits(b Backend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well, e.g.
+// for the deadline of the startup of a service. Both the initial load and the renewals are
+// bound to the timeout set by WithRenewTimeout.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b Backend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.loadh32FromSqlite(ctx, b.OpenDB, b.Table)
+}
+
+// Loadh32FromSqlite is the same as LoadHighBits(Backend{OpenDB: openDB, Table: table}).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32FromSqlite(openDB OpenDB, table string) error {
+	return w.LoadHighBits(Backend{OpenDB: openDB, Table: table})
+}
+
+// loadh32FromSqlite implements LoadHighBitsContext.
+func (w *WUID) loadh32FromSqlite(ctx context.Context, openDB OpenDB, table string) error {
+	if len(table) == 0 {
+		return errors.New("table cannot be empty")
+	}
+	if _, ok := w.w.Fingerprint(); ok && w.w.AuditTable == "" {
+		return errors.New("WithInstanceFingerprint requires WithAuditTable")
+	}
+	if err := w.w.Interlock("sqlite", table); err != nil {
+		return err
+	}
+
+	return w.w.Load(ctx, w.renewer(openDB, table))
+}
+
+// renewer returns the Renewer fetching h32 from table.
+func (w *WUID) renewer(openDB OpenDB, table string) internal.Renewer {
+	return &renewer{w: w, openDB: openDB, table: table}
+}
+
+// renewer fetches h32 from table, and raises the number in table past the reserved ranges.
+type renewer struct {
+	w      *WUID
+	openDB OpenDB
+	table  string
+}
+
+func (r *renewer) Renew(ctx context.Context) (int64, error) {
+	return r.w.fetchh32FromSqlite(ctx, r.openDB, r.table)
+}
+
+func (r *renewer) Raise(ctx context.Context, h32 int64) error {
+	db, autoClose, err := r.openDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+	_, err = db.ExecContext(ctx, raiseQuery(r.table), h32)
+	return err
+}
+
+func raiseQuery(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (x, h) VALUES (0, ?) ON CONFLICT (x) DO UPDATE SET h = MAX(h, excluded.h)", table)
+}
+
+// fetchh32FromSqlite adds 1 to the number in table and returns its new value.
+func (w *WUID) fetchh32FromSqlite(ctx context.Context, openDB OpenDB, table string) (h32 int64, err error) {
+	span := w.w.StartLoadSpan("sqlite", table)
+	defer func() {
+		span.End(err)
+	}()
+
+	db, autoClose, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	return w.incr(ctx, db, table)
+}
+
+func incrQuery(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (x, h) VALUES (0, 1) ON CONFLICT (x) DO UPDATE SET h = h + 1 RETURNING h", table)
+}
+
+// incr adds 1 to the number in table and returns its new value. With WithAuditTable, the
+// allocation is recorded in the same transaction.
+func (w *WUID) incr(ctx context.Context, db *sql.DB, table string) (h32 int64, err error) {
+	if w.w.AuditTable == "" {
+		err = db.QueryRowContext(ctx, incrQuery(table)).Scan(&h32)
+		return h32, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err = tx.QueryRowContext(ctx, incrQuery(table)).Scan(&h32); err != nil {
+		return 0, err
+	}
+	if err = w.audit(ctx, tx, h32); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return h32, nil
+}
+
+// audit records the allocation of h32 in the table set by WithAuditTable. With
+// WithInstanceFingerprint, the start time of the process is recorded as well.
+func (w *WUID) audit(ctx context.Context, tx *sql.Tx, h32 int64) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var err error
+	if fp, ok := w.w.Fingerprint(); ok {
+		query := fmt.Sprintf("INSERT INTO %s (h, name, hostname, pid, allocated_at, started_at) VALUES (?, ?, ?, ?, ?, ?)", w.w.AuditTable)
+		_, err = tx.ExecContext(ctx, query, h32, w.w.Name, fp.Host, fp.PID, now, fp.StartTime.UTC().Format(time.RFC3339Nano))
+	} else {
+		hostname, _ := os.Hostname()
+		query := fmt.Sprintf("INSERT INTO %s (h, name, hostname, pid, allocated_at) VALUES (?, ?, ?, ?, ?)", w.w.AuditTable)
+		_, err = tx.ExecContext(ctx, query, h32, w.w.Name, hostname, os.Getpid(), now)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the allocation in the audit table: %w", err)
+	}
+	return nil
+}
+
+// RecoverFromMirror raises the number in the SQLite table to the h32 saved in the mirror set
+// by WithMirror, unless it is greater already, and then loads h32 like Loadh32FromSqlite. Use
+// it to bootstrap a database that lost the number in a disaster.
+func (w *WUID) RecoverFromMirror(openDB OpenDB, table string) error {
+	if len(table) == 0 {
+		return errors.New("table cannot be empty")
+	}
+	h32, err := w.w.LoadMirror()
+	if err != nil {
+		return fmt.Errorf("failed to load h32 from the mirror: %w", err)
+	}
+
+	db, autoClose, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	ctx1, cancel1 := context.WithTimeout(context.Background(), w.w.RenewTimeout())
+	defer cancel1()
+	if _, err := db.ExecContext(ctx1, raiseQuery(table), h32); err != nil {
+		return err
+	}
+	w.w.Warnf("<wuid> the number in SQLite is recovered from the mirror. name: %s, h32: %d", w.w.Name, h32)
+	return w.loadh32FromSqlite(context.Background(), openDB, table)
+}
+
+type sequenceAllocator struct {
+	openDB OpenDB
+	table  string
+}
+
+// NewSequenceAllocator creates a SequenceAllocator in a SQLite table to be passed to
+// WithSequenceAllocator. See the README for the definition of the table.
+func NewSequenceAllocator(openDB OpenDB, table string) SequenceAllocator {
+	if openDB == nil {
+		panic("openDB cannot be nil")
+	}
+	if table == "" {
+		panic("table cannot be empty")
+	}
+	return &sequenceAllocator{openDB: openDB, table: table}
+}
+
+func (a *sequenceAllocator) Allocate(ctx context.Context, key string, n int64) (last int64, err error) {
+	db, autoClose, err := a.openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	query := fmt.Sprintf("INSERT INTO %s (k, n) VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET n = n + excluded.n RETURNING n", a.table)
+	err = db.QueryRowContext(ctx, query, key, n).Scan(&last)
+	return last, err
+}
+
+type registry struct {
+	openDB OpenDB
+	table  string
+}
+
+// NewRegistry creates a Registry in a SQLite table to be passed to WithRegistry. See the README
+// for the definition of the table.
+func NewRegistry(openDB OpenDB, table string) Registry {
+	if openDB == nil {
+		panic("openDB cannot be nil")
+	}
+	if table == "" {
+		panic("table cannot be empty")
+	}
+	return &registry{openDB: openDB, table: table}
+}
+
+func (r *registry) Claim(ctx context.Context, section int8, h32 int64, owner string) (claimedBy string, err error) {
+	db, autoClose, err := r.openDB()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	query := fmt.Sprintf("INSERT INTO %s (section, h, owner) VALUES (?, ?, ?) ON CONFLICT (section, h) DO UPDATE SET owner = owner RETURNING owner", r.table)
+	err = db.QueryRowContext(ctx, query, section, h32, owner).Scan(&claimedBy)
+	return claimedBy, err
+}
+
+// LoadManyFromSqlite creates a generator for each table, named after the table, and loads their
+// high 28 bits in a single transaction, which speeds up the startup of the services with many
+// generators. Afterwards, each generator renews on its own.
+func LoadManyFromSqlite(openDB OpenDB, tables []string, logger Logger, opts ...Option) (map[string]*WUID, error) {
+	return LoadManyFromSqliteContext(context.Background(), openDB, tables, logger, opts...)
+}
+
+// LoadManyFromSqliteContext is like LoadManyFromSqlite but the load is bound to ctx as well.
+func LoadManyFromSqliteContext(ctx context.Context, openDB OpenDB, tables []string, logger Logger, opts ...Option) (m map[string]*WUID, err error) {
+	m = make(map[string]*WUID, len(tables))
+	for _, table := range tables {
+		if len(table) == 0 {
+			return nil, errors.New("table cannot be empty")
+		}
+		if _, ok := m[table]; ok {
+			return nil, fmt.Errorf("duplicate table: %s", table)
+		}
+		m[table] = NewWUID(table, logger, opts...)
+	}
+	if len(tables) == 0 {
+		return m, nil
+	}
+
+	db, autoClose, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	ctx1, cancel1 := context.WithTimeout(ctx, m[tables[0]].w.RenewTimeout())
+	defer cancel1()
+	tx, err := db.BeginTx(ctx1, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	h32s := make([]int64, len(tables))
+	for i, table := range tables {
+		if err = tx.QueryRowContext(ctx1, incrQuery(table)).Scan(&h32s[i]); err != nil {
+			return nil, err
+		}
+		if m[table].w.AuditTable != "" {
+			if err = m[table].audit(ctx1, tx, h32s[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i, table := range tables {
+		if err = m[table].w.Apply(ctx, h32s[i], m[table].renewer(openDB, table)); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return m, nil
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
+
+// WithAuditTable records every allocation of h32 in the append-only table name, together
+// with the time, the hostname, the pid and the name of the generator, in the same transaction
+// as the allocation. See the README for the definition of the table.
+func WithAuditTable(name string) Option {
+	if name == "" {
+		panic("name cannot be empty")
+	}
+	return func(w *internal.WUID) {
+		w.AuditTable = name
+	}
+}
+
+// WhoOwns returns the fingerprint of the process that allocated h32 to the generator name,
+// which was recorded in auditTable with WithAuditTable and WithInstanceFingerprint. It returns
+// wuiderr.ErrOwnerUnknown if nothing is recorded.
+func WhoOwns(openDB OpenDB, auditTable, name string, h32 int64) (Fingerprint, error) {
+	if len(auditTable) == 0 {
+		return Fingerprint{}, errors.New("auditTable cannot be empty")
+	}
+	db, autoClose, err := openDB()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	defer func() {
+		if autoClose {
+			_ = db.Close()
+		}
+	}()
+
+	var fp Fingerprint
+	var startedAt sql.NullString
+	query := fmt.Sprintf("SELECT hostname, pid, started_at FROM %s WHERE h = ? AND name = ? ORDER BY allocated_at DESC LIMIT 1", auditTable)
+	err = db.QueryRow(query, h32, name).Scan(&fp.Host, &fp.PID, &startedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Fingerprint{}, fmt.Errorf("%w: %d", wuiderr.ErrOwnerUnknown, h32)
+	}
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	if startedAt.Valid {
+		if fp.StartTime, err = time.Parse(time.RFC3339Nano, startedAt.String); err != nil {
+			return Fingerprint{}, err
+		}
+	}
+	return fp, nil
+}
+
+// Fingerprint identifies the process that allocated an h32.
+type Fingerprint = internal.Fingerprint
+
+// WithInstanceFingerprint records the start time of the process in the table set by
+// WithAuditTable, in addition to the hostname and the pid, so that WhoOwns can trace a
+// problematic identifier back to the instance that generated it. It requires WithAuditTable.
+func WithInstanceFingerprint() Option {
+	return internal.WithInstanceFingerprint()
+}
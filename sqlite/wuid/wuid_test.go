@@ -0,0 +1,440 @@
+package wuid
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/mirror"
+	"github.com/driftboat/wuid/wuiderr"
+	"github.com/edwingeng/slog"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	dumb = slog.NewDumbLogger()
+)
+
+var (
+	cfg struct {
+		table string
+	}
+)
+
+func init() {
+	cfg.table = "wuid"
+}
+
+func connect(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "wuid.db") + "?_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	const ddl = "CREATE TABLE IF NOT EXISTS %s (x INTEGER PRIMARY KEY CHECK (x = 0), h INTEGER NOT NULL)"
+	if _, err := db.Exec(fmt.Sprintf(ddl, cfg.table)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWUID_Loadh32FromSqlite(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	w := NewWUID("alpha", dumb)
+	err := w.Loadh32FromSqlite(openDB, cfg.table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := atomic.LoadInt64(&w.w.N)
+	if initial != 1<<32 {
+		t.Fatalf("w.w.N is %d, while it should be %d", initial, int64(1<<32))
+	}
+	for i := 1; i < 100; i++ {
+		if err := w.RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		expected := ((initial >> 32) + int64(i)) << 32
+		if atomic.LoadInt64(&w.w.N) != expected {
+			t.Fatalf("w.w.N is %d, while it should be %d. i: %d", atomic.LoadInt64(&w.w.N), expected, i)
+		}
+		n := rand.Intn(10)
+		for j := 0; j < n; j++ {
+			w.Next()
+		}
+	}
+
+	w2 := NewWUID("beta", dumb)
+	if err := w2.Loadh32FromSqlite(openDB, cfg.table); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w2.w.N)>>32 != initial>>32+100 {
+		t.Fatal(`atomic.LoadInt64(&w2.w.N)>>32 != initial>>32+100`)
+	}
+}
+
+func TestWUID_Loadh32FromSqlite_Error(t *testing.T) {
+	w := NewWUID("alpha", dumb)
+	if w.Loadh32FromSqlite(nil, "") == nil {
+		t.Fatal("table is not properly checked")
+	}
+
+	openErrorDB := func() (*sql.DB, bool, error) {
+		return nil, true, errors.New("beta")
+	}
+	if w.Loadh32FromSqlite(openErrorDB, "beta") == nil {
+		t.Fatal(`w.Loadh32FromSqlite(openErrorDB, "beta") == nil`)
+	}
+
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	if w.Loadh32FromSqlite(openDB, "beta") == nil {
+		t.Fatal("a missing table is not properly handled")
+	}
+}
+
+func TestLoadManyFromSqlite(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	tables := []string{"wuid_order", "wuid_user", cfg.table}
+	for _, table := range tables[:2] {
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (x INTEGER PRIMARY KEY CHECK (x = 0), h INTEGER NOT NULL)", table)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO wuid_user (x, h) VALUES (0, 41)"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManyFromSqlite(openDB, tables, dumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 {
+		t.Fatalf("len(m) is %d, while it should be 3", len(m))
+	}
+	if v := atomic.LoadInt64(&m["wuid_user"].w.N) >> 32; v != 42 {
+		t.Fatalf("h32 is %d, while it should be 42", v)
+	}
+	for _, table := range tables {
+		if m[table].w.Name != table {
+			t.Fatalf("the name is %s, while it should be %s", m[table].w.Name, table)
+		}
+		h32 := atomic.LoadInt64(&m[table].w.N) >> 32
+		if err := m[table].RenewNow(); err != nil {
+			t.Fatal(err)
+		}
+		if v := atomic.LoadInt64(&m[table].w.N) >> 32; v != h32+1 {
+			t.Fatalf("h32 is %d, while it should be %d. table: %s", v, h32+1, table)
+		}
+	}
+
+	if _, err := LoadManyFromSqlite(openDB, []string{"wuid_order", "wuid_missing"}, dumb); err == nil {
+		t.Fatal("LoadManyFromSqlite should have failed")
+	}
+	var h32 int64
+	if err := db.QueryRow("SELECT h FROM wuid_order").Scan(&h32); err != nil {
+		t.Fatal(err)
+	}
+	if h32 != 2 {
+		t.Fatalf("h is %d, while it should be 2 after the rollback", h32)
+	}
+	if _, err := LoadManyFromSqlite(openDB, []string{"wuid_order", "wuid_order"}, dumb); err == nil {
+		t.Fatal("duplicate tables are not properly checked")
+	}
+}
+
+func TestWUID_RecoverFromMirror(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	m := mirror.NewFile(filepath.Join(t.TempDir(), "wuid.h32"))
+	if err := m.Store(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWUID("alpha", dumb, WithMirror(m))
+	if err := w.RecoverFromMirror(openDB, cfg.table); err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt64(&w.w.N) >> 32; v != 43 {
+		t.Fatalf("h32 is %d, while it should be 43", v)
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET h = 100", cfg.table)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RecoverFromMirror(openDB, cfg.table); err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt64(&w.w.N) >> 32; v != 101 {
+		t.Fatalf("h32 is %d, while it should be 101", v)
+	}
+
+	if NewWUID("alpha", dumb).RecoverFromMirror(openDB, cfg.table) == nil {
+		t.Fatal("RecoverFromMirror should have failed without a mirror")
+	}
+}
+
+func TestWithAuditTable(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	const ddl = "CREATE TABLE wuid_audit (id INTEGER PRIMARY KEY AUTOINCREMENT, h INTEGER NOT NULL, name TEXT NOT NULL, hostname TEXT NOT NULL, pid INTEGER NOT NULL, allocated_at TEXT NOT NULL)"
+	if _, err := db.Exec(ddl); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWUID("alpha", dumb, WithAuditTable("wuid_audit"))
+	for i := 0; i < 2; i++ {
+		if err := w.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := LoadManyFromSqlite(openDB, []string{cfg.table}, dumb, WithAuditTable("wuid_audit")); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT h, name, pid FROM wuid_audit ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var hs []int64
+	for rows.Next() {
+		var h, pid int64
+		var name string
+		if err := rows.Scan(&h, &name, &pid); err != nil {
+			t.Fatal(err)
+		}
+		if pid != int64(os.Getpid()) {
+			t.Fatalf("pid is %d, while it should be %d", pid, os.Getpid())
+		}
+		hs = append(hs, h)
+	}
+	if len(hs) != 3 || hs[0]+1 != hs[1] || hs[1]+1 != hs[2] {
+		t.Fatalf("the allocations recorded are %v", hs)
+	}
+
+	w2 := NewWUID("alpha", dumb, WithAuditTable("no_such_table"))
+	if err := w2.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err == nil {
+		t.Fatal("the allocation should fail without the audit table")
+	}
+}
+
+func TestWithInstanceFingerprint(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	const ddl = "CREATE TABLE wuid_audit (id INTEGER PRIMARY KEY AUTOINCREMENT, h INTEGER NOT NULL, name TEXT NOT NULL, hostname TEXT NOT NULL, pid INTEGER NOT NULL, allocated_at TEXT NOT NULL, started_at TEXT)"
+	if _, err := db.Exec(ddl); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWUID("alpha", dumb, WithInstanceFingerprint())
+	if err := w.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err == nil {
+		t.Fatal("WithInstanceFingerprint should require WithAuditTable")
+	}
+	w = NewWUID("alpha", dumb, WithInstanceFingerprint(), WithAuditTable("wuid_audit"))
+	if err := w.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err != nil {
+		t.Fatal(err)
+	}
+	h32 := w.CurrentHighBits().Value
+	fp, err := WhoOwns(openDB, "wuid_audit", "alpha", h32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.PID != os.Getpid() || fp.StartTime.IsZero() {
+		t.Fatalf("unexpected fingerprint: %+v", fp)
+	}
+	if _, err := WhoOwns(openDB, "wuid_audit", "beta", h32); !errors.Is(err, wuiderr.ErrOwnerUnknown) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrOwnerUnknown", err)
+	}
+}
+
+func TestNewSequenceAllocator(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	if _, err := db.Exec("CREATE TABLE wuid_seq (k TEXT PRIMARY KEY, n INTEGER NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewSequenceAllocator(openDB, "wuid_seq")
+	w1 := NewWUID("alpha", dumb, WithSequenceAllocator(a, 4))
+	w2 := NewWUID("alpha", dumb, WithSequenceAllocator(a, 4))
+	var all []int64
+	for i := 0; i < 10; i++ {
+		for _, w := range []*WUID{w1, w2} {
+			v, err := w.Sequence("acme").Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, v)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("%d is a duplicate", all[i])
+		}
+	}
+	if all[0] != 1 || all[len(all)-1] > 24 {
+		t.Fatalf("the numbers handed out are %v", all)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	const ddl = "CREATE TABLE wuid_registry (section INTEGER NOT NULL, h INTEGER NOT NULL, owner TEXT NOT NULL, PRIMARY KEY (section, h))"
+	if _, err := db.Exec(ddl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE wuid_beta (x INTEGER PRIMARY KEY CHECK (x = 0), h INTEGER NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry(openDB, "wuid_registry")
+	w1 := NewWUID("alpha", dumb, WithRegistry(r))
+	if err := w1.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err != nil {
+		t.Fatal(err)
+	}
+	w2 := NewWUID("beta", dumb, WithRegistry(r))
+	if err := w2.LoadHighBits(Backend{OpenDB: openDB, Table: "wuid_beta"}); !errors.Is(err, wuiderr.ErrInvalidH32) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrInvalidH32", err)
+	}
+	w3 := NewWUID("beta", dumb, WithRegistry(r), WithSection(1))
+	if err := w3.LoadHighBits(Backend{OpenDB: openDB, Table: "wuid_beta"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithReservedH32Ranges(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+	w := NewWUID("alpha", dumb, WithReservedH32Ranges([2]int64{1, 1000}, [2]int64{1002, 1002}))
+	if err := w.LoadHighBits(Backend{OpenDB: openDB, Table: cfg.table}); err != nil {
+		t.Fatal(err)
+	}
+	if h32 := atomic.LoadInt64(&w.w.N) >> 32; h32 != 1001 {
+		t.Fatalf("the reserved range should have been skipped at once. h32: %d", h32)
+	}
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if h32 := atomic.LoadInt64(&w.w.N) >> 32; h32 != 1003 {
+		t.Fatalf("h32 1002 should have been skipped. h32: %d", h32)
+	}
+}
+
+func waitUntilNumRenewedReaches(t *testing.T, w *WUID, expected int64) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if w.Stats().NumRenewed == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestWUID_Next_Renew(t *testing.T) {
+	db := connect(t)
+	openDB := func() (*sql.DB, bool, error) {
+		return db, false, nil
+	}
+
+	w := NewWUID("alpha", slog.NewScavenger())
+	err := w.Loadh32FromSqlite(openDB, cfg.table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h32 := atomic.LoadInt64(&w.w.N) >> 32
+	atomic.StoreInt64(&w.w.N, (h32<<32)|internal.Bye)
+	n1a := w.Next()
+	if n1a>>32 != h32 {
+		t.Fatal(`n1a>>32 != h32`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 1)
+	n1b := w.Next()
+	if n1b != (h32+1)<<32+1 {
+		t.Fatal(`n1b != (h32+1)<<32+1`)
+	}
+
+	atomic.StoreInt64(&w.w.N, ((h32+1)<<32)|internal.Bye)
+	n2a := w.Next()
+	if n2a>>32 != h32+1 {
+		t.Fatal(`n2a>>32 != h32+1`)
+	}
+
+	waitUntilNumRenewedReaches(t, w, 2)
+	n2b := w.Next()
+	if n2b != (h32+2)<<32+1 {
+		t.Fatal(`n2b != (h32+2)<<32+1`)
+	}
+
+	var num int
+	sc := w.w.Logger.(*slog.Scavenger)
+	sc.Filter(func(level, msg string) bool {
+		if level == slog.LevelInfo && strings.Contains(msg, "renew succeeded") {
+			num++
+		}
+		return true
+	})
+	if num != 2 {
+		t.Fatal(`num != 2`)
+	}
+}
+
+func Example() {
+	openDB := func() (*sql.DB, bool, error) {
+		var db *sql.DB
+		// ...
+		return db, true, nil
+	}
+
+	// Setup
+	w := NewWUID("alpha", nil)
+	err := w.LoadHighBits(Backend{OpenDB: openDB, Table: "wuid"})
+	if err != nil {
+		panic(err)
+	}
+
+	// Generate
+	for i := 0; i < 10; i++ {
+		fmt.Printf("%#016x\n", w.Next())
+	}
+}
@@ -0,0 +1,184 @@
+package wuid
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RenewalPool runs the background renewals of many generators with a fixed number of
+// goroutines. Pass its Submit to WithRenewExecutor of an adapter.
+type RenewalPool struct {
+	tasks     chan func()
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRenewalPool creates a RenewalPool with the given number of workers.
+func NewRenewalPool(workers int) *RenewalPool {
+	if workers <= 0 {
+		panic("workers must be positive")
+	}
+	p := &RenewalPool{
+		tasks: make(chan func(), workers*16),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *RenewalPool) work() {
+	for {
+		select {
+		case task := <-p.tasks:
+			task()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Submit queues a task. It never blocks: when the queue is full or the pool is closed, the
+// task runs in a goroutine of its own, so that a renewal is never lost.
+func (p *RenewalPool) Submit(task func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		go task()
+		return
+	}
+	select {
+	case p.tasks <- task:
+	default:
+		go task()
+	}
+}
+
+// Close stops the workers. The tasks still in the queue run in goroutines of their own, like
+// the ones submitted afterwards, because a generator starts no other renewal until its task
+// has run.
+func (p *RenewalPool) Close() {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+		close(p.done)
+		for {
+			select {
+			case task := <-p.tasks:
+				go task()
+			default:
+				return
+			}
+		}
+	})
+}
+
+// TenantBackend creates the generator of a tenant, loading the high bits from key, which is
+// "wuid:" followed by the tenant ID. The generator should run its renewals with submit, e.g.
+// by passing it to WithRenewExecutor.
+type TenantBackend func(key string, submit func(task func())) (WUID, error)
+
+// TenantMux manages an independent generator for each tenant of a multi-tenant service. The
+// generators are created on first use, share a RenewalPool, and are evicted after being idle
+// for a while.
+type TenantMux struct {
+	backend TenantBackend
+	maxIdle time.Duration
+	pool    *RenewalPool
+	m       *lazyMap
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewTenantMux creates a TenantMux whose generators are created by backend and renewed by
+// the given number of workers. A generator unused for maxIdle is evicted, and stopped if it
+// has a Stop method. A maxIdle of 0 disables the eviction. Call Close to release the
+// resources.
+func NewTenantMux(backend TenantBackend, maxIdle time.Duration, workers int) *TenantMux {
+	if backend == nil {
+		panic("backend cannot be nil")
+	}
+	if maxIdle < 0 {
+		panic("maxIdle cannot be negative")
+	}
+	mux := &TenantMux{
+		backend: backend,
+		maxIdle: maxIdle,
+		pool:    NewRenewalPool(workers),
+		done:    make(chan struct{}),
+	}
+	mux.m = newLazyMap(mux.create)
+	if maxIdle > 0 {
+		go mux.evictLoop()
+	}
+	return mux
+}
+
+// Get returns the generator of tenant, creating it if necessary. The creation of a generator
+// only holds up the callers asking for the same tenant. A failed creation is not cached, so the
+// next call tries again.
+func (mux *TenantMux) Get(tenant string) (WUID, error) {
+	return mux.m.get(tenant)
+}
+
+func (mux *TenantMux) create(tenant string) (WUID, error) {
+	w, err := mux.backend("wuid:"+tenant, mux.pool.Submit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the generator of tenant %q: %w", tenant, err)
+	}
+	if w == nil {
+		return nil, fmt.Errorf("the backend returned a nil generator for tenant %q", tenant)
+	}
+	return w, nil
+}
+
+// Next returns a unique identifier of tenant.
+func (mux *TenantMux) Next(tenant string) (int64, error) {
+	w, err := mux.Get(tenant)
+	if err != nil {
+		return 0, err
+	}
+	return w.Next(), nil
+}
+
+// Len returns the number of the generators in use.
+func (mux *TenantMux) Len() int {
+	return mux.m.len()
+}
+
+func (mux *TenantMux) evictLoop() {
+	ticker := time.NewTicker(mux.maxIdle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mux.evict(time.Now().Add(-mux.maxIdle).UnixNano())
+		case <-mux.done:
+			return
+		}
+	}
+}
+
+// evict removes the generators not used since deadline.
+func (mux *TenantMux) evict(deadline int64) {
+	for _, w := range mux.m.evict(deadline) {
+		if s, ok := w.(interface{ Stop() }); ok {
+			s.Stop()
+		}
+	}
+}
+
+// Close evicts all the generators and stops the renewal workers.
+func (mux *TenantMux) Close() {
+	mux.once.Do(func() {
+		close(mux.done)
+		mux.evict(1<<63 - 1)
+		mux.pool.Close()
+	})
+}
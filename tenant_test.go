@@ -0,0 +1,178 @@
+package wuid
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestTenantMux(t *testing.T) {
+	b := wuidtest.NewFakeBackend()
+	var mu sync.Mutex
+	keys := make(map[string]int)
+	foo := errors.New("foo")
+	mux := NewTenantMux(func(key string, submit func(task func())) (WUID, error) {
+		if key == "wuid:bad" {
+			return nil, foo
+		}
+		mu.Lock()
+		keys[key]++
+		mu.Unlock()
+		w := wuidtest.NewWUID(key, nil)
+		if err := w.LoadHighBits(b); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}, time.Hour, 2)
+	defer mux.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, tenant := range []string{"acme", "globex"} {
+				if _, err := mux.Next(tenant); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(keys) != 2 || keys["wuid:acme"] != 1 || keys["wuid:globex"] != 1 {
+		t.Fatalf("the generators created are %v", keys)
+	}
+	if _, err := mux.Get("bad"); !errors.Is(err, foo) {
+		t.Fatalf("err is %v, while it should wrap foo", err)
+	}
+
+	mux.evict(time.Now().Add(time.Minute).UnixNano())
+	if mux.Len() != 0 {
+		t.Fatalf("mux.Len() is %d, while it should be 0 after the eviction", mux.Len())
+	}
+	if _, err := mux.Next("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if keys["wuid:acme"] != 2 {
+		t.Fatal("the evicted generator should have been created again")
+	}
+}
+
+func TestTenantMux_SlowBackend(t *testing.T) {
+	b := wuidtest.NewFakeBackend()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	keys := make(map[string]int)
+	mux := NewTenantMux(func(key string, submit func(task func())) (WUID, error) {
+		mu.Lock()
+		keys[key]++
+		mu.Unlock()
+		if key == "wuid:slow" {
+			<-release
+		}
+		w := wuidtest.NewWUID(key, nil)
+		if err := w.LoadHighBits(b); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}, time.Hour, 2)
+	defer mux.Close()
+	if _, err := mux.Get("acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mux.Next("slow"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// The cached and the other tenants are served while slow is being created.
+	for _, tenant := range []string{"acme", "globex"} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := mux.Next(tenant)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Get(%q) is blocked by the creation of another tenant", tenant)
+		}
+	}
+	close(release)
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if keys["wuid:slow"] != 1 {
+		t.Fatalf("the concurrent callers should share one creation. calls: %d", keys["wuid:slow"])
+	}
+}
+
+func TestRenewalPool(t *testing.T) {
+	p := NewRenewalPool(2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	n := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		p.Submit(func() {
+			defer wg.Done()
+			mu.Lock()
+			n++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	p.Close()
+	wg.Add(1)
+	p.Submit(wg.Done)
+	wg.Wait()
+	if n != 100 {
+		t.Fatalf("n is %d, while it should be 100", n)
+	}
+}
+
+func TestRenewalPool_Close(t *testing.T) {
+	p := NewRenewalPool(1)
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.Submit(func() {
+		defer wg.Done()
+		<-block
+	})
+	// The worker is busy, so the following tasks stay in the queue until Close.
+	var n int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		p.Submit(func() {
+			defer wg.Done()
+			atomic.AddInt64(&n, 1)
+		})
+	}
+	p.Close()
+	close(block)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("%d of the queued tasks ran, while Close should run all of them", atomic.LoadInt64(&n))
+	}
+}
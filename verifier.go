@@ -0,0 +1,117 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+// minH32Refresh is the minimum interval between two fetches of the allocated h32, which keeps
+// a flood of forged identifiers from hammering the backend.
+const minH32Refresh = time.Second
+
+// Verifier checks whether the identifiers could have been generated with a configuration, so
+// that an ingestion pipeline can reject forged ones without asking the generators. It checks
+// the section, the floor, the check digit and the range of h32, and, with an h32 source, that
+// h32 has been allocated by the backend. A Verifier is safe for concurrent use.
+type Verifier struct {
+	w       *core.WUID
+	current func(ctx context.Context) (int64, error)
+
+	mu        sync.Mutex
+	maxH32    int64
+	fetchedAt time.Time
+	fetch     *h32Fetch
+}
+
+// h32Fetch is a call to current shared by the callers of Verify.
+type h32Fetch struct {
+	done   chan struct{}
+	maxH32 int64
+	err    error
+}
+
+// NewVerifier creates a Verifier for the identifiers generated with opts, which are the
+// options of the adapters, e.g. WithSection, WithStep and WithChecksum. current returns the
+// greatest h32 allocated by the backend, e.g. the value of the key in Redis. It is called
+// again only when an identifier carries a greater h32, at most once a second. If current is
+// nil, any h32 up to the maximum is accepted. WithTransform is not supported.
+func NewVerifier(current func(ctx context.Context) (int64, error), opts ...core.Option) (*Verifier, error) {
+	if err := core.Validate(opts...); err != nil {
+		return nil, err
+	}
+	w := core.NewWUID("verifier", nil, opts...)
+	// CheckID fails with an error other than ErrInvalidID only for the configurations it
+	// cannot check at all.
+	if _, err := w.CheckID(1 << 32); err != nil && !errors.Is(err, wuiderr.ErrInvalidID) {
+		return nil, err
+	}
+	return &Verifier{w: w, current: current}, nil
+}
+
+// Verify returns an error wrapping wuiderr.ErrInvalidID if id could not have been generated
+// with the configuration, wuiderr.ErrUnverified if its h32 is beyond the allocation fetched
+// last and another fetch is not allowed yet, or another error if the allocated h32 cannot be
+// fetched. An h32 is rejected only after a fetch made for it. The concurrent callers share a
+// single fetch, which runs without blocking the identifiers already known to be allocated.
+func (v *Verifier) Verify(ctx context.Context, id int64) error {
+	h32, err := v.w.CheckID(id)
+	if err != nil {
+		return err
+	}
+	if v.current == nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	if h32 <= v.maxH32 {
+		v.mu.Unlock()
+		return nil
+	}
+	f := v.fetch
+	if f == nil {
+		if time.Since(v.fetchedAt) < minH32Refresh {
+			v.mu.Unlock()
+			return fmt.Errorf("%w: h32 %d of %d is beyond %d", wuiderr.ErrUnverified, h32, id, v.maxH32)
+		}
+		f = &h32Fetch{done: make(chan struct{})}
+		v.fetch = f
+		v.mu.Unlock()
+		v.fetchH32(ctx, f)
+	} else {
+		v.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if f.err != nil {
+		return fmt.Errorf("failed to fetch the allocated h32: %w", f.err)
+	}
+	if h32 > f.maxH32 {
+		return fmt.Errorf("%w: h32 %d of %d has not been allocated", wuiderr.ErrInvalidID, h32, id)
+	}
+	return nil
+}
+
+func (v *Verifier) fetchH32(ctx context.Context, f *h32Fetch) {
+	n, err := v.current(ctx)
+	v.mu.Lock()
+	if err == nil {
+		if n > v.maxH32 {
+			v.maxH32 = n
+		}
+		v.fetchedAt = time.Now()
+	}
+	f.maxH32, f.err = v.maxH32, err
+	v.fetch = nil
+	v.mu.Unlock()
+	close(f.done)
+}
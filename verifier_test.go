@@ -0,0 +1,125 @@
+package wuid
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/core"
+	"github.com/driftboat/wuid/wuiderr"
+)
+
+func TestVerifier(t *testing.T) {
+	var numFetches int
+	current := func(ctx context.Context) (int64, error) {
+		numFetches++
+		return 5, nil
+	}
+	v, err := NewVerifier(current, core.WithSection(3), core.WithStep(16, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := core.NewWUID("alpha", nil, core.WithSection(3), core.WithStep(16, 10))
+	g.Reset(5 << 32)
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		if err := v.Verify(ctx, g.Next()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []int64{
+		-1,
+		3<<60 | 5<<32 | 15,
+		2<<60 | 5<<32 | 10,
+		3<<60 | 0<<32 | 10,
+		3<<60 | 5<<32 | core.PanicValue/10*10 + 10,
+	} {
+		if err := v.Verify(ctx, id); !errors.Is(err, wuiderr.ErrInvalidID) {
+			t.Fatalf("%#x should have been rejected. err: %v", id, err)
+		}
+	}
+	if numFetches != 1 {
+		t.Fatalf("numFetches != 1. numFetches: %d", numFetches)
+	}
+
+	// An h32 beyond the allocation is rejected only after a fresh fetch.
+	g.Reset(6 << 32)
+	id6 := g.Next()
+	if err := v.Verify(ctx, id6); !errors.Is(err, wuiderr.ErrUnverified) {
+		t.Fatalf("the throttled fetch should have been reported. err: %v", err)
+	}
+	v.fetchedAt = time.Time{}
+	if err := v.Verify(ctx, id6); !errors.Is(err, wuiderr.ErrInvalidID) {
+		t.Fatalf("the unallocated h32 should have been rejected. err: %v", err)
+	}
+	if numFetches != 2 {
+		t.Fatalf("numFetches != 2. numFetches: %d", numFetches)
+	}
+
+	v, err = NewVerifier(nil, core.WithChecksum(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g = core.NewWUID("alpha", nil, core.WithChecksum(10))
+	g.Reset(1 << 32)
+	id := g.Next()
+	if err := v.Verify(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(ctx, id+1); !errors.Is(err, wuiderr.ErrInvalidID) {
+		t.Fatalf("the wrong check digit should have been rejected. err: %v", err)
+	}
+
+	if _, err := NewVerifier(nil, core.WithTransform(func(n int64) int64 { return n })); err == nil {
+		t.Fatal("NewVerifier should have failed")
+	}
+}
+
+func TestVerifier_SlowFetch(t *testing.T) {
+	var numFetches int64
+	release := make(chan struct{})
+	current := func(ctx context.Context) (int64, error) {
+		atomic.AddInt64(&numFetches, 1)
+		<-release
+		return 6, nil
+	}
+	v, err := NewVerifier(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.maxH32 = 5
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := v.Verify(ctx, 6<<32|1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// The identifiers already known to be allocated are not held up by the fetch.
+	done := make(chan error, 1)
+	go func() {
+		done <- v.Verify(ctx, 5<<32|1)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Verify is blocked by the fetch")
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt64(&numFetches); n != 1 {
+		t.Fatalf("the concurrent callers should share one fetch. numFetches: %d", n)
+	}
+}
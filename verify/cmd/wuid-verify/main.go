@@ -0,0 +1,52 @@
+// Command wuid-verify reads the identifiers dumped by multiple services and reports the
+// collisions, the overlapping sections and the reused h32. Each file is a source, and - or no
+// file at all reads stdin. It exits with 1 if anything suspicious is found. See the verify
+// package for the format of the dumps.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driftboat/wuid/verify"
+)
+
+func main() {
+	var opts verify.Options
+	flag.BoolVar(&opts.Base62, "base62", false, "whether the identifiers are in base62 rather than decimal")
+	flag.BoolVar(&opts.Sectioned, "section", false, "whether WithSection is used")
+	flag.BoolVar(&opts.Checksum, "checksum", false, "whether WithChecksum(10) is used")
+	flag.DurationVar(&opts.Window, "window", 0, "how long an old h32 may still be used after a new one is loaded (default 1m)")
+	flag.Parse()
+
+	v := verify.New(opts)
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		if err := read(v, name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	r := v.Report()
+	_ = r.Print(os.Stdout)
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
+
+func read(v *verify.Verifier, name string) error {
+	if name == "-" {
+		return v.Read("stdin", os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.Read(name, f)
+}
@@ -0,0 +1,365 @@
+// Package verify checks the identifiers collected from multiple services for the mistakes
+// that break the uniqueness across processes: collisions, sections shared by services that do
+// not share a counter, and h32 loaded more than once. It helps with validating a migration
+// from another ID scheme, or a fleet whose configurations are in doubt.
+//
+//	v := verify.New(verify.Options{Sectioned: true})
+//	if err := v.Read("orders", f); err != nil {
+//		return err
+//	}
+//	r := v.Report()
+//
+// The same is available from the command line, where each file is a source:
+//
+//	go run github.com/driftboat/wuid/verify/cmd/wuid-verify -section orders.txt payments.txt
+package verify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/driftboat/wuid"
+)
+
+// Options describes how the identifiers were generated.
+type Options struct {
+	// Base62 indicates that the identifiers are dumped in base62, e.g. by wuid.ID, rather
+	// than in decimal.
+	Base62 bool
+	// Sectioned indicates that WithSection is used, which places the section in the highest
+	// 4 bits.
+	Sectioned bool
+	// Checksum indicates that WithChecksum(10) is used. The check digit is verified and
+	// removed before the decoding.
+	Checksum bool
+	// Window is the time an instance may keep issuing identifiers with an old h32 after it
+	// has loaded a new one, e.g. from the requests in flight. The default is one minute.
+	Window time.Duration
+}
+
+// Record is an identifier collected from a source, e.g. a service or a dump file.
+type Record struct {
+	Source string
+	Line   int
+	ID     int64
+	// Time is when the identifier was generated. It is optional, but the h32 returning after a
+	// greater one can only be detected with it.
+	Time time.Time
+}
+
+// Position locates a Record.
+type Position struct {
+	Source string
+	Line   int
+}
+
+func (p Position) String() string {
+	return p.Source + ":" + strconv.Itoa(p.Line)
+}
+
+// Collision is an identifier found more than once.
+type Collision struct {
+	ID        int64
+	Positions []Position
+}
+
+// SectionOverlap is a section used by more than one source. The sources that do not share a
+// counter must use different sections, or their h32 may collide.
+type SectionOverlap struct {
+	Section int64
+	Sources []string
+}
+
+// H32Reuse is an h32 that was loaded more than once: either by more than one source, or by the
+// same source again after a greater h32, e.g. when the counter in the data source was reset.
+type H32Reuse struct {
+	Section int64
+	H32     int64
+	Sources []string
+	// After is the greater h32 the source had moved to, or 0 if the h32 is shared by sources.
+	After int64
+}
+
+// Report is the outcome of the verification.
+type Report struct {
+	Total           int
+	Collisions      []Collision
+	SectionOverlaps []SectionOverlap
+	H32Reuses       []H32Reuse
+}
+
+// OK reports whether nothing suspicious was found.
+func (r Report) OK() bool {
+	return len(r.Collisions) == 0 && len(r.SectionOverlaps) == 0 && len(r.H32Reuses) == 0
+}
+
+type h32Key struct {
+	section, h32 int64
+}
+
+type h32Use struct {
+	first, last time.Time
+}
+
+// Verifier accumulates the records of all the sources. It is not safe for concurrent use.
+type Verifier struct {
+	opts       Options
+	total      int
+	seen       map[int64]Position
+	collisions map[int64][]Position
+	sections   map[int64]map[string]struct{}
+	uses       map[string]map[h32Key]*h32Use
+}
+
+// New returns a Verifier.
+func New(opts Options) *Verifier {
+	if opts.Window == 0 {
+		opts.Window = time.Minute
+	}
+	return &Verifier{
+		opts:       opts,
+		seen:       make(map[int64]Position),
+		collisions: make(map[int64][]Position),
+		sections:   make(map[int64]map[string]struct{}),
+		uses:       make(map[string]map[h32Key]*h32Use),
+	}
+}
+
+// Decode returns the section and the h32 of id.
+func (v *Verifier) Decode(id int64) (section, h32 int64, err error) {
+	if id <= 0 {
+		return 0, 0, fmt.Errorf("%d is not a valid identifier", id)
+	}
+	n := id
+	if v.opts.Checksum {
+		if !wuid.ValidateChecksum(id) {
+			return 0, 0, fmt.Errorf("%d has an invalid check digit", id)
+		}
+		n = id / 10
+	}
+	if v.opts.Sectioned {
+		return n >> 60, n >> 32 & 0x0FFFFFFF, nil
+	}
+	return 0, n >> 32, nil
+}
+
+// Add adds a record.
+func (v *Verifier) Add(rec Record) error {
+	section, h32, err := v.Decode(rec.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", Position{rec.Source, rec.Line}, err)
+	}
+	v.total++
+
+	pos := Position{Source: rec.Source, Line: rec.Line}
+	if first, ok := v.seen[rec.ID]; ok {
+		if len(v.collisions[rec.ID]) == 0 {
+			v.collisions[rec.ID] = append(v.collisions[rec.ID], first)
+		}
+		v.collisions[rec.ID] = append(v.collisions[rec.ID], pos)
+	} else {
+		v.seen[rec.ID] = pos
+	}
+
+	if v.opts.Sectioned {
+		m := v.sections[section]
+		if m == nil {
+			m = make(map[string]struct{})
+			v.sections[section] = m
+		}
+		m[rec.Source] = struct{}{}
+	}
+
+	m := v.uses[rec.Source]
+	if m == nil {
+		m = make(map[h32Key]*h32Use)
+		v.uses[rec.Source] = m
+	}
+	key := h32Key{section: section, h32: h32}
+	u := m[key]
+	if u == nil {
+		u = &h32Use{}
+		m[key] = u
+	}
+	if !rec.Time.IsZero() {
+		if u.first.IsZero() || rec.Time.Before(u.first) {
+			u.first = rec.Time
+		}
+		if rec.Time.After(u.last) {
+			u.last = rec.Time
+		}
+	}
+	return nil
+}
+
+// Read adds the records of source from r. Each line holds an identifier, optionally followed
+// by a space, a tab or a comma and the time it was generated in RFC 3339. Empty lines and the
+// lines starting with # are skipped.
+func (v *Verifier) Read(source string, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		rec := Record{Source: source, Line: line}
+		if i := strings.IndexAny(s, " \t,"); i >= 0 {
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s[i+1:]))
+			if err != nil {
+				return fmt.Errorf("%s: %w", Position{source, line}, err)
+			}
+			s, rec.Time = s[:i], t
+		}
+		id, err := v.parse(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", Position{source, line}, err)
+		}
+		rec.ID = id
+		if err := v.Add(rec); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (v *Verifier) parse(s string) (int64, error) {
+	if v.opts.Base62 {
+		id, err := wuid.ParseID(s)
+		return int64(id), err
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid identifier: " + strconv.Quote(s))
+	}
+	return id, nil
+}
+
+// Report returns the findings so far, sorted for a stable output.
+func (v *Verifier) Report() Report {
+	r := Report{Total: v.total}
+	for id, ps := range v.collisions {
+		r.Collisions = append(r.Collisions, Collision{ID: id, Positions: ps})
+	}
+	sort.Slice(r.Collisions, func(i, j int) bool {
+		return r.Collisions[i].ID < r.Collisions[j].ID
+	})
+
+	for section, m := range v.sections {
+		if len(m) > 1 {
+			r.SectionOverlaps = append(r.SectionOverlaps, SectionOverlap{Section: section, Sources: sortedKeys(m)})
+		}
+	}
+	sort.Slice(r.SectionOverlaps, func(i, j int) bool {
+		return r.SectionOverlaps[i].Section < r.SectionOverlaps[j].Section
+	})
+
+	shared := make(map[h32Key]map[string]struct{})
+	for source, m := range v.uses {
+		for key := range m {
+			if shared[key] == nil {
+				shared[key] = make(map[string]struct{})
+			}
+			shared[key][source] = struct{}{}
+		}
+		r.H32Reuses = append(r.H32Reuses, v.returned(source, m)...)
+	}
+	for key, m := range shared {
+		if len(m) > 1 {
+			r.H32Reuses = append(r.H32Reuses, H32Reuse{Section: key.section, H32: key.h32, Sources: sortedKeys(m)})
+		}
+	}
+	sort.Slice(r.H32Reuses, func(i, j int) bool {
+		a, b := r.H32Reuses[i], r.H32Reuses[j]
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		if a.H32 != b.H32 {
+			return a.H32 < b.H32
+		}
+		if a.After != b.After {
+			return a.After < b.After
+		}
+		return strings.Join(a.Sources, ",") < strings.Join(b.Sources, ",")
+	})
+	return r
+}
+
+// returned finds the h32 of source that were used again after a greater h32 of the same section
+// had been in use for longer than the window.
+func (v *Verifier) returned(source string, m map[h32Key]*h32Use) []H32Reuse {
+	keys := make([]h32Key, 0, len(m))
+	for key, u := range m {
+		if !u.first.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].section != keys[j].section {
+			return keys[i].section < keys[j].section
+		}
+		return keys[i].h32 > keys[j].h32
+	})
+
+	var reuses []H32Reuse
+	var earliest h32Key
+	for i, key := range keys {
+		if i == 0 || key.section != keys[i-1].section {
+			earliest = key
+			continue
+		}
+		if m[key].last.Sub(m[earliest].first) > v.opts.Window {
+			reuses = append(reuses, H32Reuse{Section: key.section, H32: key.h32, Sources: []string{source}, After: earliest.h32})
+		}
+		if m[key].first.Before(m[earliest].first) {
+			earliest = key
+		}
+	}
+	return reuses
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Print writes r in a human-readable form.
+func (r Report) Print(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "identifiers\t%d\n", r.Total)
+	_, _ = fmt.Fprintf(tw, "collisions\t%d\n", len(r.Collisions))
+	_, _ = fmt.Fprintf(tw, "section overlaps\t%d\n", len(r.SectionOverlaps))
+	_, _ = fmt.Fprintf(tw, "h32 reuses\t%d\n", len(r.H32Reuses))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range r.Collisions {
+		ps := make([]string, len(c.Positions))
+		for i, p := range c.Positions {
+			ps[i] = p.String()
+		}
+		_, _ = fmt.Fprintf(out, "collision: %d at %s\n", c.ID, strings.Join(ps, ", "))
+	}
+	for _, o := range r.SectionOverlaps {
+		_, _ = fmt.Fprintf(out, "section overlap: section %d is used by %s\n", o.Section, strings.Join(o.Sources, ", "))
+	}
+	for _, u := range r.H32Reuses {
+		if u.After != 0 {
+			_, _ = fmt.Fprintf(out, "h32 reuse: h32 %d of section %d is used by %s again after h32 %d\n", u.H32, u.Section, u.Sources[0], u.After)
+		} else {
+			_, _ = fmt.Fprintf(out, "h32 reuse: h32 %d of section %d is used by %s\n", u.H32, u.Section, strings.Join(u.Sources, ", "))
+		}
+	}
+	return nil
+}
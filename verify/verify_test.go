@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid"
+)
+
+func TestVerifier(t *testing.T) {
+	v := New(Options{})
+	if err := v.Read("orders", strings.NewReader("# orders\n"+
+		"4294967297 2024-05-01T10:00:00Z\n"+
+		"4294967298 2024-05-01T10:00:01Z\n"+
+		"\n"+
+		"8589934593,2024-05-01T11:00:00Z\n"+
+		"4294967299\t2024-05-01T12:00:00Z\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Read("payments", strings.NewReader("4294967298\n12884901889\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := v.Report()
+	if r.Total != 6 || r.OK() {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if len(r.Collisions) != 1 || r.Collisions[0].ID != 4294967298 ||
+		r.Collisions[0].Positions[0] != (Position{"orders", 3}) || r.Collisions[0].Positions[1] != (Position{"payments", 1}) {
+		t.Fatalf("unexpected collisions: %+v", r.Collisions)
+	}
+	if len(r.SectionOverlaps) != 0 {
+		t.Fatalf("unexpected section overlaps: %+v", r.SectionOverlaps)
+	}
+	if len(r.H32Reuses) != 2 {
+		t.Fatalf("unexpected h32 reuses: %+v", r.H32Reuses)
+	}
+	if u := r.H32Reuses[0]; u.H32 != 1 || u.After != 0 || strings.Join(u.Sources, ",") != "orders,payments" {
+		t.Fatalf("unexpected h32 reuse: %+v", u)
+	}
+	if u := r.H32Reuses[1]; u.H32 != 1 || u.After != 2 || strings.Join(u.Sources, ",") != "orders" {
+		t.Fatalf("unexpected h32 reuse: %+v", u)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "collision: 4294967298 at orders:3, payments:1") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestVerifier_Window(t *testing.T) {
+	v := New(Options{Window: time.Hour})
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, rec := range []struct {
+		h32 int64
+		t   time.Duration
+	}{{1, 0}, {2, time.Minute}, {1, 2 * time.Minute}, {2, time.Hour}} {
+		if err := v.Add(Record{Source: "orders", Line: i + 1, ID: rec.h32<<32 | int64(i+1), Time: base.Add(rec.t)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r := v.Report(); !r.OK() {
+		t.Fatalf("the requests in flight should be tolerated: %+v", r)
+	}
+}
+
+func TestVerifier_Sectioned(t *testing.T) {
+	v := New(Options{Sectioned: true, Base62: true})
+	for _, rec := range []Record{
+		{Source: "orders", ID: 1<<60 | 5<<32 | 1},
+		{Source: "orders", ID: 1<<60 | 5<<32 | 2},
+		{Source: "payments", ID: 2<<60 | 5<<32 | 1},
+		{Source: "refunds", ID: 2<<60 | 6<<32 | 1},
+	} {
+		if err := v.Read(rec.Source, strings.NewReader(wuid.ID(rec.ID).String()+"\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := v.Report()
+	if len(r.Collisions) != 0 || len(r.H32Reuses) != 0 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if len(r.SectionOverlaps) != 1 || r.SectionOverlaps[0].Section != 2 ||
+		strings.Join(r.SectionOverlaps[0].Sources, ",") != "payments,refunds" {
+		t.Fatalf("unexpected section overlaps: %+v", r.SectionOverlaps)
+	}
+}
+
+func TestVerifier_Error(t *testing.T) {
+	for _, s := range []string{"abc\n", "4294967297 yesterday\n", "-1\n"} {
+		if err := New(Options{}).Read("orders", strings.NewReader(s)); err == nil {
+			t.Fatalf("Read should have failed with %q", s)
+		}
+	}
+	if err := New(Options{Checksum: true}).Read("orders", strings.NewReader("5723\n")); err == nil {
+		t.Fatal("Read should have failed with an invalid check digit")
+	}
+	if err := New(Options{Checksum: true}).Read("orders", strings.NewReader("5724\n")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,5 +1,103 @@
 package wuid
 
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/driftboat/wuid/core"
+)
+
 type WUID interface {
 	Next() int64
 }
+
+type holder struct {
+	w WUID
+}
+
+var defaultWUID atomic.Value
+
+// SetDefault sets the generator used by the package-level Next and NextString, so that small
+// applications do not have to pass a generator around. Any adapter's WUID can be passed in
+// once it has loaded the high bits. SetDefault is safe to call concurrently with Next.
+func SetDefault(w WUID) {
+	if w == nil {
+		panic("w cannot be nil")
+	}
+	defaultWUID.Store(holder{w: w})
+}
+
+// Default returns the generator set by SetDefault, or nil if there is none.
+func Default() WUID {
+	h, _ := defaultWUID.Load().(holder)
+	return h.w
+}
+
+// Next returns a unique identifier from the default generator. It panics if SetDefault has
+// not been called.
+func Next() int64 {
+	h, ok := defaultWUID.Load().(holder)
+	if !ok {
+		panic("wuid: SetDefault has not been called")
+	}
+	return h.w.Next()
+}
+
+// NextString returns a unique identifier from the default generator in decimal, which is
+// unsigned if the generator uses WithUint64.
+func NextString() string {
+	h, ok := defaultWUID.Load().(holder)
+	if ok {
+		if s, ok := h.w.(interface{ NextString() string }); ok {
+			return s.NextString()
+		}
+	}
+	return strconv.FormatInt(Next(), 10)
+}
+
+// AppendNext appends a unique identifier from the default generator in decimal to dst and
+// returns the extended buffer, without allocating when dst has room for it.
+func AppendNext(dst []byte) []byte {
+	h, ok := defaultWUID.Load().(holder)
+	if ok {
+		if a, ok := h.w.(interface{ AppendNext(dst []byte) []byte }); ok {
+			return a.AppendNext(dst)
+		}
+	}
+	return AppendString(dst, Next())
+}
+
+// AppendString appends id in decimal, the form returned by NextString, to dst and returns the
+// extended buffer, like strconv.AppendInt.
+func AppendString(dst []byte, id int64) []byte {
+	return core.AppendString(dst, id)
+}
+
+// ValidateChecksum reports whether the lowest decimal digit of id is the check digit added by
+// WithChecksum of the adapters, so that a mistyped identifier can be rejected before a lookup.
+func ValidateChecksum(id int64) bool {
+	return core.ValidateChecksum(id)
+}
+
+// SectionID is the section branded on the identifiers by WithSection of the adapters.
+type SectionID = core.SectionID
+
+// SectionOf returns the section branded on id by WithSection of the adapters, or 0 for the
+// identifiers generated without it, e.g. to route an identifier to the datacenter that
+// generated it.
+func SectionOf(id int64) SectionID {
+	return core.SectionOf(id)
+}
+
+// ParseString parses an identifier in decimal, which is the format of NextString. If the
+// default generator provides StringFormat, e.g. any adapter's WUID, the identifier is validated
+// against its configuration, including the check digit of WithChecksum. Otherwise any positive
+// decimal number without leading zeros is accepted.
+func ParseString(s string) (ID, error) {
+	f := core.AnyStringFormat()
+	if sf, ok := Default().(interface{ StringFormat() core.StringFormat }); ok {
+		f = sf.StringFormat()
+	}
+	n, err := f.Parse(s)
+	return ID(n), err
+}
@@ -0,0 +1,95 @@
+package wuid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/driftboat/wuid/wuidtest"
+)
+
+func TestSetDefault(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Next should have panicked without a default generator")
+			}
+		}()
+		Next()
+	}()
+	if Default() != nil {
+		t.Fatal("Default should return nil without a default generator")
+	}
+
+	w := wuidtest.NewDeterministicWUID(42)
+	SetDefault(w)
+	if Default() != WUID(w) {
+		t.Fatal("Default should return the generator set by SetDefault")
+	}
+	if v := Next(); v != 42<<32|1 {
+		t.Fatalf("Next returned %#016x, while it should be %#016x", v, 42<<32|1)
+	}
+	if s := NextString(); s != "180388626434" {
+		t.Fatalf("NextString returned %s, while it should be 180388626434", s)
+	}
+
+	wuidtest.Run(t, WUID(nextFunc(Next)), wuidtest.Config{Goroutines: 8, PerGoroutine: 1000, Monotonic: true})
+}
+
+type nextFunc func() int64
+
+func (f nextFunc) Next() int64 {
+	return f()
+}
+
+func TestValidateChecksum(t *testing.T) {
+	if !ValidateChecksum(5724) || ValidateChecksum(5742) {
+		t.Fatal("ValidateChecksum does not work as expected")
+	}
+}
+
+func TestSectionOf(t *testing.T) {
+	if s := SectionOf(3<<60 | 42<<32 | 1); s != 3 {
+		t.Fatalf("SectionOf returned %d, while it should be 3", s)
+	}
+	if s := SectionOf(0x1FFFFF<<32 | 1); s != 0 {
+		t.Fatalf("SectionOf returned %d, while it should be 0", s)
+	}
+}
+
+func TestParseString(t *testing.T) {
+	w := wuidtest.NewDeterministicWUID(42)
+	SetDefault(w)
+	s := NextString()
+	id, err := ParseString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != ID(42<<32|1) {
+		t.Fatalf("ParseString returned %d, while it should be %d", id, 42<<32|1)
+	}
+	for _, s := range []string{"", "123", "0" + s, "99999999999999999"} {
+		if _, err := ParseString(s); err == nil {
+			t.Fatalf("ParseString(%q) should have failed", s)
+		}
+	}
+
+	SetDefault(nextFunc(w.Next))
+	if id, err := ParseString("123"); err != nil || id != 123 {
+		t.Fatalf("ParseString returned %d, %v, while it should accept any positive number", id, err)
+	}
+}
+
+func TestNextIntoContext(t *testing.T) {
+	SetDefault(wuidtest.NewDeterministicWUID(42))
+	ctx1, id1 := NextIntoContext(context.Background())
+	ctx2, id2 := NextIntoContext(ctx1)
+	if id1 != 42<<32|1 || id2 != 42<<32|2 {
+		t.Fatalf("NextIntoContext should take the IDs from the default generator. id1: %d, id2: %d", id1, id2)
+	}
+	if id, _ := FromContext(ctx1); id != id1 {
+		t.Fatal("the first context should keep its ID")
+	}
+	if id, _ := FromContext(ctx2); id != id2 {
+		t.Fatal("the second context should carry the new ID")
+	}
+}
@@ -0,0 +1,62 @@
+// Package wuiderr defines the errors returned by WUID, so that callers can branch with
+// errors.Is and errors.As instead of matching messages.
+package wuiderr
+
+import (
+	"errors"
+)
+
+var (
+	// ErrH32Exhausted indicates that the value loaded from the backend exceeds the maximum h32.
+	ErrH32Exhausted = errors.New("h32 is exhausted")
+	// ErrLowBitsExhausted is the value Next panics with when the low bits run out before the
+	// renewal succeeds.
+	ErrLowBitsExhausted = errors.New("the low 36 bits are about to run out")
+	// ErrLowBitsOverflow is the value Next panics with when the low 32 bits have carried into
+	// the high bits, which would alias the identifiers of another h32. Reset panics with it and
+	// ResetForward returns it when n does not fit in the high bits.
+	ErrLowBitsOverflow = errors.New("the low 32 bits overflow into the high bits")
+	// ErrInvalidH32 indicates that the value loaded from the backend cannot be used as h32.
+	ErrInvalidH32 = errors.New("invalid h32")
+	// ErrNotReady is the value Next panics with when the first load started by Loadh32Async
+	// does not succeed within the ready timeout.
+	ErrNotReady = errors.New("the first load of h32 is not done")
+	// ErrDuplicateID is the value Next panics with when WithDuplicateGuard detects a duplicate.
+	ErrDuplicateID = errors.New("duplicate identifier")
+	// ErrRateLimited is returned by NextOrErr when the rate limit set by WithRateLimit is
+	// exceeded.
+	ErrRateLimited = errors.New("the rate limit is exceeded")
+	// ErrOwnerUnknown is returned by WhoOwns when no fingerprint is recorded for an h32.
+	ErrOwnerUnknown = errors.New("the owner of the h32 is unknown")
+	// ErrRewind is returned by ResetForward when it would move the counter backwards.
+	ErrRewind = errors.New("the counter cannot be moved backwards")
+	// ErrInvalidID indicates that an identifier cannot have been generated by a configuration,
+	// e.g. a forged one rejected by CheckID.
+	ErrInvalidID = errors.New("invalid identifier")
+	// ErrUnverified is returned by Verifier.Verify when an identifier carries an h32 beyond
+	// the allocation fetched last, and the fetch is throttled. It is not a rejection: retry
+	// later.
+	ErrUnverified = errors.New("the h32 cannot be verified yet")
+	// ErrInvalidSignature is returned by VerifySigned when the tag of a signed identifier does
+	// not match.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrFaultInjected indicates that a load failed because of a fault injected by
+	// WithFaultInjector.
+	ErrFaultInjected = errors.New("the fault is injected")
+	// ErrDuplicateGenerator is returned by a load when another live generator of the process
+	// loads from the same key with the same section and name, and WithStrictInterlock is used.
+	ErrDuplicateGenerator = errors.New("another generator loads from the same key")
+)
+
+// ErrRenewFailed is returned by RenewNow when the high bits cannot be renewed.
+type ErrRenewFailed struct {
+	Cause error
+}
+
+func (e *ErrRenewFailed) Error() string {
+	return "renew failed: " + e.Cause.Error()
+}
+
+func (e *ErrRenewFailed) Unwrap() error {
+	return e.Cause
+}
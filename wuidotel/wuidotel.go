@@ -0,0 +1,67 @@
+// Package wuidotel traces the loads and renewals of the high bits with OpenTelemetry. It is
+// kept apart from the core package, so that the core has no dependency outside the standard
+// library. The adapters forward WithTracerProvider, which uses it.
+package wuidotel
+
+import (
+	"context"
+
+	"github.com/driftboat/wuid/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracer returns a core.Tracer starting the spans named wuid.load with a tracer of tp.
+func NewTracer(tp trace.TracerProvider) core.Tracer {
+	if tp == nil {
+		panic("tp cannot be nil")
+	}
+	return tracer{t: tp.Tracer("github.com/driftboat/wuid")}
+}
+
+// WithTracerProvider enables OpenTelemetry tracing of the loads and renewals of the high bits.
+func WithTracerProvider(tp trace.TracerProvider) core.Option {
+	return core.WithTracer(NewTracer(tp))
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) StartLoad(attrs []core.Attribute) core.Span {
+	_, s := t.t.Start(context.Background(), "wuid.load", trace.WithAttributes(convert(attrs)...))
+	return span{s: s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s span) SetAttributes(attrs []core.Attribute) {
+	s.s.SetAttributes(convert(attrs)...)
+}
+
+func (s span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.s.End()
+}
+
+func convert(attrs []core.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		}
+	}
+	return kvs
+}
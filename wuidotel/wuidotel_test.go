@@ -0,0 +1,47 @@
+package wuidotel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/driftboat/wuid/core"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithTracerProvider(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	w := core.NewWUID("alpha", nil, WithTracerProvider(tp))
+
+	span := w.StartLoadSpan("redis", "wuid")
+	span.End(errors.New("foo"))
+	span = w.StartLoadSpan("redis", "wuid")
+	w.Reset(7 << 32)
+	span.End(nil)
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("len(spans) is %d, while it should be 2", len(spans))
+	}
+	if spans[0].Name() != "wuid.load" || spans[0].Status().Description != "foo" {
+		t.Fatal("the error is not recorded")
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range spans[1].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["wuid.backend"].AsString() != "redis" || attrs["wuid.key"].AsString() != "wuid" {
+		t.Fatal("the backend attributes are not as expected")
+	}
+	if _, ok := attrs["wuid.renewal"]; !ok {
+		t.Fatal("the renewal attribute is missing")
+	}
+	if attrs["wuid.old_h32"].AsInt64() != 0 || attrs["wuid.new_h32"].AsInt64() != 7 {
+		t.Fatal("the h32 attributes are not as expected")
+	}
+	if attrs["wuid.retry_count"].AsInt64() != 1 {
+		t.Fatal("the retry count is not as expected")
+	}
+}
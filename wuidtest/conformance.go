@@ -0,0 +1,138 @@
+package wuidtest
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+)
+
+// Instance is a generator checked by Conformance. The WUID types of all the adapters
+// implement it.
+type Instance interface {
+	Next() int64
+	RenewNow() error
+	CurrentHighBits() internal.HighBits
+}
+
+// Target is a data source checked by Conformance, e.g. a Redis key created for the test.
+type Target struct {
+	// New creates an instance and loads its first h32 from the data source. All the instances
+	// created by New share the same counter, just like the processes of a fleet.
+	New func(t testing.TB) Instance
+	// Break makes the data source unavailable until Heal is called, e.g. by failing the client
+	// factory or by stopping the server. The failure injection is skipped if either is nil.
+	Break func(t testing.TB)
+	Heal  func(t testing.TB)
+}
+
+// Conformance runs the checks every data source, including the custom ones, should pass: the
+// identifiers stay unique across renewals and across instances, every renewal moves to an h32
+// never used before, and a failed renewal keeps the current h32 in use and recovers once the
+// data source is back.
+func Conformance(t *testing.T, target Target) {
+	t.Run("Unique", func(t *testing.T) {
+		conformUnique(t, target)
+	})
+	t.Run("FreshH32", func(t *testing.T) {
+		conformFreshH32(t, target)
+	})
+	t.Run("FailureInjection", func(t *testing.T) {
+		if target.Break == nil || target.Heal == nil {
+			t.Skip("the target cannot be broken")
+		}
+		conformFailure(t, target)
+	})
+}
+
+func conformUnique(t *testing.T, target Target) {
+	const numInstances, numRounds, perRound = 3, 5, 2000
+	results := make([][]int64, numInstances)
+	errs := make([]error, numInstances)
+	var wg sync.WaitGroup
+	for i := 0; i < numInstances; i++ {
+		w := target.New(t)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for r := 0; r < numRounds; r++ {
+				for j := 0; j < perRound; j++ {
+					results[i] = append(results[i], w.Next())
+				}
+				if err := w.RenewNow(); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var all []int64
+	for _, a := range results {
+		all = append(all, a...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i] < all[j]
+	})
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("duplication detected. id: %#016x", all[i])
+		}
+	}
+}
+
+func conformFreshH32(t *testing.T, target Target) {
+	w1, w2 := target.New(t), target.New(t)
+	seen := make(map[int64]bool)
+	for i := 0; i < 10; i++ {
+		for _, w := range []Instance{w1, w2} {
+			h32 := w.CurrentHighBits().Value
+			if seen[h32] {
+				t.Fatalf("h32 %d is used twice", h32)
+			}
+			seen[h32] = true
+			if err := w.RenewNow(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func conformFailure(t *testing.T, target Target) {
+	w := target.New(t)
+	h32 := w.CurrentHighBits().Value
+	v1 := w.Next()
+
+	target.Break(t)
+	healed := false
+	defer func() {
+		if !healed {
+			target.Heal(t)
+		}
+	}()
+	if err := w.RenewNow(); err == nil {
+		t.Fatal("RenewNow should have failed while the data source is unavailable")
+	}
+	if hb := w.CurrentHighBits(); hb.Value != h32 {
+		t.Fatalf("a failed renewal should keep h32 %d in use, not %d", h32, hb.Value)
+	}
+	if v2 := w.Next(); v2 == v1 {
+		t.Fatalf("duplication detected. id: %#016x", v2)
+	}
+
+	target.Heal(t)
+	healed = true
+	if err := w.RenewNow(); err != nil {
+		t.Fatalf("RenewNow should have recovered. err: %v", err)
+	}
+	if hb := w.CurrentHighBits(); hb.Value == h32 {
+		t.Fatalf("h32 %d should have been replaced", h32)
+	}
+}
@@ -0,0 +1,243 @@
+package wuidtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+// FakeBackend is an in-memory data source for unit tests. Its failures and exhaustion are
+// under control of the test.
+type FakeBackend struct {
+	mu       sync.Mutex
+	h32      int64
+	numLoads int
+	errs     []error
+}
+
+// NewFakeBackend creates a FakeBackend. The first load returns 1.
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{}
+}
+
+// Fail makes the following len(errs) loads fail with errs in order.
+func (b *FakeBackend) Fail(errs ...error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errs = append(b.errs, errs...)
+}
+
+// SetH32 sets the counter, so that the next load returns h32+1. Set it to the maximum h32 to
+// see how the code under test copes with an exhausted data source.
+func (b *FakeBackend) SetH32(h32 int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.h32 = h32
+}
+
+// H32 returns the current value of the counter.
+func (b *FakeBackend) H32() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.h32
+}
+
+// NumLoads returns the number of loads, including the failed ones.
+func (b *FakeBackend) NumLoads() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.numLoads
+}
+
+func (b *FakeBackend) incr() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.numLoads++
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return 0, err
+	}
+	b.h32++
+	return b.h32, nil
+}
+
+// WUID is a WUID generator backed by a FakeBackend.
+type WUID struct {
+	w *internal.WUID
+}
+
+type Logger = internal.Logger
+
+type Option = internal.Option
+
+// NewWUID creates a new WUID instance. The options of any adapter package, e.g.
+// redis/v8/wuid.WithStep, can be passed in.
+func NewWUID(name string, logger Logger, opts ...Option) *WUID {
+	return &WUID{w: internal.NewWUID(name, logger, opts...)}
+}
+
+// NewDeterministicWUID creates a WUID instance whose first h32 is seed, so that a single
+// goroutine always gets the same identifiers. It panics if seed is not a valid h32.
+func NewDeterministicWUID(seed int64, opts ...Option) *WUID {
+	b := NewFakeBackend()
+	b.SetH32(seed - 1)
+	w := NewWUID("deterministic", slog.NewDumbLogger(), opts...)
+	if err := w.LoadHighBits(b); err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// Next returns a unique identifier.
+func (w *WUID) Next() int64 {
+	return w.w.Next()
+}
+
+// NextOrErr is like Next but returns an error instead of waiting or panicking, e.g.
+// wuiderr.ErrRateLimited when the rate limit set by WithRateLimit is exceeded.
+func (w *WUID) NextOrErr() (int64, error) {
+	return w.w.NextOrErr()
+}
+
+// LoadHighBits adds 1 to the counter of b and uses the new value as the high bits. b is saved
+// for future renewal.
+func (w *WUID) LoadHighBits(b *FakeBackend) error {
+	return w.LoadHighBitsContext(context.Background(), b)
+}
+
+// LoadHighBitsContext is like LoadHighBits but the initial load is bound to ctx as well.
+func (w *WUID) LoadHighBitsContext(ctx context.Context, b *FakeBackend) error {
+	if w.w.Deterministic() {
+		return nil
+	}
+	return w.w.Load(ctx, internal.RenewerFunc(func(ctx context.Context) (h32 int64, err error) {
+		span := w.w.StartLoadSpan("fake", "")
+		defer func() {
+			span.End(err)
+		}()
+		return b.incr()
+	}))
+}
+
+// NextN fills dst with unique identifiers, which are reserved with a single atomic operation.
+func (w *WUID) NextN(dst []int64) {
+	w.w.NextN(dst)
+}
+
+// NextString returns a unique identifier in decimal.
+func (w *WUID) NextString() string {
+	return w.w.NextString()
+}
+
+// NextStringFixed returns a unique identifier in decimal, padded with zeros to width, so that
+// the strings sort in the same order as the numbers, e.g. as S3 prefixes or LevelDB keys.
+// width must be at least StringWidth().
+func (w *WUID) NextStringFixed(width int) string {
+	return w.w.NextStringFixed(width)
+}
+
+// StringWidth returns the number of decimal digits of the greatest identifier the instance
+// can generate, which is 16, 17 with WithChecksum, or 19 with WithSection.
+func (w *WUID) StringWidth() int {
+	return w.w.StringWidth()
+}
+
+type StatsSnapshot = internal.StatsSnapshot
+
+// Stats returns a snapshot of the statistics.
+func (w *WUID) Stats() StatsSnapshot {
+	return w.w.Stats()
+}
+
+// RenewNow reacquires the high bits immediately.
+func (w *WUID) RenewNow() error {
+	return w.w.RenewNow()
+}
+
+// FastForward skips the identifiers up to the next renewal boundary, so that the next call to
+// Next triggers a renewal in the background.
+func (w *WUID) FastForward() {
+	w.w.FastForward()
+}
+
+// Exhaust uses up the low bits, so that Next panics until the next successful renewal.
+func (w *WUID) Exhaust() {
+	w.w.Exhaust()
+}
+
+// Stop stops the background renewal started by WithMaxH32Age.
+func (w *WUID) Stop() {
+	w.w.Stop()
+}
+
+type ResetOption = internal.ResetOption
+
+// ApplyOptions changes the tunables of a live instance without a restart: WithRenewTimeout,
+// WithReadyTimeout, WithRateLimit, WithQuietRenewals, WithLogSampling and
+// WithH32ExhaustionAlarm. The other options, e.g. WithStep and WithSection, would change the
+// numbers being generated, so they are rejected, and nothing is applied.
+func (w *WUID) ApplyOptions(opts ...Option) error {
+	return w.w.ApplyOptions(opts...)
+}
+
+// Pressure returns a score in [0, 1] telling how close the instance is to exhausting its low
+// bits, so that a load balancer or an admission controller can shed traffic from it before
+// Next panics. It stays 0 until a renewal is due, grows to 1 as the low bits run out, and is
+// at least 0.5 while the last renewal has failed.
+func (w *WUID) Pressure() float64 {
+	return w.w.Pressure()
+}
+
+// ReconfigureStep changes the step and the floor, just like WithStep, from the next h32 on,
+// so that the numbers already issued cannot be generated again. It lets a running fleet
+// migrate its sharding parameters without restarting every process.
+func (w *WUID) ReconfigureStep(step, floor int64) error {
+	return w.w.ReconfigureStep(step, floor)
+}
+
+// Seq is a dense sequence of numbers for a key. See Sequence.
+type Seq = internal.Seq
+
+// Sequence returns a dense sequence of numbers for key, e.g. the invoice numbers of a
+// customer, so that a per-entity counter does not have to be built on top of Next. It
+// requires WithSequenceAllocator.
+func (w *WUID) Sequence(key string) *Seq {
+	return w.w.Sequence(key)
+}
+
+// StringFormat describes the identifiers returned by NextString, e.g. for OpenAPI and JSON
+// Schema. See the StringFormat method.
+type StringFormat = internal.StringFormat
+
+// StringFormat returns the pattern, the lengths and the range of the identifiers returned by
+// NextString. Its Parse method validates and parses an identifier received from outside.
+func (w *WUID) StringFormat() StringFormat {
+	return w.w.StringFormat()
+}
+
+// NextULID returns a unique identifier as a 26-character ULID, whose random part is replaced
+// by an identifier from Next, so that the ULIDs never collide while they still sort by time.
+func (w *WUID) NextULID() string {
+	return w.w.NextULID()
+}
+
+// ResetForward moves the counter to n. It refuses to move the counter backwards unless
+// AllowRewind of any adapter package is passed.
+func (w *WUID) ResetForward(n int64, opts ...ResetOption) error {
+	return w.w.ResetForward(n, opts...)
+}
+
+// Logger returns the logger in use.
+func (w *WUID) Logger() Logger {
+	return w.w.Logger
+}
+
+// Loadh32FromFake is the same as LoadHighBits(b).
+//
+// Deprecated: Use LoadHighBits instead.
+func (w *WUID) Loadh32FromFake(b *FakeBackend) error {
+	return w.LoadHighBits(b)
+}
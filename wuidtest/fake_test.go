@@ -0,0 +1,96 @@
+package wuidtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/driftboat/wuid/wuiderr"
+	"github.com/edwingeng/slog"
+)
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	startTime := time.Now()
+	for time.Since(startTime) < time.Second*3 {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestNewDeterministicWUID(t *testing.T) {
+	w1 := NewDeterministicWUID(100)
+	w2 := NewDeterministicWUID(100)
+	for i := 0; i < 100; i++ {
+		if v1, v2 := w1.Next(), w2.Next(); v1 != v2 || v1 != 100<<32+int64(i)+1 {
+			t.Fatalf("the identifiers are not deterministic. v1: %x, v2: %x", v1, v2)
+		}
+	}
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		NewDeterministicWUID(0)
+		t.Fatal("NewDeterministicWUID should have panicked")
+	}()
+}
+
+func TestFakeBackend(t *testing.T) {
+	b := NewFakeBackend()
+	w := NewWUID("alpha", slog.NewDumbLogger())
+	if err := w.LoadHighBits(b); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v>>32 != 1 || b.H32() != 1 || b.NumLoads() != 1 {
+		t.Fatalf("the first load does not work as expected. v: %x", v)
+	}
+
+	foo := errors.New("foo")
+	b.Fail(foo)
+	w.FastForward()
+	w.Next()
+	waitUntil(t, func() bool { return w.Stats().NumRenewFailed == 1 })
+	if err := w.Stats().LastRenewError; !errors.Is(err, foo) {
+		t.Fatalf("LastRenewError is %v, while it should be foo", err)
+	}
+
+	w.FastForward()
+	w.Next()
+	waitUntil(t, func() bool { return w.Stats().NumRenewed == 1 })
+	if v := w.Next(); v>>32 != 2 {
+		t.Fatalf("the renewal does not work as expected. v: %x", v)
+	}
+
+	w.Exhaust()
+	func() {
+		defer func() {
+			r := recover()
+			if err, ok := r.(error); !ok || !errors.Is(err, wuiderr.ErrLowBitsExhausted) {
+				t.Fatalf("r is %v, while it should be wuiderr.ErrLowBitsExhausted", r)
+			}
+		}()
+		w.Next()
+	}()
+
+	b.SetH32(internal.H32Mask >> 32)
+	if err := w.RenewNow(); !errors.Is(err, wuiderr.ErrH32Exhausted) {
+		t.Fatalf("err is %v, while it should be wuiderr.ErrH32Exhausted", err)
+	}
+	b.SetH32(10)
+	if err := w.RenewNow(); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Next(); v>>32 != 11 {
+		t.Fatalf("Next should work again after the renewal. v: %x", v)
+	}
+}
+
+func TestFakeBackend_Harness(t *testing.T) {
+	w := NewDeterministicWUID(1, internal.WithStep(8, 0), internal.WithShards(4))
+	Run(t, w, Config{Step: 8})
+}
@@ -0,0 +1,116 @@
+// Package wuidtest provides a harness that checks the invariants of a WUID generator under
+// concurrency. It works with any data source, including the custom ones. In addition, it
+// provides a fake data source for the unit tests of the code consuming WUIDs.
+package wuidtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Generator is implemented by the WUID types of all the adapters.
+type Generator interface {
+	Next() int64
+}
+
+// Config describes the load and the invariants to check.
+type Config struct {
+	// Goroutines is the number of goroutines calling Next. It defaults to 8.
+	Goroutines int
+	// PerGoroutine is the number of identifiers generated by each goroutine. It defaults to 10000.
+	PerGoroutine int
+	// Monotonic requires the identifiers generated by each goroutine to be increasing. Leave it
+	// off for obfuscated generators.
+	Monotonic bool
+	// Step, if greater than 1, requires the identifiers sharing the same high 32 bits to be
+	// congruent modulo Step. It is ignored when Floor is set.
+	Step int64
+	// Floor, if greater than 1, requires every identifier to be a multiple of Floor.
+	Floor int64
+	// Section, if not nil, requires every identifier to be stamped with the section ID.
+	Section *int8
+}
+
+// Run calls g.Next from cfg.Goroutines goroutines, checks the invariants described by cfg and
+// returns all the identifiers in ascending order. Uniqueness is always checked.
+func Run(t testing.TB, g Generator, cfg Config) []int64 {
+	t.Helper()
+	if cfg.Goroutines <= 0 {
+		cfg.Goroutines = 8
+	}
+	if cfg.PerGoroutine <= 0 {
+		cfg.PerGoroutine = 10000
+	}
+
+	results := make([][]int64, cfg.Goroutines)
+	errs := make([]error, cfg.Goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("Next panicked: %v", r)
+				}
+			}()
+			a := make([]int64, cfg.PerGoroutine)
+			for j := range a {
+				a[j] = g.Next()
+			}
+			results[i] = a
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := make([]int64, 0, cfg.Goroutines*cfg.PerGoroutine)
+	for _, a := range results {
+		if err := Check(a, cfg); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, a...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i] < all[j]
+	})
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("duplication detected. id: %#016x", all[i])
+		}
+	}
+	return all
+}
+
+// Check checks the invariants described by cfg against a in the order of generation. It does
+// not check uniqueness.
+func Check(a []int64, cfg Config) error {
+	residues := make(map[int64]int64)
+	for i, id := range a {
+		if cfg.Monotonic && i > 0 && id <= a[i-1] {
+			return fmt.Errorf("the identifiers are not increasing. prev: %#016x, id: %#016x", a[i-1], id)
+		}
+		if cfg.Floor > 1 {
+			if id%cfg.Floor != 0 {
+				return fmt.Errorf("the identifier is not a multiple of the floor. id: %#016x, floor: %d", id, cfg.Floor)
+			}
+		} else if cfg.Step > 1 {
+			r, ok := residues[id>>32]
+			if !ok {
+				residues[id>>32] = id % cfg.Step
+			} else if id%cfg.Step != r {
+				return fmt.Errorf("the identifier does not follow the step. id: %#016x, step: %d", id, cfg.Step)
+			}
+		}
+		if cfg.Section != nil && id>>60 != int64(*cfg.Section) {
+			return fmt.Errorf("the identifier is not stamped with the section. id: %#016x, section: %d", id, *cfg.Section)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package wuidtest
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/driftboat/wuid/internal"
+	"github.com/edwingeng/slog"
+)
+
+func newWUID(h32 int64, opts ...internal.Option) *internal.WUID {
+	w := internal.NewWUID("alpha", slog.NewDumbLogger(), opts...)
+	next := h32 - 1
+	err := w.Load(context.Background(), internal.RenewerFunc(func(context.Context) (int64, error) {
+		return atomic.AddInt64(&next, 1), nil
+	}))
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+func TestRun(t *testing.T) {
+	section := int8(3)
+	w := newWUID(1, internal.WithSection(section), internal.WithStep(16, 10))
+	all := Run(t, w, Config{Monotonic: true, Step: 16, Floor: 10, Section: &section})
+	if len(all) != 8*10000 {
+		t.Fatalf("len(all) is %d, while it should be %d", len(all), 8*10000)
+	}
+
+	w2 := newWUID(1, internal.WithShards(4), internal.WithStep(1000, 0))
+	Run(t, w2, Config{Goroutines: 16, PerGoroutine: 1000, Step: 1000})
+}
+
+func TestConformance(t *testing.T) {
+	var counter int64
+	var broken int32
+	Conformance(t, Target{
+		New: func(t testing.TB) Instance {
+			w := internal.NewWUID("alpha", slog.NewDumbLogger())
+			err := w.Load(context.Background(), internal.RenewerFunc(func(context.Context) (int64, error) {
+				if atomic.LoadInt32(&broken) != 0 {
+					return 0, errors.New("broken")
+				}
+				return atomic.AddInt64(&counter, 1), nil
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return w
+		},
+		Break: func(testing.TB) { atomic.StoreInt32(&broken, 1) },
+		Heal:  func(testing.TB) { atomic.StoreInt32(&broken, 0) },
+	})
+}
+
+func TestCheck(t *testing.T) {
+	section := int8(1)
+	for i, c := range []struct {
+		a   []int64
+		cfg Config
+	}{
+		{[]int64{2, 1}, Config{Monotonic: true}},
+		{[]int64{10, 15}, Config{Floor: 10}},
+		{[]int64{16, 33}, Config{Step: 16}},
+		{[]int64{1, 2}, Config{Section: &section}},
+	} {
+		if Check(c.a, c.cfg) == nil {
+			t.Fatalf("Check should have failed. i: %d", i)
+		}
+	}
+	if err := Check([]int64{16, 32, 1<<32 | 5, 1<<32 | 21}, Config{Monotonic: true, Step: 16}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func FuzzRun(f *testing.F) {
+	f.Add(int64(1), int64(0), int8(-1), 1, 0, uint16(1))
+	f.Add(int64(16), int64(10), int8(2), 4, 0, uint16(100))
+	f.Add(int64(1000), int64(7), int8(-1), 1, 5, uint16(0xFFFF))
+	f.Fuzz(func(t *testing.T, step, floor int64, section int8, shards, seed int, h32 uint16) {
+		var opts []internal.Option
+		if opt, err := internal.TryWithStep(step, floor); err == nil {
+			opts = append(opts, opt)
+		} else {
+			step, floor = 1, 0
+		}
+		cfg := Config{Goroutines: 4, PerGoroutine: 500, Step: step, Floor: floor}
+		if opt, err := internal.TryWithSection(section); err == nil {
+			opts = append(opts, opt)
+			cfg.Section = &section
+		}
+		cfg.Monotonic = true
+		if shards > 1 && shards <= 256 && step*int64(shards) <= internal.MaxStep {
+			// A goroutine may switch lanes when its stack moves.
+			opts = append(opts, internal.WithShards(shards))
+			cfg.Monotonic = false
+		}
+		if opt, err := internal.TryWithObfuscation(seed); err == nil {
+			opts = append(opts, opt)
+			cfg.Step = 0
+			cfg.Monotonic = false
+		}
+		if internal.Validate(opts...) != nil {
+			return
+		}
+		Run(t, newWUID(int64(h32)+1, opts...), cfg)
+	})
+}